@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"gorm.io/gorm"
 	"os"
@@ -35,6 +36,7 @@ func Start() error {
 	}
 
 	s := api.NewServer(conf, postgresDB)
+	s.StartBackgroundJobs(context.Background())
 
 	addr := ":" + s.Config.API.Port
 	zap.L().Info(fmt.Sprintf("starting server at %v", addr))
@@ -1,17 +1,20 @@
 package v1
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/stripe/stripe-go/v72"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/request"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/response"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/service"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/statement"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,29 +24,69 @@ type KermesseService interface {
 	CreateKermesse(ctx context.Context, kermesse domain.Kermesse, organizerID uint) (domain.Kermesse, error)
 	AddParticipantToKermesse(ctx context.Context, kermesseID, userID uint) error
 	CreateStand(ctx context.Context, stand domain.Stand, stock []domain.Stock, standHolderID uint) (domain.Stand, error)
-	CreateTokenTransaction(transaction domain.TokenTransaction, user domain.User) (domain.TokenTransaction, error)
-	ValidateTokenTransaction(transactionID uint, user domain.User) (domain.TokenTransaction, error)
+	CreateTokenTransaction(ctx context.Context, transaction domain.TokenTransaction, user domain.User) (domain.TokenTransaction, error)
+	ValidateTokenTransaction(ctx context.Context, kermesseID, transactionID uint, user domain.User) (domain.TokenTransaction, error)
+	RejectTokenTransaction(ctx context.Context, kermesseID, transactionID uint, user domain.User, reason string) (domain.TokenTransaction, error)
+	CreateCashTokenPurchase(ctx context.Context, kermesseID uint, user domain.User, parentID uint, amount int) (domain.TokenTransaction, error)
+	GetPendingCashPurchases(ctx context.Context, kermesseID uint, user domain.User) ([]domain.TokenTransaction, error)
 	CreateParentToChildTokenTransaction(ctx context.Context, transaction domain.TokenTransaction, user domain.User) (domain.TokenTransaction, error)
 	GetStandByID(standID uint) (domain.Stand, error)
-	PerformPurchase(ctx context.Context, userID, kermesseID, standID uint, stockID uint, quantity int, totalCost int) (domain.TokenTransaction, error)
+	PerformPurchase(ctx context.Context, userID, kermesseID, standID uint, stockID uint, quantity int) (domain.TokenTransaction, error)
+	Checkout(ctx context.Context, userID, kermesseID, standID uint, cart []domain.CartLine) (domain.Order, error)
+	RefundPurchase(ctx context.Context, kermesseID, transactionID uint, user domain.User, quantity int) (domain.TokenTransaction, error)
 	GetStockItem(standID uint, stockId uint) (domain.Stock, error)
 	GetTokenTransactionByID(transactionID uint) (domain.TokenTransaction, error)
 	IsStandHolderAssociatedWithStand(ctx context.Context, standHolderID, standID uint) (bool, error)
 	//ApproveTransaction(ctx context.Context, transactionID uint, standHolderID uint, itemName string, quantity int) error
-	RejectTransaction(ctx context.Context, transactionID uint, standHolderID uint) error
+	RejectTransaction(ctx context.Context, kermesseID, transactionID uint, userID uint) (domain.TokenTransaction, error)
+	CreateCharge(ctx context.Context, kermesseID, standID uint, holder domain.User, studentCode string, cart []domain.CartLine) (domain.Charge, error)
+	ConfirmCharge(ctx context.Context, kermesseID, transactionID uint, user domain.User) (domain.Charge, error)
+	CreatePaymentRequest(ctx context.Context, kermesseID, standID uint, holder domain.User, cart []domain.CartLine, amount int) (domain.SignedStandPaymentRequest, error)
+	PayPaymentRequest(ctx context.Context, kermesseID, userID uint, payload string) (domain.Order, error)
+	PaymentRequestQRCode(kermesseID uint, payload string, size int) ([]byte, error)
+	IssueOfflineAllowance(ctx context.Context, kermesseID uint, user domain.User, studentID uint, limit int) (domain.IssuedOfflineAllowance, error)
+	ReconcileOfflineVouchers(ctx context.Context, kermesseID, standID uint, holder domain.User, payloads []string) (domain.VoucherReconciliation, error)
+	CreatePromotion(ctx context.Context, kermesseID, standID uint, user domain.User, promotion domain.Promotion) (domain.Promotion, error)
+	GetPromotions(ctx context.Context, kermesseID, standID uint) ([]domain.Promotion, error)
+	DeactivatePromotion(ctx context.Context, kermesseID, standID uint, user domain.User, promotionID uint) error
+	ReserveStock(ctx context.Context, userID, kermesseID, standID uint, cart []domain.CartLine) ([]domain.StockReservation, error)
+	ReleaseReservation(ctx context.Context, kermesseID, reservationID, userID uint) (domain.StockReservation, error)
 	GetChildrenTransactions(ctx context.Context, userID uint) ([]domain.TokenTransaction, error)
-	UpdateStock(ctx context.Context, req request.StockUpdateRequest, userID uint, standID uint) error
+	UpdateStock(ctx context.Context, kermesseID, standID uint, user domain.User, req request.StockUpdateRequest) error
 	IsKermesseOrganizer(kermesseID, userID uint) (bool, error)
 	GetStandsByKermesseID(kermesseID uint) ([]domain.Stand, error)
+	GetStand(kermesseID, standID uint) (domain.Stand, error)
+	UpdateStand(ctx context.Context, kermesseID, standID uint, user domain.User, req request.StandPatchRequest) (domain.Stand, error)
+	ArchiveStand(ctx context.Context, kermesseID, standID uint, user domain.User) error
+	GetStandStock(ctx context.Context, kermesseID, standID, stockID uint, user domain.User) (domain.Stock, error)
+	UpdateStandStock(ctx context.Context, kermesseID, standID, stockID uint, user domain.User, req request.StockPatchRequest) (domain.Stock, error)
+	ArchiveStandStock(ctx context.Context, kermesseID, standID, stockID uint, user domain.User) error
 	IsStandHolder(userID, standID uint) (bool, error)
-	ProcessStripePayment(paymentMethodID string, amount int) (*stripe.PaymentIntent, error)
+	GetStandStaff(ctx context.Context, kermesseID, standID uint, user domain.User) ([]domain.StandStaff, error)
+	InviteStandStaff(ctx context.Context, kermesseID, standID uint, user domain.User, req request.StandInvitationRequest) (domain.StandInvitation, error)
+	AcceptStandInvitation(ctx context.Context, user domain.User, code string) (domain.StandStaff, error)
+	RemoveStandStaff(ctx context.Context, kermesseID, standID, staffID uint, user domain.User) error
+	PurchaseTokens(ctx context.Context, kermesseID uint, user domain.User, paymentMethodID string, amount int) (domain.TokenTransaction, domain.Payment, error)
+	HandlePaymentEvent(ctx context.Context, payload []byte, signature string) (domain.PaymentEvent, error)
 	SaveChatMessage(message domain.ChatMessage) (domain.ChatMessage, error)
 	GetChatMessages(kermesseID, standID uint, limit, offset int) ([]domain.ChatMessage, error)
 	AttributePointsToStudent(ctx context.Context, kermesseID, standID, studentID uint, points int) (domain.PointAttributionResult, error)
 	//IsUserKermesseOrganizer(kermesseID, userID uint) (bool, error)
 	//IsUserStandHolder(standID, userID uint) (bool, error)
-	UpdateParentTokens(ctx context.Context, parentID uint, amount int) (domain.Parent, error)
-	CreateStock(ctx context.Context, stock domain.Stock, userID uint) (domain.Stock, error)
+	CreateStock(ctx context.Context, kermesseID uint, user domain.User, stock domain.Stock) (domain.Stock, error)
+	GetStockAudit(ctx context.Context, kermesseID, standID uint, user domain.User) (domain.StockAudit, error)
+	GetLowStockItems(ctx context.Context, kermesseID uint, user domain.User) ([]domain.LowStockItem, error)
+	GetNotifications(ctx context.Context, user domain.User) ([]domain.Notification, error)
+	AuditLedger(ctx context.Context, kermesseID uint, user domain.User) (domain.LedgerAudit, error)
+	CloseKermesse(ctx context.Context, kermesseID uint, user domain.User) (domain.Kermesse, error)
+	SetKermesseStatus(ctx context.Context, kermesseID uint, user domain.User, status domain.KermesseStatus) (domain.Kermesse, error)
+	UpdateKermesse(ctx context.Context, kermesseID uint, user domain.User, req request.KermessePatchRequest) (domain.Kermesse, error)
+	CancelKermesse(ctx context.Context, kermesseID uint, user domain.User) (domain.KermesseCancellation, error)
+	RunKermesseRefunds(ctx context.Context, kermesseID uint, user domain.User) (domain.RefundRunReport, error)
+	GetRefundReport(ctx context.Context, kermesseID uint, user domain.User) (domain.RefundRunReport, error)
+	GetMyTransactions(ctx context.Context, user domain.User, filter domain.TransactionFilter) (domain.TransactionPage, error)
+	GetKermesseTransactions(ctx context.Context, kermesseID uint, user domain.User, filter domain.TransactionFilter) (domain.TransactionPage, error)
+	GetFamilyStatement(ctx context.Context, kermesseID uint, user domain.User) (domain.FamilyStatement, error)
 }
 
 type KermesseHandler struct {
@@ -108,7 +151,7 @@ func (h *KermesseHandler) HandleGetKermesses(ctx *gin.Context) {
 
 // HandleCreateKermesse godoc
 // @Summary      Create a new kermesse
-// @Description  Creates a new kermesse event. Only users with the "organizer" role can create kermesses.
+// @Description  Creates a new kermesse event. Only users with the "organizer" role can create kermesses. Tokens are sold at token_price each, in the minor unit of currency, or through the cheapest combination of token_packs. Stands take sales between starts_at and ends_at, and times are rendered in RFC 3339 with the offset of time_zone.
 // @Tags         kermesses
 // @Accept       json
 // @Produce      json
@@ -117,6 +160,7 @@ func (h *KermesseHandler) HandleGetKermesses(ctx *gin.Context) {
 // @Failure      400    {object}  response.Err
 // @Failure      401    {object}  response.Err
 // @Failure      403    {object}  response.Err
+// @Failure      422    {object}  response.Err
 // @Failure      500    {object}  response.Err
 // @Router       /kermesses [post]
 // @Security BearerAuth
@@ -141,28 +185,55 @@ func (h *KermesseHandler) HandleCreateKermesse(ctx *gin.Context) {
 
 	fmt.Printf("input: %v\n", input)
 
+	input.Currency = strings.ToLower(input.Currency)
 	if err := input.Validate(); err != nil {
 		response.RenderErr(ctx, response.ErrBadRequest(err))
 		return
 	}
 
-	parsedDate, err := time.Parse("02/01/2006", input.Date)
-	if err != nil {
-		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid date format: %v", err)))
-		return
-	}
-
 	kermesse := domain.Kermesse{
 		Name:        input.Name,
-		Date:        parsedDate,
+		TimeZone:    input.TimeZone,
 		Location:    input.Location,
 		Description: input.Description,
+		Currency:    input.Currency,
+		TokenPrice:  input.TokenPrice,
+	}
+	if input.StartsAt != "" {
+		startsAt, err := time.Parse(time.RFC3339, input.StartsAt)
+		if err != nil {
+			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid starts_at: %w", err)))
+			return
+		}
+		endsAt, err := time.Parse(time.RFC3339, input.EndsAt)
+		if err != nil {
+			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid ends_at: %w", err)))
+			return
+		}
+		kermesse.StartsAt, kermesse.EndsAt = &startsAt, &endsAt
+		kermesse.Date = kermesse.DayOf(startsAt)
+	}
+	if input.Date != "" {
+		parsedDate, err := time.ParseInLocation("02/01/2006", input.Date, kermesse.Zone())
+		if err != nil {
+			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid date format: %v", err)))
+			return
+		}
+		kermesse.Date = parsedDate
+	}
+	for _, pack := range input.TokenPacks {
+		kermesse.TokenPacks = append(kermesse.TokenPacks, domain.TokenPack{Tokens: pack.Tokens, Price: pack.Price})
 	}
 
 	createdKermesse, err := h.svc.CreateKermesse(ctx.Request.Context(), kermesse, user.ID)
 	if err != nil {
-		err = fmt.Errorf("HandleCreateKermesse -> h.svc.CreateKermesse -> %w", err)
-		response.RenderErr(ctx, response.ErrInternalServerError(err))
+		switch {
+		case errors.Is(err, service.ErrInvalidSchedule):
+			response.RenderErr(ctx, response.ErrUnprocessableEntity(err))
+		default:
+			err = fmt.Errorf("HandleCreateKermesse -> h.svc.CreateKermesse -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
 		return
 	}
 
@@ -171,13 +242,15 @@ func (h *KermesseHandler) HandleCreateKermesse(ctx *gin.Context) {
 
 // HandleKermesseParticipation godoc
 // @Summary      Participate in a kermesse
-// @Description  Adds the authenticated user as a participant to the specified kermesse
+// @Description  Adds the authenticated user as a participant to the specified kermesse, once it is published
 // @Tags         kermesses
 // @Produce      json
 // @Param        kermesseID  path      int  true  "Kermesse ID"
 // @Success      200
 // @Failure      400  {object}  response.Err
 // @Failure      401  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
 // @Failure      500  {object}  response.Err
 // @Router       /kermesses/{kermesseID}/participate [get]
 // @Security     BearerAuth
@@ -196,8 +269,15 @@ func (h *KermesseHandler) HandleKermesseParticipation(ctx *gin.Context) {
 
 	err = h.svc.AddParticipantToKermesse(ctx.Request.Context(), uint(kermesseID), user.ID)
 	if err != nil {
-		err = fmt.Errorf("HandleKermesseParticipation -> h.svc.AddParticipantToKermesse -> %w", err)
-		response.RenderErr(ctx, response.ErrInternalServerError(err))
+		switch {
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		case isKermesseStatusErr(err):
+			response.RenderErr(ctx, kermesseStatusErr(err))
+		default:
+			err = fmt.Errorf("HandleKermesseParticipation -> h.svc.AddParticipantToKermesse -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
 		return
 	}
 
@@ -206,7 +286,7 @@ func (h *KermesseHandler) HandleKermesseParticipation(ctx *gin.Context) {
 
 // HandleGetStands godoc
 // @Summary      Get stands for a kermesse
-// @Description  Retrieves all stands for a specific kermesse. The user must be a participant, organizer, or stand holder associated with the kermesse to access this information.
+// @Description  Retrieves all stands for a specific kermesse. The user must be a participant, organizer, or stand holder associated with the kermesse to access this information. Stock items tell how many units are reserved and how many are still available.
 // @Tags         kermesses,stands
 // @Produce      json
 // @Param        kermesseID  path      int  true  "Kermesse ID"
@@ -230,21 +310,9 @@ func (h *KermesseHandler) HandleGetStands(ctx *gin.Context) {
 		return
 	}
 
-	// Check if the user is a participant or organizer of the kermesse
-	isParticipant, err := h.svc.IsParticipating(uint(kermesseID), user.ID)
-	if err != nil {
-		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to check user participation: %w", err)))
-		return
-	}
-
-	isOrganizer, err := h.svc.IsKermesseOrganizer(uint(kermesseID), user.ID)
-	if err != nil {
-		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to check user organizer status: %w", err)))
-		return
-	}
-
-	if !isParticipant && !isOrganizer {
-		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user %v is not authorized to view stands for this kermesse", user.ID)))
+	isOrganizer, respErr := h.standViewer(ctx, uint(kermesseID), user)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
 		return
 	}
 
@@ -257,40 +325,74 @@ func (h *KermesseHandler) HandleGetStands(ctx *gin.Context) {
 	var result []map[string]interface{}
 
 	for _, stand := range stands {
-		standInfo := map[string]interface{}{
-			"id":          stand.ID,
-			"name":        stand.Name,
-			"type":        stand.Type,
-			"description": stand.Description,
+		standInfo, err := h.standView(ctx, user, stand, isOrganizer)
+		if err != nil {
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+			return
 		}
 
-		if isOrganizer {
-			// Organizers can see all details
+		result = append(result, standInfo)
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// standViewer tells whether user may view the stands of the kermesse, as a
+// participant or an organizer, and whether they organize it.
+func (h *KermesseHandler) standViewer(ctx *gin.Context, kermesseID uint, user domain.User) (isOrganizer bool, respErr *response.Err) {
+	// Check if the user is a participant or organizer of the kermesse
+	isParticipant, err := h.svc.IsParticipating(kermesseID, user.ID)
+	if err != nil {
+		return false, response.ErrInternalServerError(fmt.Errorf("failed to check user participation: %w", err))
+	}
+
+	isOrganizer, err = h.svc.IsKermesseOrganizer(kermesseID, user.ID)
+	if err != nil {
+		return false, response.ErrInternalServerError(fmt.Errorf("failed to check user organizer status: %w", err))
+	}
+
+	if !isParticipant && !isOrganizer {
+		return false, response.ErrPermissionDenied(fmt.Errorf("user %v is not authorized to view stands for this kermesse", user.ID))
+	}
+
+	return isOrganizer, nil
+}
+
+// standView renders stand for user. Only organizers and the stand's holders
+// see its counters and stock.
+func (h *KermesseHandler) standView(ctx *gin.Context, user domain.User, stand domain.Stand, isOrganizer bool) (map[string]interface{}, error) {
+	standInfo := map[string]interface{}{
+		"id":          stand.ID,
+		"name":        stand.Name,
+		"type":        stand.Type,
+		"description": stand.Description,
+		"opens_at":    stand.OpensAt,
+		"closes_at":   stand.ClosesAt,
+	}
+
+	if isOrganizer {
+		// Organizers can see all details
+		standInfo["tokens_spent"] = stand.TokensSpent
+		standInfo["points_given"] = stand.PointsGiven
+		standInfo["stock"] = stand.Stock
+	} else if user.Role == "stand_holder" {
+		isStandHolder, err := h.svc.IsStandHolderAssociatedWithStand(ctx, user.ID, stand.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check stand holder association: %w", err)
+		}
+		if isStandHolder {
 			standInfo["tokens_spent"] = stand.TokensSpent
 			standInfo["points_given"] = stand.PointsGiven
 			standInfo["stock"] = stand.Stock
-		} else if user.Role == "stand_holder" {
-			isStandHolder, err := h.svc.IsStandHolderAssociatedWithStand(ctx, user.ID, stand.ID)
-			if err != nil {
-				response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to check stand holder association: %w", err)))
-				return
-			}
-			if isStandHolder {
-				standInfo["tokens_spent"] = stand.TokensSpent
-				standInfo["points_given"] = stand.PointsGiven
-				standInfo["stock"] = stand.Stock
-			}
 		}
-
-		result = append(result, standInfo)
 	}
 
-	ctx.JSON(http.StatusOK, result)
+	return standInfo, nil
 }
 
 // HandleCreateStand godoc
 // @Summary      Create a new stand for a kermesse
-// @Description  Creates a new stand for a specific kermesse. Only organizers, admins, or stand holders can perform this action.
+// @Description  Creates a new stand for a specific kermesse, from its draft until it closes. Only organizers, admins, or stand holders can perform this action.
 // @Tags         kermesses,stands
 // @Accept       json
 // @Produce      json
@@ -300,6 +402,9 @@ func (h *KermesseHandler) HandleGetStands(ctx *gin.Context) {
 // @Failure      400  {object}  response.Err
 // @Failure      401  {object}  response.Err
 // @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      422  {object}  response.Err
 // @Failure      500  {object}  response.Err
 // @Router       /kermesses/{kermesseID}/stand [post]
 // @Security     BearerAuth
@@ -354,6 +459,14 @@ func (h *KermesseHandler) HandleCreateStand(ctx *gin.Context) {
 		Description: req.Description,
 		KermesseID:  uint(kermesseID),
 	}
+	if stand.OpensAt, err = optionalTime(req.OpensAt); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid opens_at: %w", err)))
+		return
+	}
+	if stand.ClosesAt, err = optionalTime(req.ClosesAt); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid closes_at: %w", err)))
+		return
+	}
 
 	var stock []domain.Stock
 
@@ -361,17 +474,27 @@ func (h *KermesseHandler) HandleCreateStand(ctx *gin.Context) {
 		stock = make([]domain.Stock, len(req.Stock))
 		for i, s := range req.Stock {
 			stock[i] = domain.Stock{
-				ItemName:  s.ItemName,
-				Quantity:  s.Quantity,
-				TokenCost: s.TokenCost,
+				ItemName:          s.ItemName,
+				Quantity:          s.Quantity,
+				TokenCost:         s.TokenCost,
+				LowStockThreshold: s.LowStockThreshold,
 			}
 		}
 	}
 
 	createdStand, err := h.svc.CreateStand(ctx.Request.Context(), stand, stock, user.ID)
 	if err != nil {
-		err = fmt.Errorf("HandleCreateStand -> h.svc.CreateStand -> %w", err)
-		response.RenderErr(ctx, response.ErrInternalServerError(err))
+		switch {
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		case isKermesseStatusErr(err):
+			response.RenderErr(ctx, kermesseStatusErr(err))
+		case errors.Is(err, service.ErrInvalidSchedule):
+			response.RenderErr(ctx, response.ErrUnprocessableEntity(err))
+		default:
+			err = fmt.Errorf("HandleCreateStand -> h.svc.CreateStand -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
 		return
 	}
 
@@ -386,10 +509,14 @@ func (h *KermesseHandler) HandleCreateStand(ctx *gin.Context) {
 // @Produce      json
 // @Param        kermesseID  path      int                          true  "Kermesse ID"
 // @Param        purchase    body      request.TokenPurchaseRequest true  "Token purchase details"
+// @Param        Idempotency-Key header string                      false "Key making retries of this request safe"
 // @Success      201  {object}  domain.TokenTransaction
+// @Success      202  {object}  domain.TokenTransaction
 // @Failure      400  {object}  response.Err
 // @Failure      401  {object}  response.Err
+// @Failure      402  {object}  response.Err
 // @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
 // @Failure      500  {object}  response.Err
 // @Router       /kermesses/{kermesseID}/token/purchase [post]
 // @Security     BearerAuth
@@ -435,58 +562,77 @@ func (h *KermesseHandler) HandleTokenPurchase(ctx *gin.Context) {
 		return
 	}
 
-	paymentIntent, err := h.svc.ProcessStripePayment(purchaseRequest.PaymentMethodID, purchaseRequest.Amount)
+	transaction, payment, err := h.svc.PurchaseTokens(ctx, uint(kermesseID), user, purchaseRequest.PaymentMethodID, purchaseRequest.Amount)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payment: " + err.Error()})
+		switch {
+		case errors.Is(err, service.ErrPaymentDeclined):
+			response.RenderErr(ctx, response.ErrPaymentRequired(err))
+		case errors.Is(err, service.ErrInvalidTokenAmount):
+			response.RenderErr(ctx, response.ErrInvalidInput("amount", purchaseRequest.Amount))
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		case errors.Is(err, service.ErrUserNotParticipant):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case isKermesseStatusErr(err):
+			response.RenderErr(ctx, kermesseStatusErr(err))
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payment: " + err.Error()})
+		}
 		return
 	}
 
-	// Create token transaction
-	transaction := domain.TokenTransaction{
-		KermesseID: uint(kermesseID),
-		FromID:     user.ID,
-		FromType:   "parent",
-		ToID:       uint(kermesseID),
-		ToType:     "kermess",
-		Amount:     purchaseRequest.Amount,
-		Type:       domain.TokenPurchase,
-		Status:     "Completed",
-	}
-
-	// Submit token purchase purchaseRequest
-	createdTransaction, err := h.svc.CreateTokenTransaction(transaction, user)
+	updatedBalance, err := h.uSvc.GetUserTokens(ctx, user.ID, uint(kermesseID))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit token purchase purchaseRequest"})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get parent's token balance"})
 		return
 	}
 
-	updatedParent, err := h.svc.UpdateParentTokens(ctx, user.ID, purchaseRequest.Amount)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update parent's token balance"})
+	// The payment still needs the parent, e.g. for 3-D Secure. The tokens are
+	// credited once the provider reports the outcome through the webhook.
+	if transaction.Status == "Pending" {
+		ctx.JSON(http.StatusAccepted, gin.H{
+			"message":               "Token purchase is waiting for the payment to complete",
+			"transaction":           transaction,
+			"payment_intent_id":     payment.ID,
+			"payment_status":        payment.Status,
+			"client_secret":         payment.ClientSecret,
+			"updated_token_balance": updatedBalance,
+		})
 		return
 	}
 
 	ctx.JSON(http.StatusCreated, gin.H{
 		"message":               "Token purchase request submitted successfully",
-		"transaction":           createdTransaction,
-		"payment_intent_id":     paymentIntent.ID,
-		"updated_token_balance": updatedParent.Tokens,
+		"transaction":           transaction,
+		"payment_intent_id":     payment.ID,
+		"payment_status":        payment.Status,
+		"updated_token_balance": updatedBalance,
 	})
 }
 
-// HandleParentSendTokensToChild godoc
-// @Summary Send tokens from parent to child
-// @Description Allows a parent to send tokens to their child
-// @Tags kermesses
-// @Accept json
-// @Produce json
-// @Param sendTokensRequest body request.SendTokensRequest true "Send tokens request"
-// @Success 201
-// @Failure 400 {object} response.Err
-// @Failure 403 {object} response.Err
-// @Failure 500 {object} response.Err
-// @Router /token/transferToChild [post]
-func (h *KermesseHandler) HandleParentSendTokensToChild(ctx *gin.Context) {
+// HandleCashTokenPurchase godoc
+// @Summary      Record a cash token purchase
+// @Description  Records tokens paid in cash at the cash desk as a pending purchase. Parents record their own purchases; organizers of the kermesse record them on behalf of a participating parent given by parent_id. Tokens are credited once an organizer approves the purchase.
+// @Tags         kermesses,tokens
+// @Accept       json
+// @Produce      json
+// @Param        kermesseID  path      int                              true  "Kermesse ID"
+// @Param        purchase    body      request.CashTokenPurchaseRequest true  "Cash purchase details"
+// @Param        Idempotency-Key header string                          false "Key making retries of this request safe"
+// @Success      201  {object}  domain.TokenTransaction
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/token/cash-purchase [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleCashTokenPurchase(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
 
 	user, respErr := getUserFromContext(ctx, h.uSvc)
 	if respErr != nil {
@@ -494,156 +640,1913 @@ func (h *KermesseHandler) HandleParentSendTokensToChild(ctx *gin.Context) {
 		return
 	}
 
-	if user.Role != "parent" {
-		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user %v is not authorized to send tokens", user.ID)))
-		return
-	}
-
-	var sendTokensRequest request.SendTokensRequest
-	if err := ctx.ShouldBindJSON(&sendTokensRequest); err != nil {
+	var req request.CashTokenPurchaseRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
 		return
 	}
 
-	if err := sendTokensRequest.Validate(); err != nil {
-		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
 		return
 	}
 
-	// Create token transaction
-	transaction := domain.TokenTransaction{
-		FromID:   user.ID,
-		FromType: "parent",
-		ToID:     sendTokensRequest.StudentID,
-		ToType:   "student",
-		Amount:   sendTokensRequest.Amount,
-		Type:     domain.TokenDistribution,
-		Status:   "Pending",
-	}
-
-	// Submit token transfer request
-	createdTransaction, err := h.svc.CreateParentToChildTokenTransaction(ctx, transaction, user)
+	transaction, err := h.svc.CreateCashTokenPurchase(ctx.Request.Context(), uint(kermesseID), user, req.ParentID, req.Amount)
 	if err != nil {
 		switch {
-		case errors.Is(err, service.ErrInsufficientTokens):
-			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("insufficient tokens")))
-		case errors.Is(err, service.ErrNotParentOfStudent):
-			response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user %v is not the parent of student %v", user.ID, sendTokensRequest.StudentID)))
+		case errors.Is(err, service.ErrUnauthorizedOrganizer), errors.Is(err, service.ErrInvalidUserRole), errors.Is(err, service.ErrUserNotParticipant):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case errors.Is(err, service.ErrUserNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("parent", "id", req.ParentID))
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		case errors.Is(err, service.ErrInvalidTokenAmount):
+			response.RenderErr(ctx, response.ErrInvalidInput("amount", req.Amount))
+		case isKermesseStatusErr(err):
+			response.RenderErr(ctx, kermesseStatusErr(err))
 		default:
+			err = fmt.Errorf("HandleCashTokenPurchase -> h.svc.CreateCashTokenPurchase -> %w", err)
 			response.RenderErr(ctx, response.ErrInternalServerError(err))
 		}
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{
-		"message":     "Token transfer request submitted successfully",
-		"transaction": createdTransaction,
-	})
+	ctx.JSON(http.StatusCreated, transaction)
 }
 
-// HandleStandPurchase godoc
-// @Summary Make a purchase from a stand
-// @Description Allows a user to make a purchase from a stand in a kermesse
-// @Tags kermesses
-// @Accept json
-// @Produce json
-// @Param kermesseID path int true "Kermesse ID"
-// @Param standID path int true "Stand ID"
-// @Param purchaseRequest body request.StandPurchaseRequest true "Purchase request"
-// @Success 200
-// @Failure 400 {object} response.Err
-// @Failure 403 {object} response.Err
-// @Failure 404 {object} response.Err
-// @Failure 500 {object} response.Err
-// @Router /kermesses/{kermesseID}/stand/{standID}/purchase [post]
-func (h *KermesseHandler) HandleStandPurchase(ctx *gin.Context) {
+// HandleGetPendingTokenPurchases godoc
+// @Summary      List pending cash token purchases
+// @Description  Lists the cash purchases of a kermesse waiting for approval, oldest first. Only organizers of the kermesse can see them.
+// @Tags         kermesses,tokens
+// @Produce      json
+// @Param        kermesseID  path  int  true  "Kermesse ID"
+// @Success      200  {array}   domain.TokenTransaction
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/token/pending [get]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleGetPendingTokenPurchases(ctx *gin.Context) {
 	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
 	if err != nil {
 		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
 		return
 	}
 
-	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
-	if err != nil {
-		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
 		return
 	}
 
-	var purchaseRequest request.StandPurchaseRequest
-	if err := ctx.ShouldBindJSON(&purchaseRequest); err != nil {
-		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+	transactions, err := h.svc.GetPendingCashPurchases(ctx.Request.Context(), uint(kermesseID), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnauthorizedOrganizer):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		default:
+			err = fmt.Errorf("HandleGetPendingTokenPurchases -> h.svc.GetPendingCashPurchases -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
 		return
 	}
 
-	if err := purchaseRequest.Validate(); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	ctx.JSON(http.StatusOK, transactions)
+}
+
+// HandleApproveTokenPurchase godoc
+// @Summary      Approve a cash token purchase
+// @Description  Credits the parent with the tokens of a pending cash purchase and adds them to the kermesse's tokens sold. Only organizers of the kermesse can approve, while it is open.
+// @Tags         kermesses,tokens
+// @Produce      json
+// @Param        kermesseID     path  int  true  "Kermesse ID"
+// @Param        transactionID  path  int  true  "Transaction ID"
+// @Param        Idempotency-Key header string false "Key making retries of this request safe"
+// @Success      200  {object}  domain.TokenTransaction
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/token/transactions/{transactionID}/approve [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleApproveTokenPurchase(ctx *gin.Context) {
+	kermesseID, transactionID, user, ok := h.parseTokenPurchaseDecision(ctx)
+	if !ok {
 		return
 	}
 
-	user, respErr := getUserFromContext(ctx, h.uSvc)
-	if respErr != nil {
-		response.RenderErr(ctx, respErr)
+	transaction, err := h.svc.ValidateTokenTransaction(ctx.Request.Context(), kermesseID, transactionID, user)
+	if err != nil {
+		renderTokenPurchaseDecisionErr(ctx, transactionID, err)
 		return
 	}
 
-	// Check if user is a participant of the kermesse
-	isParticipant, err := h.svc.IsParticipating(uint(kermesseID), user.ID)
-	if err != nil {
-		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to check user participation: %w", err)))
+	ctx.JSON(http.StatusOK, transaction)
+}
+
+// HandleRejectTokenPurchase godoc
+// @Summary      Reject a cash token purchase
+// @Description  Rejects a pending cash purchase, keeping the reason on the transaction. Only organizers of the kermesse can reject.
+// @Tags         kermesses,tokens
+// @Accept       json
+// @Produce      json
+// @Param        kermesseID     path  int                                true  "Kermesse ID"
+// @Param        transactionID  path  int                                true  "Transaction ID"
+// @Param        rejection      body  request.RejectTokenPurchaseRequest true  "Rejection reason"
+// @Param        Idempotency-Key header string                            false "Key making retries of this request safe"
+// @Success      200  {object}  domain.TokenTransaction
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/token/transactions/{transactionID}/reject [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleRejectTokenPurchase(ctx *gin.Context) {
+	kermesseID, transactionID, user, ok := h.parseTokenPurchaseDecision(ctx)
+	if !ok {
 		return
 	}
-	if !isParticipant {
-		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user is not a participant of this kermesse")))
+
+	var req request.RejectTokenPurchaseRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
 		return
 	}
 
-	// Get stand details
-	stand, err := h.svc.GetStandByID(uint(standID))
-	if err != nil {
-		response.RenderErr(ctx, response.ErrNotFound("stand", "ID", standID))
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
 		return
 	}
 
-	// Get stock item
-	stockItem, err := h.svc.GetStockItem(uint(standID), purchaseRequest.StockID)
+	transaction, err := h.svc.RejectTokenTransaction(ctx.Request.Context(), kermesseID, transactionID, user, req.Reason)
 	if err != nil {
-		response.RenderErr(ctx, response.ErrNotFound("Stock", "ID", purchaseRequest.StockID))
+		renderTokenPurchaseDecisionErr(ctx, transactionID, err)
 		return
 	}
 
-	// Check stock availability (skip for activity stands)
-	if stand.Type != "activity" && stockItem.Quantity < purchaseRequest.Quantity {
-		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("not enough stock available")))
+	ctx.JSON(http.StatusOK, transaction)
+}
+
+// HandleRefundPurchase godoc
+// @Summary      Refund a stand purchase
+// @Description  Gives back some or all of the items of a stand purchase: the buyer gets the tokens back and the items return to the stock. Stand holders of the stand and organizers of the kermesse can refund during the refund window after the purchase, while the kermesse is open.
+// @Tags         kermesses,tokens
+// @Accept       json
+// @Produce      json
+// @Param        kermesseID     path  int                           true  "Kermesse ID"
+// @Param        transactionID  path  int                           true  "ID of the purchase transaction"
+// @Param        refund         body  request.RefundPurchaseRequest false "Items to refund"
+// @Param        Idempotency-Key header string                      false "Key making retries of this request safe"
+// @Success      201  {object}  domain.TokenTransaction
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      422  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/token/transactions/{transactionID}/refund [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleRefundPurchase(ctx *gin.Context) {
+	kermesseID, transactionID, user, ok := h.parseTokenPurchaseDecision(ctx)
+	if !ok {
 		return
 	}
 
-	// Calculate total cost
-	totalCost := stockItem.TokenCost * purchaseRequest.Quantity
-
-	userTokens, err := h.uSvc.GetUserTokens(ctx, user.ID)
-	if err != nil {
-		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to get user tokens: %w", err)))
+	var req request.RefundPurchaseRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
 		return
 	}
-	if userTokens < totalCost {
-		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("not enough tokens for this purchase")))
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
 		return
 	}
 
-	// Perform the purchase
-	purchase, err := h.svc.PerformPurchase(ctx, user.ID, uint(kermesseID), uint(standID), purchaseRequest.StockID, purchaseRequest.Quantity, totalCost)
+	refund, err := h.svc.RefundPurchase(ctx.Request.Context(), kermesseID, transactionID, user, req.Quantity)
 	if err != nil {
-		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to perform purchase: %w", err)))
+		switch {
+		case errors.Is(err, service.ErrTransactionNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("transaction", "id", transactionID))
+		case errors.Is(err, service.ErrRefundNotAllowed):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case errors.Is(err, service.ErrInvalidRefund):
+			response.RenderErr(ctx, response.ErrInvalidInput("quantity", req.Quantity))
+		case errors.Is(err, service.ErrRefundWindowExpired):
+			response.RenderErr(ctx, response.ErrUnprocessableEntity(err))
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		case isKermesseStatusErr(err):
+			response.RenderErr(ctx, kermesseStatusErr(err))
+		case errors.Is(err, service.ErrPurchaseConflict), errors.Is(err, service.ErrInsufficientTokens),
+			errors.Is(err, service.ErrInvalidTransactionStatus):
+			response.RenderErr(ctx, response.ErrConflict(err))
+		default:
+			err = fmt.Errorf("HandleRefundPurchase -> h.svc.RefundPurchase -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"message":         "Purchase successful",
+	ctx.JSON(http.StatusCreated, refund)
+}
+
+func (h *KermesseHandler) parseTokenPurchaseDecision(ctx *gin.Context) (kermesseID, transactionID uint, user domain.User, ok bool) {
+	parsedKermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return 0, 0, domain.User{}, false
+	}
+
+	parsedTransactionID, err := strconv.ParseUint(ctx.Param("transactionID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid transaction ID")))
+		return 0, 0, domain.User{}, false
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return 0, 0, domain.User{}, false
+	}
+
+	return uint(parsedKermesseID), uint(parsedTransactionID), user, true
+}
+
+func renderTokenPurchaseDecisionErr(ctx *gin.Context, transactionID uint, err error) {
+	switch {
+	case errors.Is(err, service.ErrTransactionNotFound):
+		response.RenderErr(ctx, response.ErrNotFound("transaction", "id", transactionID))
+	case errors.Is(err, service.ErrUnauthorizedOrganizer):
+		response.RenderErr(ctx, response.ErrPermissionDenied(err))
+	case errors.Is(err, service.ErrInvalidTransactionStatus):
+		response.RenderErr(ctx, response.ErrConflict(fmt.Errorf("transaction %v is not a pending cash purchase", transactionID)))
+	case errors.Is(err, service.ErrKermesseNotFound):
+		response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", ctx.Param("kermesseID")))
+	case isKermesseStatusErr(err):
+		response.RenderErr(ctx, kermesseStatusErr(err))
+	default:
+		response.RenderErr(ctx, response.ErrInternalServerError(err))
+	}
+}
+
+// HandleStripeWebhook godoc
+// @Summary      Receive Stripe webhook events
+// @Description  Settles pending token purchases on payment_intent.succeeded and payment_intent.payment_failed. The payload must be signed with the endpoint's webhook secret; events are applied at most once.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        Stripe-Signature header string true "Stripe webhook signature"
+// @Success      200
+// @Failure      400  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /webhooks/stripe [post]
+func (h *KermesseHandler) HandleStripeWebhook(ctx *gin.Context) {
+	payload, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	event, err := h.svc.HandlePaymentEvent(ctx.Request.Context(), payload, ctx.GetHeader("Stripe-Signature"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPaymentEventProcessed):
+			// Stripe delivers events at least once; replays are acknowledged.
+			ctx.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+		case errors.Is(err, service.ErrInvalidPaymentEvent):
+			response.RenderErr(ctx, response.ErrBadRequest(err))
+		case errors.Is(err, service.ErrTransactionNotFound):
+			// Not acknowledged so that Stripe retries: the event may have
+			// arrived before the purchase was recorded.
+			response.RenderErr(ctx, response.ErrNotFound("transaction", "payment_reference", event.PaymentID))
+		default:
+			err = fmt.Errorf("HandleStripeWebhook -> h.svc.HandlePaymentEvent -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// HandleParentSendTokensToChild godoc
+// @Summary Send tokens from parent to child
+// @Description Allows a parent to send tokens of their wallet for a kermesse to their child
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param sendTokensRequest body request.SendTokensRequest true "Send tokens request"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 201
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /token/transferToChild [post]
+func (h *KermesseHandler) HandleParentSendTokensToChild(ctx *gin.Context) {
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	if user.Role != "parent" {
+		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user %v is not authorized to send tokens", user.ID)))
+		return
+	}
+
+	var sendTokensRequest request.SendTokensRequest
+	if err := ctx.ShouldBindJSON(&sendTokensRequest); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := sendTokensRequest.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	// Create token transaction
+	transaction := domain.TokenTransaction{
+		KermesseID: sendTokensRequest.KermesseID,
+		FromID:     user.ID,
+		FromType:   "parent",
+		ToID:       sendTokensRequest.StudentID,
+		ToType:     "student",
+		Amount:     sendTokensRequest.Amount,
+		Type:       domain.TokenDistribution,
+	}
+
+	// Submit token transfer request
+	createdTransaction, err := h.svc.CreateParentToChildTokenTransaction(ctx, transaction, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInsufficientTokens):
+			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("insufficient tokens")))
+		case errors.Is(err, service.ErrNotParentOfStudent):
+			response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user %v is not the parent of student %v", user.ID, sendTokensRequest.StudentID)))
+		case isKermesseStatusErr(err):
+			response.RenderErr(ctx, kermesseStatusErr(err))
+		default:
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"message":     "Token transfer request submitted successfully",
+		"transaction": createdTransaction,
+	})
+}
+
+// HandleStandPurchase godoc
+// @Summary Make a purchase from a stand
+// @Description Allows a user to make a purchase from a stand in a kermesse
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param purchaseRequest body request.StandPurchaseRequest true "Purchase request"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 200
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/purchase [post]
+func (h *KermesseHandler) HandleStandPurchase(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	var purchaseRequest request.StandPurchaseRequest
+	if err := ctx.ShouldBindJSON(&purchaseRequest); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := purchaseRequest.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	// Check if user is a participant of the kermesse
+	isParticipant, err := h.svc.IsParticipating(uint(kermesseID), user.ID)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to check user participation: %w", err)))
+		return
+	}
+	if !isParticipant {
+		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user is not a participant of this kermesse")))
+		return
+	}
+
+	userTokens, err := h.uSvc.GetUserTokens(ctx, user.ID, uint(kermesseID))
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to get user tokens: %w", err)))
+		return
+	}
+
+	// Perform the purchase, priced from the stand's stock
+	purchase, err := h.svc.PerformPurchase(ctx, user.ID, uint(kermesseID), uint(standID), purchaseRequest.StockID, purchaseRequest.Quantity)
+	if err != nil {
+		renderCheckoutErr(ctx, standID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":         "Purchase successful",
 		"purchase":        purchase,
-		"remainingTokens": userTokens - totalCost,
+		"remainingTokens": userTokens - purchase.Amount,
+	})
+}
+
+// HandleStandCheckout godoc
+// @Summary Check out a cart at a stand
+// @Description Buys several items of a stand in one order, paid by a single spend. Every line is priced from the stand's stock and the order goes through as a whole or not at all.
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param cart body request.CheckoutRequest true "Items to buy"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 201
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/checkout [post]
+func (h *KermesseHandler) HandleStandCheckout(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	var req request.CheckoutRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	isParticipant, err := h.svc.IsParticipating(uint(kermesseID), user.ID)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to check user participation: %w", err)))
+		return
+	}
+	if !isParticipant {
+		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user is not a participant of this kermesse")))
+		return
+	}
+
+	userTokens, err := h.uSvc.GetUserTokens(ctx, user.ID, uint(kermesseID))
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to get user tokens: %w", err)))
+		return
+	}
+
+	cart := make([]domain.CartLine, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		cart = append(cart, domain.CartLine{StockID: line.StockID, Quantity: line.Quantity})
+	}
+
+	order, err := h.svc.Checkout(ctx.Request.Context(), user.ID, uint(kermesseID), uint(standID), cart)
+	if err != nil {
+		renderCheckoutErr(ctx, standID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"order":            order,
+		"remaining_tokens": userTokens - order.TotalTokens,
 	})
 }
 
+func renderCheckoutErr(ctx *gin.Context, standID uint64, err error) {
+	switch {
+	case errors.Is(err, service.ErrPurchaseConflict):
+		response.RenderErr(ctx, response.ErrConflict(fmt.Errorf("purchase conflicted with a concurrent one, please retry")))
+	case errors.Is(err, service.ErrStandNotFound), errors.Is(err, service.ErrStandNotInKermesse):
+		response.RenderErr(ctx, response.ErrNotFound("stand", "ID", standID))
+	case errors.Is(err, service.ErrItemNotInStand):
+		response.RenderErr(ctx, response.ErrNotFound("Stock", "stand ID", standID))
+	case errors.Is(err, service.ErrInvalidCart):
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+	case errors.Is(err, service.ErrInsufficientStock):
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("not enough stock available")))
+	case errors.Is(err, service.ErrInsufficientTokens):
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("not enough tokens for this purchase")))
+	case errors.Is(err, service.ErrInvalidUserRole):
+		response.RenderErr(ctx, response.ErrPermissionDenied(err))
+	case isKermesseStatusErr(err):
+		response.RenderErr(ctx, kermesseStatusErr(err))
+	default:
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to perform purchase: %w", err)))
+	}
+}
+
+// HandleCreateCharge godoc
+// @Summary Charge a student at a stand
+// @Description Lets a holder of the stand ring up a sale for a student identified by their short code or badge ID. Charges within the student's auto-approve limit are settled at once; the others stay Pending until the student or their parent confirms or declines them.
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param charge body request.ChargeRequest true "Student and items to charge"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 201 {object} domain.Charge
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/charges [post]
+func (h *KermesseHandler) HandleCreateCharge(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	var req request.ChargeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	cart := make([]domain.CartLine, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		cart = append(cart, domain.CartLine{StockID: line.StockID, Quantity: line.Quantity})
+	}
+
+	charge, err := h.svc.CreateCharge(ctx.Request.Context(), uint(kermesseID), uint(standID), user, req.StudentCode, cart)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotStandHolder):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case errors.Is(err, service.ErrUnknownStudentCode):
+			response.RenderErr(ctx, response.ErrNotFound("student", "code", req.StudentCode))
+		case errors.Is(err, service.ErrUserNotParticipant):
+			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("student is not a participant of this kermesse")))
+		default:
+			renderCheckoutErr(ctx, standID, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, charge)
+}
+
+// HandleConfirmCharge godoc
+// @Summary Confirm a stand charge
+// @Description Lets the student charged, or their parent, confirm a pending charge: the items leave the stock and the tokens the student's wallet.
+// @Tags kermesses
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param transactionID path int true "ID of the charge's transaction"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 200 {object} domain.Charge
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/charges/{transactionID}/confirm [post]
+func (h *KermesseHandler) HandleConfirmCharge(ctx *gin.Context) {
+	kermesseID, transactionID, user, ok := h.parseChargeAnswer(ctx)
+	if !ok {
+		return
+	}
+
+	charge, err := h.svc.ConfirmCharge(ctx.Request.Context(), kermesseID, transactionID, user)
+	if err != nil {
+		renderChargeAnswerErr(ctx, transactionID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, charge)
+}
+
+// HandleDeclineCharge godoc
+// @Summary Decline a stand charge
+// @Description Lets the student charged or their parent decline a pending charge, or a holder of the stand cancel it.
+// @Tags kermesses
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param transactionID path int true "ID of the charge's transaction"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 200 {object} domain.TokenTransaction
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/charges/{transactionID}/decline [post]
+func (h *KermesseHandler) HandleDeclineCharge(ctx *gin.Context) {
+	kermesseID, transactionID, user, ok := h.parseChargeAnswer(ctx)
+	if !ok {
+		return
+	}
+
+	transaction, err := h.svc.RejectTransaction(ctx.Request.Context(), kermesseID, transactionID, user.ID)
+	if err != nil {
+		renderChargeAnswerErr(ctx, transactionID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transaction)
+}
+
+func (h *KermesseHandler) parseChargeAnswer(ctx *gin.Context) (kermesseID, transactionID uint, user domain.User, ok bool) {
+	kID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return 0, 0, domain.User{}, false
+	}
+
+	tID, err := strconv.ParseUint(ctx.Param("transactionID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid transaction ID")))
+		return 0, 0, domain.User{}, false
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return 0, 0, domain.User{}, false
+	}
+
+	return uint(kID), uint(tID), user, true
+}
+
+func renderChargeAnswerErr(ctx *gin.Context, transactionID uint, err error) {
+	switch {
+	case errors.Is(err, service.ErrTransactionNotFound):
+		response.RenderErr(ctx, response.ErrNotFound("charge", "transaction ID", transactionID))
+	case errors.Is(err, service.ErrChargeNotAllowed):
+		response.RenderErr(ctx, response.ErrPermissionDenied(err))
+	case errors.Is(err, service.ErrInvalidTransactionStatus):
+		response.RenderErr(ctx, response.ErrConflict(fmt.Errorf("charge is no longer pending")))
+	case errors.Is(err, service.ErrKermesseNotFound):
+		response.RenderErr(ctx, response.ErrNotFound("kermesse", "ID", ctx.Param("kermesseID")))
+	default:
+		renderCheckoutErr(ctx, 0, err)
+	}
+}
+
+// HandleCreatePaymentRequest godoc
+// @Summary Issue a payment request at a stand
+// @Description Lets a holder of the stand issue a signed, short-lived payment request for a cart. The payload is meant to be shown as a QR code for a buyer to scan and pay, once, before it expires.
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param paymentRequest body request.CreatePaymentRequestRequest true "Items to ask payment for"
+// @Success 201 {object} domain.SignedStandPaymentRequest
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/payment-requests [post]
+func (h *KermesseHandler) HandleCreatePaymentRequest(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	var req request.CreatePaymentRequestRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	cart := make([]domain.CartLine, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		cart = append(cart, domain.CartLine{StockID: line.StockID, Quantity: line.Quantity})
+	}
+
+	paymentRequest, err := h.svc.CreatePaymentRequest(ctx.Request.Context(), uint(kermesseID), uint(standID), user, cart, req.Amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotStandHolder):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case errors.Is(err, service.ErrPaymentRequestAmount):
+			response.RenderErr(ctx, response.ErrBadRequest(err))
+		default:
+			renderCheckoutErr(ctx, standID, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, paymentRequest)
+}
+
+// HandlePaymentRequestQRCode godoc
+// @Summary Render a payment request as a QR code
+// @Description Renders the payload of a payment request issued in the kermesse as a PNG QR code. Payloads that weren't issued by the server or have expired are refused.
+// @Tags kermesses
+// @Produce png
+// @Param kermesseID path int true "Kermesse ID"
+// @Param payload query string true "Payload of the payment request"
+// @Param size query int false "Approximate width of the image in pixels, 256 by default"
+// @Success 200 {file} binary
+// @Failure 400 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/payment-requests/qr [get]
+func (h *KermesseHandler) HandlePaymentRequestQRCode(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	payload := ctx.Query("payload")
+	if payload == "" || len(payload) > request.MaxPaymentRequestPayload {
+		response.RenderErr(ctx, response.ErrInvalidInput("payload", payload))
+		return
+	}
+
+	size := 256
+	if s := ctx.Query("size"); s != "" {
+		size, err = strconv.Atoi(s)
+		if err != nil || size < 64 || size > 1024 {
+			response.RenderErr(ctx, response.ErrInvalidInput("size", s))
+			return
+		}
+	}
+
+	png, err := h.svc.PaymentRequestQRCode(uint(kermesseID), payload, size)
+	if err != nil {
+		renderPaymentRequestErr(ctx, err)
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, "image/png", png)
+}
+
+// HandlePayPaymentRequest godoc
+// @Summary Pay a payment request
+// @Description Pays the payment request a stand issued, as scanned from its QR code. The request must be unexpired and unpaid, and its items still cost what it says.
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param paymentRequest body request.PayPaymentRequestRequest true "Scanned payload"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 201
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/payment-requests/pay [post]
+func (h *KermesseHandler) HandlePayPaymentRequest(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	var req request.PayPaymentRequestRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	isParticipant, err := h.svc.IsParticipating(uint(kermesseID), user.ID)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to check user participation: %w", err)))
+		return
+	}
+	if !isParticipant {
+		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user is not a participant of this kermesse")))
+		return
+	}
+
+	userTokens, err := h.uSvc.GetUserTokens(ctx, user.ID, uint(kermesseID))
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to get user tokens: %w", err)))
+		return
+	}
+
+	order, err := h.svc.PayPaymentRequest(ctx.Request.Context(), uint(kermesseID), user.ID, req.Payload)
+	if err != nil {
+		renderPaymentRequestErr(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"order":            order,
+		"remaining_tokens": userTokens - order.TotalTokens,
+	})
+}
+
+func renderPaymentRequestErr(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPaymentRequest):
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+	case errors.Is(err, service.ErrPaymentRequestExpired),
+		errors.Is(err, service.ErrPaymentRequestUsed),
+		errors.Is(err, service.ErrPaymentRequestRepriced):
+		response.RenderErr(ctx, response.ErrConflict(err))
+	default:
+		renderCheckoutErr(ctx, 0, err)
+	}
+}
+
+// HandleIssueOfflineAllowance godoc
+// @Summary Issue an offline spending allowance
+// @Description Lets a student, or their parent, get an allowance their app signs spend vouchers with while stands are offline. The secret is only returned here. The limit can't be more than the student's wallet holds.
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param allowance body request.OfflineAllowanceRequest true "Student and limit"
+// @Success 201 {object} domain.IssuedOfflineAllowance
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/offline-allowances [post]
+func (h *KermesseHandler) HandleIssueOfflineAllowance(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	var req request.OfflineAllowanceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	allowance, err := h.svc.IssueOfflineAllowance(ctx.Request.Context(), uint(kermesseID), user, req.StudentID, req.Limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAllowanceNotAllowed):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case errors.Is(err, service.ErrUnknownStudent):
+			response.RenderErr(ctx, response.ErrNotFound("student", "id", req.StudentID))
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		case errors.Is(err, service.ErrInvalidAllowance):
+			response.RenderErr(ctx, response.ErrInvalidInput("limit", req.Limit))
+		case errors.Is(err, service.ErrUserNotParticipant):
+			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("student is not a participant of this kermesse")))
+		case errors.Is(err, service.ErrInsufficientTokens):
+			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("the student's wallet holds less than the limit")))
+		case isKermesseStatusErr(err):
+			response.RenderErr(ctx, kermesseStatusErr(err))
+		default:
+			err = fmt.Errorf("HandleIssueOfflineAllowance -> h.svc.IssueOfflineAllowance -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, allowance)
+}
+
+// HandleReconcileOfflineVouchers godoc
+// @Summary Upload offline vouchers
+// @Description Lets a holder of the stand upload the spend vouchers collected while offline, including after the kermesse closed for the sales made before. Every voucher is verified and paid on its own; the report tells which were accepted, already uploaded or rejected, and why.
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param vouchers body request.OfflineVouchersRequest true "Voucher payloads"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 200 {object} domain.VoucherReconciliation
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/offline-vouchers [post]
+func (h *KermesseHandler) HandleReconcileOfflineVouchers(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	var req request.OfflineVouchersRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	report, err := h.svc.ReconcileOfflineVouchers(ctx.Request.Context(), uint(kermesseID), uint(standID), user, req.Vouchers)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotStandHolder):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		default:
+			renderCheckoutErr(ctx, standID, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// HandleCreatePromotion godoc
+// @Summary Add a promotion to a stand
+// @Description Lets a manager of the stand or an organizer of the kermesse add a bundle price, a percentage off or a buy-X-get-Y promotion, optionally limited to a time window, from the draft of the kermesse until it closes. Checkouts get the best promotion on at the time.
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param promotion body request.PromotionRequest true "Promotion rule"
+// @Success 201 {object} domain.Promotion
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/promotions [post]
+func (h *KermesseHandler) HandleCreatePromotion(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	var req request.PromotionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	promotion := domain.Promotion{
+		Name:        req.Name,
+		Type:        domain.PromotionType(req.Type),
+		Items:       make([]domain.PromotionItem, 0, len(req.Items)),
+		BundlePrice: req.BundlePrice,
+		PercentOff:  req.PercentOff,
+		BuyQuantity: req.BuyQuantity,
+		GetQuantity: req.GetQuantity,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+	}
+	for _, item := range req.Items {
+		promotion.Items = append(promotion.Items, domain.PromotionItem{StockID: item.StockID, Quantity: item.Quantity})
+	}
+
+	created, err := h.svc.CreatePromotion(ctx.Request.Context(), uint(kermesseID), uint(standID), user, promotion)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotStandHolder), errors.Is(err, service.ErrNotStandManager):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case errors.Is(err, service.ErrInvalidPromotion):
+			response.RenderErr(ctx, response.ErrBadRequest(err))
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		default:
+			renderCheckoutErr(ctx, standID, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, created)
+}
+
+// HandleGetPromotions godoc
+// @Summary List the promotions of a stand
+// @Description Returns the active promotions of the stand, including those whose time window hasn't started yet.
+// @Tags kermesses
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Success 200 {array} domain.Promotion
+// @Failure 400 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/promotions [get]
+func (h *KermesseHandler) HandleGetPromotions(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	promotions, err := h.svc.GetPromotions(ctx.Request.Context(), uint(kermesseID), uint(standID))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrStandNotFound), errors.Is(err, service.ErrStandNotInKermesse):
+			response.RenderErr(ctx, response.ErrNotFound("stand", "ID", standID))
+		default:
+			err = fmt.Errorf("HandleGetPromotions -> h.svc.GetPromotions -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, promotions)
+}
+
+// HandleDeactivatePromotion godoc
+// @Summary End a promotion of a stand
+// @Description Lets a manager of the stand or an organizer of the kermesse turn a promotion off. Orders that got their price from it keep pointing to it.
+// @Tags kermesses
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param promotionID path int true "Promotion ID"
+// @Success 204
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/promotions/{promotionID} [delete]
+func (h *KermesseHandler) HandleDeactivatePromotion(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	promotionID, err := strconv.ParseUint(ctx.Param("promotionID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid promotion ID")))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	err = h.svc.DeactivatePromotion(ctx.Request.Context(), uint(kermesseID), uint(standID), user, uint(promotionID))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotStandHolder), errors.Is(err, service.ErrNotStandManager):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case errors.Is(err, service.ErrPromotionNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("promotion", "ID", promotionID))
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		default:
+			renderCheckoutErr(ctx, standID, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// HandleReserveStock godoc
+// @Summary Reserve items at a stand
+// @Description Holds items of the stand for the user for a short while, e.g. while checking with a parent. Nobody else can buy them meanwhile; the user's next checkout at the stand confirms the reservations, and they are released once expired.
+// @Tags kermesses
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param reservation body request.ReservationRequest true "Items to reserve"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 201 {array} domain.StockReservation
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/reservations [post]
+func (h *KermesseHandler) HandleReserveStock(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	var req request.ReservationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	isParticipant, err := h.svc.IsParticipating(uint(kermesseID), user.ID)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to check user participation: %w", err)))
+		return
+	}
+	if !isParticipant {
+		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user is not a participant of this kermesse")))
+		return
+	}
+
+	cart := make([]domain.CartLine, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		cart = append(cart, domain.CartLine{StockID: line.StockID, Quantity: line.Quantity})
+	}
+
+	reservations, err := h.svc.ReserveStock(ctx.Request.Context(), user.ID, uint(kermesseID), uint(standID), cart)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNothingToReserve):
+			response.RenderErr(ctx, response.ErrBadRequest(err))
+		default:
+			renderCheckoutErr(ctx, standID, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, reservations)
+}
+
+// HandleReleaseReservation godoc
+// @Summary Release a stock reservation
+// @Description Gives up a reservation the user holds, putting its items back on sale.
+// @Tags kermesses
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param reservationID path int true "Reservation ID"
+// @Success 200 {object} domain.StockReservation
+// @Failure 400 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/reservations/{reservationID} [delete]
+func (h *KermesseHandler) HandleReleaseReservation(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	reservationID, err := strconv.ParseUint(ctx.Param("reservationID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid reservation ID")))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	reservation, err := h.svc.ReleaseReservation(ctx.Request.Context(), uint(kermesseID), uint(reservationID), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrReservationNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("reservation", "ID", reservationID))
+		default:
+			err = fmt.Errorf("HandleReleaseReservation -> h.svc.ReleaseReservation -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, reservation)
+}
+
+// HandleGetStockAudit godoc
+// @Summary Audit the stock of a stand
+// @Description Returns every change of the stand's stock quantities (sales, restocks, adjustments, waste and refunds) with its actor and transaction, and reconciles the quantity of each item against the journal.
+// @Tags kermesses
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Success 200 {object} domain.StockAudit
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/stock/movements [get]
+func (h *KermesseHandler) HandleGetStockAudit(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	audit, err := h.svc.GetStockAudit(ctx.Request.Context(), uint(kermesseID), uint(standID), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotStandHolder):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case errors.Is(err, service.ErrStandNotFound), errors.Is(err, service.ErrStandNotInKermesse):
+			response.RenderErr(ctx, response.ErrNotFound("stand", "ID", standID))
+		default:
+			err = fmt.Errorf("HandleGetStockAudit -> h.svc.GetStockAudit -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, audit)
+}
+
+// HandleGetLowStockItems godoc
+// @Summary List the items running low in a kermesse
+// @Description Lists the items of every stand of the kermesse whose quantity fell to their low-stock threshold. Only organizers of the kermesse can see them.
+// @Tags kermesses
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Success 200 {array} domain.LowStockItem
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stock/low [get]
+func (h *KermesseHandler) HandleGetLowStockItems(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	items, err := h.svc.GetLowStockItems(ctx.Request.Context(), uint(kermesseID), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		case errors.Is(err, service.ErrUnauthorizedOrganizer):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		default:
+			err = fmt.Errorf("HandleGetLowStockItems -> h.svc.GetLowStockItems -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, items)
+}
+
+// HandleGetNotifications godoc
+// @Summary Get the caller's notifications
+// @Description Lists the latest notifications stored for the caller, newest first, such as low-stock alerts of the stands they hold or the kermesses they organize.
+// @Tags notifications
+// @Produce json
+// @Success 200 {array} domain.Notification
+// @Failure 401 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /me/notifications [get]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleGetNotifications(ctx *gin.Context) {
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	notifications, err := h.svc.GetNotifications(ctx.Request.Context(), user)
+	if err != nil {
+		err = fmt.Errorf("HandleGetNotifications -> h.svc.GetNotifications -> %w", err)
+		response.RenderErr(ctx, response.ErrInternalServerError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, notifications)
+}
+
+// HandleGetStand godoc
+// @Summary Get a stand of a kermesse
+// @Description Retrieves a stand of the kermesse. Participants and organizers can see it; only organizers and the stand's staff see its counters and stock. Archived stands aren't found.
+// @Tags kermesses,stands
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Success 200 {object} domain.Stand
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID} [get]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleGetStand(ctx *gin.Context) {
+	kermesseID, standID, user, ok := h.parseStandPath(ctx)
+	if !ok {
+		return
+	}
+
+	isOrganizer, respErr := h.standViewer(ctx, uint(kermesseID), user)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	stand, err := h.svc.GetStand(uint(kermesseID), uint(standID))
+	if err != nil {
+		renderStandErr(ctx, standID, 0, fmt.Errorf("HandleGetStand -> h.svc.GetStand -> %w", err))
+		return
+	}
+
+	standInfo, err := h.standView(ctx, user, stand, isOrganizer)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInternalServerError(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, standInfo)
+}
+
+// HandleUpdateStand godoc
+// @Summary Edit a stand
+// @Description Changes the name, type, description or opening hours of a stand; fields left out keep their value, and an empty opens_at or closes_at falls back to the hours of the kermesse. Only managers of the stand and organizers of the kermesse can edit it.
+// @Tags kermesses,stands
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param stand body request.StandPatchRequest true "Stand changes"
+// @Success 200 {object} domain.Stand
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 422 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID} [patch]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleUpdateStand(ctx *gin.Context) {
+	kermesseID, standID, user, ok := h.parseStandPath(ctx)
+	if !ok {
+		return
+	}
+
+	var req request.StandPatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	stand, err := h.svc.UpdateStand(ctx.Request.Context(), uint(kermesseID), uint(standID), user, req)
+	if err != nil {
+		renderStandErr(ctx, standID, 0, fmt.Errorf("HandleUpdateStand -> h.svc.UpdateStand -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stand)
+}
+
+// HandleArchiveStand godoc
+// @Summary Remove a stand
+// @Description Archives a stand: it no longer shows in the kermesse nor takes sales, but the transactions made at it keep referring to it. Only managers of the stand and organizers of the kermesse can remove it.
+// @Tags kermesses,stands
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Success 204
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID} [delete]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleArchiveStand(ctx *gin.Context) {
+	kermesseID, standID, user, ok := h.parseStandPath(ctx)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.ArchiveStand(ctx.Request.Context(), uint(kermesseID), uint(standID), user); err != nil {
+		renderStandErr(ctx, standID, 0, fmt.Errorf("HandleArchiveStand -> h.svc.ArchiveStand -> %w", err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// HandleGetStandStock godoc
+// @Summary Get a stock item of a stand
+// @Description Retrieves a stock item of a stand with its reserved and available quantities. Only staff of the stand and organizers of the kermesse can see it.
+// @Tags kermesses,stands
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param stockID path int true "Stock ID"
+// @Success 200 {object} domain.Stock
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/stock/{stockID} [get]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleGetStandStock(ctx *gin.Context) {
+	kermesseID, standID, user, ok := h.parseStandPath(ctx)
+	if !ok {
+		return
+	}
+
+	stockID, err := strconv.ParseUint(ctx.Param("stockID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stock ID")))
+		return
+	}
+
+	stock, err := h.svc.GetStandStock(ctx.Request.Context(), uint(kermesseID), uint(standID), uint(stockID), user)
+	if err != nil {
+		renderStandErr(ctx, standID, stockID, fmt.Errorf("HandleGetStandStock -> h.svc.GetStandStock -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stock)
+}
+
+// HandleUpdateStandStock godoc
+// @Summary Edit a stock item of a stand
+// @Description Changes the name, price, low-stock threshold or quantity of a stock item; fields left out keep their value. A change of quantity is journaled with its reason: restock, waste or adjustment, the default. Only managers of the stand and organizers of the kermesse can edit it.
+// @Tags kermesses,stands
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param stockID path int true "Stock ID"
+// @Param stock body request.StockPatchRequest true "Stock item changes"
+// @Success 200 {object} domain.Stock
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 422 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/stock/{stockID} [patch]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleUpdateStandStock(ctx *gin.Context) {
+	kermesseID, standID, user, ok := h.parseStandPath(ctx)
+	if !ok {
+		return
+	}
+
+	stockID, err := strconv.ParseUint(ctx.Param("stockID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stock ID")))
+		return
+	}
+
+	var req request.StockPatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	stock, err := h.svc.UpdateStandStock(ctx.Request.Context(), uint(kermesseID), uint(standID), uint(stockID), user, req)
+	if err != nil {
+		renderStandErr(ctx, standID, stockID, fmt.Errorf("HandleUpdateStandStock -> h.svc.UpdateStandStock -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stock)
+}
+
+// HandleArchiveStandStock godoc
+// @Summary Remove a stock item of a stand
+// @Description Archives a stock item: it no longer shows in the stand nor sells, but the orders and stock movements of the item keep referring to it. Only managers of the stand and organizers of the kermesse can remove it.
+// @Tags kermesses,stands
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param stockID path int true "Stock ID"
+// @Success 204
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/stock/{stockID} [delete]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleArchiveStandStock(ctx *gin.Context) {
+	kermesseID, standID, user, ok := h.parseStandPath(ctx)
+	if !ok {
+		return
+	}
+
+	stockID, err := strconv.ParseUint(ctx.Param("stockID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stock ID")))
+		return
+	}
+
+	err = h.svc.ArchiveStandStock(ctx.Request.Context(), uint(kermesseID), uint(standID), uint(stockID), user)
+	if err != nil {
+		renderStandErr(ctx, standID, stockID, fmt.Errorf("HandleArchiveStandStock -> h.svc.ArchiveStandStock -> %w", err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// HandleGetStandStaff godoc
+// @Summary List the staff of a stand
+// @Description Lists the users working at a stand with their role, managers first. Only staff of the stand and organizers of the kermesse can see it.
+// @Tags kermesses,stands
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Success 200 {array} domain.StandStaff
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/staff [get]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleGetStandStaff(ctx *gin.Context) {
+	kermesseID, standID, user, ok := h.parseStandPath(ctx)
+	if !ok {
+		return
+	}
+
+	staff, err := h.svc.GetStandStaff(ctx.Request.Context(), uint(kermesseID), uint(standID), user)
+	if err != nil {
+		renderStandStaffErr(ctx, standID, fmt.Errorf("HandleGetStandStaff -> h.svc.GetStandStaff -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, staff)
+}
+
+// HandleInviteStandStaff godoc
+// @Summary Invite a user to the staff of a stand
+// @Description Emails a code inviting the owner of an email address to work at a stand as a manager or a cashier. Only managers of the stand and organizers of the kermesse can invite, until the kermesse closes.
+// @Tags kermesses,stands
+// @Accept json
+// @Produce json
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param invitation body request.StandInvitationRequest true "Invitation"
+// @Success 201 {object} domain.StandInvitation
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/staff/invitations [post]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleInviteStandStaff(ctx *gin.Context) {
+	kermesseID, standID, user, ok := h.parseStandPath(ctx)
+	if !ok {
+		return
+	}
+
+	var req request.StandInvitationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	invitation, err := h.svc.InviteStandStaff(ctx.Request.Context(), uint(kermesseID), uint(standID), user, req)
+	if err != nil {
+		renderStandStaffErr(ctx, standID, fmt.Errorf("HandleInviteStandStaff -> h.svc.InviteStandStaff -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, invitation)
+}
+
+// HandleAcceptStandInvitation godoc
+// @Summary Accept an invitation to the staff of a stand
+// @Description Adds the signed in stand holder to the staff of the stand the code invites them to. The code must have been sent to their email address; an invitation never demotes a manager.
+// @Tags stands
+// @Accept json
+// @Produce json
+// @Param invitation body request.AcceptStandInvitationRequest true "Invitation code"
+// @Success 200 {object} domain.StandStaff
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /stand-invitations/accept [post]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleAcceptStandInvitation(ctx *gin.Context) {
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	var req request.AcceptStandInvitationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	member, err := h.svc.AcceptStandInvitation(ctx.Request.Context(), user, req.Code)
+	if errors.Is(err, service.ErrInvitationNotFound) {
+		response.RenderErr(ctx, response.ErrNotFound("invitation", "code", req.Code))
+		return
+	}
+	if err != nil {
+		renderStandStaffErr(ctx, 0, fmt.Errorf("HandleAcceptStandInvitation -> h.svc.AcceptStandInvitation -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, member)
+}
+
+// HandleRemoveStandStaff godoc
+// @Summary Remove a user from the staff of a stand
+// @Description Takes a user off the staff of a stand. Managers of the stand and organizers of the kermesse can remove anyone, and staff can remove themselves, as long as the stand keeps a manager.
+// @Tags kermesses,stands
+// @Param kermesseID path int true "Kermesse ID"
+// @Param standID path int true "Stand ID"
+// @Param userID path int true "User ID of the staff member"
+// @Success 204
+// @Failure 400 {object} response.Err
+// @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 409 {object} response.Err
+// @Failure 500 {object} response.Err
+// @Router /kermesses/{kermesseID}/stand/{standID}/staff/{userID} [delete]
+// @Security BearerAuth
+func (h *KermesseHandler) HandleRemoveStandStaff(ctx *gin.Context) {
+	kermesseID, standID, user, ok := h.parseStandPath(ctx)
+	if !ok {
+		return
+	}
+
+	staffID, err := strconv.ParseUint(ctx.Param("userID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid user ID")))
+		return
+	}
+
+	err = h.svc.RemoveStandStaff(ctx.Request.Context(), uint(kermesseID), uint(standID), uint(staffID), user)
+	if err != nil {
+		renderStandStaffErr(ctx, standID, fmt.Errorf("HandleRemoveStandStaff -> h.svc.RemoveStandStaff -> %w", err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *KermesseHandler) parseStandPath(ctx *gin.Context) (kermesseID, standID uint64, user domain.User, ok bool) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return 0, 0, domain.User{}, false
+	}
+
+	standID, err = strconv.ParseUint(ctx.Param("standID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid stand ID")))
+		return 0, 0, domain.User{}, false
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return 0, 0, domain.User{}, false
+	}
+
+	return kermesseID, standID, user, true
+}
+
+// optionalTime parses an RFC 3339 time, nil when value is empty.
+func optionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func renderStandErr(ctx *gin.Context, standID, stockID uint64, err error) {
+	switch {
+	case errors.Is(err, service.ErrNotStandHolder), errors.Is(err, service.ErrNotStandManager):
+		response.RenderErr(ctx, response.ErrPermissionDenied(err))
+	case errors.Is(err, service.ErrStandNotFound), errors.Is(err, service.ErrStandNotInKermesse):
+		response.RenderErr(ctx, response.ErrNotFound("stand", "ID", standID))
+	case errors.Is(err, service.ErrStockNotFound):
+		response.RenderErr(ctx, response.ErrNotFound("stock", "ID", stockID))
+	case errors.Is(err, service.ErrKermesseNotFound):
+		response.RenderErr(ctx, response.ErrNotFound("kermesse", "ID", ctx.Param("kermesseID")))
+	case errors.Is(err, service.ErrInvalidStockMovement), errors.Is(err, service.ErrInvalidSchedule):
+		response.RenderErr(ctx, response.ErrUnprocessableEntity(err))
+	default:
+		response.RenderErr(ctx, response.ErrInternalServerError(err))
+	}
+}
+
+// renderStandStaffErr renders err from managing the staff of a stand.
+func renderStandStaffErr(ctx *gin.Context, standID uint64, err error) {
+	switch {
+	case errors.Is(err, service.ErrStandStaffNotFound):
+		response.RenderErr(ctx, response.ErrNotFound("stand staff member", "user ID", ctx.Param("userID")))
+	case errors.Is(err, service.ErrInvitationExpired):
+		response.RenderErr(ctx, response.ErrConflict(err).WithCode(response.CodeInvitationExpired))
+	case errors.Is(err, service.ErrInvitationUsed):
+		response.RenderErr(ctx, response.ErrConflict(err).WithCode(response.CodeInvitationUsed))
+	case errors.Is(err, service.ErrLastStandManager):
+		response.RenderErr(ctx, response.ErrConflict(err).WithCode(response.CodeLastStandManager))
+	case isKermesseStatusErr(err):
+		response.RenderErr(ctx, kermesseStatusErr(err))
+	default:
+		renderStandErr(ctx, standID, 0, err)
+	}
+}
+
 //// HandleValidatePurchase godoc
 //// @Summary Validate a purchase transaction
 //// @Description Allows a stand holder to validate a purchase transaction
@@ -755,51 +2658,254 @@ func (h *KermesseHandler) HandleStandPurchase(ctx *gin.Context) {
 //	})
 //}
 
-// HandleGetChildrenTransactions godoc
-// @Summary      Get children's transactions for a kermesse
-// @Description  Retrieves all transactions made by the children of the authenticated parent user for a specific kermesse. Only parents can access this endpoint.
+// HandleGetChildrenTransactions godoc
+// @Summary      Get children's transactions for a kermesse
+// @Description  Retrieves all transactions made by the children of the authenticated parent user for a specific kermesse. Only parents can access this endpoint.
+// @Tags         kermesses,transactions
+// @Produce      json
+// @Param        kermesseID  path      int  true  "Kermesse ID"
+// @Success      200  {array}   domain.TokenTransaction
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /children_transactions [get]
+// @Security BearerAuth
+// @Deprecated   Use /me/transactions
+func (h *KermesseHandler) HandleGetChildrenTransactions(ctx *gin.Context) {
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	if user.Role != "parent" {
+		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user %v is not authorized to view children transactions", user.ID)))
+		return
+	}
+
+	transactions, err := h.svc.GetChildrenTransactions(ctx.Request.Context(), user.ID)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to get children transactions: %w", err)))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transactions)
+}
+
+// HandleGetMyTransactions godoc
+// @Summary      Get the caller's transaction history
+// @Description  Lists the transactions visible to the caller across kermesses: parents see theirs and their children's, students theirs, stand holders their stand's and organizers everything in the kermesses they organize. Pages are ordered by creation time and chained with next_cursor.
+// @Tags         transactions
+// @Produce      json
+// @Param        type      query  []string  false  "Transaction types, repeated or comma-separated"  collectionFormat(csv)
+// @Param        status    query  []string  false  "Transaction statuses, repeated or comma-separated"  collectionFormat(csv)
+// @Param        stand_id  query  int       false  "Stand ID"
+// @Param        from      query  string    false  "Created at or after, RFC 3339"
+// @Param        to        query  string    false  "Created before, RFC 3339"
+// @Param        order     query  string    false  "asc or desc (default)"
+// @Param        limit     query  int       false  "Page size, 50 by default and 200 at most"
+// @Param        cursor    query  string    false  "next_cursor of the previous page"
+// @Success      200  {object}  domain.TransactionPage
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /me/transactions [get]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleGetMyTransactions(ctx *gin.Context) {
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	filter, ok := parseTransactionFilter(ctx)
+	if !ok {
+		return
+	}
+
+	page, err := h.svc.GetMyTransactions(ctx.Request.Context(), user, filter)
+	if err != nil {
+		renderTransactionHistoryErr(ctx, 0, fmt.Errorf("HandleGetMyTransactions -> h.svc.GetMyTransactions -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// HandleGetKermesseTransactions godoc
+// @Summary      Get the transaction history of a kermesse
+// @Description  Lists the transactions of the kermesse visible to the caller, all of them for its organizers. Accepts the same filters as /me/transactions.
+// @Tags         kermesses,transactions
+// @Produce      json
+// @Param        kermesseID  path   int       true   "Kermesse ID"
+// @Param        type        query  []string  false  "Transaction types, repeated or comma-separated"  collectionFormat(csv)
+// @Param        status      query  []string  false  "Transaction statuses, repeated or comma-separated"  collectionFormat(csv)
+// @Param        stand_id    query  int       false  "Stand ID"
+// @Param        from        query  string    false  "Created at or after, RFC 3339"
+// @Param        to          query  string    false  "Created before, RFC 3339"
+// @Param        order       query  string    false  "asc or desc (default)"
+// @Param        limit       query  int       false  "Page size, 50 by default and 200 at most"
+// @Param        cursor      query  string    false  "next_cursor of the previous page"
+// @Success      200  {object}  domain.TransactionPage
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/transactions [get]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleGetKermesseTransactions(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	filter, ok := parseTransactionFilter(ctx)
+	if !ok {
+		return
+	}
+
+	page, err := h.svc.GetKermesseTransactions(ctx.Request.Context(), uint(kermesseID), user, filter)
+	if err != nil {
+		renderTransactionHistoryErr(ctx, uint(kermesseID), fmt.Errorf("HandleGetKermesseTransactions -> h.svc.GetKermesseTransactions -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// HandleGetFamilyStatement godoc
+// @Summary      Export the family statement of a kermesse
+// @Description  Lists what the parent and their children bought, gave, spent by stand and item, got refunded, and their closing balances at the kermesse, as a CSV or PDF file. Only parents can export their statement.
 // @Tags         kermesses,transactions
-// @Produce      json
-// @Param        kermesseID  path      int  true  "Kermesse ID"
-// @Success      200  {array}   domain.TokenTransaction
+// @Produce      text/csv
+// @Produce      application/pdf
+// @Param        kermesseID  path   int     true   "Kermesse ID"
+// @Param        format      query  string  false  "csv (default) or pdf"
+// @Success      200  {file}    file
 // @Failure      400  {object}  response.Err
 // @Failure      401  {object}  response.Err
 // @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
 // @Failure      500  {object}  response.Err
-// @Router       /children_transactions [get]
-// @Security BearerAuth
-func (h *KermesseHandler) HandleGetChildrenTransactions(ctx *gin.Context) {
+// @Router       /kermesses/{kermesseID}/statement [get]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleGetFamilyStatement(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	format := ctx.DefaultQuery("format", "csv")
+	if format != "csv" && format != "pdf" {
+		response.RenderErr(ctx, response.ErrInvalidInput("format", format))
+		return
+	}
+
 	user, respErr := getUserFromContext(ctx, h.uSvc)
 	if respErr != nil {
 		response.RenderErr(ctx, respErr)
 		return
 	}
 
-	if user.Role != "parent" {
-		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("user %v is not authorized to view children transactions", user.ID)))
+	familyStatement, err := h.svc.GetFamilyStatement(ctx.Request.Context(), uint(kermesseID), user)
+	if err != nil {
+		renderTransactionHistoryErr(ctx, uint(kermesseID), fmt.Errorf("HandleGetFamilyStatement -> h.svc.GetFamilyStatement -> %w", err))
 		return
 	}
 
-	transactions, err := h.svc.GetChildrenTransactions(ctx.Request.Context(), user.ID)
+	var body bytes.Buffer
+	contentType := "text/csv; charset=utf-8"
+	if format == "pdf" {
+		contentType = "application/pdf"
+		err = statement.WritePDF(&body, familyStatement)
+	} else {
+		err = statement.WriteCSV(&body, familyStatement)
+	}
 	if err != nil {
-		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to get children transactions: %w", err)))
+		response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("HandleGetFamilyStatement -> %w", err)))
 		return
 	}
 
-	ctx.JSON(http.StatusOK, transactions)
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-kermesse-%d.%s"`, kermesseID, format))
+	ctx.Data(http.StatusOK, contentType, body.Bytes())
+}
+
+func parseTransactionFilter(ctx *gin.Context) (domain.TransactionFilter, bool) {
+	var req request.TransactionHistoryRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid query: %w", err)))
+		return domain.TransactionFilter{}, false
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return domain.TransactionFilter{}, false
+	}
+
+	filter := domain.TransactionFilter{
+		Statuses:  req.Statuses,
+		StandID:   req.StandID,
+		Ascending: req.Order == "asc",
+		Limit:     req.Limit,
+	}
+	for _, transactionType := range req.Types {
+		filter.Types = append(filter.Types, domain.TokenTransactionType(transactionType))
+	}
+	// Validate checked the dates already.
+	if req.From != "" {
+		filter.From, _ = time.Parse(time.RFC3339, req.From)
+	}
+	if req.To != "" {
+		filter.To, _ = time.Parse(time.RFC3339, req.To)
+	}
+	if req.Cursor != "" {
+		cursor, err := domain.ParseTransactionCursor(req.Cursor)
+		if err != nil {
+			response.RenderErr(ctx, response.ErrInvalidInput("cursor", req.Cursor))
+			return domain.TransactionFilter{}, false
+		}
+		filter.After = &cursor
+	}
+
+	return filter, true
+}
+
+func renderTransactionHistoryErr(ctx *gin.Context, kermesseID uint, err error) {
+	switch {
+	case errors.Is(err, service.ErrKermesseNotFound):
+		response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+	case errors.Is(err, service.ErrUnauthorizedOrganizer), errors.Is(err, service.ErrInvalidUserRole):
+		response.RenderErr(ctx, response.ErrPermissionDenied(err))
+	default:
+		response.RenderErr(ctx, response.ErrInternalServerError(err))
+	}
 }
 
 // HandleUpdateStock godoc
 // @Summary Update stock for a stand
-// @Description Allows updating the stock for items in a stand
+// @Description Allows updating the stock for items in a stand, low-stock threshold included. A change of quantity is journaled with its reason: restock, waste or adjustment, the default. Only managers of the stand and organizers of the kermesse can update it.
 // @Tags kermesses
 // @Accept json
 // @Produce json
+// @Param kermesseID path int true "Kermesse ID"
 // @Param standID path int true "Stand ID"
 // @Param stockUpdateRequest body request.StockUpdateRequest true "Stock update request"
 // @Success 200
 // @Failure 400 {object} response.Err
 // @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
+// @Failure 422 {object} response.Err
 // @Failure 500 {object} response.Err
 // @Router /kermesses/{kermesseID}/stand/{standID}/stock/update [post]
 func (h *KermesseHandler) HandleUpdateStock(ctx *gin.Context) {
@@ -814,6 +2920,12 @@ func (h *KermesseHandler) HandleUpdateStock(ctx *gin.Context) {
 		return
 	}
 
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
 	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stand ID"})
@@ -826,13 +2938,9 @@ func (h *KermesseHandler) HandleUpdateStock(ctx *gin.Context) {
 		return
 	}
 
-	err = h.svc.UpdateStock(ctx.Request.Context(), req, user.ID, uint(standID))
+	err = h.svc.UpdateStock(ctx.Request.Context(), uint(kermesseID), uint(standID), user, req)
 	if err != nil {
-		if errors.Is(err, service.ErrUnauthorizedOrganizer) {
-			response.RenderErr(ctx, response.ErrPermissionDenied(err))
-		} else {
-			response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to update stock: %w", err)))
-		}
+		renderStandErr(ctx, standID, uint64(req.StockID), fmt.Errorf("HandleUpdateStock -> h.svc.UpdateStock -> %w", err))
 		return
 	}
 
@@ -841,15 +2949,17 @@ func (h *KermesseHandler) HandleUpdateStock(ctx *gin.Context) {
 
 // HandleCreateStock godoc
 // @Summary Create stock for a stand
-// @Description Allows creating new stock items for a stand
+// @Description Allows creating new stock items for a stand. Only managers of the stand and organizers of the kermesse can create them.
 // @Tags kermesses
 // @Accept json
 // @Produce json
+// @Param kermesseID path int true "Kermesse ID"
 // @Param standID path int true "Stand ID"
 // @Param stockCreateRequest body request.StockCreateRequest true "Stock creation request"
 // @Success 201 {object} domain.Stock
 // @Failure 400 {object} response.Err
 // @Failure 403 {object} response.Err
+// @Failure 404 {object} response.Err
 // @Failure 500 {object} response.Err
 // @Router /kermesses/{kermesseID}/stand/{standID}/stock [post]
 func (h *KermesseHandler) HandleCreateStock(ctx *gin.Context) {
@@ -864,6 +2974,12 @@ func (h *KermesseHandler) HandleCreateStock(ctx *gin.Context) {
 		return
 	}
 
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
 	standID, err := strconv.ParseUint(ctx.Param("standID"), 10, 32)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stand ID"})
@@ -877,19 +2993,16 @@ func (h *KermesseHandler) HandleCreateStock(ctx *gin.Context) {
 	}
 
 	stock := domain.Stock{
-		StandID:   uint(standID),
-		ItemName:  req.ItemName,
-		Quantity:  req.Quantity,
-		TokenCost: req.TokenCost,
+		StandID:           uint(standID),
+		ItemName:          req.ItemName,
+		Quantity:          req.Quantity,
+		TokenCost:         req.TokenCost,
+		LowStockThreshold: req.LowStockThreshold,
 	}
 
-	createdStock, err := h.svc.CreateStock(ctx.Request.Context(), stock, user.ID)
+	createdStock, err := h.svc.CreateStock(ctx.Request.Context(), uint(kermesseID), user, stock)
 	if err != nil {
-		if errors.Is(err, service.ErrUnauthorizedOrganizer) {
-			response.RenderErr(ctx, response.ErrPermissionDenied(err))
-		} else {
-			response.RenderErr(ctx, response.ErrInternalServerError(fmt.Errorf("failed to create stock: %w", err)))
-		}
+		renderStandErr(ctx, standID, 0, fmt.Errorf("HandleCreateStock -> h.svc.CreateStock -> %w", err))
 		return
 	}
 
@@ -968,3 +3081,351 @@ func (h *KermesseHandler) HandleAttributePointsToStudent(c *gin.Context) {
 		TotalPoints:      attributionResult.TotalPoints,
 	})
 }
+
+// HandleAuditLedger godoc
+// @Summary      Audit the token ledger of a kermesse
+// @Description  Checks that every ledger transaction of the kermesse is balanced, that its posted token transactions have ledger entries and that the cached balances of its accounts match the entries. Only organizers of the kermesse can run it.
+// @Tags         ledger
+// @Produce      json
+// @Param        kermesseID  path  int  true  "Kermesse ID"
+// @Success      200  {object}  domain.LedgerAudit
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/ledger/audit [get]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleAuditLedger(ctx *gin.Context) {
+	kermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	audit, err := h.svc.AuditLedger(ctx.Request.Context(), uint(kermesseID), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrKermesseNotFound):
+			response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+		case errors.Is(err, service.ErrUnauthorizedOrganizer):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		default:
+			err = fmt.Errorf("HandleAuditLedger -> h.svc.AuditLedger -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"balanced": audit.IsBalanced(),
+		"audit":    audit,
+	})
+}
+
+// HandleCloseKermesse godoc
+// @Summary      Close a kermesse
+// @Description  Ends an open kermesse: balances freeze, tokens can no longer be bought, given or spent, and unused tokens can be refunded to parents. Only organizers of the kermesse can close it.
+// @Tags         kermesses
+// @Produce      json
+// @Param        kermesseID  path  int  true  "Kermesse ID"
+// @Success      200  {object}  domain.Kermesse
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/close [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleCloseKermesse(ctx *gin.Context) {
+	kermesseID, user, ok := h.parseKermesseRefunds(ctx)
+	if !ok {
+		return
+	}
+
+	kermesse, err := h.svc.CloseKermesse(ctx.Request.Context(), kermesseID, user)
+	if err != nil {
+		renderKermesseRefundsErr(ctx, kermesseID, fmt.Errorf("HandleCloseKermesse -> h.svc.CloseKermesse -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, kermesse)
+}
+
+// HandlePublishKermesse godoc
+// @Summary      Publish a kermesse
+// @Description  Moves a draft kermesse to published: families can join it, while stands keep being set up. Only organizers of the kermesse can publish it.
+// @Tags         kermesses
+// @Produce      json
+// @Param        kermesseID  path  int  true  "Kermesse ID"
+// @Success      200  {object}  domain.Kermesse
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/publish [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandlePublishKermesse(ctx *gin.Context) {
+	h.setKermesseStatus(ctx, domain.KermessePublished)
+}
+
+// HandleOpenKermesse godoc
+// @Summary      Open a kermesse
+// @Description  Moves a published kermesse to open: tokens can be bought and spent at its stands. Only organizers of the kermesse can open it.
+// @Tags         kermesses
+// @Produce      json
+// @Param        kermesseID  path  int  true  "Kermesse ID"
+// @Success      200  {object}  domain.Kermesse
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/open [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleOpenKermesse(ctx *gin.Context) {
+	h.setKermesseStatus(ctx, domain.KermesseOpen)
+}
+
+// HandleArchiveKermesse godoc
+// @Summary      Archive a kermesse
+// @Description  Moves a closed kermesse to archived once it is settled. Only organizers of the kermesse can archive it.
+// @Tags         kermesses
+// @Produce      json
+// @Param        kermesseID  path  int  true  "Kermesse ID"
+// @Success      200  {object}  domain.Kermesse
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/archive [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleArchiveKermesse(ctx *gin.Context) {
+	h.setKermesseStatus(ctx, domain.KermesseArchived)
+}
+
+// HandleUpdateKermesse godoc
+// @Summary      Edit a kermesse
+// @Description  Edits the name, date, hours, time zone, location or description of a kermesse until it closes; fields left out keep their value. The version sent must be the one the kermesse was read at, otherwise the edit is refused with a conflict. Participants and stand holders are notified when the date or location changes. Only organizers of the kermesse can edit it.
+// @Tags         kermesses
+// @Accept       json
+// @Produce      json
+// @Param        kermesseID  path  int                           true  "Kermesse ID"
+// @Param        request     body  request.KermessePatchRequest  true  "Kermesse changes"
+// @Success      200  {object}  domain.Kermesse
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID} [patch]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleUpdateKermesse(ctx *gin.Context) {
+	kermesseID, user, ok := h.parseKermesseRefunds(ctx)
+	if !ok {
+		return
+	}
+
+	var req request.KermessePatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	kermesse, err := h.svc.UpdateKermesse(ctx.Request.Context(), kermesseID, user, req)
+	if err != nil {
+		renderKermesseRefundsErr(ctx, kermesseID, fmt.Errorf("HandleUpdateKermesse -> h.svc.UpdateKermesse -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, kermesse)
+}
+
+// HandleCancelKermesse godoc
+// @Summary      Cancel a kermesse
+// @Description  Calls off a kermesse that isn't closed yet. Participants and stand holders are notified, and the unused tokens paid by card are refunded like when the kermesse closes. When refunds fail, the kermesse stays cancelled without a refund report and organizers run the refunds again. Only organizers of the kermesse can cancel it.
+// @Tags         kermesses
+// @Produce      json
+// @Param        kermesseID  path  int  true  "Kermesse ID"
+// @Param        Idempotency-Key header string false "Key making retries of this request safe"
+// @Success      200  {object}  domain.KermesseCancellation
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/cancel [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleCancelKermesse(ctx *gin.Context) {
+	kermesseID, user, ok := h.parseKermesseRefunds(ctx)
+	if !ok {
+		return
+	}
+
+	cancellation, err := h.svc.CancelKermesse(ctx.Request.Context(), kermesseID, user)
+	if err != nil {
+		renderKermesseRefundsErr(ctx, kermesseID, fmt.Errorf("HandleCancelKermesse -> h.svc.CancelKermesse -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, cancellation)
+}
+
+func (h *KermesseHandler) setKermesseStatus(ctx *gin.Context, status domain.KermesseStatus) {
+	kermesseID, user, ok := h.parseKermesseRefunds(ctx)
+	if !ok {
+		return
+	}
+
+	kermesse, err := h.svc.SetKermesseStatus(ctx.Request.Context(), kermesseID, user, status)
+	if err != nil {
+		renderKermesseRefundsErr(ctx, kermesseID, fmt.Errorf("h.svc.SetKermesseStatus -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, kermesse)
+}
+
+// HandleRunKermesseRefunds godoc
+// @Summary      Refund unused tokens of a closed kermesse
+// @Description  Refunds the unused tokens of every family, parent and children, to the card the parent bought them with, never for more than was paid. Running again resumes an interrupted run and retries refunds the payment provider did not confirm.
+// @Tags         kermesses,tokens
+// @Produce      json
+// @Param        kermesseID  path  int  true  "Kermesse ID"
+// @Param        Idempotency-Key header string false "Key making retries of this request safe"
+// @Success      200  {object}  domain.RefundRunReport
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/refunds [post]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleRunKermesseRefunds(ctx *gin.Context) {
+	kermesseID, user, ok := h.parseKermesseRefunds(ctx)
+	if !ok {
+		return
+	}
+
+	report, err := h.svc.RunKermesseRefunds(ctx.Request.Context(), kermesseID, user)
+	if err != nil {
+		renderKermesseRefundsErr(ctx, kermesseID, fmt.Errorf("HandleRunKermesseRefunds -> h.svc.RunKermesseRefunds -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// HandleGetRefundReport godoc
+// @Summary      Get the refund report of a closed kermesse
+// @Tags         kermesses,tokens
+// @Produce      json
+// @Param        kermesseID  path  int  true  "Kermesse ID"
+// @Success      200  {object}  domain.RefundRunReport
+// @Failure      400  {object}  response.Err
+// @Failure      401  {object}  response.Err
+// @Failure      403  {object}  response.Err
+// @Failure      404  {object}  response.Err
+// @Failure      409  {object}  response.Err
+// @Failure      500  {object}  response.Err
+// @Router       /kermesses/{kermesseID}/refunds [get]
+// @Security     BearerAuth
+func (h *KermesseHandler) HandleGetRefundReport(ctx *gin.Context) {
+	kermesseID, user, ok := h.parseKermesseRefunds(ctx)
+	if !ok {
+		return
+	}
+
+	report, err := h.svc.GetRefundReport(ctx.Request.Context(), kermesseID, user)
+	if err != nil {
+		renderKermesseRefundsErr(ctx, kermesseID, fmt.Errorf("HandleGetRefundReport -> h.svc.GetRefundReport -> %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+func (h *KermesseHandler) parseKermesseRefunds(ctx *gin.Context) (kermesseID uint, user domain.User, ok bool) {
+	parsedKermesseID, err := strconv.ParseUint(ctx.Param("kermesseID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid kermesse ID")))
+		return 0, domain.User{}, false
+	}
+
+	user, respErr := getUserFromContext(ctx, h.uSvc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return 0, domain.User{}, false
+	}
+
+	return uint(parsedKermesseID), user, true
+}
+
+func renderKermesseRefundsErr(ctx *gin.Context, kermesseID uint, err error) {
+	switch {
+	case errors.Is(err, service.ErrKermesseNotFound):
+		response.RenderErr(ctx, response.ErrNotFound("kermesse", "id", kermesseID))
+	case errors.Is(err, service.ErrUnauthorizedOrganizer):
+		response.RenderErr(ctx, response.ErrPermissionDenied(err))
+	case isKermesseStatusErr(err):
+		response.RenderErr(ctx, kermesseStatusErr(err))
+	case errors.Is(err, service.ErrKermesseNotClosed), errors.Is(err, service.ErrPurchaseConflict):
+		response.RenderErr(ctx, response.ErrConflict(err))
+	case errors.Is(err, service.ErrInvalidSchedule):
+		response.RenderErr(ctx, response.ErrUnprocessableEntity(err))
+	default:
+		response.RenderErr(ctx, response.ErrInternalServerError(err))
+	}
+}
+
+// kermesseStatusErr renders err, a request the kermesse doesn't take in its
+// status or at this time, as a conflict coded after the reason. It returns
+// nil when err isn't about the kermesse status.
+func kermesseStatusErr(err error) *response.Err {
+	var code int
+	switch {
+	case errors.Is(err, service.ErrKermesseNotPublished):
+		code = response.CodeKermesseNotPublished
+	case errors.Is(err, service.ErrKermesseNotOpen):
+		code = response.CodeKermesseNotOpen
+	case errors.Is(err, service.ErrKermesseClosed):
+		code = response.CodeKermesseClosed
+	case errors.Is(err, service.ErrKermesseArchived):
+		code = response.CodeKermesseArchived
+	case errors.Is(err, service.ErrKermesseCancelled):
+		code = response.CodeKermesseCancelled
+	case errors.Is(err, service.ErrKermesseVersionConflict):
+		code = response.CodeKermesseVersion
+	case errors.Is(err, service.ErrStandClosed):
+		code = response.CodeStandClosed
+	case errors.Is(err, service.ErrInvalidKermesseTransition), errors.Is(err, service.ErrKermesseStatusChanged):
+		code = response.CodeKermesseTransition
+	default:
+		return nil
+	}
+
+	return response.ErrConflict(err).WithCode(code)
+}
+
+func isKermesseStatusErr(err error) bool {
+	return kermesseStatusErr(err) != nil
+}
@@ -1,31 +1,61 @@
 package request
 
 import (
+	"errors"
 	"fmt"
 	validation "github.com/go-ozzo/ozzo-validation"
+	"time"
 )
 
+// SupportedCurrencies are the currencies tokens can be sold in.
+var SupportedCurrencies = []interface{}{"eur", "usd", "gbp", "chf"}
+
 type StockItem struct {
-	ItemName  string `json:"item_name"`
-	Quantity  int    `json:"quantity"`
-	TokenCost int    `json:"token_cost"`
+	ItemName          string `json:"item_name"`
+	Quantity          int    `json:"quantity"`
+	TokenCost         int    `json:"token_cost"`
+	LowStockThreshold int    `json:"low_stock_threshold"`
 }
 
+// CreateKermesseRequest creates a kermesse. StartsAt and EndsAt, in RFC 3339,
+// give its hours and make Date optional; a kermesse with only a Date has no
+// hours. TimeZone defaults to UTC.
 type CreateKermesseRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Date        string `json:"date" binding:"required" format:"DD/MM/YYYY"`
-	Location    string `json:"location" binding:"required"`
-	Description string `json:"description"`
+	Name        string             `json:"name" binding:"required"`
+	Date        string             `json:"date" format:"DD/MM/YYYY"`
+	StartsAt    string             `json:"starts_at" example:"2026-06-20T10:00:00+02:00"`
+	EndsAt      string             `json:"ends_at" example:"2026-06-20T18:00:00+02:00"`
+	TimeZone    string             `json:"time_zone" example:"Europe/Paris"`
+	Location    string             `json:"location" binding:"required"`
+	Description string             `json:"description"`
+	Currency    string             `json:"currency" binding:"required" example:"eur"`
+	TokenPrice  int64              `json:"token_price" binding:"required" example:"100"` // In the currency's minor unit.
+	TokenPacks  []TokenPackRequest `json:"token_packs"`
+}
+
+type TokenPackRequest struct {
+	Tokens int   `json:"tokens" example:"10"`
+	Price  int64 `json:"price" example:"800"` // In the currency's minor unit.
+}
+
+func (req TokenPackRequest) Validate() error {
+	return validation.ValidateStruct(
+		&req,
+		validation.Field(&req.Tokens, validation.Required, validation.Min(2)),
+		validation.Field(&req.Price, validation.Required, validation.Min(int64(1))),
+	)
 }
 
 type SendTokensRequest struct {
-	StudentID uint `json:"student_id" binding:"required"`
-	Amount    int  `json:"amount" binding:"required,min=1"`
+	KermesseID uint `json:"kermesse_id" binding:"required"`
+	StudentID  uint `json:"student_id" binding:"required"`
+	Amount     int  `json:"amount" binding:"required,min=1"`
 }
 
 func (req *SendTokensRequest) Validate() error {
 	err := validation.ValidateStruct(
 		req,
+		validation.Field(&req.KermesseID, validation.Required, validation.Min(uint(1))),
 		validation.Field(&req.StudentID, validation.Required, validation.Min(uint(1))),
 		validation.Field(&req.Amount, validation.Required, validation.Min(1)),
 	)
@@ -36,9 +66,10 @@ func (req *SendTokensRequest) Validate() error {
 }
 
 type StockCreateRequest struct {
-	ItemName  string `json:"itemName"`
-	Quantity  int    `json:"quantity"`
-	TokenCost int    `json:"tokenCost"`
+	ItemName          string `json:"itemName"`
+	Quantity          int    `json:"quantity"`
+	TokenCost         int    `json:"tokenCost"`
+	LowStockThreshold int    `json:"lowStockThreshold"`
 }
 
 func (r *StockCreateRequest) Validate() error {
@@ -47,6 +78,7 @@ func (r *StockCreateRequest) Validate() error {
 		validation.Field(&r.ItemName, validation.Required, validation.Length(1, 50)),
 		validation.Field(&r.Quantity, validation.Required, validation.Min(0)),
 		validation.Field(&r.TokenCost, validation.Required, validation.Min(1)),
+		validation.Field(&r.LowStockThreshold, validation.Min(0)),
 	)
 }
 
@@ -54,16 +86,60 @@ func (req *CreateKermesseRequest) Validate() error {
 	return validation.ValidateStruct(
 		req,
 		validation.Field(&req.Name, validation.Required, validation.Length(2, 50)),
-		validation.Field(&req.Date, validation.Required),
+		validation.Field(&req.Date, requiredIf(req.StartsAt == ""), validation.Date("02/01/2006")),
+		validation.Field(&req.StartsAt, requiredIf(req.EndsAt != ""), validation.Date(time.RFC3339)),
+		validation.Field(&req.EndsAt, requiredIf(req.StartsAt != ""), validation.Date(time.RFC3339)),
+		validation.Field(&req.TimeZone, validation.By(knownTimeZone)),
 		validation.Field(&req.Location, validation.Required, validation.Length(2, 50)),
 		validation.Field(&req.Description, validation.Length(0, 200)),
+		validation.Field(&req.Currency, validation.Required, validation.In(SupportedCurrencies...)),
+		validation.Field(&req.TokenPrice, validation.Required, validation.Min(int64(1))),
+		validation.Field(&req.TokenPacks, validation.By(distinctTokenPacks)),
 	)
 }
 
+// requiredIf is validation.Required when cond holds, and no rule otherwise.
+func requiredIf(cond bool) validation.Rule {
+	if !cond {
+		return validation.By(func(interface{}) error { return nil })
+	}
+
+	return validation.Required
+}
+
+func knownTimeZone(value interface{}) error {
+	value, isNil := validation.Indirect(value)
+	name, _ := value.(string)
+	if isNil || name == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(name); err != nil || name == "Local" {
+		return errors.New("must be an IANA time zone")
+	}
+
+	return nil
+}
+
+func distinctTokenPacks(value interface{}) error {
+	packs, _ := value.([]TokenPackRequest)
+	seen := make(map[int]bool, len(packs))
+	for _, pack := range packs {
+		if seen[pack.Tokens] {
+			return errors.New("must not contain two packs of the same size")
+		}
+		seen[pack.Tokens] = true
+	}
+	return nil
+}
+
+// CreateStandRequest creates a stand. OpensAt and ClosesAt, in RFC 3339,
+// narrow when it takes sales to less than the hours of its kermesse.
 type CreateStandRequest struct {
 	Name        string      `json:"name"`
 	Type        string      `json:"type"`
 	Description string      `json:"description"`
+	OpensAt     string      `json:"opens_at" example:"2026-06-20T12:00:00+02:00"`
+	ClosesAt    string      `json:"closes_at" example:"2026-06-20T14:00:00+02:00"`
 	Stock       []StockItem `json:"stock"`
 }
 
@@ -72,6 +148,19 @@ type TokenPurchaseRequest struct {
 	PaymentMethodID string `json:"payment_method_id" binding:"required"`
 }
 
+type CashTokenPurchaseRequest struct {
+	Amount   int  `json:"amount" binding:"required,min=1"`
+	ParentID uint `json:"parent_id"` // Only used when an organizer records the purchase.
+}
+
+type RejectTokenPurchaseRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type RefundPurchaseRequest struct {
+	Quantity int `json:"quantity"` // Items to refund, all the remaining ones when omitted.
+}
+
 type StandPurchaseRequest struct {
 	StockID  uint `json:"stock_id" binding:"required"`
 	Quantity int  `json:"quantity" binding:"required,min=1"`
@@ -102,6 +191,13 @@ type StockUpdateRequest struct {
 	ItemName  string `json:"item_name"`
 	Quantity  int    `json:"quantity"`
 	TokenCost int    `json:"token_cost"`
+	// LowStockThreshold is the quantity at which holders and organizers get
+	// alerted, 0 for never.
+	LowStockThreshold int `json:"low_stock_threshold"`
+	// Reason tells why the quantity changed: restock, waste or adjustment,
+	// the default.
+	Reason string `json:"reason"`
+	Note   string `json:"note"`
 }
 
 func (req *StockUpdateRequest) Validate() error {
@@ -111,6 +207,53 @@ func (req *StockUpdateRequest) Validate() error {
 		validation.Field(&req.ItemName, validation.Required, validation.Length(1, 50)),
 		validation.Field(&req.Quantity, validation.Required, validation.Min(0)),
 		validation.Field(&req.TokenCost, validation.Required, validation.Min(1)),
+		validation.Field(&req.LowStockThreshold, validation.Min(0)),
+		validation.Field(&req.Reason, validation.In("restock", "waste", "adjustment")),
+		validation.Field(&req.Note, validation.Length(0, 200)),
+	)
+}
+
+// StandPatchRequest edits a stand; fields left out keep their value. An
+// empty OpensAt or ClosesAt falls back to the hours of the kermesse.
+type StandPatchRequest struct {
+	Name        *string `json:"name"`
+	Type        *string `json:"type"`
+	Description *string `json:"description"`
+	OpensAt     *string `json:"opens_at"`
+	ClosesAt    *string `json:"closes_at"`
+}
+
+func (req *StandPatchRequest) Validate() error {
+	return validation.ValidateStruct(
+		req,
+		validation.Field(&req.Name, validation.NilOrNotEmpty, validation.Length(2, 50)),
+		validation.Field(&req.Type, validation.NilOrNotEmpty, validation.In("food", "drink", "activity")),
+		validation.Field(&req.Description, validation.Length(0, 200)),
+		validation.Field(&req.OpensAt, validation.Date(time.RFC3339)),
+		validation.Field(&req.ClosesAt, validation.Date(time.RFC3339)),
+	)
+}
+
+// StockPatchRequest edits a stock item; fields left out keep their value.
+// A change of quantity is journaled like with StockUpdateRequest.
+type StockPatchRequest struct {
+	ItemName          *string `json:"item_name"`
+	Quantity          *int    `json:"quantity"`
+	TokenCost         *int    `json:"token_cost"`
+	LowStockThreshold *int    `json:"low_stock_threshold"`
+	Reason            string  `json:"reason"`
+	Note              string  `json:"note"`
+}
+
+func (req *StockPatchRequest) Validate() error {
+	return validation.ValidateStruct(
+		req,
+		validation.Field(&req.ItemName, validation.NilOrNotEmpty, validation.Length(1, 50)),
+		validation.Field(&req.Quantity, validation.Min(0)),
+		validation.Field(&req.TokenCost, validation.NilOrNotEmpty, validation.Min(1)),
+		validation.Field(&req.LowStockThreshold, validation.Min(0)),
+		validation.Field(&req.Reason, validation.In("restock", "waste", "adjustment")),
+		validation.Field(&req.Note, validation.Length(0, 200)),
 	)
 }
 
@@ -137,12 +280,35 @@ func (req *TokenPurchaseRequest) Validate() error {
 	return nil
 }
 
+func (req *CashTokenPurchaseRequest) Validate() error {
+	return validation.ValidateStruct(
+		req,
+		validation.Field(&req.Amount, validation.Required, validation.Min(1)),
+	)
+}
+
+func (req *RefundPurchaseRequest) Validate() error {
+	return validation.ValidateStruct(
+		req,
+		validation.Field(&req.Quantity, validation.Min(0)),
+	)
+}
+
+func (req *RejectTokenPurchaseRequest) Validate() error {
+	return validation.ValidateStruct(
+		req,
+		validation.Field(&req.Reason, validation.Required, validation.Length(1, 255)),
+	)
+}
+
 func (req *CreateStandRequest) Validate() error {
 	err := validation.ValidateStruct(
 		req,
 		validation.Field(&req.Name, validation.Required, validation.Length(2, 50)),
 		validation.Field(&req.Type, validation.Required, validation.In("food", "drink", "activity")),
 		validation.Field(&req.Description, validation.Length(0, 200)),
+		validation.Field(&req.OpensAt, validation.Date(time.RFC3339)),
+		validation.Field(&req.ClosesAt, validation.Date(time.RFC3339)),
 		//validation.Field(&req.Stock, validation.Required, validation.Each(validation.By(validateStockItem))),
 	)
 	if err != nil {
@@ -162,6 +328,7 @@ func validateStockItem(value interface{}) error {
 		validation.Field(&item.ItemName, validation.Required, validation.Length(1, 50)),
 		validation.Field(&item.Quantity, validation.Required, validation.Min(0)),
 		validation.Field(&item.TokenCost, validation.Required, validation.Min(1)),
+		validation.Field(&item.LowStockThreshold, validation.Min(0)),
 	)
 }
 
@@ -181,3 +348,31 @@ func (req *AttributePointsRequest) Validate() error {
 	}
 	return nil
 }
+
+// KermessePatchRequest edits a kermesse; fields left out keep their value.
+// Version is the one the kermesse was read at, so that edits made since
+// aren't overwritten.
+type KermessePatchRequest struct {
+	Version     int     `json:"version" binding:"required"`
+	Name        *string `json:"name"`
+	Date        *string `json:"date" format:"DD/MM/YYYY"`
+	StartsAt    *string `json:"starts_at" example:"2026-06-20T10:00:00+02:00"`
+	EndsAt      *string `json:"ends_at" example:"2026-06-20T18:00:00+02:00"`
+	TimeZone    *string `json:"time_zone" example:"Europe/Paris"`
+	Location    *string `json:"location"`
+	Description *string `json:"description"`
+}
+
+func (req *KermessePatchRequest) Validate() error {
+	return validation.ValidateStruct(
+		req,
+		validation.Field(&req.Version, validation.Required, validation.Min(1)),
+		validation.Field(&req.Name, validation.NilOrNotEmpty, validation.Length(2, 50)),
+		validation.Field(&req.Date, validation.NilOrNotEmpty, validation.Date("02/01/2006")),
+		validation.Field(&req.StartsAt, validation.NilOrNotEmpty, validation.Date(time.RFC3339)),
+		validation.Field(&req.EndsAt, validation.NilOrNotEmpty, validation.Date(time.RFC3339)),
+		validation.Field(&req.TimeZone, validation.NilOrNotEmpty, validation.By(knownTimeZone)),
+		validation.Field(&req.Location, validation.NilOrNotEmpty, validation.Length(2, 50)),
+		validation.Field(&req.Description, validation.Length(0, 200)),
+	)
+}
@@ -0,0 +1,48 @@
+package request
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+const (
+	// MaxOfflineVouchers bounds the vouchers uploaded at once.
+	MaxOfflineVouchers = 500
+	// MaxOfflineVoucherPayload is well above what a full cart signs to.
+	MaxOfflineVoucherPayload = 2048
+)
+
+type OfflineAllowanceRequest struct {
+	// StudentID can be left out by students issuing their own allowance.
+	StudentID uint `json:"student_id"`
+	Limit     int  `json:"limit"`
+}
+
+type OfflineVouchersRequest struct {
+	Vouchers []string `json:"vouchers"`
+}
+
+func (req *OfflineAllowanceRequest) Validate() error {
+	err := validation.ValidateStruct(
+		req,
+		validation.Field(&req.Limit, validation.Required, validation.Min(1)),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (req *OfflineVouchersRequest) Validate() error {
+	err := validation.ValidateStruct(
+		req,
+		validation.Field(&req.Vouchers,
+			validation.Required,
+			validation.Length(1, MaxOfflineVouchers),
+			validation.Each(validation.Length(1, MaxOfflineVoucherPayload)),
+		),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package request
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// MaxCheckoutLines bounds the number of lines of a cart.
+const MaxCheckoutLines = 50
+
+type CheckoutLine struct {
+	StockID  uint `json:"stock_id"`
+	Quantity int  `json:"quantity"`
+}
+
+type CheckoutRequest struct {
+	Lines []CheckoutLine `json:"lines"`
+}
+
+func (line CheckoutLine) Validate() error {
+	return validation.ValidateStruct(
+		&line,
+		validation.Field(&line.StockID, validation.Required, validation.Min(uint(1))),
+		validation.Field(&line.Quantity, validation.Required, validation.Min(1)),
+	)
+}
+
+func (req *CheckoutRequest) Validate() error {
+	err := validation.ValidateStruct(
+		req,
+		validation.Field(&req.Lines, validation.Required, validation.Length(1, MaxCheckoutLines)),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
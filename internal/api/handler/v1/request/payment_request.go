@@ -0,0 +1,43 @@
+package request
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// MaxPaymentRequestPayload bounds payloads well above what a full cart signs
+// to, and below what a QR code holds.
+const MaxPaymentRequestPayload = 2048
+
+type CreatePaymentRequestRequest struct {
+	Lines []CheckoutLine `json:"lines"`
+	// Amount is the total the stand expects, checked against the cart when
+	// set.
+	Amount int `json:"amount"`
+}
+
+type PayPaymentRequestRequest struct {
+	Payload string `json:"payload"`
+}
+
+func (req *CreatePaymentRequestRequest) Validate() error {
+	err := validation.ValidateStruct(
+		req,
+		validation.Field(&req.Lines, validation.Required, validation.Length(1, MaxCheckoutLines)),
+		validation.Field(&req.Amount, validation.Min(0)),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (req *PayPaymentRequestRequest) Validate() error {
+	err := validation.ValidateStruct(
+		req,
+		validation.Field(&req.Payload, validation.Required, validation.Length(1, MaxPaymentRequestPayload)),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package request
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+type ChargeRequest struct {
+	// StudentCode is the short code or the badge ID of the student charged.
+	StudentCode string         `json:"student_code"`
+	Lines       []CheckoutLine `json:"lines"`
+}
+
+type StudentPOSSettingsRequest struct {
+	// BadgeID is left empty to remove the student's badge.
+	BadgeID          string `json:"badge_id"`
+	AutoApproveLimit int    `json:"auto_approve_limit"`
+}
+
+func (req *ChargeRequest) Validate() error {
+	err := validation.ValidateStruct(
+		req,
+		validation.Field(&req.StudentCode, validation.Required, validation.Length(1, 64)),
+		validation.Field(&req.Lines, validation.Required, validation.Length(1, MaxCheckoutLines)),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (req *StudentPOSSettingsRequest) Validate() error {
+	err := validation.ValidateStruct(
+		req,
+		validation.Field(&req.BadgeID, validation.Length(0, 64)),
+		validation.Field(&req.AutoApproveLimit, validation.Min(0)),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package request
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// MaxPromotionItems bounds the items a promotion is about.
+const MaxPromotionItems = 20
+
+type PromotionItemRequest struct {
+	StockID  uint `json:"stock_id"`
+	Quantity int  `json:"quantity"`
+}
+
+type PromotionRequest struct {
+	Name        string                 `json:"name"`
+	Type        string                 `json:"type"`
+	Items       []PromotionItemRequest `json:"items"`
+	BundlePrice int                    `json:"bundle_price"`
+	PercentOff  int                    `json:"percent_off"`
+	BuyQuantity int                    `json:"buy_quantity"`
+	GetQuantity int                    `json:"get_quantity"`
+	StartsAt    *time.Time             `json:"starts_at"`
+	EndsAt      *time.Time             `json:"ends_at"`
+}
+
+func (item PromotionItemRequest) Validate() error {
+	return validation.ValidateStruct(
+		&item,
+		validation.Field(&item.StockID, validation.Required, validation.Min(uint(1))),
+		validation.Field(&item.Quantity, validation.Min(0)),
+	)
+}
+
+func (req *PromotionRequest) Validate() error {
+	err := validation.ValidateStruct(
+		req,
+		validation.Field(&req.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&req.Type, validation.Required, validation.In("bundle", "percent_off", "buy_x_get_y")),
+		validation.Field(&req.Items, validation.Length(0, MaxPromotionItems)),
+		validation.Field(&req.BundlePrice, validation.Min(0)),
+		validation.Field(&req.PercentOff, validation.Min(0), validation.Max(100)),
+		validation.Field(&req.BuyQuantity, validation.Min(0)),
+		validation.Field(&req.GetQuantity, validation.Min(0)),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package request
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+type ReservationRequest struct {
+	Lines []CheckoutLine `json:"lines"`
+}
+
+func (req *ReservationRequest) Validate() error {
+	err := validation.ValidateStruct(
+		req,
+		validation.Field(&req.Lines, validation.Required, validation.Length(1, MaxCheckoutLines)),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
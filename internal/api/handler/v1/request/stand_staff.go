@@ -0,0 +1,30 @@
+package request
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
+type StandInvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"` // "manager" or "cashier"
+}
+
+func (req *StandInvitationRequest) Validate() error {
+	return validation.ValidateStruct(
+		req,
+		validation.Field(&req.Email, validation.Required, is.Email),
+		validation.Field(&req.Role, validation.Required, validation.In("manager", "cashier")),
+	)
+}
+
+type AcceptStandInvitationRequest struct {
+	Code string `json:"code"`
+}
+
+func (req *AcceptStandInvitationRequest) Validate() error {
+	return validation.ValidateStruct(
+		req,
+		validation.Field(&req.Code, validation.Required, validation.Length(1, 32)),
+	)
+}
@@ -0,0 +1,54 @@
+package request
+
+import (
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// TransactionTypes are the transaction types a history can be filtered on.
+var TransactionTypes = []interface{}{"Purchase", "Distribution", "Spend", "OpeningBalance", "Reversal", "Refund"}
+
+// TransactionStatuses are the statuses a history can be filtered on.
+var TransactionStatuses = []interface{}{"Pending", "Completed", "Validated", "Approved", "Rejected", "Failed"}
+
+type TransactionHistoryRequest struct {
+	// Types and Statuses may be repeated or comma-separated.
+	Types    []string `form:"type" example:"Purchase,Spend"`
+	Statuses []string `form:"status" example:"Completed"`
+	StandID  uint     `form:"stand_id"`
+	From     string   `form:"from" example:"2024-06-01T00:00:00Z"` // RFC 3339, inclusive.
+	To       string   `form:"to" example:"2024-06-02T00:00:00Z"`   // RFC 3339, exclusive.
+	Order    string   `form:"order" example:"desc"`
+	Limit    int      `form:"limit" example:"50"`
+	Cursor   string   `form:"cursor"`
+}
+
+func (req *TransactionHistoryRequest) Validate() error {
+	req.Types = splitList(req.Types)
+	req.Statuses = splitList(req.Statuses)
+
+	return validation.ValidateStruct(
+		req,
+		validation.Field(&req.Types, validation.Each(validation.In(TransactionTypes...))),
+		validation.Field(&req.Statuses, validation.Each(validation.In(TransactionStatuses...))),
+		validation.Field(&req.From, validation.Date(time.RFC3339)),
+		validation.Field(&req.To, validation.Date(time.RFC3339)),
+		validation.Field(&req.Order, validation.In("asc", "desc")),
+		validation.Field(&req.Limit, validation.Min(0), validation.Max(200)),
+	)
+}
+
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,24 @@
+package response
+
+// Application-specific error codes, for clients to tell apart refusals that
+// share an HTTP status.
+const (
+	CodeKermesseNotPublished = 1001 // The kermesse is still a draft.
+	CodeKermesseNotOpen      = 1002 // The kermesse is published but not open yet.
+	CodeKermesseClosed       = 1003 // The kermesse is closed.
+	CodeKermesseArchived     = 1004 // The kermesse is archived.
+	CodeKermesseTransition   = 1005 // The kermesse can't move to the status asked.
+	CodeKermesseCancelled    = 1006 // The kermesse is cancelled.
+	CodeKermesseVersion      = 1007 // The kermesse changed since the version edited.
+	CodeStandClosed          = 1008 // The stand takes no sales at this time.
+	CodeInvitationExpired    = 1009 // The stand invitation expired.
+	CodeInvitationUsed       = 1010 // The stand invitation was already accepted.
+	CodeLastStandManager     = 1011 // The stand would be left without a manager.
+)
+
+// WithCode sets the application-specific error code of e.
+func (e *Err) WithCode(code int) *Err {
+	e.ErrorCode = code
+
+	return e
+}
@@ -89,3 +89,27 @@ func ErrPermissionDenied(err error) *Err {
 		ErrorMsg: "permission denied",
 	}
 }
+
+func ErrConflict(err error) *Err {
+	return &Err{
+		statusCode: http.StatusConflict,
+		logFunc: func() {
+			zap.L().Debug("conflict: " + err.Error())
+		},
+		ErrorMsg: err.Error(),
+	}
+}
+
+func ErrUnprocessableEntity(err error) *Err {
+	return &Err{
+		statusCode: http.StatusUnprocessableEntity,
+		ErrorMsg:   err.Error(),
+	}
+}
+
+func ErrPaymentRequired(err error) *Err {
+	return &Err{
+		statusCode: http.StatusPaymentRequired,
+		ErrorMsg:   err.Error(),
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/request"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/response"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/pkg/jwthelper"
@@ -17,10 +18,12 @@ import (
 
 type UserService interface {
 	GetUser(ctx context.Context, id uint) (domain.UserWithDetails, error)
-	GetUserTokens(ctx context.Context, userID uint) (int, error)
+	GetUserInKermesse(ctx context.Context, id, kermesseID uint) (domain.UserWithDetails, error)
+	GetUserTokens(ctx context.Context, userID, kermesseID uint) (int, error)
 	GetStudentByUserID(ctx context.Context, userID uint) (domain.Student, error)
 	GetStandHolderByUserID(ctx context.Context, userID uint) (domain.StandHolder, error)
 	GetParentByUserID(ctx context.Context, userID uint) (domain.Parent, error)
+	UpdateStudentPOSSettings(ctx context.Context, parentID, studentID uint, badgeID string, autoApproveLimit int) (domain.Student, error)
 }
 
 type UserHandler struct {
@@ -90,8 +93,11 @@ func (h *UserHandler) HandleGetUser(ctx *gin.Context) {
 // HandleGetMe godoc
 // @Summary      Get current user's information
 // @Tags         users
+// @Description  Tokens are the balance of the wallet of kermesse_id, or the sum of all wallets without it.
 // @Produce      json
-// @Success      200      {object}   domain.User
+// @Param        kermesse_id  query  int  false "kermesse ID"
+// @Success      200      {object}   domain.UserWithDetails
+// @Failure      400      {object}   response.Err
 // @Failure      401      {object}   response.Err
 // @Failure      500      {object}   response.Err
 // @Router       /me [get]
@@ -105,14 +111,23 @@ func (h *UserHandler) HandleGetMe(ctx *gin.Context) {
 
 	userID := claims.UserID
 
-	userWithDetails, err := h.svc.GetUser(ctx.Request.Context(), userID)
+	var kermesseID uint64
+	if rawKermesseID := ctx.Query("kermesse_id"); rawKermesseID != "" {
+		kermesseID, err = strconv.ParseUint(rawKermesseID, 10, 32)
+		if err != nil || kermesseID == 0 {
+			response.RenderErr(ctx, response.ErrInvalidInput("kermesse_id", rawKermesseID))
+			return
+		}
+	}
+
+	userWithDetails, err := h.svc.GetUserInKermesse(ctx.Request.Context(), userID, uint(kermesseID))
 	if err != nil {
 		if errors.Is(err, service.ErrUserNotFound) {
 			response.RenderErr(ctx, response.ErrNotFound("user", "ID", userID))
 			return
 		}
 
-		err = fmt.Errorf("v1.HandleGetMe -> h.svc.GetUser -> %w", err)
+		err = fmt.Errorf("v1.HandleGetMe -> h.svc.GetUserInKermesse -> %w", err)
 		response.RenderErr(ctx, response.ErrInternalServerError(err))
 		return
 	}
@@ -120,6 +135,70 @@ func (h *UserHandler) HandleGetMe(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, userWithDetails)
 }
 
+// HandleUpdateStudentPOSSettings godoc
+// @Summary      Set how a student pays at stands
+// @Description  Lets a parent give their child a badge to pay with at the stands' point of sale, and set the largest charge, in tokens, approved without confirmation.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        studentID  path  int                                true  "Student user ID"
+// @Param        settings   body  request.StudentPOSSettingsRequest  true  "Point of sale settings"
+// @Success      200      {object}   domain.Student
+// @Failure      400      {object}   response.Err
+// @Failure      403      {object}   response.Err
+// @Failure      404      {object}   response.Err
+// @Failure      409      {object}   response.Err
+// @Failure      500      {object}   response.Err
+// @Router       /students/{studentID}/pos-settings [put]
+// @Security     BearerAuth
+func (h *UserHandler) HandleUpdateStudentPOSSettings(ctx *gin.Context) {
+	studentID, err := strconv.ParseUint(ctx.Param("studentID"), 10, 32)
+	if err != nil {
+		response.RenderErr(ctx, response.ErrInvalidInput("studentID", ctx.Param("studentID")))
+		return
+	}
+
+	var req request.StudentPOSSettingsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("invalid request body: %w", err)))
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		response.RenderErr(ctx, response.ErrBadRequest(err))
+		return
+	}
+
+	user, respErr := getUserFromContext(ctx, h.svc)
+	if respErr != nil {
+		response.RenderErr(ctx, respErr)
+		return
+	}
+
+	if user.Role != "parent" {
+		response.RenderErr(ctx, response.ErrPermissionDenied(fmt.Errorf("only parents can change a student's point of sale settings")))
+		return
+	}
+
+	student, err := h.svc.UpdateStudentPOSSettings(ctx.Request.Context(), user.ID, uint(studentID), req.BadgeID, req.AutoApproveLimit)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownStudent):
+			response.RenderErr(ctx, response.ErrNotFound("student", "ID", studentID))
+		case errors.Is(err, service.ErrNotParentOfStudent):
+			response.RenderErr(ctx, response.ErrPermissionDenied(err))
+		case errors.Is(err, service.ErrBadgeIDTaken):
+			response.RenderErr(ctx, response.ErrConflict(err))
+		default:
+			err = fmt.Errorf("v1.HandleUpdateStudentPOSSettings -> h.svc.UpdateStudentPOSSettings -> %w", err)
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, student)
+}
+
 func getUserFromContext(ctx *gin.Context, userService UserService) (domain.User, *response.Err) {
 	claims, err := jwthelper.RetrieveClaimsFromContext(ctx)
 	if err != nil {
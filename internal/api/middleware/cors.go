@@ -13,8 +13,8 @@ func ConfigCORS(allowedDomains []string) gin.HandlerFunc {
 	conf := cors.Config{
 		AllowOriginFunc:  createAllowedOriginFunc(allowedDomains),
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Accept", "Authorization", "X-CSRF-Token"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Accept", "Authorization", "X-CSRF-Token", IdempotencyKeyHeader},
+		ExposeHeaders:    []string{"Content-Length", IdempotentReplayedHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/response"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/pkg/jwthelper"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyReplayMimeType = "application/json; charset=utf-8"
+)
+
+// IdempotencyStore keeps the keys seen by Idempotency. Begin fails with
+// domain.ErrIdempotencyKeyMismatch for a key reused with another request, and
+// with domain.ErrIdempotencyKeyInProgress while the first request runs.
+type IdempotencyStore interface {
+	Begin(ctx context.Context, userID uint, key, requestHash string) (domain.IdempotencyKey, bool, error)
+	Complete(ctx context.Context, key domain.IdempotencyKey, statusCode int, responseBody []byte) error
+	Release(ctx context.Context, key domain.IdempotencyKey) error
+}
+
+type Idempotency struct {
+	store IdempotencyStore
+}
+
+func NewIdempotency(store IdempotencyStore) *Idempotency {
+	return &Idempotency{
+		store: store,
+	}
+}
+
+// Handle makes the route honor the Idempotency-Key header. It must run after
+// VerifyJWT as keys are scoped to the authenticated user. Requests without the
+// header are passed through unchanged.
+func (i *Idempotency) Handle() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("%v header must be at most %v characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)))
+			return
+		}
+
+		claims, err := jwthelper.RetrieveClaimsFromContext(ctx)
+		if err != nil {
+			response.RenderErr(ctx, response.ErrInternalServerError(err))
+			return
+		}
+
+		requestHash, err := hashRequest(ctx)
+		if err != nil {
+			response.RenderErr(ctx, response.ErrBadRequest(fmt.Errorf("unable to read request body: %w", err)))
+			return
+		}
+
+		record, replay, err := i.store.Begin(ctx.Request.Context(), claims.UserID, key, requestHash)
+		if err != nil {
+			switch {
+			case errors.Is(err, domain.ErrIdempotencyKeyMismatch):
+				response.RenderErr(ctx, response.ErrUnprocessableEntity(err))
+			case errors.Is(err, domain.ErrIdempotencyKeyInProgress):
+				response.RenderErr(ctx, response.ErrConflict(err))
+			default:
+				response.RenderErr(ctx, response.ErrInternalServerError(err))
+			}
+			return
+		}
+
+		if replay {
+			ctx.Header(IdempotentReplayedHeader, "true")
+			ctx.Data(record.StatusCode, idempotencyReplayMimeType, record.ResponseBody)
+			ctx.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+		ctx.Writer = recorder
+
+		// A handler that panics never gets to answer: the key is released on
+		// the way out so that retries aren't refused until it expires.
+		finished := false
+		defer func() {
+			if !finished {
+				i.release(record)
+			}
+		}()
+
+		ctx.Next()
+		finished = true
+
+		// Server errors and concurrency conflicts are worth retrying, so the key
+		// is released instead of pinning that outcome.
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusConflict {
+			i.release(record)
+			return
+		}
+
+		if err := i.store.Complete(context.Background(), record, status, recorder.body.Bytes()); err != nil {
+			zap.L().Error("failed to complete idempotency key", zap.Error(err))
+		}
+	}
+}
+
+func (i *Idempotency) release(record domain.IdempotencyKey) {
+	if err := i.store.Release(context.Background(), record); err != nil {
+		zap.L().Error("failed to release idempotency key", zap.Error(err))
+	}
+}
+
+// hashRequest fingerprints the request so that a key reused with another
+// route or body is detected. The body is restored for the handler.
+func hashRequest(ctx *gin.Context) (string, error) {
+	var body []byte
+	if ctx.Request.Body != nil {
+		var err error
+		body, err = io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	h := sha256.New()
+	h.Write([]byte(ctx.Request.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(ctx.Request.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/pkg/jwthelper"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/service"
+)
+
+type memoryIdempotencyRepository struct {
+	mu     sync.Mutex
+	nextID uint
+	keys   map[string]domain.IdempotencyKey
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{keys: map[string]domain.IdempotencyKey{}}
+}
+
+func (r *memoryIdempotencyRepository) index(userID uint, key string) string {
+	return fmt.Sprintf("%d/%s", userID, key)
+}
+
+func (r *memoryIdempotencyRepository) Create(_ context.Context, key domain.IdempotencyKey) (domain.IdempotencyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[r.index(key.UserID, key.Key)]; ok {
+		return domain.IdempotencyKey{}, repository.ErrIdempotencyKeyExists
+	}
+
+	r.nextID++
+	key.ID = r.nextID
+	r.keys[r.index(key.UserID, key.Key)] = key
+
+	return key, nil
+}
+
+func (r *memoryIdempotencyRepository) FindByUserAndKey(_ context.Context, userID uint, key string) (domain.IdempotencyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found, ok := r.keys[r.index(userID, key)]
+	if !ok {
+		return domain.IdempotencyKey{}, repository.ErrIdempotencyKeyNotFound
+	}
+
+	return found, nil
+}
+
+func (r *memoryIdempotencyRepository) Complete(_ context.Context, id uint, statusCode int, responseBody []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, v := range r.keys {
+		if v.ID == id {
+			now := time.Now()
+			v.StatusCode = statusCode
+			v.ResponseBody = responseBody
+			v.CompletedAt = &now
+			r.keys[k] = v
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) Delete(_ context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, v := range r.keys {
+		if v.ID == id {
+			delete(r.keys, k)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) DeleteExpired(_ context.Context, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for k, v := range r.keys {
+		if !v.ExpiresAt.After(now) {
+			delete(r.keys, k)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func newIdempotencyTestRouter(ttl time.Duration, calls *int, status int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	store := service.NewIdempotencyService(newMemoryIdempotencyRepository(), ttl)
+	withClaims := func(ctx *gin.Context) {
+		ctx.Set("claims", &jwthelper.Claims{UserID: 1})
+	}
+
+	router.POST("/purchase", withClaims, NewIdempotency(store).Handle(), func(ctx *gin.Context) {
+		*calls++
+		ctx.JSON(status, gin.H{"call": *calls})
+	})
+
+	return router
+}
+
+func sendIdempotent(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/purchase", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestIdempotency_Handle(t *testing.T) {
+	t.Run("replays the original response for a duplicate request", func(t *testing.T) {
+		var calls int
+		router := newIdempotencyTestRouter(time.Hour, &calls, http.StatusCreated)
+
+		first := sendIdempotent(router, "key-1", `{"amount":10}`)
+		second := sendIdempotent(router, "key-1", `{"amount":10}`)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusCreated, first.Code)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.JSONEq(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("rejects a reused key with a different body", func(t *testing.T) {
+		var calls int
+		router := newIdempotencyTestRouter(time.Hour, &calls, http.StatusCreated)
+
+		sendIdempotent(router, "key-1", `{"amount":10}`)
+		second := sendIdempotent(router, "key-1", `{"amount":20}`)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusUnprocessableEntity, second.Code)
+	})
+
+	t.Run("executes requests without a key every time", func(t *testing.T) {
+		var calls int
+		router := newIdempotencyTestRouter(time.Hour, &calls, http.StatusCreated)
+
+		sendIdempotent(router, "", `{"amount":10}`)
+		sendIdempotent(router, "", `{"amount":10}`)
+
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("releases the key after a server error", func(t *testing.T) {
+		var calls int
+		router := newIdempotencyTestRouter(time.Hour, &calls, http.StatusInternalServerError)
+
+		sendIdempotent(router, "key-1", `{"amount":10}`)
+		sendIdempotent(router, "key-1", `{"amount":10}`)
+
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("releases the key after a panic", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.Use(gin.CustomRecovery(func(ctx *gin.Context, _ any) {
+			ctx.AbortWithStatus(http.StatusInternalServerError)
+		}))
+
+		var calls int
+		store := service.NewIdempotencyService(newMemoryIdempotencyRepository(), time.Hour)
+		withClaims := func(ctx *gin.Context) {
+			ctx.Set("claims", &jwthelper.Claims{UserID: 1})
+		}
+		router.POST("/purchase", withClaims, NewIdempotency(store).Handle(), func(ctx *gin.Context) {
+			calls++
+			if calls == 1 {
+				panic("boom")
+			}
+			ctx.JSON(http.StatusCreated, gin.H{"call": calls})
+		})
+
+		first := sendIdempotent(router, "key-1", `{"amount":10}`)
+		second := sendIdempotent(router, "key-1", `{"amount":10}`)
+
+		assert.Equal(t, http.StatusInternalServerError, first.Code)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("executes the request again once the key expired", func(t *testing.T) {
+		var calls int
+		router := newIdempotencyTestRouter(time.Nanosecond, &calls, http.StatusCreated)
+
+		sendIdempotent(router, "key-1", `{"amount":10}`)
+		time.Sleep(time.Millisecond)
+		second := sendIdempotent(router, "key-1", `{"amount":20}`)
+
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, http.StatusCreated, second.Code)
+	})
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
 	swaggerfiles "github.com/swaggo/files"
@@ -11,6 +13,8 @@ import (
 	v1 "github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/middleware"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/config"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/mail"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/payment"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/service"
@@ -19,6 +23,11 @@ import (
 type Server struct {
 	Config *config.AppConfig
 	Router *gin.Engine
+
+	// kermesses runs the background jobs of the kermesses.
+	kermesses *service.KermesseService
+	// idempotencyKeys backs the idempotency middleware and sweeps its keys.
+	idempotencyKeys *service.IdempotencyService
 }
 
 func NewServer(conf *config.AppConfig, db *gorm.DB) *Server {
@@ -36,7 +45,11 @@ func NewServer(conf *config.AppConfig, db *gorm.DB) *Server {
 	userHandler := s.initUserHandler(db)
 	kermesseHandler := s.initKermesseHandler(db)
 	chatHandler := s.initChatHandler(db)
-	s.MountHandlers(authHandler, userHandler, kermesseHandler, chatHandler)
+	s.idempotencyKeys = s.initIdempotencyService(db)
+	idempotency := middleware.NewIdempotency(s.idempotencyKeys)
+	s.MountHandlers(authHandler, userHandler, kermesseHandler, chatHandler, idempotency)
+
+	s.kermesses = s.initKermesseService(db)
 
 	return s
 }
@@ -65,7 +78,7 @@ func (s *Server) initChatHandler(db *gorm.DB) *v1.ChatHandler {
 	userRepo := repository.NewUserRepository(dao.NewUserDAO(db))
 	repo := repository.NewKermesseRepository(kermesseDAO, userRepo)
 	uSvc := service.NewUserService(repository.NewUserRepository(dao.NewUserDAO(db)))
-	svc := service.NewKermesseService(repo, userRepo, s.Config.Stripe)
+	svc := service.NewKermesseService(repo, userRepo, s.initPaymentProvider(), s.Config.API.RefundWindow, s.paymentRequestSettings(), s.offlineAllowanceSettings(), s.Config.API.StockReservationTTL, s.initMailer(), s.Config.API.StandInvitationTTL)
 	handler := v1.NewChatHandler(svc, uSvc)
 
 	return handler
@@ -77,13 +90,65 @@ func (s *Server) initKermesseHandler(db *gorm.DB) *v1.KermesseHandler {
 
 	userRepo := repository.NewUserRepository(dao.NewUserDAO(db))
 	repo := repository.NewKermesseRepository(kermesseDAO, userRepo)
-	svc := service.NewKermesseService(repo, userRepo, s.Config.Stripe)
+	svc := service.NewKermesseService(repo, userRepo, s.initPaymentProvider(), s.Config.API.RefundWindow, s.paymentRequestSettings(), s.offlineAllowanceSettings(), s.Config.API.StockReservationTTL, s.initMailer(), s.Config.API.StandInvitationTTL)
 	uSvc := service.NewUserService(repository.NewUserRepository(dao.NewUserDAO(db)))
 	handler := v1.NewKermesseHandler(svc, uSvc)
 
 	return handler
 }
 
+func (s *Server) initKermesseService(db *gorm.DB) *service.KermesseService {
+	userRepo := repository.NewUserRepository(dao.NewUserDAO(db))
+	repo := repository.NewKermesseRepository(dao.NewKermesseDao(db), userRepo)
+
+	return service.NewKermesseService(repo, userRepo, s.initPaymentProvider(), s.Config.API.RefundWindow, s.paymentRequestSettings(), s.offlineAllowanceSettings(), s.Config.API.StockReservationTTL, s.initMailer(), s.Config.API.StandInvitationTTL)
+}
+
+// StartBackgroundJobs starts the jobs running beside the API until ctx is
+// done: the release of expired stock reservations and the deletion of expired
+// idempotency keys.
+func (s *Server) StartBackgroundJobs(ctx context.Context) {
+	go s.kermesses.SweepReservations(ctx, s.Config.API.ReservationSweepInterval)
+	go s.idempotencyKeys.SweepExpired(ctx, s.Config.API.IdempotencySweepInterval)
+}
+
+func (s *Server) initPaymentProvider() service.PaymentProvider {
+	if s.Config.Payments != nil && s.Config.Payments.Provider == config.PaymentProviderFake {
+		return payment.NewFakeProvider()
+	}
+
+	return payment.NewStripeProvider(s.Config.Stripe)
+}
+
+func (s *Server) initMailer() service.Mailer {
+	if s.Config.Mail != nil && s.Config.Mail.Provider == config.MailProviderSMTP {
+		return mail.NewSMTPMailer(s.Config.Mail)
+	}
+
+	return mail.NewLogMailer()
+}
+
+func (s *Server) paymentRequestSettings() service.PaymentRequestSettings {
+	return service.PaymentRequestSettings{
+		Key: s.Config.API.PaymentRequestKey(),
+		TTL: s.Config.API.PaymentRequestTTL,
+	}
+}
+
+func (s *Server) offlineAllowanceSettings() service.OfflineAllowanceSettings {
+	return service.OfflineAllowanceSettings{
+		Key: s.Config.API.OfflineAllowanceKey(),
+		TTL: s.Config.API.OfflineAllowanceTTL,
+	}
+}
+
+func (s *Server) initIdempotencyService(db *gorm.DB) *service.IdempotencyService {
+	idempotencyDAO := dao.NewIdempotencyDAO(db)
+	repo := repository.NewIdempotencyRepository(idempotencyDAO)
+
+	return service.NewIdempotencyService(repo, s.Config.API.IdempotencyTTL)
+}
+
 func (s *Server) MountMiddlewares() {
 	// Logger and Recovery are needed unless we use gin.Default().
 	s.Router.Use(gin.Logger())
@@ -92,7 +157,7 @@ func (s *Server) MountMiddlewares() {
 	s.Router.Use(middleware.ConfigCORS(s.Config.API.AllowedCORSDomains))
 }
 
-func (s *Server) MountHandlers(authHandler *v1.AuthHandler, userHandler *v1.UserHandler, kermesseHandler *v1.KermesseHandler, chatHandler *v1.ChatHandler) {
+func (s *Server) MountHandlers(authHandler *v1.AuthHandler, userHandler *v1.UserHandler, kermesseHandler *v1.KermesseHandler, chatHandler *v1.ChatHandler, idempotency *middleware.Idempotency) {
 	const basePath = "/api/v1"
 
 	auth := s.Router.Group(basePath)
@@ -105,6 +170,7 @@ func (s *Server) MountHandlers(authHandler *v1.AuthHandler, userHandler *v1.User
 	{
 		users.GET("/users/:userID", userHandler.HandleGetUser)
 		users.GET("/me", userHandler.HandleGetMe)
+		users.PUT("/students/:studentID/pos-settings", userHandler.HandleUpdateStudentPOSSettings)
 	}
 
 	kermesses := s.Router.Group(basePath, middleware.NewAuthenticator(s.Config.API.JWTSigningKey).VerifyJWT())
@@ -113,13 +179,57 @@ func (s *Server) MountHandlers(authHandler *v1.AuthHandler, userHandler *v1.User
 		kermesses.GET("/kermesses/:kermesseID/participate", kermesseHandler.HandleKermesseParticipation)
 		kermesses.GET("/kermesses/:kermesseID/stand", kermesseHandler.HandleGetStands)
 		kermesses.GET("/children_transactions", kermesseHandler.HandleGetChildrenTransactions)
+		kermesses.GET("/me/transactions", kermesseHandler.HandleGetMyTransactions)
+		kermesses.GET("/me/notifications", kermesseHandler.HandleGetNotifications)
+		kermesses.GET("/kermesses/:kermesseID/transactions", kermesseHandler.HandleGetKermesseTransactions)
+		kermesses.GET("/kermesses/:kermesseID/statement", kermesseHandler.HandleGetFamilyStatement)
+		kermesses.GET("/kermesses/:kermesseID/ledger/audit", kermesseHandler.HandleAuditLedger)
 		kermesses.POST("/kermesses", kermesseHandler.HandleCreateKermesse)
 		kermesses.POST("/kermesses/:kermesseID/stand", kermesseHandler.HandleCreateStand)
-		kermesses.POST("/kermesses/:kermesseID/token/purchase", kermesseHandler.HandleTokenPurchase)
-		kermesses.POST("/token/transferToChild", kermesseHandler.HandleParentSendTokensToChild)
-		kermesses.POST("/kermesses/:kermesseID/stand/:standID/purchase", kermesseHandler.HandleStandPurchase)
+		kermesses.POST("/kermesses/:kermesseID/token/purchase", idempotency.Handle(), kermesseHandler.HandleTokenPurchase)
+		kermesses.POST("/kermesses/:kermesseID/token/cash-purchase", idempotency.Handle(), kermesseHandler.HandleCashTokenPurchase)
+		kermesses.GET("/kermesses/:kermesseID/token/pending", kermesseHandler.HandleGetPendingTokenPurchases)
+		kermesses.POST("/kermesses/:kermesseID/token/transactions/:transactionID/approve", idempotency.Handle(), kermesseHandler.HandleApproveTokenPurchase)
+		kermesses.POST("/kermesses/:kermesseID/token/transactions/:transactionID/reject", idempotency.Handle(), kermesseHandler.HandleRejectTokenPurchase)
+		kermesses.POST("/kermesses/:kermesseID/token/transactions/:transactionID/refund", idempotency.Handle(), kermesseHandler.HandleRefundPurchase)
+		kermesses.POST("/kermesses/:kermesseID/publish", kermesseHandler.HandlePublishKermesse)
+		kermesses.POST("/kermesses/:kermesseID/open", kermesseHandler.HandleOpenKermesse)
+		kermesses.POST("/kermesses/:kermesseID/close", kermesseHandler.HandleCloseKermesse)
+		kermesses.POST("/kermesses/:kermesseID/archive", kermesseHandler.HandleArchiveKermesse)
+		kermesses.POST("/kermesses/:kermesseID/cancel", idempotency.Handle(), kermesseHandler.HandleCancelKermesse)
+		kermesses.PATCH("/kermesses/:kermesseID", kermesseHandler.HandleUpdateKermesse)
+		kermesses.POST("/kermesses/:kermesseID/refunds", idempotency.Handle(), kermesseHandler.HandleRunKermesseRefunds)
+		kermesses.GET("/kermesses/:kermesseID/refunds", kermesseHandler.HandleGetRefundReport)
+		kermesses.POST("/token/transferToChild", idempotency.Handle(), kermesseHandler.HandleParentSendTokensToChild)
+		kermesses.GET("/kermesses/:kermesseID/stand/:standID", kermesseHandler.HandleGetStand)
+		kermesses.PATCH("/kermesses/:kermesseID/stand/:standID", kermesseHandler.HandleUpdateStand)
+		kermesses.DELETE("/kermesses/:kermesseID/stand/:standID", kermesseHandler.HandleArchiveStand)
+		kermesses.POST("/kermesses/:kermesseID/stand/:standID/purchase", idempotency.Handle(), kermesseHandler.HandleStandPurchase)
+		kermesses.POST("/kermesses/:kermesseID/stand/:standID/checkout", idempotency.Handle(), kermesseHandler.HandleStandCheckout)
+		kermesses.POST("/kermesses/:kermesseID/stand/:standID/charges", idempotency.Handle(), kermesseHandler.HandleCreateCharge)
+		kermesses.POST("/kermesses/:kermesseID/charges/:transactionID/confirm", idempotency.Handle(), kermesseHandler.HandleConfirmCharge)
+		kermesses.POST("/kermesses/:kermesseID/charges/:transactionID/decline", idempotency.Handle(), kermesseHandler.HandleDeclineCharge)
+		kermesses.POST("/kermesses/:kermesseID/stand/:standID/payment-requests", kermesseHandler.HandleCreatePaymentRequest)
+		kermesses.GET("/kermesses/:kermesseID/payment-requests/qr", kermesseHandler.HandlePaymentRequestQRCode)
+		kermesses.POST("/kermesses/:kermesseID/payment-requests/pay", idempotency.Handle(), kermesseHandler.HandlePayPaymentRequest)
+		kermesses.POST("/kermesses/:kermesseID/offline-allowances", kermesseHandler.HandleIssueOfflineAllowance)
+		kermesses.POST("/kermesses/:kermesseID/stand/:standID/offline-vouchers", idempotency.Handle(), kermesseHandler.HandleReconcileOfflineVouchers)
+		kermesses.POST("/kermesses/:kermesseID/stand/:standID/promotions", kermesseHandler.HandleCreatePromotion)
+		kermesses.GET("/kermesses/:kermesseID/stand/:standID/promotions", kermesseHandler.HandleGetPromotions)
+		kermesses.DELETE("/kermesses/:kermesseID/stand/:standID/promotions/:promotionID", kermesseHandler.HandleDeactivatePromotion)
+		kermesses.POST("/kermesses/:kermesseID/stand/:standID/reservations", idempotency.Handle(), kermesseHandler.HandleReserveStock)
+		kermesses.DELETE("/kermesses/:kermesseID/reservations/:reservationID", kermesseHandler.HandleReleaseReservation)
 		kermesses.POST("/kermesses/:kermesseID/stand/:standID/stock/update", kermesseHandler.HandleUpdateStock)
 		kermesses.POST("/kermesses/:kermesseID/stand/:standID/stock", kermesseHandler.HandleCreateStock)
+		kermesses.GET("/kermesses/:kermesseID/stand/:standID/stock/movements", kermesseHandler.HandleGetStockAudit)
+		kermesses.GET("/kermesses/:kermesseID/stand/:standID/stock/:stockID", kermesseHandler.HandleGetStandStock)
+		kermesses.PATCH("/kermesses/:kermesseID/stand/:standID/stock/:stockID", kermesseHandler.HandleUpdateStandStock)
+		kermesses.DELETE("/kermesses/:kermesseID/stand/:standID/stock/:stockID", kermesseHandler.HandleArchiveStandStock)
+		kermesses.GET("/kermesses/:kermesseID/stand/:standID/staff", kermesseHandler.HandleGetStandStaff)
+		kermesses.POST("/kermesses/:kermesseID/stand/:standID/staff/invitations", kermesseHandler.HandleInviteStandStaff)
+		kermesses.DELETE("/kermesses/:kermesseID/stand/:standID/staff/:userID", kermesseHandler.HandleRemoveStandStaff)
+		kermesses.POST("/stand-invitations/accept", kermesseHandler.HandleAcceptStandInvitation)
+		kermesses.GET("/kermesses/:kermesseID/stock/low", kermesseHandler.HandleGetLowStockItems)
 		kermesses.POST("/kermesses/:kermesseID/stands/:standID/attribute-points", kermesseHandler.HandleAttributePointsToStudent)
 		//kermesses.POST("/kermesses/:kermesseID/transaction/:transactionID", kermesseHandler.HandleValidatePurchase)
 		// Chat
@@ -128,6 +238,11 @@ func (s *Server) MountHandlers(authHandler *v1.AuthHandler, userHandler *v1.User
 
 	}
 
+	webhooks := s.Router.Group(basePath)
+	{
+		webhooks.POST("/webhooks/stripe", kermesseHandler.HandleStripeWebhook)
+	}
+
 	s.Router.GET("/", v1.HandleHealthcheck)
 
 	// Setup Swagger UI.
@@ -1,29 +1,109 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"fmt"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	validation "github.com/go-ozzo/ozzo-validation"
 )
 
+const (
+	defaultIdempotencyTTL           = 24 * time.Hour
+	defaultIdempotencySweepInterval = 10 * time.Minute
+	defaultRefundWindow             = 30 * time.Minute
+
+	defaultPaymentRequestTTL   = 5 * time.Minute
+	defaultOfflineAllowanceTTL = 12 * time.Hour
+
+	defaultStockReservationTTL      = 10 * time.Minute
+	defaultReservationSweepInterval = time.Minute
+
+	defaultStandInvitationTTL = 7 * 24 * time.Hour
+)
+
+const (
+	PaymentProviderStripe = "stripe"
+	PaymentProviderFake   = "fake"
+)
+
+const (
+	MailProviderLog  = "log"
+	MailProviderSMTP = "smtp"
+)
+
 type AppConfig struct {
 	API      *APIConfig      `mapstructure:"API"`
 	Gin      *GinConfig      `mapstructure:"GIN"`
 	Postgres *PostgresConfig `mapstructure:"POSTGRES"`
 	Stripe   *StripeConfig   `mapstructure:"STRIPE"`
+	Payments *PaymentsConfig `mapstructure:"PAYMENTS"`
+	Mail     *MailConfig     `mapstructure:"MAIL"`
 }
 
 func (c *AppConfig) validate() error {
+	// Stripe credentials are only needed when payments go through Stripe.
+	var stripeRules []validation.Rule
+	if c.Payments == nil || c.Payments.Provider == PaymentProviderStripe {
+		stripeRules = append(stripeRules, validation.Required)
+	}
+
 	return validation.ValidateStruct(
 		c,
 		validation.Field(&c.API, validation.Required),
 		validation.Field(&c.Gin, validation.Required),
 		validation.Field(&c.Postgres, validation.Required),
-		validation.Field(&c.Stripe, validation.Required),
+		validation.Field(&c.Stripe, stripeRules...),
 	)
 }
 
+func (c *AppConfig) setDefaults() {
+	if c == nil {
+		return
+	}
+
+	if c.API != nil && c.API.IdempotencyTTL == 0 {
+		c.API.IdempotencyTTL = defaultIdempotencyTTL
+	}
+	if c.API != nil && c.API.IdempotencySweepInterval == 0 {
+		c.API.IdempotencySweepInterval = defaultIdempotencySweepInterval
+	}
+	if c.API != nil && c.API.RefundWindow == 0 {
+		c.API.RefundWindow = defaultRefundWindow
+	}
+	if c.API != nil && c.API.PaymentRequestTTL == 0 {
+		c.API.PaymentRequestTTL = defaultPaymentRequestTTL
+	}
+	if c.API != nil && c.API.OfflineAllowanceTTL == 0 {
+		c.API.OfflineAllowanceTTL = defaultOfflineAllowanceTTL
+	}
+	if c.API != nil && c.API.StockReservationTTL == 0 {
+		c.API.StockReservationTTL = defaultStockReservationTTL
+	}
+	if c.API != nil && c.API.ReservationSweepInterval == 0 {
+		c.API.ReservationSweepInterval = defaultReservationSweepInterval
+	}
+	if c.API != nil && c.API.StandInvitationTTL == 0 {
+		c.API.StandInvitationTTL = defaultStandInvitationTTL
+	}
+
+	if c.Payments == nil {
+		c.Payments = &PaymentsConfig{}
+	}
+	if c.Payments.Provider == "" {
+		c.Payments.Provider = PaymentProviderStripe
+	}
+
+	if c.Mail == nil {
+		c.Mail = &MailConfig{}
+	}
+	if c.Mail.Provider == "" {
+		c.Mail.Provider = MailProviderLog
+	}
+}
+
 func (c *AppConfig) validateConfig() error {
 	if err := c.validate(); err != nil {
 		return fmt.Errorf("c.validate() -> %w", err)
@@ -41,19 +121,40 @@ func (c *AppConfig) validateConfig() error {
 		return fmt.Errorf("c.Postgres.validate() -> %w", err)
 	}
 
-	if err := c.Stripe.validate(); err != nil {
-		return fmt.Errorf("c.Stripe.validate() -> %w", err)
+	if err := c.Payments.validate(); err != nil {
+		return fmt.Errorf("c.Payments.validate() -> %w", err)
+	}
+
+	if c.Payments.Provider == PaymentProviderStripe {
+		if err := c.Stripe.validate(); err != nil {
+			return fmt.Errorf("c.Stripe.validate() -> %w", err)
+		}
+	}
+
+	if err := c.Mail.validate(); err != nil {
+		return fmt.Errorf("c.Mail.validate() -> %w", err)
 	}
 
 	return nil
 }
 
 type APIConfig struct {
-	Environment        string   `mapstructure:"ENV"`
-	Port               string   `mapstructure:"PORT"`
-	BaseURL            string   `mapstructure:"BASE_URL"`
-	AllowedCORSDomains []string `mapstructure:"ALLOWED_CORS_DOMAINS"`
-	JWTSigningKey      string   `mapstructure:"JWT_SIGNING_KEY"`
+	Environment        string        `mapstructure:"ENV"`
+	Port               string        `mapstructure:"PORT"`
+	BaseURL            string        `mapstructure:"BASE_URL"`
+	AllowedCORSDomains []string      `mapstructure:"ALLOWED_CORS_DOMAINS"`
+	JWTSigningKey      string        `mapstructure:"JWT_SIGNING_KEY"`
+	IdempotencyTTL     time.Duration `mapstructure:"IDEMPOTENCY_TTL"` // How long Idempotency-Key responses are kept.
+	RefundWindow       time.Duration `mapstructure:"REFUND_WINDOW"`   // How long after a stand purchase it can be refunded.
+
+	IdempotencySweepInterval time.Duration `mapstructure:"IDEMPOTENCY_SWEEP_INTERVAL"` // How often expired Idempotency-Key responses are deleted.
+
+	PaymentRequestSigningKey string        `mapstructure:"PAYMENT_REQUEST_SIGNING_KEY"` // Optional, derived from JWTSigningKey when empty.
+	PaymentRequestTTL        time.Duration `mapstructure:"PAYMENT_REQUEST_TTL"`         // How long a stand's payment request can be paid.
+	OfflineAllowanceTTL      time.Duration `mapstructure:"OFFLINE_ALLOWANCE_TTL"`       // How long a student's app can sign offline vouchers.
+	StockReservationTTL      time.Duration `mapstructure:"STOCK_RESERVATION_TTL"`       // How long a stock reservation holds items.
+	ReservationSweepInterval time.Duration `mapstructure:"RESERVATION_SWEEP_INTERVAL"`  // How often expired stock reservations are released.
+	StandInvitationTTL       time.Duration `mapstructure:"STAND_INVITATION_TTL"`        // How long an invitation to the staff of a stand can be accepted.
 }
 
 func (c *APIConfig) validate() error {
@@ -63,9 +164,42 @@ func (c *APIConfig) validate() error {
 		validation.Field(&c.Port, validation.Required),
 		validation.Field(&c.BaseURL, validation.Required),
 		validation.Field(&c.JWTSigningKey, validation.Required),
+		validation.Field(&c.IdempotencyTTL, validation.Min(time.Second)),
+		validation.Field(&c.IdempotencySweepInterval, validation.Min(time.Second)),
+		validation.Field(&c.RefundWindow, validation.Min(time.Second)),
+		validation.Field(&c.PaymentRequestTTL, validation.Min(time.Second)),
+		validation.Field(&c.OfflineAllowanceTTL, validation.Min(time.Second)),
+		validation.Field(&c.StockReservationTTL, validation.Min(time.Second)),
+		validation.Field(&c.ReservationSweepInterval, validation.Min(time.Second)),
+		validation.Field(&c.StandInvitationTTL, validation.Min(time.Second)),
 	)
 }
 
+// PaymentRequestKey returns the key signing payment requests. Without a
+// dedicated key it is derived from the JWT signing key, so that a leaked
+// payment request key can't forge JWTs and the other way round.
+func (c *APIConfig) PaymentRequestKey() []byte {
+	if c.PaymentRequestSigningKey != "" {
+		return []byte(c.PaymentRequestSigningKey)
+	}
+
+	return c.deriveKey("payment-requests")
+}
+
+// OfflineAllowanceKey returns the key the secrets of offline spending
+// allowances are derived from.
+func (c *APIConfig) OfflineAllowanceKey() []byte {
+	return c.deriveKey("offline-allowances")
+}
+
+// deriveKey derives a key for purpose from the JWT signing key.
+func (c *APIConfig) deriveKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(c.JWTSigningKey))
+	mac.Write([]byte(purpose))
+
+	return mac.Sum(nil)
+}
+
 type GinConfig struct {
 	Mode string `mapstructure:"MODE"`
 }
@@ -84,13 +218,51 @@ func (c *GinConfig) validate() error {
 }
 
 type StripeConfig struct {
-	SecretKey string `mapstructure:"SECRET_KEY"`
+	SecretKey     string `mapstructure:"SECRET_KEY"`
+	WebhookSecret string `mapstructure:"WEBHOOK_SECRET"` // Signing secret of the webhook endpoint.
 }
 
 func (c *StripeConfig) validate() error {
 	return validation.ValidateStruct(
 		c,
 		validation.Field(&c.SecretKey, validation.Required),
+		validation.Field(&c.WebhookSecret, validation.Required),
+	)
+}
+
+type PaymentsConfig struct {
+	Provider string `mapstructure:"PROVIDER"` // "stripe" (default) or "fake"
+}
+
+func (c *PaymentsConfig) validate() error {
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.Provider, validation.Required, validation.In(PaymentProviderStripe, PaymentProviderFake)),
+	)
+}
+
+type MailConfig struct {
+	Provider string `mapstructure:"PROVIDER"` // "log" (default) or "smtp"
+	Host     string `mapstructure:"HOST"`
+	Port     string `mapstructure:"PORT"`
+	Username string `mapstructure:"USERNAME"` // Optional, for servers that need authentication.
+	Password string `mapstructure:"PASSWORD"`
+	From     string `mapstructure:"FROM"`
+}
+
+func (c *MailConfig) validate() error {
+	// The SMTP server is only needed when emails are actually sent.
+	var smtpRules []validation.Rule
+	if c.Provider == MailProviderSMTP {
+		smtpRules = append(smtpRules, validation.Required)
+	}
+
+	return validation.ValidateStruct(
+		c,
+		validation.Field(&c.Provider, validation.Required, validation.In(MailProviderLog, MailProviderSMTP)),
+		validation.Field(&c.Host, smtpRules...),
+		validation.Field(&c.Port, smtpRules...),
+		validation.Field(&c.From, smtpRules...),
 	)
 }
 
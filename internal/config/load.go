@@ -23,6 +23,8 @@ func Load(configFile string) (*AppConfig, error) {
 		return nil, fmt.Errorf("viper.Unmarshal -> %w", err)
 	}
 
+	conf.setDefaults()
+
 	if err := conf.validateConfig(); err != nil {
 		return nil, fmt.Errorf("conf.validateConfig -> %w", err)
 	}
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -24,6 +25,9 @@ const (
 	postgresPassword = "pass123"
 	postgresDB       = "testDB"
 	postgresLogLevel = "error"
+
+	stripeSecretKey     = "sk_test_key"
+	stripeWebhookSecret = "whsec_test_secret"
 )
 
 func TestLoad(t *testing.T) {
@@ -48,11 +52,19 @@ func TestLoad(t *testing.T) {
 			},
 			want: &AppConfig{
 				API: &APIConfig{
-					Environment:        apiENV,
-					Port:               apiPort,
-					BaseURL:            apiBaseURL,
-					AllowedCORSDomains: strings.Split(apiAllowedCORSDomains, ","),
-					JWTSigningKey:      apiJWTSigningKey,
+					Environment:              apiENV,
+					Port:                     apiPort,
+					BaseURL:                  apiBaseURL,
+					AllowedCORSDomains:       strings.Split(apiAllowedCORSDomains, ","),
+					JWTSigningKey:            apiJWTSigningKey,
+					IdempotencyTTL:           24 * time.Hour,
+					IdempotencySweepInterval: 10 * time.Minute,
+					RefundWindow:             30 * time.Minute,
+					PaymentRequestTTL:        5 * time.Minute,
+					OfflineAllowanceTTL:      12 * time.Hour,
+					StockReservationTTL:      10 * time.Minute,
+					ReservationSweepInterval: time.Minute,
+					StandInvitationTTL:       7 * 24 * time.Hour,
 				},
 				Gin: &GinConfig{
 					Mode: ginMode,
@@ -65,6 +77,16 @@ func TestLoad(t *testing.T) {
 					DB:       postgresDB,
 					LogLevel: postgresLogLevel,
 				},
+				Stripe: &StripeConfig{
+					SecretKey:     stripeSecretKey,
+					WebhookSecret: stripeWebhookSecret,
+				},
+				Payments: &PaymentsConfig{
+					Provider: PaymentProviderStripe,
+				},
+				Mail: &MailConfig{
+					Provider: MailProviderLog,
+				},
 			},
 			wantErr:    false,
 			wantErrMsg: "",
@@ -77,7 +99,7 @@ func TestLoad(t *testing.T) {
 			},
 			want:       nil,
 			wantErr:    true,
-			wantErrMsg: "conf.validateConfig -> c.validate() -> API: cannot be blank; Gin: cannot be blank; Postgres: cannot be blank.",
+			wantErrMsg: "conf.validateConfig -> c.validate() -> API: cannot be blank; Gin: cannot be blank; Postgres: cannot be blank; Stripe: cannot be blank.",
 		},
 		{
 			name:     "Invalid YAML file",
@@ -114,6 +136,142 @@ func TestLoad(t *testing.T) {
 			wantErr:    true,
 			wantErrMsg: `conf.validateConfig -> c.API.validate() -> Port: cannot be blank.`,
 		},
+		{
+			name: "Custom idempotency TTL",
+			setupENV: func() {
+				setENVs(t)
+
+				err := os.Setenv("API_IDEMPOTENCY_TTL", "30m")
+				require.NoError(t, err)
+			},
+			args: args{
+				configFile: "testdata/good.yml",
+			},
+			want: &AppConfig{
+				API: &APIConfig{
+					Environment:              apiENV,
+					Port:                     apiPort,
+					BaseURL:                  apiBaseURL,
+					AllowedCORSDomains:       strings.Split(apiAllowedCORSDomains, ","),
+					JWTSigningKey:            apiJWTSigningKey,
+					IdempotencyTTL:           30 * time.Minute,
+					IdempotencySweepInterval: 10 * time.Minute,
+					RefundWindow:             30 * time.Minute,
+					PaymentRequestTTL:        5 * time.Minute,
+					OfflineAllowanceTTL:      12 * time.Hour,
+					StockReservationTTL:      10 * time.Minute,
+					ReservationSweepInterval: time.Minute,
+					StandInvitationTTL:       7 * 24 * time.Hour,
+				},
+				Gin: &GinConfig{
+					Mode: ginMode,
+				},
+				Postgres: &PostgresConfig{
+					Host:     postgresHost,
+					Port:     postgresPort,
+					User:     postgresUsername,
+					Password: postgresPassword,
+					DB:       postgresDB,
+					LogLevel: postgresLogLevel,
+				},
+				Stripe: &StripeConfig{
+					SecretKey:     stripeSecretKey,
+					WebhookSecret: stripeWebhookSecret,
+				},
+				Payments: &PaymentsConfig{
+					Provider: PaymentProviderStripe,
+				},
+				Mail: &MailConfig{
+					Provider: MailProviderLog,
+				},
+			},
+			wantErr:    false,
+			wantErrMsg: "",
+		},
+		{
+			name: "Fake payment provider without Stripe credentials",
+			setupENV: func() {
+				setENVs(t)
+
+				err := os.Unsetenv("STRIPE_SECRET_KEY")
+				require.NoError(t, err)
+
+				err = os.Unsetenv("STRIPE_WEBHOOK_SECRET")
+				require.NoError(t, err)
+
+				err = os.Setenv("PAYMENTS_PROVIDER", PaymentProviderFake)
+				require.NoError(t, err)
+			},
+			args: args{
+				configFile: "testdata/good.yml",
+			},
+			want: &AppConfig{
+				API: &APIConfig{
+					Environment:              apiENV,
+					Port:                     apiPort,
+					BaseURL:                  apiBaseURL,
+					AllowedCORSDomains:       strings.Split(apiAllowedCORSDomains, ","),
+					JWTSigningKey:            apiJWTSigningKey,
+					IdempotencyTTL:           24 * time.Hour,
+					IdempotencySweepInterval: 10 * time.Minute,
+					RefundWindow:             30 * time.Minute,
+					PaymentRequestTTL:        5 * time.Minute,
+					OfflineAllowanceTTL:      12 * time.Hour,
+					StockReservationTTL:      10 * time.Minute,
+					ReservationSweepInterval: time.Minute,
+					StandInvitationTTL:       7 * 24 * time.Hour,
+				},
+				Gin: &GinConfig{
+					Mode: ginMode,
+				},
+				Postgres: &PostgresConfig{
+					Host:     postgresHost,
+					Port:     postgresPort,
+					User:     postgresUsername,
+					Password: postgresPassword,
+					DB:       postgresDB,
+					LogLevel: postgresLogLevel,
+				},
+				Payments: &PaymentsConfig{
+					Provider: PaymentProviderFake,
+				},
+				Mail: &MailConfig{
+					Provider: MailProviderLog,
+				},
+			},
+			wantErr:    false,
+			wantErrMsg: "",
+		},
+		{
+			name: "Invalid Payments configs - unknown provider",
+			setupENV: func() {
+				setENVs(t)
+
+				err := os.Setenv("PAYMENTS_PROVIDER", "unknown")
+				require.NoError(t, err)
+			},
+			args: args{
+				configFile: "testdata/good.yml",
+			},
+			want:       nil,
+			wantErr:    true,
+			wantErrMsg: `conf.validateConfig -> c.Payments.validate() -> Provider: must be a valid value.`,
+		},
+		{
+			name: "Invalid Mail configs - SMTP without server",
+			setupENV: func() {
+				setENVs(t)
+
+				err := os.Setenv("MAIL_PROVIDER", MailProviderSMTP)
+				require.NoError(t, err)
+			},
+			args: args{
+				configFile: "testdata/good.yml",
+			},
+			want:       nil,
+			wantErr:    true,
+			wantErrMsg: `conf.validateConfig -> c.Mail.validate() -> From: cannot be blank; Host: cannot be blank; Port: cannot be blank.`,
+		},
 		{
 			name: "Invalid Gin configs - missing mode",
 			setupENV: func() {
@@ -197,6 +355,8 @@ func setENVs(t *testing.T) {
 		"POSTGRES_PASSWORD":        postgresPassword,
 		"POSTGRES_DB":              postgresDB,
 		"POSTGRES_LOG_LEVEL":       postgresLogLevel,
+		"STRIPE_SECRET_KEY":        stripeSecretKey,
+		"STRIPE_WEBHOOK_SECRET":    stripeWebhookSecret,
 	}
 
 	for k, v := range m {
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotificationLowStock          NotificationType = "low_stock"
+	NotificationKermesseUpdated   NotificationType = "kermesse_updated"
+	NotificationKermesseCancelled NotificationType = "kermesse_cancelled"
+)
+
+// Notification is a message stored for a user to read later.
+type Notification struct {
+	ID         uint             `json:"id"`
+	UserID     uint             `json:"user_id"`
+	KermesseID uint             `json:"kermesse_id"`
+	StandID    uint             `json:"stand_id,omitempty"` // Unset for kermesse-wide notifications.
+	Type       NotificationType `json:"type"`
+	Message    string           `json:"message"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+// LowStockItem is an item a stand is running low on.
+type LowStockItem struct {
+	StandID   uint   `json:"stand_id"`
+	StandName string `json:"stand_name"`
+	StockID   uint   `json:"stock_id"`
+	ItemName  string `json:"item_name"`
+	Quantity  int    `json:"quantity"`
+	Available int    `json:"available"`
+	Threshold int    `json:"threshold"`
+}
+
+func newLowStockItem(stand Stand, stock Stock) LowStockItem {
+	return LowStockItem{
+		StandID:   stand.ID,
+		StandName: stand.Name,
+		StockID:   stock.ID,
+		ItemName:  stock.ItemName,
+		Quantity:  stock.Quantity,
+		Available: stock.AvailableQuantity(),
+		Threshold: stock.LowStockThreshold,
+	}
+}
+
+// Message tells the stand's staff about the item.
+func (i LowStockItem) Message() string {
+	return fmt.Sprintf("Low stock at %s: %d %s left (alert threshold %d)", i.StandName, i.Quantity, i.ItemName, i.Threshold)
+}
+
+// LowStockItems returns the items the stands are running low on.
+func LowStockItems(stands []Stand) []LowStockItem {
+	items := []LowStockItem{}
+	for _, stand := range LiveStands(stands) {
+		for _, stock := range stand.Stock {
+			if stock.IsLow() {
+				items = append(items, newLowStockItem(stand, stock))
+			}
+		}
+	}
+
+	return items
+}
+
+// CrossedLowStock returns the items of stand that movements took from above
+// their low-stock threshold down to it or below, as they are after the
+// movements. Items already low before aren't alerted about again.
+func CrossedLowStock(stand Stand, movements []StockMovement) []LowStockItem {
+	thresholds := map[uint]Stock{}
+	for _, stock := range stand.Stock {
+		thresholds[stock.ID] = stock
+	}
+
+	var items []LowStockItem
+	for _, movement := range movements {
+		stock, ok := thresholds[movement.StockID]
+		if !ok || stock.LowStockThreshold <= 0 {
+			continue
+		}
+
+		before := movement.QuantityAfter - movement.Delta
+		if before > stock.LowStockThreshold && movement.QuantityAfter <= stock.LowStockThreshold {
+			stock.Quantity = movement.QuantityAfter
+			items = append(items, newLowStockItem(stand, stock))
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStock_IsLow(t *testing.T) {
+	assert.False(t, Stock{Quantity: 0}.IsLow())
+	assert.False(t, Stock{Quantity: 3, LowStockThreshold: 2}.IsLow())
+	assert.True(t, Stock{Quantity: 2, LowStockThreshold: 2}.IsLow())
+	assert.True(t, Stock{Quantity: 0, LowStockThreshold: 2}.IsLow())
+}
+
+func TestCrossedLowStock(t *testing.T) {
+	stand := Stand{
+		ID:   7,
+		Name: "Crêpes",
+		Stock: []Stock{
+			{ID: 11, ItemName: "Crêpe", Quantity: 10, LowStockThreshold: 3},
+			{ID: 12, ItemName: "Juice", Quantity: 5, LowStockThreshold: 2, Reserved: 1},
+			{ID: 13, ItemName: "Tea", Quantity: 5},
+		},
+	}
+
+	items := CrossedLowStock(stand, []StockMovement{
+		{StockID: 11, Delta: -2, QuantityAfter: 4},
+		{StockID: 12, Delta: -3, QuantityAfter: 2},
+		{StockID: 13, Delta: -5, QuantityAfter: 0},
+	})
+	assert.Equal(t, []LowStockItem{
+		{StandID: 7, StandName: "Crêpes", StockID: 12, ItemName: "Juice", Quantity: 2, Available: 1, Threshold: 2},
+	}, items)
+	assert.Equal(t, "Low stock at Crêpes: 2 Juice left (alert threshold 2)", items[0].Message())
+
+	// Items already low aren't alerted about again.
+	assert.Empty(t, CrossedLowStock(stand, []StockMovement{{StockID: 12, Delta: -1, QuantityAfter: 1}}))
+	assert.Len(t, CrossedLowStock(stand, []StockMovement{{StockID: 11, Delta: -1, QuantityAfter: 3}}), 1)
+}
+
+func TestLowStockItems(t *testing.T) {
+	stands := []Stand{
+		{ID: 7, Name: "Crêpes", Stock: []Stock{
+			{ID: 11, ItemName: "Crêpe", Quantity: 1, LowStockThreshold: 3},
+			{ID: 12, ItemName: "Juice", Quantity: 5, LowStockThreshold: 2},
+		}},
+		{ID: 8, Name: "Darts"},
+	}
+
+	assert.Equal(t, []LowStockItem{
+		{StandID: 7, StandName: "Crêpes", StockID: 11, ItemName: "Crêpe", Quantity: 1, Available: 1, Threshold: 3},
+	}, LowStockItems(stands))
+	assert.Empty(t, LowStockItems(nil))
+}
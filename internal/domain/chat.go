@@ -2,6 +2,10 @@ package domain
 
 import "time"
 
+// SystemSenderID is the sender of the messages the application posts to
+// stand chats itself, such as low-stock alerts.
+const SystemSenderID = 0
+
 type ChatMessage struct {
 	ID         uint      `json:"id"`
 	KermesseID uint      `json:"kermesse_id"`
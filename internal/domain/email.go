@@ -0,0 +1,8 @@
+package domain
+
+// Email is a plain text message sent to a single address.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
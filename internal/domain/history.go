@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor is returned for pagination cursors that were not issued
+// by the API.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	DefaultTransactionPageSize = 50
+	MaxTransactionPageSize     = 200
+)
+
+// TransactionFilter narrows down a transaction history. Zero values don't
+// filter.
+type TransactionFilter struct {
+	KermesseID uint
+	Types      []TokenTransactionType
+	Statuses   []string
+	StandID    uint
+	From       time.Time // Inclusive.
+	To         time.Time // Exclusive.
+	// Ascending lists the oldest transactions first, instead of the newest.
+	Ascending bool
+	Limit     int
+	// After resumes the history past the last transaction of a page.
+	After *TransactionCursor
+}
+
+// TransactionParty is one side of a transaction: a user or a stand.
+type TransactionParty struct {
+	Type string // "parent", "student" or "stand".
+	IDs  []uint
+}
+
+// TransactionScope is what part of the history a user may see: transactions
+// of the given kermesses, or with one of the given parties on either side.
+// An empty scope sees nothing.
+type TransactionScope struct {
+	KermesseIDs []uint
+	Parties     []TransactionParty
+}
+
+func (s TransactionScope) IsEmpty() bool {
+	for _, party := range s.Parties {
+		if len(party.IDs) > 0 {
+			return false
+		}
+	}
+
+	return len(s.KermesseIDs) == 0
+}
+
+// TransactionCursor points at the last transaction of a page. Transactions
+// are ordered by creation time then ID, so that pages stay stable while new
+// transactions come in.
+type TransactionCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"id"`
+}
+
+func (c TransactionCursor) Encode() string {
+	payload, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func ParseTransactionCursor(cursor string) (TransactionCursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return TransactionCursor{}, ErrInvalidCursor
+	}
+
+	var c TransactionCursor
+	if err := json.Unmarshal(payload, &c); err != nil || c.ID == 0 {
+		return TransactionCursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+type TransactionPage struct {
+	Transactions []TokenTransaction `json:"transactions"`
+	// NextCursor fetches the next page. It is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// InLocation returns the page with the times of its transactions in loc.
+func (p TransactionPage) InLocation(loc *time.Location) TransactionPage {
+	transactions := make([]TokenTransaction, len(p.Transactions))
+	for i, transaction := range p.Transactions {
+		transactions[i] = transaction.InLocation(loc)
+	}
+	p.Transactions = transactions
+
+	return p
+}
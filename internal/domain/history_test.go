@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionCursor(t *testing.T) {
+	cursor := TransactionCursor{
+		CreatedAt: time.Date(2024, 6, 1, 14, 30, 0, 123456000, time.UTC),
+		ID:        42,
+	}
+
+	got, err := ParseTransactionCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(got.CreatedAt))
+	assert.Equal(t, cursor.ID, got.ID)
+
+	for _, invalid := range []string{"", "not a cursor", "e30", cursor.Encode() + "!"} {
+		_, err := ParseTransactionCursor(invalid)
+		assert.ErrorIs(t, err, ErrInvalidCursor, invalid)
+	}
+}
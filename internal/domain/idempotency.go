@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyMismatch   = errors.New("idempotency key was already used for a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// IdempotencyKey remembers the outcome of a money-moving request so that a
+// retried request with the same Idempotency-Key header is answered without
+// being executed twice.
+type IdempotencyKey struct {
+	ID           uint       `json:"id"`
+	UserID       uint       `json:"user_id"`
+	Key          string     `json:"key"`
+	RequestHash  string     `json:"request_hash"`
+	StatusCode   int        `json:"status_code"`
+	ResponseBody []byte     `json:"-"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func (k IdempotencyKey) IsCompleted() bool {
+	return k.CompletedAt != nil
+}
@@ -1,24 +1,194 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// MaxTokensPerPurchase bounds a single token purchase.
+const MaxTokensPerPurchase = 10000
+
+var ErrInvalidTokenAmount = errors.New("invalid token amount")
+
+// ErrInvalidKermesseTransition is returned when organizers move a kermesse
+// to a status that doesn't follow its current one.
+var ErrInvalidKermesseTransition = errors.New("invalid kermesse status transition")
+
+// ErrInvalidSchedule is returned when a kermesse or stand would close before
+// it opens, or a stand would take sales outside the hours of its kermesse.
+var ErrInvalidSchedule = errors.New("invalid opening hours")
+
+// KermesseStatus is where a kermesse is in its lifecycle. Stands are set up
+// in draft, families join once it is published, tokens are bought and spent
+// while it is open, and closing it freezes balances for settlement. Until it
+// closes, organizers can cancel it instead, which settles it the same way.
+type KermesseStatus string
+
+const (
+	KermesseDraft     KermesseStatus = "draft"
+	KermessePublished KermesseStatus = "published"
+	KermesseOpen      KermesseStatus = "open"
+	KermesseClosed    KermesseStatus = "closed"
+	KermesseArchived  KermesseStatus = "archived"
+	KermesseCancelled KermesseStatus = "cancelled"
+)
+
+// kermesseTransitions maps each status to the ones organizers can move a
+// kermesse to next.
+var kermesseTransitions = map[KermesseStatus][]KermesseStatus{
+	KermesseDraft:     {KermessePublished, KermesseCancelled},
+	KermessePublished: {KermesseOpen, KermesseCancelled},
+	KermesseOpen:      {KermesseClosed, KermesseCancelled},
+	KermesseClosed:    {KermesseArchived},
+	KermesseCancelled: {KermesseArchived},
+}
+
+// CanBecome tells whether a kermesse in status s can move to status next.
+func (s KermesseStatus) CanBecome(next KermesseStatus) bool {
+	return slices.Contains(kermesseTransitions[s], next)
+}
 
 type Kermesse struct {
-	ID            uint      `gorm:"primaryKey"`
-	Name          string    `gorm:"not null"`
-	Date          time.Time `gorm:"not null"`
-	Location      string    `gorm:"not null"`
-	Description   string
-	Organizers    []Organizer `gorm:"many2many:organizer_kermesses;"`
-	Participants  []User      `gorm:"many2many:kermesse_participants;"`
-	Stands        []Stand     `gorm:"foreignKey:KermesseID"`
-	TokensSold    int         `gorm:"default:0"`
-	IsParticipant bool        `json:"is_participant" gorm:"-"`
+	ID           uint      `gorm:"primaryKey"`
+	Name         string    `gorm:"not null"`
+	Date         time.Time `gorm:"not null"`
+	Location     string    `gorm:"not null"`
+	Description  string
+	Organizers   []Organizer `gorm:"many2many:organizer_kermesses;"`
+	Participants []User      `gorm:"many2many:kermesse_participants;"`
+	Stands       []Stand     `gorm:"foreignKey:KermesseID"`
+	TokensSold   int         `gorm:"default:0"`
+	// Currency is the lowercase ISO 4217 code tokens are sold in, e.g. "eur".
+	Currency string `json:"currency"`
+	// TokenPrice is the price of a single token in the currency's minor unit.
+	TokenPrice int64          `json:"token_price"`
+	TokenPacks []TokenPack    `json:"token_packs"`
+	Status     KermesseStatus `json:"status"`
+	// StartsAt and EndsAt bound when stands take sales. Kermesses from
+	// before they were kept only have a Date and no hours.
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	// TimeZone is the IANA name of the time zone the kermesse takes place
+	// in, e.g. "Europe/Paris". Its times are rendered with its offset.
+	TimeZone string `json:"time_zone"`
+	// ClosedAt is set once organizers close or cancel the kermesse: tokens
+	// can no longer be bought, given or spent, and unused ones can be refunded.
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+	// Version goes up with every change of the details or status of the
+	// kermesse, so that concurrent edits don't overwrite each other.
+	Version       int  `json:"version"`
+	IsParticipant bool `json:"is_participant" gorm:"-"`
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
 
+func (k Kermesse) IsClosed() bool {
+	return k.ClosedAt != nil
+}
+
+// CheckSchedule returns ErrInvalidSchedule unless the kermesse has both a
+// start and an end, the start first, or neither, in a known time zone.
+func (k Kermesse) CheckSchedule() error {
+	if _, err := time.LoadLocation(k.TimeZone); err != nil {
+		return ErrInvalidSchedule
+	}
+	if (k.StartsAt == nil) != (k.EndsAt == nil) {
+		return ErrInvalidSchedule
+	}
+	if k.StartsAt != nil && !k.StartsAt.Before(*k.EndsAt) {
+		return ErrInvalidSchedule
+	}
+
+	return nil
+}
+
+// Zone returns the time zone of the kermesse, UTC when it has none.
+func (k Kermesse) Zone() *time.Location {
+	loc, err := time.LoadLocation(k.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// DayOf returns the start of the day t falls on where the kermesse takes
+// place.
+func (k Kermesse) DayOf(t time.Time) time.Time {
+	t = t.In(k.Zone())
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// InLocation returns the kermesse and its stands with their times in its own
+// time zone.
+func (k Kermesse) InLocation() Kermesse {
+	loc := k.Zone()
+	k.Date = k.Date.In(loc)
+	k.StartsAt = timeIn(k.StartsAt, loc)
+	k.EndsAt = timeIn(k.EndsAt, loc)
+	k.ClosedAt = timeIn(k.ClosedAt, loc)
+	k.CreatedAt = k.CreatedAt.In(loc)
+	k.UpdatedAt = k.UpdatedAt.In(loc)
+	if k.Stands != nil {
+		stands := make([]Stand, len(k.Stands))
+		for i, stand := range k.Stands {
+			stands[i] = stand.InLocation(loc)
+		}
+		k.Stands = stands
+	}
+
+	return k
+}
+
+func timeIn(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	in := t.In(loc)
+
+	return &in
+}
+
+// TokenPack sells a number of tokens at once, usually below the unit price.
+type TokenPack struct {
+	ID     uint  `json:"id"`
+	Tokens int   `json:"tokens"`
+	Price  int64 `json:"price"` // In the currency's minor unit.
+}
+
+// PriceTokens returns what buying amount tokens costs, in the currency's minor
+// unit. Packs can be combined with each other and with single tokens, and the
+// cheapest combination wins.
+func (k Kermesse) PriceTokens(amount int) (int64, error) {
+	if amount <= 0 || amount > MaxTokensPerPurchase {
+		return 0, ErrInvalidTokenAmount
+	}
+
+	// costs[n] is the cheapest way to buy exactly n tokens.
+	costs := make([]int64, amount+1)
+	for n := 1; n <= amount; n++ {
+		costs[n] = costs[n-1] + k.TokenPrice
+		for _, pack := range k.TokenPacks {
+			if pack.Tokens > 0 && pack.Tokens <= n && costs[n-pack.Tokens]+pack.Price < costs[n] {
+				costs[n] = costs[n-pack.Tokens] + pack.Price
+			}
+		}
+	}
+
+	return costs[amount], nil
+}
+
 type PointAttributionResult struct {
 	StudentID   uint
 	PointsAdded int
 	TotalPoints int
 }
+
+// KermesseCancellation is a cancelled kermesse and the refunds of its unused
+// tokens. Refunds is nil when they failed and have to be run again.
+type KermesseCancellation struct {
+	Kermesse Kermesse         `json:"kermesse"`
+	Refunds  *RefundRunReport `json:"refunds,omitempty"`
+}
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKermesse_PriceTokens(t *testing.T) {
+	euroFair := Kermesse{
+		Currency:   "eur",
+		TokenPrice: 100,
+		TokenPacks: []TokenPack{
+			{Tokens: 10, Price: 800},
+			{Tokens: 25, Price: 1900},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		kermesse Kermesse
+		amount   int
+		want     int64
+		wantErr  error
+	}{
+		{
+			name:     "Unit price without packs",
+			kermesse: Kermesse{Currency: "usd", TokenPrice: 100},
+			amount:   7,
+			want:     700,
+		},
+		{
+			name:     "Below the smallest pack",
+			kermesse: euroFair,
+			amount:   9,
+			want:     900,
+		},
+		{
+			name:     "Exactly one pack",
+			kermesse: euroFair,
+			amount:   10,
+			want:     800,
+		},
+		{
+			name:     "Pack and single tokens",
+			kermesse: euroFair,
+			amount:   13,
+			want:     1100,
+		},
+		{
+			name:     "Cheapest combination of packs",
+			kermesse: euroFair,
+			amount:   30,
+			want:     2400,
+		},
+		{
+			name:     "Larger pack when it is cheaper",
+			kermesse: euroFair,
+			amount:   25,
+			want:     1900,
+		},
+		{
+			name:     "Pack dearer than single tokens is ignored",
+			kermesse: Kermesse{TokenPrice: 100, TokenPacks: []TokenPack{{Tokens: 5, Price: 600}}},
+			amount:   5,
+			want:     500,
+		},
+		{
+			name:     "Zero tokens",
+			kermesse: euroFair,
+			amount:   0,
+			wantErr:  ErrInvalidTokenAmount,
+		},
+		{
+			name:     "Too many tokens",
+			kermesse: euroFair,
+			amount:   MaxTokensPerPurchase + 1,
+			wantErr:  ErrInvalidTokenAmount,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.kermesse.PriceTokens(tt.amount)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestKermesseStatus_CanBecome(t *testing.T) {
+	assert.True(t, KermesseDraft.CanBecome(KermessePublished))
+	assert.True(t, KermessePublished.CanBecome(KermesseOpen))
+	assert.True(t, KermesseOpen.CanBecome(KermesseClosed))
+	assert.True(t, KermesseClosed.CanBecome(KermesseArchived))
+
+	// Kermesses can be cancelled until they close.
+	assert.True(t, KermesseDraft.CanBecome(KermesseCancelled))
+	assert.True(t, KermesseOpen.CanBecome(KermesseCancelled))
+	assert.True(t, KermesseCancelled.CanBecome(KermesseArchived))
+	assert.False(t, KermesseClosed.CanBecome(KermesseCancelled))
+	assert.False(t, KermesseCancelled.CanBecome(KermesseOpen))
+
+	// Statuses can't be skipped, repeated or undone.
+	assert.False(t, KermesseDraft.CanBecome(KermesseOpen))
+	assert.False(t, KermesseOpen.CanBecome(KermesseOpen))
+	assert.False(t, KermesseClosed.CanBecome(KermesseOpen))
+	assert.False(t, KermesseArchived.CanBecome(KermesseDraft))
+	assert.False(t, KermesseArchived.CanBecome(""))
+}
+
+func TestKermesse_CheckSchedule(t *testing.T) {
+	starts := time.Date(2026, 6, 20, 10, 0, 0, 0, time.UTC)
+	ends := starts.Add(8 * time.Hour)
+
+	assert.NoError(t, Kermesse{}.CheckSchedule())
+	assert.NoError(t, Kermesse{StartsAt: &starts, EndsAt: &ends, TimeZone: "Europe/Paris"}.CheckSchedule())
+
+	assert.ErrorIs(t, Kermesse{StartsAt: &starts}.CheckSchedule(), ErrInvalidSchedule)
+	assert.ErrorIs(t, Kermesse{StartsAt: &ends, EndsAt: &starts}.CheckSchedule(), ErrInvalidSchedule)
+	assert.ErrorIs(t, Kermesse{StartsAt: &starts, EndsAt: &starts}.CheckSchedule(), ErrInvalidSchedule)
+	assert.ErrorIs(t, Kermesse{TimeZone: "Mars/Olympus"}.CheckSchedule(), ErrInvalidSchedule)
+}
+
+func TestKermesse_InLocation(t *testing.T) {
+	starts := time.Date(2026, 6, 20, 8, 0, 0, 0, time.UTC)
+	kermesse := Kermesse{Date: starts, StartsAt: &starts, TimeZone: "Europe/Paris"}.InLocation()
+
+	// The same instants, rendered with the offset of the kermesse.
+	assert.True(t, kermesse.StartsAt.Equal(starts))
+	assert.Equal(t, "2026-06-20T10:00:00+02:00", kermesse.StartsAt.Format(time.RFC3339))
+	assert.Equal(t, "2026-06-20T10:00:00+02:00", kermesse.Date.Format(time.RFC3339))
+	assert.Nil(t, kermesse.EndsAt)
+	assert.Nil(t, kermesse.ClosedAt)
+
+	// Kermesses without a time zone are in UTC.
+	assert.Equal(t, time.UTC, Kermesse{}.Zone())
+}
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrUnknownLedgerAccount = errors.New("unknown ledger account")
+
+type LedgerAccountType string
+
+const (
+	LedgerAccountParent          LedgerAccountType = "parent"
+	LedgerAccountStudent         LedgerAccountType = "student"
+	LedgerAccountStand           LedgerAccountType = "stand"
+	LedgerAccountKermesse        LedgerAccountType = "kermesse"
+	LedgerAccountPaymentClearing LedgerAccountType = "payment_clearing"
+)
+
+// LedgerEntryDirection follows the wallet convention: a debit takes tokens out
+// of an account and a credit puts tokens into it.
+type LedgerEntryDirection string
+
+const (
+	LedgerDebit  LedgerEntryDirection = "debit"
+	LedgerCredit LedgerEntryDirection = "credit"
+)
+
+// LedgerAccountKey identifies an account. Every account belongs to a
+// kermesse, so that tokens bought for one kermesse can only be spent there.
+type LedgerAccountKey struct {
+	Type       LedgerAccountType
+	OwnerID    uint
+	KermesseID uint
+}
+
+// AllowsOverdraft reports whether the account may go below zero. Only the
+// accounts issuing tokens (kermesse cash desk and payment clearing) can,
+// their negative balance being the tokens they put in circulation.
+func (k LedgerAccountKey) AllowsOverdraft() bool {
+	return k.Type == LedgerAccountKermesse || k.Type == LedgerAccountPaymentClearing
+}
+
+type LedgerAccount struct {
+	ID         uint              `json:"id"`
+	Type       LedgerAccountType `json:"type"`
+	OwnerID    uint              `json:"owner_id"`
+	KermesseID uint              `json:"kermesse_id"`
+	Balance    int               `json:"balance"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+type LedgerEntry struct {
+	ID            uint                 `json:"id"`
+	TransactionID uint                 `json:"transaction_id"`
+	AccountID     uint                 `json:"account_id"`
+	Direction     LedgerEntryDirection `json:"direction"`
+	Amount        int                  `json:"amount"`
+	CreatedAt     time.Time            `json:"created_at"`
+}
+
+type LedgerAccountMismatch struct {
+	AccountID     uint `json:"account_id"`
+	CachedBalance int  `json:"cached_balance"`
+	LedgerBalance int  `json:"ledger_balance"`
+}
+
+type LedgerAudit struct {
+	Accounts               int                     `json:"accounts"`
+	Entries                int                     `json:"entries"`
+	UnbalancedTransactions []uint                  `json:"unbalanced_transactions"`
+	MismatchedTransactions []uint                  `json:"mismatched_transactions"`
+	UnpostedTransactions   []uint                  `json:"unposted_transactions"`
+	MismatchedAccounts     []LedgerAccountMismatch `json:"mismatched_accounts"`
+}
+
+func (a LedgerAudit) IsBalanced() bool {
+	return len(a.UnbalancedTransactions) == 0 &&
+		len(a.MismatchedTransactions) == 0 &&
+		len(a.UnpostedTransactions) == 0 &&
+		len(a.MismatchedAccounts) == 0
+}
+
+// Wallet is the balance a parent or student holds for one kermesse.
+type Wallet struct {
+	KermesseID uint `json:"kermesse_id"`
+	Tokens     int  `json:"tokens"`
+}
+
+func ledgerAccountFor(userType string, ownerID, kermesseID uint) (LedgerAccountKey, error) {
+	var accountType LedgerAccountType
+	switch strings.ToLower(userType) {
+	case "parent":
+		accountType = LedgerAccountParent
+	case "student":
+		accountType = LedgerAccountStudent
+	case "stand":
+		accountType = LedgerAccountStand
+	case "kermesse", "kermess":
+		accountType = LedgerAccountKermesse
+	default:
+		return LedgerAccountKey{}, ErrUnknownLedgerAccount
+	}
+
+	return LedgerAccountKey{Type: accountType, OwnerID: ownerID, KermesseID: kermesseID}, nil
+}
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenTransaction_LedgerAccounts(t *testing.T) {
+	const kermesseID = 4
+
+	clearing := LedgerAccountKey{Type: LedgerAccountPaymentClearing, OwnerID: kermesseID, KermesseID: kermesseID}
+
+	tests := []struct {
+		name        string
+		transaction TokenTransaction
+		wantDebit   LedgerAccountKey
+		wantCredit  LedgerAccountKey
+		wantErr     error
+	}{
+		{
+			name:        "Purchase credits the buyer from the clearing account",
+			transaction: TokenTransaction{KermesseID: kermesseID, FromID: 2, FromType: "Parent", Type: TokenPurchase},
+			wantDebit:   clearing,
+			wantCredit:  LedgerAccountKey{Type: LedgerAccountParent, OwnerID: 2, KermesseID: kermesseID},
+		},
+		{
+			name:        "Opening balance credits the recipient from the clearing account",
+			transaction: TokenTransaction{KermesseID: kermesseID, ToID: 3, ToType: "student", Type: TokenOpeningBalance},
+			wantDebit:   clearing,
+			wantCredit:  LedgerAccountKey{Type: LedgerAccountStudent, OwnerID: 3, KermesseID: kermesseID},
+		},
+		{
+			name:        "Distribution moves tokens from the parent to the student",
+			transaction: TokenTransaction{KermesseID: kermesseID, FromID: 2, FromType: "Parent", ToID: 3, ToType: "Student", Type: TokenDistribution},
+			wantDebit:   LedgerAccountKey{Type: LedgerAccountParent, OwnerID: 2, KermesseID: kermesseID},
+			wantCredit:  LedgerAccountKey{Type: LedgerAccountStudent, OwnerID: 3, KermesseID: kermesseID},
+		},
+		{
+			name:        "Spend moves tokens from the buyer to the stand",
+			transaction: TokenTransaction{KermesseID: kermesseID, FromID: 3, FromType: "Student", ToID: 7, ToType: "Stand", Type: TokenSpend},
+			wantDebit:   LedgerAccountKey{Type: LedgerAccountStudent, OwnerID: 3, KermesseID: kermesseID},
+			wantCredit:  LedgerAccountKey{Type: LedgerAccountStand, OwnerID: 7, KermesseID: kermesseID},
+		},
+		{
+			name:        "Reversal moves tokens from the stand back to the buyer",
+			transaction: TokenTransaction{KermesseID: kermesseID, FromID: 7, FromType: "Stand", ToID: 3, ToType: "Student", Type: TokenReversal},
+			wantDebit:   LedgerAccountKey{Type: LedgerAccountStand, OwnerID: 7, KermesseID: kermesseID},
+			wantCredit:  LedgerAccountKey{Type: LedgerAccountStudent, OwnerID: 3, KermesseID: kermesseID},
+		},
+		{
+			name:        "Refund gives tokens back to the clearing account",
+			transaction: TokenTransaction{KermesseID: kermesseID, FromID: 2, FromType: "parent", Type: TokenRefund},
+			wantDebit:   LedgerAccountKey{Type: LedgerAccountParent, OwnerID: 2, KermesseID: kermesseID},
+			wantCredit:  clearing,
+		},
+		{
+			name:        "Unknown account type",
+			transaction: TokenTransaction{KermesseID: kermesseID, FromID: 2, FromType: "Teacher", ToID: 3, ToType: "Student", Type: TokenDistribution},
+			wantErr:     ErrUnknownLedgerAccount,
+		},
+		{
+			name:        "Unknown transaction type",
+			transaction: TokenTransaction{KermesseID: kermesseID, FromID: 2, FromType: "Parent", Type: "Gift"},
+			wantErr:     ErrUnknownLedgerAccount,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			debit, credit, err := tt.transaction.LedgerAccounts()
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantDebit, debit)
+			assert.Equal(t, tt.wantCredit, credit)
+		})
+	}
+}
+
+func TestLedgerAccountKey_AllowsOverdraft(t *testing.T) {
+	assert.True(t, LedgerAccountKey{Type: LedgerAccountKermesse}.AllowsOverdraft())
+	assert.True(t, LedgerAccountKey{Type: LedgerAccountPaymentClearing}.AllowsOverdraft())
+	assert.False(t, LedgerAccountKey{Type: LedgerAccountParent}.AllowsOverdraft())
+	assert.False(t, LedgerAccountKey{Type: LedgerAccountStudent}.AllowsOverdraft())
+	assert.False(t, LedgerAccountKey{Type: LedgerAccountStand}.AllowsOverdraft())
+}
+
+func TestLedgerAudit_IsBalanced(t *testing.T) {
+	tests := []struct {
+		name  string
+		audit LedgerAudit
+		want  bool
+	}{
+		{
+			name:  "Clean ledger",
+			audit: LedgerAudit{Accounts: 4, Entries: 6, UnbalancedTransactions: []uint{}, MismatchedTransactions: []uint{}, UnpostedTransactions: []uint{}, MismatchedAccounts: []LedgerAccountMismatch{}},
+			want:  true,
+		},
+		{
+			name:  "Unbalanced transaction",
+			audit: LedgerAudit{UnbalancedTransactions: []uint{1}},
+		},
+		{
+			name:  "Mismatched transaction",
+			audit: LedgerAudit{MismatchedTransactions: []uint{1}},
+		},
+		{
+			name:  "Unposted transaction",
+			audit: LedgerAudit{UnpostedTransactions: []uint{1}},
+		},
+		{
+			name:  "Mismatched account",
+			audit: LedgerAudit{MismatchedAccounts: []LedgerAccountMismatch{{AccountID: 1, CachedBalance: 5, LedgerBalance: 3}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.audit.IsBalanced())
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// offlineVoucherPrefix starts every offline voucher payload.
+const offlineVoucherPrefix = "kov1"
+
+// ErrInvalidVoucher is returned for vouchers that are malformed or weren't
+// signed with the secret of the allowance they name.
+var ErrInvalidVoucher = errors.New("invalid offline voucher")
+
+// Statuses of an uploaded voucher.
+const (
+	VoucherAccepted  = "accepted"
+	VoucherDuplicate = "duplicate"
+	VoucherRejected  = "rejected"
+)
+
+// Reasons a voucher is rejected for.
+const (
+	VoucherReasonInvalid            = "invalid_voucher"
+	VoucherReasonUnknownAllowance   = "unknown_allowance"
+	VoucherReasonWrongStand         = "wrong_stand"
+	VoucherReasonAllowanceExpired   = "allowance_expired"
+	VoucherReasonInvalidSigningTime = "invalid_signing_time"
+	VoucherReasonStandClosed        = "stand_closed"
+	VoucherReasonLimitExceeded      = "limit_exceeded"
+	VoucherReasonInsufficientTokens = "insufficient_tokens"
+	VoucherReasonInvalidCart        = "invalid_cart"
+	VoucherReasonPriceMismatch      = "price_mismatch"
+	VoucherReasonConflict           = "conflict"
+)
+
+// OfflineAllowance lets a student's app sign spend vouchers while stands
+// have no connection, up to Limit tokens until it expires. Tokens aren't
+// held: vouchers are paid from the student's wallet when stands upload them.
+type OfflineAllowance struct {
+	ID         uint      `json:"id"`
+	KermesseID uint      `json:"kermesse_id"`
+	StudentID  uint      `json:"student_id"`
+	Limit      int       `json:"limit"`
+	Spent      int       `json:"spent"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// offlineClockSkew is how far ahead of the server the clock of an app may
+// run when it signs a voucher.
+const offlineClockSkew = time.Minute
+
+// SignedWithin tells whether a voucher of the allowance can have been signed
+// at signedAt: not before the allowance was issued, nor after the voucher
+// was uploaded at uploadedAt. Apps choose the signing time, so it is all
+// that keeps a voucher from being backdated or postdated. Signing times are
+// to the second.
+func (a OfflineAllowance) SignedWithin(signedAt, uploadedAt time.Time) bool {
+	return !signedAt.Before(a.CreatedAt.Truncate(time.Second)) && !signedAt.After(uploadedAt.Add(offlineClockSkew))
+}
+
+// IssuedOfflineAllowance is an allowance along with the secret the app signs
+// vouchers with. The secret is handed out when the allowance is issued only.
+type IssuedOfflineAllowance struct {
+	OfflineAllowance
+	Secret string `json:"secret"`
+}
+
+// OfflineAllowanceSecret derives the voucher signing secret of the allowance
+// from key, so that secrets needn't be stored.
+func OfflineAllowanceSecret(key []byte, allowanceID uint) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("allowance:" + strconv.FormatUint(uint64(allowanceID), 10)))
+
+	return mac.Sum(nil)
+}
+
+// OfflineVoucher is a spend a student's app signed offline at a stand.
+// Sequence numbers are unique within an allowance and make double spends
+// detectable.
+type OfflineVoucher struct {
+	AllowanceID uint       `json:"allowance_id"`
+	Sequence    uint       `json:"sequence"`
+	StandID     uint       `json:"stand_id"`
+	Lines       []CartLine `json:"lines"`
+	Amount      int        `json:"amount"`
+	SignedAt    time.Time  `json:"signed_at"`
+}
+
+type offlineVoucherClaims struct {
+	AllowanceID uint     `json:"v"`
+	Sequence    uint     `json:"n"`
+	StandID     uint     `json:"s"`
+	Lines       [][2]int `json:"l"`
+	Amount      int      `json:"a"`
+	SignedAt    int64    `json:"t"`
+}
+
+// Sign returns the payload of the voucher, signed with the secret of its
+// allowance. Apps do the same on their side.
+func (v OfflineVoucher) Sign(secret []byte) string {
+	claims := offlineVoucherClaims{
+		AllowanceID: v.AllowanceID,
+		Sequence:    v.Sequence,
+		StandID:     v.StandID,
+		Amount:      v.Amount,
+		SignedAt:    v.SignedAt.Unix(),
+	}
+	for _, line := range v.Lines {
+		claims.Lines = append(claims.Lines, [2]int{int(line.StockID), line.Quantity})
+	}
+
+	// Marshalling plain numbers can't fail.
+	body, _ := json.Marshal(claims)
+	signed := offlineVoucherPrefix + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signVoucher(signed, secret))
+}
+
+// ParseOfflineVoucher decodes payload and checks its signature against the
+// secret, derived from key, of the allowance it names.
+func ParseOfflineVoucher(payload string, key []byte) (OfflineVoucher, error) {
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 || parts[0] != offlineVoucherPrefix {
+		return OfflineVoucher{}, ErrInvalidVoucher
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return OfflineVoucher{}, ErrInvalidVoucher
+	}
+	var claims offlineVoucherClaims
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return OfflineVoucher{}, ErrInvalidVoucher
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return OfflineVoucher{}, ErrInvalidVoucher
+	}
+	secret := OfflineAllowanceSecret(key, claims.AllowanceID)
+	if !hmac.Equal(mac, signVoucher(parts[0]+"."+parts[1], secret)) {
+		return OfflineVoucher{}, ErrInvalidVoucher
+	}
+
+	voucher := OfflineVoucher{
+		AllowanceID: claims.AllowanceID,
+		Sequence:    claims.Sequence,
+		StandID:     claims.StandID,
+		Amount:      claims.Amount,
+		SignedAt:    time.Unix(claims.SignedAt, 0),
+	}
+	for _, line := range claims.Lines {
+		if line[0] <= 0 {
+			return OfflineVoucher{}, ErrInvalidVoucher
+		}
+		voucher.Lines = append(voucher.Lines, CartLine{StockID: uint(line[0]), Quantity: line[1]})
+	}
+
+	return voucher, nil
+}
+
+func signVoucher(signed string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+
+	return mac.Sum(nil)
+}
+
+// VoucherResult is what became of one uploaded voucher. Index is its
+// position in the upload.
+type VoucherResult struct {
+	Index       int    `json:"index"`
+	AllowanceID uint   `json:"allowance_id,omitempty"`
+	Sequence    uint   `json:"sequence,omitempty"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	Order       *Order `json:"order,omitempty"`
+}
+
+// VoucherReconciliation reports on a batch of vouchers a stand uploaded.
+type VoucherReconciliation struct {
+	KermesseID uint            `json:"kermesse_id"`
+	StandID    uint            `json:"stand_id"`
+	Accepted   int             `json:"accepted"`
+	Duplicates int             `json:"duplicates"`
+	Rejected   int             `json:"rejected"`
+	Tokens     int             `json:"tokens"`
+	Results    []VoucherResult `json:"results"`
+}
+
+// Add records result in the report.
+func (r *VoucherReconciliation) Add(result VoucherResult) {
+	switch result.Status {
+	case VoucherAccepted:
+		r.Accepted++
+		if result.Order != nil {
+			r.Tokens += result.Order.TotalTokens
+		}
+	case VoucherDuplicate:
+		r.Duplicates++
+	default:
+		r.Rejected++
+	}
+	r.Results = append(r.Results, result)
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfflineVoucher_Sign(t *testing.T) {
+	key := []byte("test_key")
+	voucher := OfflineVoucher{
+		AllowanceID: 4,
+		Sequence:    2,
+		StandID:     7,
+		Lines:       []CartLine{{StockID: 11, Quantity: 1}},
+		Amount:      2,
+		SignedAt:    time.Unix(1718000000, 0),
+	}
+
+	payload := voucher.Sign(OfflineAllowanceSecret(key, 4))
+	got, err := ParseOfflineVoucher(payload, key)
+	require.NoError(t, err)
+	assert.Equal(t, voucher.AllowanceID, got.AllowanceID)
+	assert.Equal(t, voucher.Sequence, got.Sequence)
+	assert.Equal(t, voucher.Lines, got.Lines)
+	assert.True(t, voucher.SignedAt.Equal(got.SignedAt))
+
+	// The secret of another allowance can't sign for this one.
+	_, err = ParseOfflineVoucher(voucher.Sign(OfflineAllowanceSecret(key, 5)), key)
+	assert.ErrorIs(t, err, ErrInvalidVoucher)
+
+	parts := strings.Split(payload, ".")
+	voucher.Amount = 1
+	forged := strings.Split(voucher.Sign([]byte("guess")), ".")
+	_, err = ParseOfflineVoucher(parts[0]+"."+forged[1]+"."+parts[2], key)
+	assert.ErrorIs(t, err, ErrInvalidVoucher)
+
+	for _, payload := range []string{"", "kov1", "kov1.e30", "kov1.!!.e30", "kpr1." + parts[1] + "." + parts[2]} {
+		_, err = ParseOfflineVoucher(payload, key)
+		assert.ErrorIs(t, err, ErrInvalidVoucher, payload)
+	}
+}
+
+func TestVoucherReconciliation_Add(t *testing.T) {
+	var report VoucherReconciliation
+	report.Add(VoucherResult{Index: 0, Status: VoucherAccepted, Order: &Order{TotalTokens: 3}})
+	report.Add(VoucherResult{Index: 1, Status: VoucherDuplicate})
+	report.Add(VoucherResult{Index: 2, Status: VoucherRejected, Reason: VoucherReasonInvalid})
+	report.Add(VoucherResult{Index: 3, Status: VoucherAccepted, Order: &Order{TotalTokens: 2}})
+
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, 1, report.Duplicates)
+	assert.Equal(t, 1, report.Rejected)
+	assert.Equal(t, 5, report.Tokens)
+	assert.Len(t, report.Results, 4)
+}
+
+func TestOfflineAllowance_SignedWithin(t *testing.T) {
+	issued := time.Date(2024, 6, 15, 14, 0, 0, 500_000_000, time.UTC)
+	uploaded := issued.Add(2 * time.Hour)
+	allowance := OfflineAllowance{CreatedAt: issued, ExpiresAt: issued.Add(4 * time.Hour)}
+
+	tests := []struct {
+		name     string
+		signedAt time.Time
+		want     bool
+	}{
+		{name: "While offline", signedAt: issued.Add(time.Hour), want: true},
+		{name: "The second the allowance was issued", signedAt: issued.Truncate(time.Second), want: true},
+		{name: "Backdated before the allowance", signedAt: issued.Add(-time.Minute)},
+		{name: "Clock of the app slightly ahead", signedAt: uploaded.Add(30 * time.Second), want: true},
+		{name: "After the upload", signedAt: uploaded.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, allowance.SignedWithin(tt.signedAt, uploaded))
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	// ErrInvalidCart is returned for empty carts and lines without items.
+	ErrInvalidCart = errors.New("invalid cart")
+	// ErrItemNotInStand is returned for cart lines about items the stand
+	// doesn't sell.
+	ErrItemNotInStand = errors.New("item not sold by the stand")
+)
+
+// CartLine is an item and how many of it a buyer wants.
+type CartLine struct {
+	StockID  uint `json:"stock_id"`
+	Quantity int  `json:"quantity"`
+}
+
+// Order is what a buyer got at a stand in one checkout, paid by a single
+// spend transaction. TotalTokens is what the buyer pays, with the Discount
+// of the promotion PromotionID, if any, taken off.
+type Order struct {
+	ID            uint        `json:"id"`
+	KermesseID    uint        `json:"kermesse_id"`
+	StandID       uint        `json:"stand_id"`
+	BuyerID       uint        `json:"buyer_id"`
+	BuyerType     string      `json:"buyer_type"`
+	TransactionID uint        `json:"transaction_id"`
+	TotalTokens   int         `json:"total_tokens"`
+	PromotionID   *uint       `json:"promotion_id,omitempty"`
+	Discount      int         `json:"discount"`
+	Lines         []OrderLine `json:"lines"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+type OrderLine struct {
+	ID       uint   `json:"id"`
+	StockID  uint   `json:"stock_id"`
+	ItemName string `json:"item_name"`
+	Quantity int    `json:"quantity"`
+	// UnitCost is the token cost of the item at checkout.
+	UnitCost int `json:"unit_cost"`
+	Tokens   int `json:"tokens"`
+}
+
+// NewOrder prices a cart at stand from its current stock. Lines about the
+// same item are merged, and lines come out ordered by stock ID. Stock
+// availability is left to the checkout, which holds the rows.
+func NewOrder(stand Stand, cart []CartLine) (Order, error) {
+	if len(cart) == 0 {
+		return Order{}, ErrInvalidCart
+	}
+
+	quantities := map[uint]int{}
+	for _, line := range cart {
+		if line.Quantity <= 0 {
+			return Order{}, ErrInvalidCart
+		}
+		quantities[line.StockID] += line.Quantity
+	}
+
+	order := Order{KermesseID: stand.KermesseID, StandID: stand.ID}
+	for stockID, quantity := range quantities {
+		i := slices.IndexFunc(stand.Stock, func(s Stock) bool { return s.ID == stockID })
+		if i < 0 || stand.Stock[i].IsArchived() {
+			return Order{}, ErrItemNotInStand
+		}
+		item := stand.Stock[i]
+
+		line := OrderLine{
+			StockID:  item.ID,
+			ItemName: item.ItemName,
+			Quantity: quantity,
+			UnitCost: item.TokenCost,
+			Tokens:   item.TokenCost * quantity,
+		}
+		order.Lines = append(order.Lines, line)
+		order.TotalTokens += line.Tokens
+	}
+	slices.SortFunc(order.Lines, func(a, b OrderLine) int { return int(a.StockID) - int(b.StockID) })
+
+	return order, nil
+}
+
+// Spend builds the transaction paying for the order. A single-item order
+// tells which item it bought, so that it can be refunded item by item.
+func (o Order) Spend() TokenTransaction {
+	transaction := TokenTransaction{
+		KermesseID: o.KermesseID,
+		FromID:     o.BuyerID,
+		FromType:   o.BuyerType,
+		ToID:       o.StandID,
+		ToType:     "Stand",
+		Amount:     o.TotalTokens,
+		Type:       TokenSpend,
+		StandID:    &o.StandID,
+		Status:     "Validated",
+		// The spend keeps track of the promotion it got its price from.
+		PromotionID: o.PromotionID,
+	}
+	if len(o.Lines) == 1 {
+		transaction.StockID = &o.Lines[0].StockID
+		transaction.Quantity = o.Lines[0].Quantity
+	}
+
+	return transaction
+}
+
+// Charge is an order a stand holder rang up for a student, with the spend
+// paying for it. The spend stays Pending until the student or their parent
+// confirms it, unless it is within the student's auto-approve limit.
+type Charge struct {
+	Order       Order            `json:"order"`
+	Transaction TokenTransaction `json:"transaction"`
+}
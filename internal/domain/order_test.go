@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testStand = Stand{
+	ID:         7,
+	KermesseID: 3,
+	Stock: []Stock{
+		{ID: 11, StandID: 7, ItemName: "Crêpe", Quantity: 10, TokenCost: 2},
+		{ID: 12, StandID: 7, ItemName: "Juice", Quantity: 5, TokenCost: 1},
+	},
+}
+
+func TestNewOrder(t *testing.T) {
+	order, err := NewOrder(testStand, []CartLine{
+		{StockID: 12, Quantity: 1},
+		{StockID: 11, Quantity: 2},
+		{StockID: 12, Quantity: 2},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, uint(3), order.KermesseID)
+	assert.Equal(t, uint(7), order.StandID)
+	assert.Equal(t, 7, order.TotalTokens)
+	assert.Equal(t, []OrderLine{
+		{StockID: 11, ItemName: "Crêpe", Quantity: 2, UnitCost: 2, Tokens: 4},
+		{StockID: 12, ItemName: "Juice", Quantity: 3, UnitCost: 1, Tokens: 3},
+	}, order.Lines)
+
+	_, err = NewOrder(testStand, nil)
+	assert.ErrorIs(t, err, ErrInvalidCart)
+
+	_, err = NewOrder(testStand, []CartLine{{StockID: 11, Quantity: 0}})
+	assert.ErrorIs(t, err, ErrInvalidCart)
+
+	_, err = NewOrder(testStand, []CartLine{{StockID: 11, Quantity: 1}, {StockID: 99, Quantity: 1}})
+	assert.ErrorIs(t, err, ErrItemNotInStand)
+
+	// Archived items are off sale.
+	archived := testStand
+	archived.Stock = slices.Clone(testStand.Stock)
+	archivedAt := time.Now()
+	archived.Stock[1].ArchivedAt = &archivedAt
+	_, err = NewOrder(archived, []CartLine{{StockID: 12, Quantity: 1}})
+	assert.ErrorIs(t, err, ErrItemNotInStand)
+}
+
+func TestOrder_Spend(t *testing.T) {
+	order, err := NewOrder(testStand, []CartLine{{StockID: 11, Quantity: 2}})
+	require.NoError(t, err)
+	order.BuyerID, order.BuyerType = 5, "Student"
+
+	spend := order.Spend()
+	assert.Equal(t, TokenSpend, spend.Type)
+	assert.Equal(t, 4, spend.Amount)
+	require.NotNil(t, spend.StockID)
+	assert.Equal(t, uint(11), *spend.StockID)
+	assert.Equal(t, 2, spend.Quantity)
+
+	// A spend for several items is refunded as a whole.
+	order, err = NewOrder(testStand, []CartLine{{StockID: 11, Quantity: 2}, {StockID: 12, Quantity: 1}})
+	require.NoError(t, err)
+	order.BuyerID, order.BuyerType = 5, "Student"
+
+	spend = order.Spend()
+	assert.Equal(t, 5, spend.Amount)
+	assert.Nil(t, spend.StockID)
+	assert.Equal(t, 1, spend.RefundableQuantity())
+}
@@ -0,0 +1,96 @@
+package domain
+
+import "errors"
+
+// ErrInvalidPaymentEvent is returned for provider events that cannot be
+// trusted or understood, e.g. because of a bad signature.
+var ErrInvalidPaymentEvent = errors.New("invalid payment event")
+
+// PaymentMethod tells how a token purchase is paid for.
+type PaymentMethod string
+
+const (
+	PaymentMethodCard PaymentMethod = "card"
+	// PaymentMethodCash purchases are paid at the cash desk and approved by an
+	// organizer.
+	PaymentMethodCash PaymentMethod = "cash"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentSucceeded      PaymentStatus = "succeeded"
+	PaymentFailed         PaymentStatus = "failed"
+	PaymentRequiresAction PaymentStatus = "requires_action"
+	PaymentProcessing     PaymentStatus = "processing"
+)
+
+type PaymentRequest struct {
+	PaymentMethodID string
+	Amount          int64 // In the currency's minor unit, e.g. cents.
+	Currency        string
+	Description     string
+}
+
+type Payment struct {
+	ID            string        `json:"id"`
+	Status        PaymentStatus `json:"status"`
+	Amount        int64         `json:"amount"`
+	Currency      string        `json:"currency"`
+	ClientSecret  string        `json:"client_secret,omitempty"`
+	FailureReason string        `json:"failure_reason,omitempty"`
+}
+
+// PaymentEvent is an asynchronous notification about a payment, such as a
+// Stripe webhook. Status is empty for events that do not settle a payment.
+type PaymentEvent struct {
+	ID            string        `json:"id"`
+	Type          string        `json:"type"`
+	PaymentID     string        `json:"payment_id"`
+	Status        PaymentStatus `json:"status"`
+	FailureReason string        `json:"failure_reason,omitempty"`
+}
+
+type RefundRequest struct {
+	PaymentID string // The payment to refund, e.g. a Stripe PaymentIntent ID.
+	Amount    int64  // In the currency's minor unit.
+	// IdempotencyKey makes retrying the same refund safe.
+	IdempotencyKey string
+}
+
+type PaymentRefund struct {
+	ID            string        `json:"id"`
+	Status        PaymentStatus `json:"status"`
+	Amount        int64         `json:"amount"`
+	FailureReason string        `json:"failure_reason,omitempty"`
+}
+
+// RefundRunReport sums up the end-of-kermesse refunds of a kermesse.
+type RefundRunReport struct {
+	KermesseID     uint            `json:"kermesse_id"`
+	Currency       string          `json:"currency"`
+	Parents        []ParentRefunds `json:"parents"`
+	RefundedTokens int             `json:"refunded_tokens"`
+	RefundedAmount int64           `json:"refunded_amount"`
+	// PendingRefunds were not confirmed by the payment provider yet. Their
+	// tokens are set aside and the next run retries them.
+	PendingRefunds []uint `json:"pending_refunds"`
+	// DeclinedRefunds were declined for good by the payment provider, e.g.
+	// because the card was closed. Their tokens are set aside too, but their
+	// money has to be paid back by hand; runs don't retry them.
+	DeclinedRefunds []uint `json:"declined_refunds"`
+	DeclinedAmount  int64  `json:"declined_amount"`
+	// UnrefundableTokens are unused tokens that no card payment can pay back,
+	// e.g. tokens bought in cash.
+	UnrefundableTokens int `json:"unrefundable_tokens"`
+}
+
+// ParentRefunds is what a parent got back for the unused tokens of their family.
+type ParentRefunds struct {
+	ParentID       uint  `json:"parent_id"`
+	RefundedTokens int   `json:"refunded_tokens"`
+	RefundedAmount int64 `json:"refunded_amount"`
+	PendingTokens  int   `json:"pending_tokens"`
+	DeclinedTokens int   `json:"declined_tokens"`
+	DeclinedAmount int64 `json:"declined_amount"`
+}
@@ -0,0 +1,189 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrInvalidPromotion is returned for promotions whose rule doesn't make
+// sense, or that are about items the stand doesn't sell.
+var ErrInvalidPromotion = errors.New("invalid promotion")
+
+type PromotionType string
+
+const (
+	// PromotionBundle sells Items together, in their quantities, for
+	// BundlePrice tokens.
+	PromotionBundle PromotionType = "bundle"
+	// PromotionPercentOff takes PercentOff percent off Items.
+	PromotionPercentOff PromotionType = "percent_off"
+	// PromotionBuyXGetY takes PercentOff percent off GetQuantity units of an
+	// item for every BuyQuantity units bought at full price, 100 making them
+	// free.
+	PromotionBuyXGetY PromotionType = "buy_x_get_y"
+)
+
+type PromotionItem struct {
+	StockID uint `json:"stock_id"`
+	// Quantity is how many of the item a bundle holds. Other types ignore it.
+	Quantity int `json:"quantity,omitempty"`
+}
+
+// Promotion is a pricing rule of a stand. Any type can be limited to a time
+// window, e.g. cheaper drinks in the last hour.
+type Promotion struct {
+	ID      uint          `json:"id"`
+	StandID uint          `json:"stand_id"`
+	Name    string        `json:"name"`
+	Type    PromotionType `json:"type"`
+	// Items are what a bundle is made of, or the items the other types apply
+	// to, all items of the stand when empty.
+	Items       []PromotionItem `json:"items"`
+	BundlePrice int             `json:"bundle_price,omitempty"`
+	PercentOff  int             `json:"percent_off,omitempty"`
+	BuyQuantity int             `json:"buy_quantity,omitempty"`
+	GetQuantity int             `json:"get_quantity,omitempty"`
+	// StartsAt and EndsAt bound when the promotion applies. Either can be
+	// left out.
+	StartsAt  *time.Time `json:"starts_at,omitempty"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Validate checks the rule of the promotion against the stock of stand.
+func (p Promotion) Validate(stand Stand) error {
+	for _, item := range p.Items {
+		if !slices.ContainsFunc(stand.Stock, func(s Stock) bool { return s.ID == item.StockID }) {
+			return ErrInvalidPromotion
+		}
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.StartsAt.Before(*p.EndsAt) {
+		return ErrInvalidPromotion
+	}
+
+	switch p.Type {
+	case PromotionBundle:
+		units := 0
+		for _, item := range p.Items {
+			if item.Quantity <= 0 {
+				return ErrInvalidPromotion
+			}
+			units += item.Quantity
+		}
+		// A bundle is worth it from two items on, and can't be free.
+		if units < 2 || p.BundlePrice <= 0 {
+			return ErrInvalidPromotion
+		}
+	case PromotionPercentOff:
+		// Orders can't come out free.
+		if p.PercentOff <= 0 || p.PercentOff >= 100 {
+			return ErrInvalidPromotion
+		}
+	case PromotionBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 || p.PercentOff <= 0 || p.PercentOff > 100 {
+			return ErrInvalidPromotion
+		}
+	default:
+		return ErrInvalidPromotion
+	}
+
+	return nil
+}
+
+// AppliesAt tells whether the promotion is on at t.
+func (p Promotion) AppliesAt(t time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && t.Before(*p.StartsAt) {
+		return false
+	}
+	if p.EndsAt != nil && !t.Before(*p.EndsAt) {
+		return false
+	}
+
+	return true
+}
+
+// Discount is how many tokens the promotion takes off order, rounded down.
+func (p Promotion) Discount(order Order) int {
+	switch p.Type {
+	case PromotionBundle:
+		bundles, bundlePrice := -1, 0
+		for _, item := range p.Items {
+			line, ok := order.line(item.StockID)
+			if !ok || item.Quantity <= 0 {
+				return 0
+			}
+			if n := line.Quantity / item.Quantity; bundles < 0 || n < bundles {
+				bundles = n
+			}
+			bundlePrice += line.UnitCost * item.Quantity
+		}
+		if bundles <= 0 || bundlePrice <= p.BundlePrice {
+			return 0
+		}
+		return bundles * (bundlePrice - p.BundlePrice)
+	case PromotionPercentOff:
+		tokens := 0
+		for _, line := range order.Lines {
+			if p.covers(line.StockID) {
+				tokens += line.Tokens
+			}
+		}
+		return tokens * p.PercentOff / 100
+	case PromotionBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return 0
+		}
+		discount := 0
+		for _, line := range order.Lines {
+			if p.covers(line.StockID) {
+				free := line.Quantity / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+				discount += free * line.UnitCost * p.PercentOff / 100
+			}
+		}
+		return discount
+	}
+
+	return 0
+}
+
+func (p Promotion) covers(stockID uint) bool {
+	return len(p.Items) == 0 || slices.ContainsFunc(p.Items, func(i PromotionItem) bool { return i.StockID == stockID })
+}
+
+func (o Order) line(stockID uint) (OrderLine, bool) {
+	i := slices.IndexFunc(o.Lines, func(l OrderLine) bool { return l.StockID == stockID })
+	if i < 0 {
+		return OrderLine{}, false
+	}
+
+	return o.Lines[i], true
+}
+
+// ApplyBestPromotion takes off the order the promotion, among those on at t,
+// giving the largest discount. Promotions don't add up: one applies at most.
+func (o *Order) ApplyBestPromotion(promotions []Promotion, at time.Time) {
+	var best *Promotion
+	bestDiscount := 0
+	for i, promotion := range promotions {
+		if !promotion.AppliesAt(at) {
+			continue
+		}
+		// Never below one token, spends must move something.
+		discount := min(promotion.Discount(*o), o.TotalTokens+o.Discount-1)
+		if discount > bestDiscount {
+			best, bestDiscount = &promotions[i], discount
+		}
+	}
+	if best == nil {
+		return
+	}
+
+	o.TotalTokens += o.Discount - bestDiscount
+	o.Discount = bestDiscount
+	o.PromotionID = &best.ID
+}
@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromotion_Validate(t *testing.T) {
+	start := time.Date(2024, 6, 15, 16, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	valid := []Promotion{
+		{Type: PromotionBundle, Items: []PromotionItem{{StockID: 11, Quantity: 1}, {StockID: 12, Quantity: 1}}, BundlePrice: 2},
+		{Type: PromotionBundle, Items: []PromotionItem{{StockID: 11, Quantity: 3}}, BundlePrice: 5},
+		{Type: PromotionPercentOff, PercentOff: 50, StartsAt: &start, EndsAt: &end},
+		{Type: PromotionBuyXGetY, Items: []PromotionItem{{StockID: 12}}, BuyQuantity: 2, GetQuantity: 1, PercentOff: 100},
+	}
+	for _, promotion := range valid {
+		assert.NoError(t, promotion.Validate(testStand), promotion)
+	}
+
+	invalid := []Promotion{
+		{Type: "free_for_all"},
+		{Type: PromotionBundle, Items: []PromotionItem{{StockID: 11, Quantity: 1}}, BundlePrice: 1},
+		{Type: PromotionBundle, Items: []PromotionItem{{StockID: 11, Quantity: 2}}},
+		{Type: PromotionBundle, Items: []PromotionItem{{StockID: 11, Quantity: 2}, {StockID: 12}}, BundlePrice: 3},
+		{Type: PromotionPercentOff, PercentOff: 100},
+		{Type: PromotionPercentOff, PercentOff: 10, Items: []PromotionItem{{StockID: 99}}},
+		{Type: PromotionPercentOff, PercentOff: 10, StartsAt: &end, EndsAt: &start},
+		{Type: PromotionBuyXGetY, BuyQuantity: 2, PercentOff: 100},
+	}
+	for _, promotion := range invalid {
+		assert.ErrorIs(t, promotion.Validate(testStand), ErrInvalidPromotion, promotion)
+	}
+}
+
+func TestPromotion_Discount(t *testing.T) {
+	order, err := NewOrder(testStand, []CartLine{{StockID: 11, Quantity: 3}, {StockID: 12, Quantity: 5}})
+	require.NoError(t, err)
+	require.Equal(t, 11, order.TotalTokens)
+
+	// Two crêpe and juice bundles can be made out of the order.
+	bundle := Promotion{Type: PromotionBundle, Items: []PromotionItem{{StockID: 11, Quantity: 1}, {StockID: 12, Quantity: 2}}, BundlePrice: 3}
+	assert.Equal(t, 2, bundle.Discount(order))
+
+	// A bundle that costs more than its items is no deal.
+	bundle.BundlePrice = 5
+	assert.Equal(t, 0, bundle.Discount(order))
+
+	percentOff := Promotion{Type: PromotionPercentOff, PercentOff: 50, Items: []PromotionItem{{StockID: 12}}}
+	assert.Equal(t, 2, percentOff.Discount(order))
+	percentOff.Items = nil
+	assert.Equal(t, 5, percentOff.Discount(order))
+
+	// Buy two juices, get one free: one of the five juices is.
+	buyXGetY := Promotion{Type: PromotionBuyXGetY, Items: []PromotionItem{{StockID: 12}}, BuyQuantity: 2, GetQuantity: 1, PercentOff: 100}
+	assert.Equal(t, 1, buyXGetY.Discount(order))
+}
+
+func TestPromotion_AppliesAt(t *testing.T) {
+	start := time.Date(2024, 6, 15, 16, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	happyHour := Promotion{Active: true, StartsAt: &start, EndsAt: &end}
+
+	assert.False(t, happyHour.AppliesAt(start.Add(-time.Minute)))
+	assert.True(t, happyHour.AppliesAt(start))
+	assert.True(t, happyHour.AppliesAt(end.Add(-time.Minute)))
+	assert.False(t, happyHour.AppliesAt(end))
+
+	happyHour.Active = false
+	assert.False(t, happyHour.AppliesAt(start))
+}
+
+func TestOrder_ApplyBestPromotion(t *testing.T) {
+	at := time.Date(2024, 6, 15, 16, 30, 0, 0, time.UTC)
+	later := at.Add(time.Hour)
+	promotions := []Promotion{
+		{ID: 1, Active: true, Type: PromotionPercentOff, PercentOff: 10},
+		{ID: 2, Active: true, Type: PromotionBundle, Items: []PromotionItem{{StockID: 11, Quantity: 2}}, BundlePrice: 3},
+		{ID: 3, Active: true, Type: PromotionPercentOff, PercentOff: 90, StartsAt: &later},
+	}
+
+	order, err := NewOrder(testStand, []CartLine{{StockID: 11, Quantity: 4}})
+	require.NoError(t, err)
+	order.ApplyBestPromotion(promotions, at)
+
+	require.NotNil(t, order.PromotionID)
+	assert.Equal(t, uint(2), *order.PromotionID)
+	assert.Equal(t, 2, order.Discount)
+	assert.Equal(t, 6, order.TotalTokens)
+
+	spend := order.Spend()
+	assert.Equal(t, 6, spend.Amount)
+	assert.Equal(t, order.PromotionID, spend.PromotionID)
+
+	// Applying again starts over from the full price.
+	order.ApplyBestPromotion(promotions, later)
+	assert.Equal(t, uint(3), *order.PromotionID)
+	assert.Equal(t, 7, order.Discount)
+	assert.Equal(t, 1, order.TotalTokens)
+
+	// Orders never come out free.
+	order, err = NewOrder(testStand, []CartLine{{StockID: 12, Quantity: 1}})
+	require.NoError(t, err)
+	order.ApplyBestPromotion([]Promotion{{ID: 4, Active: true, Type: PromotionPercentOff, PercentOff: 99}}, at)
+	assert.Nil(t, order.PromotionID)
+	assert.Equal(t, 1, order.TotalTokens)
+}
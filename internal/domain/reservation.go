@@ -0,0 +1,70 @@
+package domain
+
+import "time"
+
+type ReservationStatus string
+
+const (
+	// ReservationHeld sets stock aside until the reservation expires.
+	ReservationHeld ReservationStatus = "held"
+	// ReservationConfirmed reservations were bought by their user.
+	ReservationConfirmed ReservationStatus = "confirmed"
+	// ReservationReleased reservations were given up or expired.
+	ReservationReleased ReservationStatus = "released"
+)
+
+// StockReservation holds Quantity units of a stock item for a user, e.g. a
+// student checking with their parent before paying. Only the user can buy
+// the units until the reservation expires: their next checkout at the stand
+// confirms it, and the reservation sweeper releases it once expired.
+type StockReservation struct {
+	ID         uint              `json:"id"`
+	KermesseID uint              `json:"kermesse_id"`
+	StandID    uint              `json:"stand_id"`
+	StockID    uint              `json:"stock_id"`
+	UserID     uint              `json:"user_id"`
+	Quantity   int               `json:"quantity"`
+	Status     ReservationStatus `json:"status"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+	// TransactionID is the spend that bought a confirmed reservation.
+	TransactionID *uint     `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewStockReservations reserves the items of cart at stand for the user
+// until expiresAt, one reservation per item.
+func NewStockReservations(stand Stand, userID uint, cart []CartLine, expiresAt time.Time) ([]StockReservation, error) {
+	// Pricing merges and sorts the lines, and checks the items.
+	order, err := NewOrder(stand, cart)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations := make([]StockReservation, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		reservations = append(reservations, StockReservation{
+			KermesseID: stand.KermesseID,
+			StandID:    stand.ID,
+			StockID:    line.StockID,
+			UserID:     userID,
+			Quantity:   line.Quantity,
+			Status:     ReservationHeld,
+			ExpiresAt:  expiresAt,
+		})
+	}
+
+	return reservations, nil
+}
+
+// HeldQuantities sums, per stock item, the units reservations still hold at
+// t.
+func HeldQuantities(reservations []StockReservation, t time.Time) map[uint]int {
+	held := map[uint]int{}
+	for _, reservation := range reservations {
+		if reservation.Status == ReservationHeld && t.Before(reservation.ExpiresAt) {
+			held[reservation.StockID] += reservation.Quantity
+		}
+	}
+
+	return held
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStockReservations(t *testing.T) {
+	expiresAt := time.Date(2024, 6, 15, 16, 10, 0, 0, time.UTC)
+	reservations, err := NewStockReservations(testStand, 5, []CartLine{
+		{StockID: 12, Quantity: 1},
+		{StockID: 11, Quantity: 1},
+		{StockID: 12, Quantity: 1},
+	}, expiresAt)
+	require.NoError(t, err)
+
+	assert.Equal(t, []StockReservation{
+		{KermesseID: 3, StandID: 7, StockID: 11, UserID: 5, Quantity: 1, Status: ReservationHeld, ExpiresAt: expiresAt},
+		{KermesseID: 3, StandID: 7, StockID: 12, UserID: 5, Quantity: 2, Status: ReservationHeld, ExpiresAt: expiresAt},
+	}, reservations)
+
+	_, err = NewStockReservations(testStand, 5, []CartLine{{StockID: 99, Quantity: 1}}, expiresAt)
+	assert.ErrorIs(t, err, ErrItemNotInStand)
+}
+
+func TestHeldQuantities(t *testing.T) {
+	now := time.Date(2024, 6, 15, 16, 0, 0, 0, time.UTC)
+	held := HeldQuantities([]StockReservation{
+		{StockID: 11, Quantity: 1, Status: ReservationHeld, ExpiresAt: now.Add(time.Minute)},
+		{StockID: 11, Quantity: 2, Status: ReservationHeld, ExpiresAt: now.Add(time.Minute)},
+		{StockID: 12, Quantity: 1, Status: ReservationHeld, ExpiresAt: now},
+		{StockID: 12, Quantity: 4, Status: ReservationConfirmed, ExpiresAt: now.Add(time.Minute)},
+	}, now)
+
+	assert.Equal(t, map[uint]int{11: 3}, held)
+}
+
+func TestStock_AvailableQuantity(t *testing.T) {
+	assert.Equal(t, 3, Stock{Quantity: 5, Reserved: 2}.AvailableQuantity())
+	// Offline sales can take the quantity below what's reserved.
+	assert.Equal(t, 0, Stock{Quantity: 1, Reserved: 2}.AvailableQuantity())
+}
@@ -1,6 +1,13 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrStandClosed is returned when a sale is made outside the opening hours
+// of a stand.
+var ErrStandClosed = errors.New("stand is closed at this time")
 
 type Stand struct {
 	ID          uint   `gorm:"primaryKey"`
@@ -14,4 +21,84 @@ type Stand struct {
 	PointsGiven int      `gorm:"default:0"` // Only for activity stands
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	// ArchivedAt is when the stand was removed. Archived stands take no new
+	// sales but stay around for the transactions that refer to them.
+	ArchivedAt *time.Time
+	// OpensAt and ClosesAt narrow when the stand takes sales. Either left
+	// out falls back to the start or end of the kermesse.
+	OpensAt  *time.Time `json:"opens_at,omitempty"`
+	ClosesAt *time.Time `json:"closes_at,omitempty"`
+}
+
+func (s Stand) IsArchived() bool {
+	return s.ArchivedAt != nil
+}
+
+// OpeningHours returns when the stand takes sales at kermesse: its own
+// hours, cut to those of the kermesse. A nil bound leaves that side open.
+func (s Stand) OpeningHours(kermesse Kermesse) (opens, closes *time.Time) {
+	opens, closes = kermesse.StartsAt, kermesse.EndsAt
+	if s.OpensAt != nil && (opens == nil || s.OpensAt.After(*opens)) {
+		opens = s.OpensAt
+	}
+	if s.ClosesAt != nil && (closes == nil || s.ClosesAt.Before(*closes)) {
+		closes = s.ClosesAt
+	}
+
+	return opens, closes
+}
+
+// IsOpenAt tells whether the stand takes sales at kermesse at time t.
+func (s Stand) IsOpenAt(kermesse Kermesse, t time.Time) bool {
+	opens, closes := s.OpeningHours(kermesse)
+
+	return (opens == nil || !t.Before(*opens)) && (closes == nil || t.Before(*closes))
+}
+
+// CheckOpeningHours returns ErrInvalidSchedule when the stand would never be
+// open at kermesse.
+func (s Stand) CheckOpeningHours(kermesse Kermesse) error {
+	opens, closes := s.OpeningHours(kermesse)
+	if opens != nil && closes != nil && !opens.Before(*closes) {
+		return ErrInvalidSchedule
+	}
+
+	return nil
+}
+
+// InLocation returns the stand with its times in loc.
+func (s Stand) InLocation(loc *time.Location) Stand {
+	s.CreatedAt = s.CreatedAt.In(loc)
+	s.UpdatedAt = s.UpdatedAt.In(loc)
+	s.ArchivedAt = timeIn(s.ArchivedAt, loc)
+	s.OpensAt = timeIn(s.OpensAt, loc)
+	s.ClosesAt = timeIn(s.ClosesAt, loc)
+
+	return s
+}
+
+// Live returns the stand without its archived stock items.
+func (s Stand) Live() Stand {
+	var stock []Stock
+	for _, item := range s.Stock {
+		if !item.IsArchived() {
+			stock = append(stock, item)
+		}
+	}
+	s.Stock = stock
+
+	return s
+}
+
+// LiveStands returns the stands that aren't archived, without their archived
+// stock items.
+func LiveStands(stands []Stand) []Stand {
+	live := make([]Stand, 0, len(stands))
+	for _, stand := range stands {
+		if !stand.IsArchived() {
+			live = append(live, stand.Live())
+		}
+	}
+
+	return live
 }
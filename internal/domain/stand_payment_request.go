@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// paymentRequestPrefix starts every payment request payload, so that the
+// format can change without breaking printed codes.
+const paymentRequestPrefix = "kpr1"
+
+var (
+	// ErrInvalidPaymentRequest is returned for payloads that are malformed or
+	// weren't signed by us.
+	ErrInvalidPaymentRequest = errors.New("invalid payment request")
+	// ErrPaymentRequestExpired is returned for payment requests past their
+	// expiry.
+	ErrPaymentRequestExpired = errors.New("payment request expired")
+)
+
+// StandPaymentRequest is a stand asking for a given cart to be paid. It is
+// handed to the buyer as a signed payload, usually through a QR code, and
+// can be paid once before it expires.
+type StandPaymentRequest struct {
+	ID         string     `json:"id"`
+	KermesseID uint       `json:"kermesse_id"`
+	StandID    uint       `json:"stand_id"`
+	Lines      []CartLine `json:"lines"`
+	// Amount is the token price of the cart when the request was issued.
+	Amount    int       `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SignedStandPaymentRequest is a payment request along with the payload
+// buyers pay it with.
+type SignedStandPaymentRequest struct {
+	StandPaymentRequest
+	Payload string `json:"payload"`
+}
+
+// paymentRequestClaims is the signed body of a payload, kept short so that
+// QR codes stay small.
+type paymentRequestClaims struct {
+	ID         string   `json:"i"`
+	KermesseID uint     `json:"k"`
+	StandID    uint     `json:"s"`
+	Lines      [][2]int `json:"l"`
+	Amount     int      `json:"a"`
+	ExpiresAt  int64    `json:"e"`
+}
+
+// NewStandPaymentRequest issues a payment request for order, valid for ttl.
+func NewStandPaymentRequest(order Order, ttl time.Duration) (StandPaymentRequest, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return StandPaymentRequest{}, fmt.Errorf("rand.Read -> %w", err)
+	}
+
+	request := StandPaymentRequest{
+		ID:         base64.RawURLEncoding.EncodeToString(nonce),
+		KermesseID: order.KermesseID,
+		StandID:    order.StandID,
+		Amount:     order.TotalTokens,
+		ExpiresAt:  time.Now().Add(ttl).Truncate(time.Second),
+	}
+	for _, line := range order.Lines {
+		request.Lines = append(request.Lines, CartLine{StockID: line.StockID, Quantity: line.Quantity})
+	}
+
+	return request, nil
+}
+
+// Sign returns the payload of the request, signed with key.
+func (r StandPaymentRequest) Sign(key []byte) string {
+	claims := paymentRequestClaims{
+		ID:         r.ID,
+		KermesseID: r.KermesseID,
+		StandID:    r.StandID,
+		Amount:     r.Amount,
+		ExpiresAt:  r.ExpiresAt.Unix(),
+	}
+	for _, line := range r.Lines {
+		claims.Lines = append(claims.Lines, [2]int{int(line.StockID), line.Quantity})
+	}
+
+	// Marshalling plain numbers and strings can't fail.
+	body, _ := json.Marshal(claims)
+	signed := paymentRequestPrefix + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signPaymentRequest(signed, key))
+}
+
+// Expired tells whether the request can no longer be paid.
+func (r StandPaymentRequest) Expired() bool {
+	return !time.Now().Before(r.ExpiresAt)
+}
+
+// ParseStandPaymentRequest checks the signature of payload and returns the
+// request it carries. Expiry is left to the caller.
+func ParseStandPaymentRequest(payload string, key []byte) (StandPaymentRequest, error) {
+	i := strings.LastIndexByte(payload, '.')
+	if i < 0 || !strings.HasPrefix(payload, paymentRequestPrefix+".") {
+		return StandPaymentRequest{}, ErrInvalidPaymentRequest
+	}
+	signed, signature := payload[:i], payload[i+1:]
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signPaymentRequest(signed, key)) {
+		return StandPaymentRequest{}, ErrInvalidPaymentRequest
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(signed, paymentRequestPrefix+"."))
+	if err != nil {
+		return StandPaymentRequest{}, ErrInvalidPaymentRequest
+	}
+	var claims paymentRequestClaims
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return StandPaymentRequest{}, ErrInvalidPaymentRequest
+	}
+
+	request := StandPaymentRequest{
+		ID:         claims.ID,
+		KermesseID: claims.KermesseID,
+		StandID:    claims.StandID,
+		Amount:     claims.Amount,
+		ExpiresAt:  time.Unix(claims.ExpiresAt, 0),
+	}
+	for _, line := range claims.Lines {
+		if line[0] <= 0 {
+			return StandPaymentRequest{}, ErrInvalidPaymentRequest
+		}
+		request.Lines = append(request.Lines, CartLine{StockID: uint(line[0]), Quantity: line[1]})
+	}
+
+	return request, nil
+}
+
+func signPaymentRequest(signed string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+
+	return mac.Sum(nil)
+}
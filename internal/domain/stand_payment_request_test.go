@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStandPaymentRequest_Sign(t *testing.T) {
+	key := []byte("test_key")
+	order, err := NewOrder(testStand, []CartLine{{StockID: 11, Quantity: 2}, {StockID: 12, Quantity: 1}})
+	require.NoError(t, err)
+
+	request, err := NewStandPaymentRequest(order, 5*time.Minute)
+	require.NoError(t, err)
+	assert.NotEmpty(t, request.ID)
+	assert.Equal(t, 5, request.Amount)
+	assert.False(t, request.Expired())
+
+	payload := request.Sign(key)
+	assert.True(t, strings.HasPrefix(payload, "kpr1."))
+
+	got, err := ParseStandPaymentRequest(payload, key)
+	require.NoError(t, err)
+	assert.Equal(t, request.ID, got.ID)
+	assert.Equal(t, request.KermesseID, got.KermesseID)
+	assert.Equal(t, request.StandID, got.StandID)
+	assert.Equal(t, request.Lines, got.Lines)
+	assert.Equal(t, request.Amount, got.Amount)
+	assert.True(t, request.ExpiresAt.Equal(got.ExpiresAt))
+
+	_, err = ParseStandPaymentRequest(payload, []byte("other_key"))
+	assert.ErrorIs(t, err, ErrInvalidPaymentRequest)
+
+	// Tampering with the body breaks the signature.
+	parts := strings.Split(payload, ".")
+	request.Amount = 1
+	forged := strings.Split(request.Sign([]byte("other_key")), ".")
+	_, err = ParseStandPaymentRequest(parts[0]+"."+forged[1]+"."+parts[2], key)
+	assert.ErrorIs(t, err, ErrInvalidPaymentRequest)
+
+	for _, payload := range []string{"", "kpr1", "kpr1.e30", "kpr1.e30.!!", "kpr2." + parts[1] + "." + parts[2]} {
+		_, err = ParseStandPaymentRequest(payload, key)
+		assert.ErrorIs(t, err, ErrInvalidPaymentRequest, payload)
+	}
+}
+
+func TestStandPaymentRequest_Expired(t *testing.T) {
+	assert.True(t, StandPaymentRequest{ExpiresAt: time.Now().Add(-time.Second)}.Expired())
+	assert.False(t, StandPaymentRequest{ExpiresAt: time.Now().Add(time.Minute)}.Expired())
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// StandRole is what a member of the staff of a stand may do there.
+type StandRole string
+
+const (
+	// StandManager runs the stand: edits it and its stock, and manages its
+	// staff.
+	StandManager StandRole = "manager"
+	// StandCashier sells at the stand.
+	StandCashier StandRole = "cashier"
+)
+
+const (
+	// invitationCodeAlphabet leaves out characters easily mistaken for one
+	// another, such as 0 and O, when copied from an email.
+	invitationCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	invitationCodeLength   = 8
+)
+
+var (
+	// ErrInvitationNotFound is returned for unknown codes, and for codes sent
+	// to another email address than the one of the user.
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrInvitationExpired is returned for invitations past their expiry.
+	ErrInvitationExpired = errors.New("invitation expired")
+	// ErrInvitationUsed is returned for invitations already accepted.
+	ErrInvitationUsed = errors.New("invitation already accepted")
+)
+
+// StandStaff is a user working at a stand. A user can work several stands,
+// at the same kermesse or at different ones, each with its own role.
+type StandStaff struct {
+	StandID    uint      `json:"stand_id"`
+	KermesseID uint      `json:"kermesse_id"`
+	UserID     uint      `json:"user_id"`
+	Name       string    `json:"name,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	Role       StandRole `json:"role"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CanManage tells whether the member can edit the stand and its staff.
+func (s StandStaff) CanManage() bool {
+	return s.Role == StandManager
+}
+
+// StandInvitation asks the owner of an email address to join the staff of a
+// stand. The code is sent to that address and is accepted once.
+type StandInvitation struct {
+	ID         uint       `json:"id"`
+	StandID    uint       `json:"stand_id"`
+	KermesseID uint       `json:"kermesse_id"`
+	Email      string     `json:"email"`
+	Role       StandRole  `json:"role"`
+	Code       string     `json:"-"`
+	InvitedBy  uint       `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedBy *uint      `json:"accepted_by,omitempty"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NewStandInvitation invites email to the staff of stand as role, for ttl.
+func NewStandInvitation(stand Stand, email string, role StandRole, invitedBy uint, ttl time.Duration) (StandInvitation, error) {
+	code := make([]byte, invitationCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(invitationCodeAlphabet))))
+		if err != nil {
+			return StandInvitation{}, fmt.Errorf("rand.Int -> %w", err)
+		}
+		code[i] = invitationCodeAlphabet[n.Int64()]
+	}
+
+	return StandInvitation{
+		StandID:    stand.ID,
+		KermesseID: stand.KermesseID,
+		Email:      strings.ToLower(strings.TrimSpace(email)),
+		Role:       role,
+		Code:       string(code),
+		InvitedBy:  invitedBy,
+		ExpiresAt:  time.Now().Add(ttl).Truncate(time.Second),
+	}, nil
+}
+
+// NormalizeInvitationCode puts a code typed by a user in the form codes are
+// stored in.
+func NormalizeInvitationCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CheckAcceptable tells whether user can accept the invitation at time t.
+func (i StandInvitation) CheckAcceptable(user User, t time.Time) error {
+	if !strings.EqualFold(i.Email, strings.TrimSpace(user.Email)) {
+		return ErrInvitationNotFound
+	}
+	if i.AcceptedAt != nil {
+		return ErrInvitationUsed
+	}
+	if !t.Before(i.ExpiresAt) {
+		return ErrInvitationExpired
+	}
+
+	return nil
+}
+
+// InLocation returns the invitation with its times in loc.
+func (i StandInvitation) InLocation(loc *time.Location) StandInvitation {
+	i.ExpiresAt = i.ExpiresAt.In(loc)
+	i.AcceptedAt = timeIn(i.AcceptedAt, loc)
+	i.CreatedAt = i.CreatedAt.In(loc)
+
+	return i
+}
@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStandInvitation(t *testing.T) {
+	invitation, err := NewStandInvitation(testStand, " Holder@Test.com ", StandCashier, 5, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, testStand.ID, invitation.StandID)
+	assert.Equal(t, testStand.KermesseID, invitation.KermesseID)
+	assert.Equal(t, "holder@test.com", invitation.Email)
+	assert.Equal(t, StandCashier, invitation.Role)
+	assert.Equal(t, uint(5), invitation.InvitedBy)
+	assert.Len(t, invitation.Code, invitationCodeLength)
+	assert.Equal(t, invitation.Code, NormalizeInvitationCode(" "+strings.ToLower(invitation.Code)))
+
+	other, err := NewStandInvitation(testStand, "holder@test.com", StandCashier, 5, time.Hour)
+	require.NoError(t, err)
+	assert.NotEqual(t, invitation.Code, other.Code)
+}
+
+func TestStandInvitation_CheckAcceptable(t *testing.T) {
+	now := time.Now()
+	acceptedAt := now.Add(-time.Minute)
+	invitation := StandInvitation{Email: "holder@test.com", ExpiresAt: now.Add(time.Hour)}
+	accepted := invitation
+	accepted.AcceptedAt = &acceptedAt
+	holder := User{Email: "Holder@test.com"}
+
+	tests := []struct {
+		name       string
+		invitation StandInvitation
+		user       User
+		at         time.Time
+		wantErr    error
+	}{
+		{name: "Acceptable", invitation: invitation, user: holder, at: now},
+		{name: "Other email", invitation: invitation, user: User{Email: "other@test.com"}, at: now, wantErr: ErrInvitationNotFound},
+		{name: "Accepted", invitation: accepted, user: holder, at: now, wantErr: ErrInvitationUsed},
+		{name: "Expired", invitation: invitation, user: holder, at: now.Add(time.Hour), wantErr: ErrInvitationExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.invitation.CheckAcceptable(tt.user, tt.at)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveStands(t *testing.T) {
+	archivedAt := time.Now()
+	stands := []Stand{
+		{ID: 1, Stock: []Stock{{ID: 11}, {ID: 12, ArchivedAt: &archivedAt}}},
+		{ID: 2, ArchivedAt: &archivedAt, Stock: []Stock{{ID: 21}}},
+		{ID: 3},
+	}
+
+	live := LiveStands(stands)
+	assert.Len(t, live, 2)
+	assert.Equal(t, uint(1), live[0].ID)
+	assert.Equal(t, []Stock{{ID: 11}}, live[0].Stock)
+	assert.Equal(t, uint(3), live[1].ID)
+	assert.Empty(t, live[1].Stock)
+
+	// The stands given are left alone.
+	assert.Len(t, stands[0].Stock, 2)
+}
+
+func TestStand_IsOpenAt(t *testing.T) {
+	at := func(hour int) *time.Time {
+		t := time.Date(2026, 6, 20, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	fair := Kermesse{StartsAt: at(10), EndsAt: at(18)}
+
+	tests := []struct {
+		name     string
+		kermesse Kermesse
+		stand    Stand
+		open     []int
+		closed   []int
+	}{
+		{
+			name:     "Kermesse without hours",
+			kermesse: Kermesse{},
+			stand:    Stand{},
+			open:     []int{0, 12, 23},
+		},
+		{
+			name:     "Hours of the kermesse",
+			kermesse: fair,
+			stand:    Stand{},
+			open:     []int{10, 17},
+			closed:   []int{9, 18},
+		},
+		{
+			name:     "Own hours",
+			kermesse: fair,
+			stand:    Stand{OpensAt: at(12), ClosesAt: at(14)},
+			open:     []int{12, 13},
+			closed:   []int{11, 14},
+		},
+		{
+			name:     "Own closing only",
+			kermesse: fair,
+			stand:    Stand{ClosesAt: at(12)},
+			open:     []int{10, 11},
+			closed:   []int{9, 12},
+		},
+		{
+			name:     "Cut to the hours of the kermesse",
+			kermesse: fair,
+			stand:    Stand{OpensAt: at(8), ClosesAt: at(20)},
+			open:     []int{10, 17},
+			closed:   []int{8, 18},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, hour := range tt.open {
+				assert.True(t, tt.stand.IsOpenAt(tt.kermesse, *at(hour)), "open at %d", hour)
+			}
+			for _, hour := range tt.closed {
+				assert.False(t, tt.stand.IsOpenAt(tt.kermesse, *at(hour)), "closed at %d", hour)
+			}
+		})
+	}
+}
+
+func TestStand_CheckOpeningHours(t *testing.T) {
+	at := func(hour int) *time.Time {
+		t := time.Date(2026, 6, 20, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	fair := Kermesse{StartsAt: at(10), EndsAt: at(18)}
+
+	assert.NoError(t, Stand{}.CheckOpeningHours(fair))
+	assert.NoError(t, Stand{OpensAt: at(12), ClosesAt: at(14)}.CheckOpeningHours(fair))
+	assert.NoError(t, Stand{OpensAt: at(20)}.CheckOpeningHours(Kermesse{}))
+
+	assert.ErrorIs(t, Stand{OpensAt: at(14), ClosesAt: at(12)}.CheckOpeningHours(fair), ErrInvalidSchedule)
+	assert.ErrorIs(t, Stand{OpensAt: at(18)}.CheckOpeningHours(fair), ErrInvalidSchedule)
+	assert.ErrorIs(t, Stand{ClosesAt: at(9)}.CheckOpeningHours(fair), ErrInvalidSchedule)
+}
@@ -0,0 +1,185 @@
+package domain
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostedStatuses are the statuses of transactions that moved tokens.
+var PostedStatuses = []string{"Completed", "Validated", "Approved"}
+
+// FamilyStatement is what a parent and their children bought, gave, spent and
+// got back at a kermesse.
+type FamilyStatement struct {
+	KermesseID   uint                `json:"kermesse_id"`
+	KermesseName string              `json:"kermesse_name"`
+	Currency     string              `json:"currency"`
+	Parent       StatementMember     `json:"parent"`
+	Children     []StatementMember   `json:"children"`
+	Purchases    []StatementPurchase `json:"purchases"`
+	Transfers    []StatementTransfer `json:"transfers"`
+	Spends       []StatementSpend    `json:"spends"`
+	Refunds      []StatementRefund   `json:"refunds"`
+	Balances     []StatementBalance  `json:"balances"`
+	GeneratedAt  time.Time           `json:"generated_at"`
+}
+
+type StatementMember struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type StatementPurchase struct {
+	TransactionID uint          `json:"transaction_id"`
+	Date          time.Time     `json:"date"`
+	Tokens        int           `json:"tokens"`
+	Amount        int64         `json:"amount"` // In the currency's minor unit.
+	Method        PaymentMethod `json:"method"`
+	Status        string        `json:"status"`
+}
+
+// StatementTransfer is tokens a parent gave to one of their children.
+type StatementTransfer struct {
+	TransactionID uint      `json:"transaction_id"`
+	Date          time.Time `json:"date"`
+	Child         string    `json:"child"`
+	Tokens        int       `json:"tokens"`
+}
+
+// StatementSpend sums up what a family member bought of an item at a stand.
+type StatementSpend struct {
+	Member   string `json:"member"`
+	Stand    string `json:"stand"`
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	Tokens   int    `json:"tokens"`
+}
+
+// StatementRefund is either a stand purchase given back, in tokens, or
+// unused tokens paid back on the parent's card once the kermesse closed.
+type StatementRefund struct {
+	TransactionID uint                 `json:"transaction_id"`
+	Date          time.Time            `json:"date"`
+	Type          TokenTransactionType `json:"type"`
+	Member        string               `json:"member"`
+	Stand         string               `json:"stand,omitempty"`
+	Tokens        int                  `json:"tokens"`
+	Amount        int64                `json:"amount,omitempty"` // Money paid back, for card refunds.
+	Status        string               `json:"status"`
+}
+
+type StatementBalance struct {
+	Member string `json:"member"`
+	Tokens int    `json:"tokens"`
+}
+
+// NewFamilyStatement builds the statement of parent and children at kermesse
+// from their transactions there, in chronological order. Stands give names to
+// the stands and items spends refer to. Balances are left to the caller.
+func NewFamilyStatement(kermesse Kermesse, parent User, children []User, stands []Stand, transactions []TokenTransaction) FamilyStatement {
+	statement := FamilyStatement{
+		KermesseID:   kermesse.ID,
+		KermesseName: kermesse.Name,
+		Currency:     kermesse.Currency,
+		Parent:       StatementMember{ID: parent.ID, Name: parent.Name},
+		Children:     []StatementMember{},
+		Purchases:    []StatementPurchase{},
+		Transfers:    []StatementTransfer{},
+		Spends:       []StatementSpend{},
+		Refunds:      []StatementRefund{},
+		Balances:     []StatementBalance{},
+	}
+
+	names := map[string]string{memberKey("parent", parent.ID): parent.Name}
+	for _, child := range children {
+		statement.Children = append(statement.Children, StatementMember{ID: child.ID, Name: child.Name})
+		names[memberKey("student", child.ID)] = child.Name
+	}
+	memberName := func(memberType string, id uint) string {
+		return names[memberKey(memberType, id)]
+	}
+
+	standNames := map[uint]string{}
+	itemNames := map[uint]string{}
+	for _, stand := range stands {
+		standNames[stand.ID] = stand.Name
+		for _, item := range stand.Stock {
+			itemNames[item.ID] = item.ItemName
+		}
+	}
+	standName := func(standID *uint) string {
+		if standID == nil {
+			return ""
+		}
+		return standNames[*standID]
+	}
+
+	spends := map[StatementSpend]int{} // Index in statement.Spends, by member, stand and item.
+	for _, tt := range transactions {
+		switch tt.Type {
+		case TokenPurchase:
+			statement.Purchases = append(statement.Purchases, StatementPurchase{
+				TransactionID: tt.ID,
+				Date:          tt.CreatedAt,
+				Tokens:        tt.Amount,
+				Amount:        tt.MoneyAmount,
+				Method:        tt.PaymentMethod,
+				Status:        tt.Status,
+			})
+		case TokenDistribution:
+			if !strings.EqualFold(tt.ToType, "student") {
+				continue
+			}
+			statement.Transfers = append(statement.Transfers, StatementTransfer{
+				TransactionID: tt.ID,
+				Date:          tt.CreatedAt,
+				Child:         memberName(tt.ToType, tt.ToID),
+				Tokens:        tt.Amount,
+			})
+		case TokenSpend:
+			if !slices.Contains(PostedStatuses, tt.Status) {
+				continue
+			}
+			key := StatementSpend{Member: memberName(tt.FromType, tt.FromID), Stand: standName(tt.StandID)}
+			if tt.StockID != nil {
+				key.Item = itemNames[*tt.StockID]
+			}
+			i, ok := spends[key]
+			if !ok {
+				i = len(statement.Spends)
+				spends[key] = i
+				statement.Spends = append(statement.Spends, key)
+			}
+			statement.Spends[i].Quantity += max(tt.Quantity, 1)
+			statement.Spends[i].Tokens += tt.Amount
+		case TokenReversal:
+			statement.Refunds = append(statement.Refunds, StatementRefund{
+				TransactionID: tt.ID,
+				Date:          tt.CreatedAt,
+				Type:          tt.Type,
+				Member:        memberName(tt.ToType, tt.ToID),
+				Stand:         standName(tt.StandID),
+				Tokens:        tt.Amount,
+				Status:        tt.Status,
+			})
+		case TokenRefund:
+			statement.Refunds = append(statement.Refunds, StatementRefund{
+				TransactionID: tt.ID,
+				Date:          tt.CreatedAt,
+				Type:          tt.Type,
+				Member:        memberName(tt.FromType, tt.FromID),
+				Tokens:        tt.Amount,
+				Amount:        tt.MoneyAmount,
+				Status:        tt.Status,
+			})
+		}
+	}
+
+	return statement
+}
+
+func memberKey(memberType string, id uint) string {
+	return strings.ToLower(memberType) + ":" + strconv.FormatUint(uint64(id), 10)
+}
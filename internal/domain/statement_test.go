@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFamilyStatement(t *testing.T) {
+	standID, crepeID, juiceID := uint(5), uint(6), uint(7)
+	at := time.Date(2024, 6, 1, 14, 0, 0, 0, time.UTC)
+
+	kermesse := Kermesse{ID: 1, Name: "Summer fair", Currency: "eur"}
+	parent := User{ID: 2, Name: "Alice", Role: "parent"}
+	children := []User{{ID: 3, Name: "Bob", Role: "student"}}
+	stands := []Stand{{ID: standID, Name: "Crêpes", Stock: []Stock{{ID: crepeID, ItemName: "Crêpe"}, {ID: juiceID, ItemName: "Juice"}}}}
+	transactions := []TokenTransaction{
+		{ID: 10, Type: TokenPurchase, FromID: 2, FromType: "parent", Amount: 10, MoneyAmount: 1000, PaymentMethod: PaymentMethodCard, Status: "Completed", CreatedAt: at},
+		{ID: 11, Type: TokenDistribution, FromID: 2, FromType: "parent", ToID: 3, ToType: "student", Amount: 6, Status: "Completed", CreatedAt: at},
+		{ID: 12, Type: TokenSpend, FromID: 3, FromType: "Student", ToID: standID, ToType: "Stand", StandID: &standID, StockID: &crepeID, Quantity: 2, Amount: 4, Status: "Validated", CreatedAt: at},
+		{ID: 13, Type: TokenSpend, FromID: 3, FromType: "Student", ToID: standID, ToType: "Stand", StandID: &standID, StockID: &crepeID, Quantity: 1, Amount: 2, Status: "Validated", CreatedAt: at},
+		{ID: 14, Type: TokenSpend, FromID: 2, FromType: "Parent", ToID: standID, ToType: "Stand", StandID: &standID, StockID: &juiceID, Quantity: 1, Amount: 1, Status: "Validated", CreatedAt: at},
+		{ID: 15, Type: TokenSpend, FromID: 3, FromType: "Student", ToID: standID, ToType: "Stand", StandID: &standID, StockID: &juiceID, Quantity: 1, Amount: 1, Status: "Rejected", CreatedAt: at},
+		{ID: 16, Type: TokenReversal, FromID: standID, FromType: "Stand", ToID: 3, ToType: "Student", StandID: &standID, StockID: &crepeID, Quantity: 1, Amount: 2, Status: "Completed", CreatedAt: at},
+		{ID: 17, Type: TokenRefund, FromID: 2, FromType: "parent", ToID: 2, ToType: "parent", Amount: 3, MoneyAmount: 300, Status: "Completed", CreatedAt: at},
+	}
+
+	got := NewFamilyStatement(kermesse, parent, children, stands, transactions)
+
+	assert.Equal(t, "Summer fair", got.KermesseName)
+	assert.Equal(t, []StatementMember{{ID: 3, Name: "Bob"}}, got.Children)
+	assert.Equal(t, []StatementPurchase{
+		{TransactionID: 10, Date: at, Tokens: 10, Amount: 1000, Method: PaymentMethodCard, Status: "Completed"},
+	}, got.Purchases)
+	assert.Equal(t, []StatementTransfer{
+		{TransactionID: 11, Date: at, Child: "Bob", Tokens: 6},
+	}, got.Transfers)
+	assert.Equal(t, []StatementSpend{
+		{Member: "Bob", Stand: "Crêpes", Item: "Crêpe", Quantity: 3, Tokens: 6},
+		{Member: "Alice", Stand: "Crêpes", Item: "Juice", Quantity: 1, Tokens: 1},
+	}, got.Spends)
+	assert.Equal(t, []StatementRefund{
+		{TransactionID: 16, Date: at, Type: TokenReversal, Member: "Bob", Stand: "Crêpes", Tokens: 2, Status: "Completed"},
+		{TransactionID: 17, Date: at, Type: TokenRefund, Member: "Alice", Tokens: 3, Amount: 300, Status: "Completed"},
+	}, got.Refunds)
+}
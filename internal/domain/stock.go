@@ -1,9 +1,34 @@
 package domain
 
+import "time"
+
 type Stock struct {
 	ID        uint   `gorm:"primaryKey"`
 	StandID   uint   `gorm:"not null"`
 	ItemName  string `gorm:"not null"`
 	Quantity  int    `gorm:"not null"`
-	TokenCost int    `gorm:"not null"` // Cost in tokens
+	TokenCost int    `gorm:"not null"`           // Cost in tokens
+	Reserved  int    `gorm:"not null;default:0"` // Held by reservations, still in Quantity
+	Available int    `gorm:"-"`                  // What can be bought or reserved
+	// LowStockThreshold is the quantity at which the stand runs low on the
+	// item. 0 turns low-stock alerts off.
+	LowStockThreshold int `gorm:"not null;default:0"`
+	// ArchivedAt is when the item was taken off sale. Archived items stay
+	// around for the orders and movements that refer to them.
+	ArchivedAt *time.Time
+}
+
+// AvailableQuantity is what's left of the stock once reservations are set
+// aside. Offline sales can take the quantity below what's reserved.
+func (s Stock) AvailableQuantity() int {
+	return max(s.Quantity-s.Reserved, 0)
+}
+
+// IsLow tells whether the stand is running low on the item.
+func (s Stock) IsLow() bool {
+	return s.LowStockThreshold > 0 && s.Quantity <= s.LowStockThreshold
+}
+
+func (s Stock) IsArchived() bool {
+	return s.ArchivedAt != nil
 }
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidStockMovement is returned for manual stock changes whose reason
+// doesn't fit the change, e.g. waste adding items.
+var ErrInvalidStockMovement = errors.New("invalid stock movement")
+
+type StockMovementReason string
+
+const (
+	StockSale       StockMovementReason = "sale"
+	StockRestock    StockMovementReason = "restock"
+	StockAdjustment StockMovementReason = "adjustment"
+	StockWaste      StockMovementReason = "waste"
+	StockRefund     StockMovementReason = "refund"
+)
+
+// AllowsManual tells whether stand holders can give the reason for a change
+// of delta items they make by hand: restocks add items, waste takes them
+// away and adjustments correct counts either way. Sales and refunds come
+// with their transactions only.
+func (r StockMovementReason) AllowsManual(delta int) bool {
+	switch r {
+	case StockRestock:
+		return delta > 0
+	case StockWaste:
+		return delta < 0
+	case StockAdjustment:
+		return delta != 0
+	}
+
+	return false
+}
+
+// StockMovement is an entry of the stock journal: Delta items of a stock
+// item came in or went out for Reason, leaving QuantityAfter in stock.
+type StockMovement struct {
+	ID            uint                `json:"id"`
+	StandID       uint                `json:"stand_id"`
+	StockID       uint                `json:"stock_id"`
+	Delta         int                 `json:"delta"`
+	QuantityAfter int                 `json:"quantity_after"`
+	Reason        StockMovementReason `json:"reason"`
+	// ActorID is the user the change came from: the buyer of a sale, the
+	// refunder of a refund, the stand holder otherwise.
+	ActorID       *uint     `json:"actor_id,omitempty"`
+	TransactionID *uint     `json:"transaction_id,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// StockItemAudit reconciles the quantity of a stock item against its
+// journal. A Difference tells of changes the journal doesn't explain, e.g.
+// stock created before it was kept.
+type StockItemAudit struct {
+	StockID         uint   `json:"stock_id"`
+	ItemName        string `json:"item_name"`
+	Quantity        int    `json:"quantity"`
+	JournalQuantity int    `json:"journal_quantity"`
+	Difference      int    `json:"difference"`
+}
+
+// StockAudit is the stock journal of a stand, reconciled item by item.
+type StockAudit struct {
+	StandID    uint             `json:"stand_id"`
+	Reconciled bool             `json:"reconciled"`
+	Items      []StockItemAudit `json:"items"`
+	Movements  []StockMovement  `json:"movements"`
+}
+
+// NewStockAudit reconciles the stock of stand against its movements.
+func NewStockAudit(stand Stand, movements []StockMovement) StockAudit {
+	journal := map[uint]int{}
+	for _, movement := range movements {
+		journal[movement.StockID] += movement.Delta
+	}
+
+	audit := StockAudit{
+		StandID:    stand.ID,
+		Reconciled: true,
+		Items:      make([]StockItemAudit, 0, len(stand.Stock)),
+		Movements:  movements,
+	}
+	for _, stock := range stand.Stock {
+		item := StockItemAudit{
+			StockID:         stock.ID,
+			ItemName:        stock.ItemName,
+			Quantity:        stock.Quantity,
+			JournalQuantity: journal[stock.ID],
+			Difference:      stock.Quantity - journal[stock.ID],
+		}
+		if item.Difference != 0 {
+			audit.Reconciled = false
+		}
+		audit.Items = append(audit.Items, item)
+	}
+
+	return audit
+}
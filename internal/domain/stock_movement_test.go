@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStockMovementReason_AllowsManual(t *testing.T) {
+	assert.True(t, StockRestock.AllowsManual(3))
+	assert.False(t, StockRestock.AllowsManual(-3))
+	assert.True(t, StockWaste.AllowsManual(-1))
+	assert.False(t, StockWaste.AllowsManual(1))
+	assert.True(t, StockAdjustment.AllowsManual(-1))
+	assert.True(t, StockAdjustment.AllowsManual(1))
+
+	// Sales and refunds only come with their transactions.
+	assert.False(t, StockSale.AllowsManual(-1))
+	assert.False(t, StockRefund.AllowsManual(1))
+}
+
+func TestNewStockAudit(t *testing.T) {
+	movements := []StockMovement{
+		{StockID: 11, Delta: 12, QuantityAfter: 12, Reason: StockRestock},
+		{StockID: 11, Delta: -1, QuantityAfter: 11, Reason: StockWaste},
+		{StockID: 11, Delta: -2, QuantityAfter: 9, Reason: StockSale},
+		{StockID: 11, Delta: 1, QuantityAfter: 10, Reason: StockRefund},
+		{StockID: 12, Delta: 4, QuantityAfter: 4, Reason: StockRestock},
+	}
+
+	audit := NewStockAudit(testStand, movements)
+	assert.Equal(t, uint(7), audit.StandID)
+	assert.False(t, audit.Reconciled)
+	assert.Equal(t, []StockItemAudit{
+		{StockID: 11, ItemName: "Crêpe", Quantity: 10, JournalQuantity: 10},
+		{StockID: 12, ItemName: "Juice", Quantity: 5, JournalQuantity: 4, Difference: 1},
+	}, audit.Items)
+	assert.Equal(t, movements, audit.Movements)
+
+	movements = append(movements, StockMovement{StockID: 12, Delta: 1, QuantityAfter: 5, Reason: StockAdjustment})
+	assert.True(t, NewStockAudit(testStand, movements).Reconciled)
+}
@@ -1,15 +1,27 @@
 package domain
 
 import (
+	"errors"
 	"time"
 )
 
+// ErrInvalidRefund is returned when giving back something that can't be
+// refunded, or more than is left to refund.
+var ErrInvalidRefund = errors.New("invalid refund")
+
 type TokenTransactionType string
 
 const (
 	TokenPurchase     TokenTransactionType = "Purchase"
 	TokenDistribution TokenTransactionType = "Distribution"
 	TokenSpend        TokenTransactionType = "Spend"
+	// TokenOpeningBalance carries balances held before the ledger existed.
+	TokenOpeningBalance TokenTransactionType = "OpeningBalance"
+	// TokenReversal gives the tokens of a spend back to the buyer.
+	TokenReversal TokenTransactionType = "Reversal"
+	// TokenRefund buys unused tokens back once a kermesse is closed, refunding
+	// the card purchase they came from.
+	TokenRefund TokenTransactionType = "Refund"
 )
 
 type TokenTransaction struct {
@@ -23,8 +35,36 @@ type TokenTransaction struct {
 	Type       TokenTransactionType
 	StandID    *uint
 	Status     string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	// PaymentReference identifies the payment that funds a purchase, e.g. a
+	// Stripe PaymentIntent ID.
+	PaymentReference string
+	PaymentMethod    PaymentMethod
+	// MoneyAmount is what a purchase costs in Currency's minor unit.
+	MoneyAmount int64
+	Currency    string
+	// RejectionReason explains why an organizer rejected a pending purchase.
+	RejectionReason string
+	// StockID and Quantity tell what a spend bought, or what a reversal returns.
+	StockID  *uint
+	Quantity int
+	// PromotionID is the promotion a spend got its price from, if any.
+	PromotionID *uint
+	// RefundedQuantity counts what was given back so far: items of a spend,
+	// tokens of a purchase.
+	RefundedQuantity int
+	// ReversedTransactionID links a reversal to the spend it compensates, and a
+	// refund to the purchase it pays back.
+	ReversedTransactionID *uint
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+}
+
+// InLocation returns the transaction with its times in loc.
+func (tt TokenTransaction) InLocation(loc *time.Location) TokenTransaction {
+	tt.CreatedAt = tt.CreatedAt.In(loc)
+	tt.UpdatedAt = tt.UpdatedAt.In(loc)
+
+	return tt
 }
 
 func (tt *TokenTransaction) Approve() {
@@ -33,10 +73,124 @@ func (tt *TokenTransaction) Approve() {
 	}
 }
 
-func (tt *TokenTransaction) Reject() {
+func (tt *TokenTransaction) Reject(reason string) {
 	if tt.Type == TokenPurchase && tt.Status == "Pending" {
 		tt.Status = "Rejected"
+		tt.RejectionReason = reason
+	}
+}
+
+// LedgerAccounts returns the account debited and the account credited when the
+// transaction is posted to the ledger. Both belong to the transaction's kermesse.
+func (tt *TokenTransaction) LedgerAccounts() (debit LedgerAccountKey, credit LedgerAccountKey, err error) {
+	switch tt.Type {
+	case TokenPurchase:
+		debit = LedgerAccountKey{Type: LedgerAccountPaymentClearing, OwnerID: tt.KermesseID, KermesseID: tt.KermesseID}
+		credit, err = ledgerAccountFor(tt.FromType, tt.FromID, tt.KermesseID)
+	case TokenOpeningBalance:
+		debit = LedgerAccountKey{Type: LedgerAccountPaymentClearing, OwnerID: tt.KermesseID, KermesseID: tt.KermesseID}
+		credit, err = ledgerAccountFor(tt.ToType, tt.ToID, tt.KermesseID)
+	case TokenDistribution, TokenSpend, TokenReversal:
+		if debit, err = ledgerAccountFor(tt.FromType, tt.FromID, tt.KermesseID); err != nil {
+			return LedgerAccountKey{}, LedgerAccountKey{}, err
+		}
+		credit, err = ledgerAccountFor(tt.ToType, tt.ToID, tt.KermesseID)
+	case TokenRefund:
+		debit, err = ledgerAccountFor(tt.FromType, tt.FromID, tt.KermesseID)
+		credit = LedgerAccountKey{Type: LedgerAccountPaymentClearing, OwnerID: tt.KermesseID, KermesseID: tt.KermesseID}
+	default:
+		err = ErrUnknownLedgerAccount
+	}
+	if err != nil {
+		return LedgerAccountKey{}, LedgerAccountKey{}, err
 	}
+
+	return debit, credit, nil
+}
+
+// Settled tells whether the transaction moved its tokens, as opposed to a
+// charge still pending or declined.
+func (tt *TokenTransaction) Settled() bool {
+	return tt.Status == "Completed" || tt.Status == "Validated"
+}
+
+// RefundableQuantity is the number of items of a spend not refunded yet.
+// Spends recorded without a quantity count as a single item. Only settled
+// spends can be refunded: a pending or declined charge never took the tokens.
+func (tt *TokenTransaction) RefundableQuantity() int {
+	if tt.Type != TokenSpend || !tt.Settled() {
+		return 0
+	}
+
+	return max(tt.Quantity, 1) - tt.RefundedQuantity
+}
+
+// Reverse builds the transaction giving quantity items of a spend back: the
+// tokens go from the stand to the buyer, and the items back to the stock.
+func (tt *TokenTransaction) Reverse(quantity int) (TokenTransaction, error) {
+	if quantity <= 0 || quantity > tt.RefundableQuantity() {
+		return TokenTransaction{}, ErrInvalidRefund
+	}
+
+	// Price the refund from the cumulated refunded quantity, so that refunding
+	// a spend piece by piece gives back exactly what was spent.
+	items := max(tt.Quantity, 1)
+	amount := tt.Amount*(tt.RefundedQuantity+quantity)/items - tt.Amount*tt.RefundedQuantity/items
+
+	return TokenTransaction{
+		KermesseID:            tt.KermesseID,
+		FromID:                tt.ToID,
+		FromType:              tt.ToType,
+		ToID:                  tt.FromID,
+		ToType:                tt.FromType,
+		Amount:                amount,
+		Type:                  TokenReversal,
+		StandID:               tt.StandID,
+		StockID:               tt.StockID,
+		Quantity:              quantity,
+		Status:                "Completed",
+		ReversedTransactionID: &tt.ID,
+	}, nil
+}
+
+// RefundableTokens is the number of tokens of a purchase that can still be
+// refunded for money. Only card purchases that went through qualify.
+func (tt *TokenTransaction) RefundableTokens() int {
+	if tt.Type != TokenPurchase || tt.PaymentMethod != PaymentMethodCard || tt.Status != "Completed" ||
+		tt.PaymentReference == "" || tt.MoneyAmount <= 0 {
+		return 0
+	}
+
+	return tt.Amount - tt.RefundedQuantity
+}
+
+// RefundTokens builds the refund of tokens of a card purchase. The tokens
+// leave the wallet of holderType/holderID, the parent or one of their
+// children, and the money goes back to the card of the parent who paid.
+func (tt *TokenTransaction) RefundTokens(holderType string, holderID uint, tokens int) (TokenTransaction, error) {
+	if tokens <= 0 || tokens > tt.RefundableTokens() {
+		return TokenTransaction{}, ErrInvalidRefund
+	}
+
+	// As for reversals, price from the cumulated refunded tokens so that the
+	// refunds of a purchase never add up to more than was paid.
+	money := tt.MoneyAmount*int64(tt.RefundedQuantity+tokens)/int64(tt.Amount) -
+		tt.MoneyAmount*int64(tt.RefundedQuantity)/int64(tt.Amount)
+
+	return TokenTransaction{
+		KermesseID:            tt.KermesseID,
+		FromID:                holderID,
+		FromType:              holderType,
+		ToID:                  tt.FromID,
+		ToType:                tt.FromType,
+		Amount:                tokens,
+		Type:                  TokenRefund,
+		Status:                "Pending",
+		PaymentMethod:         PaymentMethodCard,
+		MoneyAmount:           money,
+		Currency:              tt.Currency,
+		ReversedTransactionID: &tt.ID,
+	}, nil
 }
 
 func (tt *TokenTransaction) IsValid() bool {
@@ -0,0 +1,236 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenTransaction_Reverse(t *testing.T) {
+	standID, stockID := uint(7), uint(8)
+	spend := TokenTransaction{
+		ID:         42,
+		KermesseID: 1,
+		FromID:     3,
+		FromType:   "Student",
+		ToID:       standID,
+		ToType:     "Stand",
+		Amount:     9,
+		Type:       TokenSpend,
+		StandID:    &standID,
+		StockID:    &stockID,
+		Quantity:   3,
+		Status:     "Validated",
+	}
+
+	tests := []struct {
+		name       string
+		spend      TokenTransaction
+		quantity   int
+		wantAmount int
+		wantErr    error
+	}{
+		{
+			name:       "Full refund",
+			spend:      spend,
+			quantity:   3,
+			wantAmount: 9,
+		},
+		{
+			name:       "Partial refund",
+			spend:      spend,
+			quantity:   1,
+			wantAmount: 3,
+		},
+		{
+			name: "Rest of a partially refunded spend",
+			spend: func() TokenTransaction {
+				s := spend
+				s.RefundedQuantity = 1
+				return s
+			}(),
+			quantity:   2,
+			wantAmount: 6,
+		},
+		{
+			name: "Spend recorded without quantity",
+			spend: func() TokenTransaction {
+				s := spend
+				s.Quantity = 0
+				return s
+			}(),
+			quantity:   1,
+			wantAmount: 9,
+		},
+		{
+			name: "More than what is left",
+			spend: func() TokenTransaction {
+				s := spend
+				s.RefundedQuantity = 2
+				return s
+			}(),
+			quantity: 2,
+			wantErr:  ErrInvalidRefund,
+		},
+		{
+			name:     "Zero items",
+			spend:    spend,
+			quantity: 0,
+			wantErr:  ErrInvalidRefund,
+		},
+		{
+			name: "Pending charge",
+			spend: func() TokenTransaction {
+				s := spend
+				s.Status = "Pending"
+				return s
+			}(),
+			quantity: 1,
+			wantErr:  ErrInvalidRefund,
+		},
+		{
+			name: "Declined charge",
+			spend: func() TokenTransaction {
+				s := spend
+				s.Status = "Rejected"
+				return s
+			}(),
+			quantity: 1,
+			wantErr:  ErrInvalidRefund,
+		},
+		{
+			name:     "Not a spend",
+			spend:    TokenTransaction{ID: 1, Type: TokenPurchase, Amount: 10, Quantity: 1},
+			quantity: 1,
+			wantErr:  ErrInvalidRefund,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.spend.Reverse(tt.quantity)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, TokenReversal, got.Type)
+			assert.Equal(t, tt.wantAmount, got.Amount)
+			assert.Equal(t, tt.quantity, got.Quantity)
+			assert.Equal(t, tt.spend.ToID, got.FromID)
+			assert.Equal(t, tt.spend.FromID, got.ToID)
+			require.NotNil(t, got.ReversedTransactionID)
+			assert.Equal(t, tt.spend.ID, *got.ReversedTransactionID)
+
+			debit, credit, err := got.LedgerAccounts()
+			require.NoError(t, err)
+			assert.Equal(t, LedgerAccountKey{Type: LedgerAccountStand, OwnerID: standID, KermesseID: 1}, debit)
+			assert.Equal(t, LedgerAccountKey{Type: LedgerAccountStudent, OwnerID: 3, KermesseID: 1}, credit)
+		})
+	}
+}
+
+func TestTokenTransaction_RefundTokens(t *testing.T) {
+	purchase := TokenTransaction{
+		ID:               42,
+		KermesseID:       1,
+		FromID:           3,
+		FromType:         "parent",
+		ToID:             1,
+		ToType:           "kermess",
+		Amount:           3,
+		Type:             TokenPurchase,
+		Status:           "Completed",
+		PaymentMethod:    PaymentMethodCard,
+		PaymentReference: "pi_42",
+		MoneyAmount:      1000,
+		Currency:         "eur",
+	}
+
+	tests := []struct {
+		name      string
+		purchase  TokenTransaction
+		tokens    int
+		wantMoney int64
+		wantErr   error
+	}{
+		{
+			name:      "Whole purchase",
+			purchase:  purchase,
+			tokens:    3,
+			wantMoney: 1000,
+		},
+		{
+			name:      "Part of a purchase rounds down",
+			purchase:  purchase,
+			tokens:    1,
+			wantMoney: 333,
+		},
+		{
+			name: "Rest of a partially refunded purchase",
+			purchase: func() TokenTransaction {
+				p := purchase
+				p.RefundedQuantity = 1
+				return p
+			}(),
+			tokens:    2,
+			wantMoney: 667,
+		},
+		{
+			name: "More than what is left",
+			purchase: func() TokenTransaction {
+				p := purchase
+				p.RefundedQuantity = 2
+				return p
+			}(),
+			tokens:  2,
+			wantErr: ErrInvalidRefund,
+		},
+		{
+			name: "Paid in cash",
+			purchase: func() TokenTransaction {
+				p := purchase
+				p.PaymentMethod = PaymentMethodCash
+				p.PaymentReference = ""
+				return p
+			}(),
+			tokens:  1,
+			wantErr: ErrInvalidRefund,
+		},
+		{
+			name: "Payment not completed",
+			purchase: func() TokenTransaction {
+				p := purchase
+				p.Status = "Pending"
+				return p
+			}(),
+			tokens:  1,
+			wantErr: ErrInvalidRefund,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.purchase.RefundTokens("student", 5, tt.tokens)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, TokenRefund, got.Type)
+			assert.Equal(t, "Pending", got.Status)
+			assert.Equal(t, tt.tokens, got.Amount)
+			assert.Equal(t, tt.wantMoney, got.MoneyAmount)
+			assert.Equal(t, "eur", got.Currency)
+			assert.Equal(t, purchase.FromID, got.ToID)
+			require.NotNil(t, got.ReversedTransactionID)
+			assert.Equal(t, purchase.ID, *got.ReversedTransactionID)
+
+			debit, credit, err := got.LedgerAccounts()
+			require.NoError(t, err)
+			assert.Equal(t, LedgerAccountKey{Type: LedgerAccountStudent, OwnerID: 5, KermesseID: 1}, debit)
+			assert.Equal(t, LedgerAccountKey{Type: LedgerAccountPaymentClearing, OwnerID: 1, KermesseID: 1}, credit)
+		})
+	}
+}
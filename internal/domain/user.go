@@ -14,31 +14,54 @@ type User struct {
 
 type UserWithDetails struct {
 	User
-	Tokens   int       `json:"tokens,omitempty"`
-	StandID  uint      `json:"stand_id,omitempty"`
-	Students []Student `json:"students,omitempty"`
+	// Tokens is the balance of the wallet of the requested kermesse, or the
+	// sum of all wallets when no kermesse was given.
+	Tokens  int      `json:"tokens,omitempty"`
+	Wallets []Wallet `json:"wallets,omitempty"`
+	// Stands are the stands a stand holder works at.
+	Stands   []StandStaff `json:"stands,omitempty"`
+	Students []Student    `json:"students,omitempty"`
 }
 
 type Student struct {
-	UserID   uint `gorm:"primaryKey"`
-	User     User `gorm:"foreignKey:UserID"`
-	Points   int  `json:"points"`
-	Tokens   int  `json:"tokens" default:"0"`
-	ParentID uint `json:"parent_id" default:"null"`
-	IsActive bool `json:"is_active" default:"false"`
+	UserID   uint     `gorm:"primaryKey"`
+	User     User     `gorm:"foreignKey:UserID"`
+	Points   int      `json:"points"`
+	Tokens   int      `json:"tokens" default:"0"` // Sum of all wallets, or the wallet of the requested kermesse.
+	Wallets  []Wallet `json:"wallets,omitempty"`
+	ParentID uint     `json:"parent_id" default:"null"`
+	IsActive bool     `json:"is_active" default:"false"`
+	// ShortCode and BadgeID identify the student at the point of sale of a
+	// stand.
+	ShortCode string `json:"short_code,omitempty"`
+	BadgeID   string `json:"badge_id,omitempty"`
+	// AutoApproveLimit is the largest charge, in tokens, that goes through
+	// without the student or their parent confirming it.
+	AutoApproveLimit int `json:"auto_approve_limit"`
 }
 
 type Parent struct {
+	UserID  uint     `gorm:"primaryKey"`
+	User    User     `gorm:"foreignKey:UserID"`
+	Tokens  int      `json:"tokens"  default:"0"` // Sum of all wallets, or the wallet of the requested kermesse.
+	Wallets []Wallet `json:"wallets,omitempty"`
+}
+
+type StandHolder struct {
 	UserID uint `gorm:"primaryKey"`
 	User   User `gorm:"foreignKey:UserID"`
-	Tokens int  `json:"tokens"  default:"0"`
+	// Stands are the stands the holder works at, with their role at each.
+	Stands []StandStaff
 }
 
-type StandHolder struct {
-	UserID  uint `gorm:"primaryKey"`
-	User    User `gorm:"foreignKey:UserID"`
-	StandID uint
-	Stand   Stand `gorm:"foreignKey:StandID"`
+// StandIDs returns the IDs of the stands the holder works at.
+func (h StandHolder) StandIDs() []uint {
+	ids := make([]uint, len(h.Stands))
+	for i, stand := range h.Stands {
+		ids[i] = stand.StandID
+	}
+
+	return ids
 }
 
 type Organizer struct {
@@ -0,0 +1,326 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/pkg/dockertester"
+)
+
+type LedgerDBTestSuite struct {
+	suite.Suite
+
+	db       *gorm.DB
+	pool     *dockertest.Pool
+	resource *dockertest.Resource
+
+	kermesseDAO *dao.KermesseDao
+
+	kermesse dao.Kermesse
+}
+
+func (s *LedgerDBTestSuite) SetupSuite() {
+	// Initialize container.
+	dt := dockertester.InitPostgres()
+	s.pool = dt.Pool
+	s.resource = dt.Resource
+
+	// Open connection.
+	db, err := dockertester.OpenPostgres(dt.Resource, dt.HostPort)
+	require.NoError(s.T(), err)
+
+	s.db = db
+}
+
+func (s *LedgerDBTestSuite) TearDownSuite() {
+	err := s.pool.Purge(s.resource) // Destroy the container.
+	require.NoError(s.T(), err)
+}
+
+func (s *LedgerDBTestSuite) SetupTest() {
+	// Run migrations.
+	err := dao.InitTables(s.db)
+	require.NoError(s.T(), err)
+
+	// Initialize DAO.
+	s.kermesseDAO = dao.NewKermesseDao(s.db)
+
+	s.kermesse = dao.Kermesse{Name: "Spring fair", Date: time.Now(), Location: "School yard"}
+	require.NoError(s.T(), s.db.Create(&s.kermesse).Error)
+}
+
+func (s *LedgerDBTestSuite) TearDownTest() {
+	script, err := os.ReadFile("../scripts/clean_db.sql")
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(string(script)).Error
+	require.NoError(s.T(), err)
+}
+
+func TestLedgerDB(t *testing.T) {
+	suite.Run(t, new(LedgerDBTestSuite))
+}
+
+func (s *LedgerDBTestSuite) createUser(id uint, role string) {
+	user := dao.User{ID: id, Email: fmt.Sprintf("user%d@example.com", id), Password: "secret", Name: fmt.Sprintf("User %d", id), Role: role}
+	require.NoError(s.T(), s.db.Create(&user).Error)
+}
+
+func (s *LedgerDBTestSuite) createParent(id uint) {
+	s.createUser(id, "parent")
+	require.NoError(s.T(), s.db.Create(&dao.Parent{UserID: id}).Error)
+}
+
+func (s *LedgerDBTestSuite) createStudent(id, parentID uint) {
+	s.createUser(id, "student")
+	require.NoError(s.T(), s.db.Create(&dao.Student{UserID: id, ParentID: parentID}).Error)
+}
+
+func (s *LedgerDBTestSuite) participate(kermesseID, userID uint) {
+	require.NoError(s.T(), s.db.Exec("INSERT INTO kermesse_participants (kermesse_id, user_id) VALUES (?, ?)", kermesseID, userID).Error)
+}
+
+// observeLogs captures the warnings logged until the returned function is
+// called.
+func (s *LedgerDBTestSuite) observeLogs() (*observer.ObservedLogs, func()) {
+	core, logs := observer.New(zap.WarnLevel)
+
+	return logs, zap.ReplaceGlobals(zap.New(core))
+}
+
+func (s *LedgerDBTestSuite) assertBalances(balances map[dao.LedgerAccountKey]int) {
+	for key, want := range balances {
+		account, err := s.kermesseDAO.GetLedgerAccount(context.TODO(), key)
+		require.NoError(s.T(), err, key)
+		assert.Equal(s.T(), want, account.Balance, key)
+	}
+}
+
+func (s *LedgerDBTestSuite) assertAuditBalanced(kermesseID uint) {
+	audit, err := s.kermesseDAO.AuditLedger(context.TODO(), kermesseID)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), audit.UnbalancedTransactions)
+	assert.Empty(s.T(), audit.MismatchedTransactions)
+	assert.Empty(s.T(), audit.UnpostedTransactions)
+	assert.Empty(s.T(), audit.MismatchedAccounts)
+}
+
+func (s *LedgerDBTestSuite) fund(kermesseID, studentID uint, amount int) dao.TokenTransaction {
+	transaction, err := s.kermesseDAO.CreatePostedTokenTransaction(context.TODO(), dao.TokenTransaction{
+		KermesseID: kermesseID,
+		FromType:   "payment_clearing",
+		ToID:       studentID,
+		ToType:     "student",
+		Amount:     amount,
+		Type:       dao.TokenOpeningBalance,
+		Status:     "Completed",
+	},
+		dao.LedgerAccountKey{Type: "payment_clearing", OwnerID: kermesseID, KermesseID: kermesseID, AllowOverdraft: true},
+		dao.LedgerAccountKey{Type: "student", OwnerID: studentID, KermesseID: kermesseID},
+	)
+	require.NoError(s.T(), err)
+
+	return transaction
+}
+
+func (s *LedgerDBTestSuite) TestLedgerDB_AuditLedger() {
+	other := dao.Kermesse{Name: "Winter fair", Date: time.Now(), Location: "Gym"}
+	require.NoError(s.T(), s.db.Create(&other).Error)
+
+	s.fund(s.kermesse.ID, 10, 5)
+	s.fund(other.ID, 10, 3)
+
+	audit, err := s.kermesseDAO.AuditLedger(context.TODO(), s.kermesse.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, audit.Accounts)
+	assert.Equal(s.T(), 2, audit.Entries)
+	assert.Empty(s.T(), audit.UnbalancedTransactions)
+	assert.Empty(s.T(), audit.MismatchedTransactions)
+	assert.Empty(s.T(), audit.UnpostedTransactions)
+	assert.Empty(s.T(), audit.MismatchedAccounts)
+
+	// Drift the cached balance of the other kermesse and leave a completed
+	// transaction without entries there.
+	account, err := s.kermesseDAO.GetLedgerAccount(context.TODO(), dao.LedgerAccountKey{Type: "student", OwnerID: 10, KermesseID: other.ID})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.db.Model(&dao.LedgerAccount{}).Where("id = ?", account.ID).Update("balance", 7).Error)
+
+	unposted := dao.TokenTransaction{KermesseID: other.ID, FromType: "payment_clearing", ToID: 10, ToType: "student", Amount: 2, Type: dao.TokenOpeningBalance, Status: "Completed"}
+	require.NoError(s.T(), s.db.Create(&unposted).Error)
+
+	// The audit of a kermesse only looks at its own ledger.
+	audit, err = s.kermesseDAO.AuditLedger(context.TODO(), s.kermesse.ID)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), audit.UnpostedTransactions)
+	assert.Empty(s.T(), audit.MismatchedAccounts)
+
+	audit, err = s.kermesseDAO.AuditLedger(context.TODO(), other.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []uint{unposted.ID}, audit.UnpostedTransactions)
+	assert.Equal(s.T(), []dao.LedgerAccountMismatch{{AccountID: account.ID, CachedBalance: 7, LedgerBalance: 3}}, audit.MismatchedAccounts)
+}
+
+func (s *LedgerDBTestSuite) TestLedgerDB_MigrateLegacyBalances() {
+	const (
+		parentID      = 20
+		studentID     = 21
+		orphanID      = 22
+		brokeID       = 23
+		otherParentID = 24
+	)
+
+	// The parent took part in the kermesse, and a later one followed.
+	later := dao.Kermesse{Name: "Winter fair", Date: time.Now().Add(24 * time.Hour), Location: "Gym"}
+	require.NoError(s.T(), s.db.Create(&later).Error)
+
+	s.createParent(parentID)
+	s.createStudent(studentID, parentID)
+	s.createParent(otherParentID)
+	s.createStudent(orphanID, otherParentID)
+	s.createStudent(brokeID, parentID)
+	s.participate(s.kermesse.ID, parentID)
+
+	// Bring back the balances the ledger replaced.
+	for _, table := range []string{"parents", "students"} {
+		require.NoError(s.T(), s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN tokens integer NOT NULL DEFAULT 0", table)).Error)
+	}
+	require.NoError(s.T(), s.db.Exec("UPDATE parents SET tokens = 12 WHERE user_id = ?", parentID).Error)
+	require.NoError(s.T(), s.db.Exec("UPDATE students SET tokens = 4 WHERE user_id = ?", studentID).Error)
+	require.NoError(s.T(), s.db.Exec("UPDATE students SET tokens = 3 WHERE user_id = ?", orphanID).Error)
+
+	err := dao.InitTables(s.db)
+	require.NoError(s.T(), err)
+
+	assert.False(s.T(), s.db.Migrator().HasColumn(&dao.Parent{}, "tokens"))
+	assert.False(s.T(), s.db.Migrator().HasColumn(&dao.Student{}, "tokens"))
+
+	// Balances follow the kermesse of their owner or of the student's parent,
+	// and the latest kermesse when neither took part in any.
+	s.assertBalances(map[dao.LedgerAccountKey]int{
+		{Type: "parent", OwnerID: parentID, KermesseID: s.kermesse.ID}:                12,
+		{Type: "student", OwnerID: studentID, KermesseID: s.kermesse.ID}:              4,
+		{Type: "payment_clearing", OwnerID: s.kermesse.ID, KermesseID: s.kermesse.ID}: -16,
+		{Type: "student", OwnerID: orphanID, KermesseID: later.ID}:                    3,
+		{Type: "payment_clearing", OwnerID: later.ID, KermesseID: later.ID}:           -3,
+	})
+
+	// Nothing is opened for an empty balance, nor left without a kermesse.
+	var accounts int64
+	err = s.db.Model(&dao.LedgerAccount{}).Where("owner_id = ? OR kermesse_id = 0", brokeID).Count(&accounts).Error
+	require.NoError(s.T(), err)
+	assert.Zero(s.T(), accounts)
+
+	var openings []dao.TokenTransaction
+	err = s.db.Where("type = ?", dao.TokenOpeningBalance).Order("amount DESC").Find(&openings).Error
+	require.NoError(s.T(), err)
+	require.Len(s.T(), openings, 3)
+	assert.Equal(s.T(), "Completed", openings[0].Status)
+	assert.Equal(s.T(), s.kermesse.ID, openings[0].KermesseID)
+	assert.Equal(s.T(), 12, openings[0].Amount)
+
+	s.assertAuditBalanced(s.kermesse.ID)
+	s.assertAuditBalanced(later.ID)
+}
+
+func (s *LedgerDBTestSuite) TestLedgerDB_MigrateLedgerWallets() {
+	const (
+		parentID  = 30
+		studentID = 31
+	)
+
+	later := dao.Kermesse{Name: "Winter fair", Date: time.Now().Add(24 * time.Hour), Location: "Gym"}
+	require.NoError(s.T(), s.db.Create(&later).Error)
+
+	stand := dao.Stand{Name: "Crêpes", Type: "food", KermesseID: &later.ID}
+	require.NoError(s.T(), s.db.Create(&stand).Error)
+
+	s.createParent(parentID)
+	s.createStudent(studentID, parentID)
+	s.participate(s.kermesse.ID, parentID)
+
+	// Rebuild the global balances: a single account per owner, opening
+	// balances without a kermesse, and tokens distributed in one kermesse
+	// while spent in the other.
+	require.NoError(s.T(), s.db.Exec("CREATE UNIQUE INDEX idx_ledger_accounts_owner ON ledger_accounts (type, owner_id)").Error)
+
+	accounts := map[string]*dao.LedgerAccount{
+		"clearing": {Type: "payment_clearing", Balance: -14},
+		"parent":   {Type: "parent", OwnerID: parentID, Balance: 4},
+		"student":  {Type: "student", OwnerID: studentID, Balance: 2},
+		"stand":    {Type: "stand", OwnerID: stand.ID, Balance: 8},
+	}
+	for _, account := range accounts {
+		require.NoError(s.T(), s.db.Create(account).Error)
+	}
+
+	legacy := []struct {
+		transaction   dao.TokenTransaction
+		debit, credit string
+	}{
+		{dao.TokenTransaction{FromType: "payment_clearing", ToID: parentID, ToType: "parent", Amount: 10, Type: dao.TokenOpeningBalance, Status: "Completed"}, "clearing", "parent"},
+		{dao.TokenTransaction{FromType: "payment_clearing", ToID: studentID, ToType: "student", Amount: 4, Type: dao.TokenOpeningBalance, Status: "Completed"}, "clearing", "student"},
+		{dao.TokenTransaction{KermesseID: s.kermesse.ID, FromID: parentID, FromType: "Parent", ToID: studentID, ToType: "Student", Amount: 6, Type: dao.TokenDistribution, Status: "Completed"}, "parent", "student"},
+		{dao.TokenTransaction{KermesseID: later.ID, FromID: studentID, FromType: "Student", ToID: stand.ID, ToType: "Stand", Amount: 8, Type: dao.TokenSpend, StandID: &stand.ID, Status: "Validated"}, "student", "stand"},
+	}
+	for _, l := range legacy {
+		transaction := l.transaction
+		require.NoError(s.T(), s.db.Create(&transaction).Error)
+
+		entries := []dao.LedgerEntry{
+			{TransactionID: transaction.ID, AccountID: accounts[l.debit].ID, Direction: dao.LedgerDebit, Amount: transaction.Amount},
+			{TransactionID: transaction.ID, AccountID: accounts[l.credit].ID, Direction: dao.LedgerCredit, Amount: transaction.Amount},
+		}
+		require.NoError(s.T(), s.db.Create(&entries).Error)
+	}
+
+	logs, restore := s.observeLogs()
+	defer restore()
+
+	err := dao.InitTables(s.db)
+	require.NoError(s.T(), err)
+
+	assert.False(s.T(), s.db.Migrator().HasIndex(&dao.LedgerAccount{}, "idx_ledger_accounts_owner"))
+
+	// Opening balances moved to the kermesse the parent took part in.
+	var unassigned int64
+	err = s.db.Model(&dao.TokenTransaction{}).Where("kermesse_id = 0").Count(&unassigned).Error
+	require.NoError(s.T(), err)
+	assert.Zero(s.T(), unassigned)
+
+	s.assertBalances(map[dao.LedgerAccountKey]int{
+		{Type: "payment_clearing", OwnerID: s.kermesse.ID, KermesseID: s.kermesse.ID}: -14,
+		{Type: "parent", OwnerID: parentID, KermesseID: s.kermesse.ID}:                4,
+		{Type: "student", OwnerID: studentID, KermesseID: s.kermesse.ID}:              10,
+		{Type: "student", OwnerID: studentID, KermesseID: later.ID}:                   -8,
+		{Type: "stand", OwnerID: stand.ID, KermesseID: later.ID}:                      8,
+	})
+
+	var leftovers int64
+	err = s.db.Model(&dao.LedgerAccount{}).Where("kermesse_id = 0 AND balance <> 0").Count(&leftovers).Error
+	require.NoError(s.T(), err)
+	assert.Zero(s.T(), leftovers)
+
+	s.assertAuditBalanced(s.kermesse.ID)
+	s.assertAuditBalanced(later.ID)
+
+	// The wallet spent beyond what it holds in the later kermesse is reported.
+	overdrawn, err := s.kermesseDAO.GetLedgerAccount(context.TODO(), dao.LedgerAccountKey{Type: "student", OwnerID: studentID, KermesseID: later.ID})
+	require.NoError(s.T(), err)
+
+	warnings := logs.FilterMessage("ledger wallet migrated with a negative balance").All()
+	require.Len(s.T(), warnings, 1)
+	assert.Equal(s.T(), int64(overdrawn.ID), warnings[0].ContextMap()["account_id"])
+	assert.Equal(s.T(), int64(-8), warnings[0].ContextMap()["balance"])
+}
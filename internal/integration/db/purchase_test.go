@@ -0,0 +1,257 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/pkg/dockertester"
+)
+
+type PurchaseDBTestSuite struct {
+	suite.Suite
+
+	db       *gorm.DB
+	pool     *dockertest.Pool
+	resource *dockertest.Resource
+
+	kermesseDAO *dao.KermesseDao
+
+	kermesse dao.Kermesse
+	stand    dao.Stand
+	stock    dao.Stock
+}
+
+func (s *PurchaseDBTestSuite) SetupSuite() {
+	// Initialize container.
+	dt := dockertester.InitPostgres()
+	s.pool = dt.Pool
+	s.resource = dt.Resource
+
+	// Open connection.
+	db, err := dockertester.OpenPostgres(dt.Resource, dt.HostPort)
+	require.NoError(s.T(), err)
+
+	s.db = db
+}
+
+func (s *PurchaseDBTestSuite) TearDownSuite() {
+	err := s.pool.Purge(s.resource) // Destroy the container.
+	require.NoError(s.T(), err)
+}
+
+func (s *PurchaseDBTestSuite) SetupTest() {
+	// Run migrations.
+	err := dao.InitTables(s.db)
+	require.NoError(s.T(), err)
+
+	// Initialize DAO.
+	s.kermesseDAO = dao.NewKermesseDao(s.db)
+
+	// Seed a kermesse with a single stand selling a single item.
+	s.kermesse = dao.Kermesse{Name: "Spring fair", Date: time.Now(), Location: "School yard"}
+	require.NoError(s.T(), s.db.Create(&s.kermesse).Error)
+
+	s.stand = dao.Stand{Name: "Crêpes", Type: "food", KermesseID: &s.kermesse.ID}
+	require.NoError(s.T(), s.db.Create(&s.stand).Error)
+
+	s.stock = dao.Stock{StandID: s.stand.ID, ItemName: "Crêpe", Quantity: 5, TokenCost: 2}
+	require.NoError(s.T(), s.db.Create(&s.stock).Error)
+}
+
+func (s *PurchaseDBTestSuite) TearDownTest() {
+	script, err := os.ReadFile("../scripts/clean_db.sql")
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(string(script)).Error
+	require.NoError(s.T(), err)
+}
+
+func TestPurchaseDB(t *testing.T) {
+	suite.Run(t, new(PurchaseDBTestSuite))
+}
+
+func (s *PurchaseDBTestSuite) fundStudent(studentID uint, amount int) {
+	_, err := s.kermesseDAO.CreatePostedTokenTransaction(context.TODO(), dao.TokenTransaction{
+		KermesseID: s.kermesse.ID,
+		FromType:   "payment_clearing",
+		ToID:       studentID,
+		ToType:     "student",
+		Amount:     amount,
+		Type:       dao.TokenOpeningBalance,
+		Status:     "Completed",
+	},
+		dao.LedgerAccountKey{Type: "payment_clearing", OwnerID: s.kermesse.ID, KermesseID: s.kermesse.ID, AllowOverdraft: true},
+		dao.LedgerAccountKey{Type: "student", OwnerID: studentID, KermesseID: s.kermesse.ID},
+	)
+	require.NoError(s.T(), err)
+}
+
+func (s *PurchaseDBTestSuite) purchase(studentID uint) error {
+	_, err := s.checkout(studentID, dao.OrderLine{StockID: s.stock.ID, ItemName: s.stock.ItemName, Quantity: 1, UnitCost: s.stock.TokenCost, Tokens: s.stock.TokenCost})
+
+	return err
+}
+
+func (s *PurchaseDBTestSuite) checkout(studentID uint, lines ...dao.OrderLine) (dao.Order, error) {
+	total := 0
+	for _, line := range lines {
+		total += line.Tokens
+	}
+
+	return s.kermesseDAO.Checkout(context.TODO(), dao.Order{
+		KermesseID:  s.kermesse.ID,
+		StandID:     s.stand.ID,
+		BuyerID:     studentID,
+		BuyerType:   "Student",
+		TotalTokens: total,
+		Lines:       lines,
+	}, dao.TokenTransaction{
+		KermesseID: s.kermesse.ID,
+		FromID:     studentID,
+		FromType:   "Student",
+		ToID:       s.stand.ID,
+		ToType:     "Stand",
+		Amount:     total,
+		Type:       dao.TokenSpend,
+		StandID:    &s.stand.ID,
+		Status:     "Validated",
+	},
+		dao.LedgerAccountKey{Type: "student", OwnerID: studentID, KermesseID: s.kermesse.ID},
+		dao.LedgerAccountKey{Type: "stand", OwnerID: s.stand.ID, KermesseID: s.kermesse.ID},
+		true,
+	)
+}
+
+// runConcurrently fires n purchases at once and returns how many succeeded.
+func (s *PurchaseDBTestSuite) runConcurrently(n int, studentID func(i int) uint) int {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+
+			err := s.purchase(studentID(i))
+			if err != nil {
+				assert.True(s.T(), errors.Is(err, dao.ErrPurchaseConflict), "unexpected error: %v", err)
+				return
+			}
+
+			mu.Lock()
+			succeeded++
+			mu.Unlock()
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	return succeeded
+}
+
+func (s *PurchaseDBTestSuite) assertConsistent(succeeded, initialStock int) {
+	stock, err := s.kermesseDAO.GetStockByID(context.TODO(), s.stock.ID)
+	require.NoError(s.T(), err)
+	assert.GreaterOrEqual(s.T(), stock.Quantity, 0)
+	assert.Equal(s.T(), initialStock-succeeded, stock.Quantity)
+
+	stand, err := s.kermesseDAO.GetStandByID(s.stand.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), succeeded*s.stock.TokenCost, stand.TokensSpent)
+
+	var negative int64
+	err = s.db.Model(&dao.LedgerAccount{}).
+		Where("type IN ? AND balance < 0", []string{"student", "stand"}).
+		Count(&negative).Error
+	require.NoError(s.T(), err)
+	assert.Zero(s.T(), negative)
+
+	audit, err := s.kermesseDAO.AuditLedger(context.TODO(), s.kermesse.ID)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), audit.UnbalancedTransactions)
+	assert.Empty(s.T(), audit.MismatchedTransactions)
+	assert.Empty(s.T(), audit.UnpostedTransactions)
+	assert.Empty(s.T(), audit.MismatchedAccounts)
+}
+
+func (s *PurchaseDBTestSuite) TestPurchaseDB_ConcurrentPurchasesDoNotOversell() {
+	const buyers = 20
+
+	for i := 1; i <= buyers; i++ {
+		s.fundStudent(uint(1000+i), 100)
+	}
+
+	succeeded := s.runConcurrently(buyers, func(i int) uint { return uint(1001 + i) })
+
+	assert.Equal(s.T(), s.stock.Quantity, succeeded)
+	s.assertConsistent(succeeded, s.stock.Quantity)
+}
+
+func (s *PurchaseDBTestSuite) TestPurchaseDB_ConcurrentPurchasesDoNotOverdraw() {
+	const (
+		studentID = 2001
+		attempts  = 10
+	)
+
+	// Enough tokens for two crêpes only, while five are in stock.
+	s.fundStudent(studentID, 2*s.stock.TokenCost)
+
+	succeeded := s.runConcurrently(attempts, func(int) uint { return studentID })
+
+	assert.Equal(s.T(), 2, succeeded)
+	s.assertConsistent(succeeded, s.stock.Quantity)
+
+	account, err := s.kermesseDAO.GetLedgerAccount(context.TODO(), dao.LedgerAccountKey{
+		Type:       "student",
+		OwnerID:    studentID,
+		KermesseID: s.kermesse.ID,
+	})
+	require.NoError(s.T(), err)
+	assert.Zero(s.T(), account.Balance)
+}
+
+func (s *PurchaseDBTestSuite) TestPurchaseDB_CheckoutIsAtomic() {
+	const studentID = 3001
+
+	s.fundStudent(studentID, 100)
+
+	juice := dao.Stock{StandID: s.stand.ID, ItemName: "Juice", Quantity: 1, TokenCost: 1}
+	require.NoError(s.T(), s.db.Create(&juice).Error)
+
+	crepes := dao.OrderLine{StockID: s.stock.ID, ItemName: s.stock.ItemName, Quantity: 2, UnitCost: s.stock.TokenCost, Tokens: 2 * s.stock.TokenCost}
+
+	// The last juice can't be sold twice: nothing of the order is kept.
+	_, err := s.checkout(studentID, crepes, dao.OrderLine{StockID: juice.ID, ItemName: juice.ItemName, Quantity: 2, UnitCost: 1, Tokens: 2})
+	assert.True(s.T(), errors.Is(err, dao.ErrInsufficientStock), "unexpected error: %v", err)
+	s.assertConsistent(0, s.stock.Quantity)
+
+	order, err := s.checkout(studentID, crepes, dao.OrderLine{StockID: juice.ID, ItemName: juice.ItemName, Quantity: 1, UnitCost: 1, Tokens: 1})
+	require.NoError(s.T(), err)
+	assert.NotZero(s.T(), order.ID)
+	assert.NotZero(s.T(), order.TransactionID)
+	require.Len(s.T(), order.Lines, 2)
+
+	stock, err := s.kermesseDAO.GetStockByID(context.TODO(), juice.ID)
+	require.NoError(s.T(), err)
+	assert.Zero(s.T(), stock.Quantity)
+
+	stand, err := s.kermesseDAO.GetStandByID(s.stand.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 2*s.stock.TokenCost+1, stand.TokensSpent)
+}
@@ -0,0 +1,2863 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ory/dockertest/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/response"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/config"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/payment"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/pkg/jwthelper"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/pkg/dockertester"
+)
+
+const (
+	parentUserID    = 200
+	organizerUserID = 201
+	kermesseID      = 300
+)
+
+type KermesseHandlerTestSuite struct {
+	suite.Suite
+
+	db       *gorm.DB
+	pool     *dockertest.Pool
+	resource *dockertest.Resource
+	server   *api.Server
+}
+
+func (s *KermesseHandlerTestSuite) SetupSuite() {
+	// Initialize container.
+	dt := dockertester.InitPostgres()
+	s.pool = dt.Pool
+	s.resource = dt.Resource
+
+	// Open connection.
+	db, err := dockertester.OpenPostgres(dt.Resource, dt.HostPort)
+	require.NoError(s.T(), err)
+
+	s.db = db
+}
+
+func (s *KermesseHandlerTestSuite) TearDownSuite() {
+	err := s.pool.Purge(s.resource) // Destroy the container.
+	require.NoError(s.T(), err)
+}
+
+func (s *KermesseHandlerTestSuite) SetupTest() {
+	// Run migrations.
+	err := dao.InitTables(s.db)
+	require.NoError(s.T(), err)
+
+	// Seed a parent taking part in a kermesse.
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'parent@test.com', 'password', 'Parent', 'parent', NOW(), NOW())`, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "parents" ("user_id") VALUES (?)`, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesses" ("id", "name", "date", "location", "created_at", "updated_at") VALUES (?, 'Kermesse', NOW(), 'School', NOW(), NOW())`, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, kermesseID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	// Seed its organizer.
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'organizer@test.com', 'password', 'Organizer', 'organizer', NOW(), NOW())`, organizerUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "organizers" ("user_id") VALUES (?)`, organizerUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "organizer_kermesses" ("organizer_user_id", "kermesse_id") VALUES (?, ?)`, organizerUserID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	// Create API server backed by the fake payment provider.
+	s.server = api.NewServer(&config.AppConfig{
+		API: &config.APIConfig{
+			JWTSigningKey:       jwtSigningKey,
+			RefundWindow:        time.Hour,
+			PaymentRequestTTL:   time.Minute,
+			OfflineAllowanceTTL: time.Hour,
+			StockReservationTTL: time.Minute,
+			StandInvitationTTL:  time.Hour,
+		},
+		Gin: &config.GinConfig{
+			Mode: gin.TestMode,
+		},
+		Postgres: &config.PostgresConfig{},
+		Payments: &config.PaymentsConfig{
+			Provider: config.PaymentProviderFake,
+		},
+	}, s.db)
+}
+
+func (s *KermesseHandlerTestSuite) TearDownTest() {
+	script, err := os.ReadFile("../scripts/clean_db.sql")
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(string(script)).Error
+	require.NoError(s.T(), err)
+}
+
+func TestKermesseHandler(t *testing.T) {
+	suite.Run(t, new(KermesseHandlerTestSuite))
+}
+
+func (s *KermesseHandlerTestSuite) parentTokens() int {
+	var balance int
+	err := s.db.Raw(`SELECT COALESCE(SUM(balance), 0) FROM "ledger_accounts" WHERE "type" = 'parent' AND "owner_id" = ?`, parentUserID).Scan(&balance).Error
+	require.NoError(s.T(), err)
+
+	return balance
+}
+
+// sendAs sends a JSON request authenticated as userID.
+func (s *KermesseHandlerTestSuite) sendAs(userID uint, method, path string, payload any) *httptest.ResponseRecorder {
+	token, err := jwthelper.GenerateToken([]byte(jwtSigningKey), userID, "")
+	require.NoError(s.T(), err)
+
+	var body []byte
+	if payload != nil {
+		body, err = json.Marshal(payload)
+		require.NoError(s.T(), err)
+	}
+
+	req, err := http.NewRequest(method, path, bytes.NewReader(body))
+	require.NoError(s.T(), err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return executeRequest(req, s.server)
+}
+
+func (s *KermesseHandlerTestSuite) purchaseTokens(paymentMethodID string, amount int) *httptest.ResponseRecorder {
+	return s.sendAs(parentUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/purchase", kermesseID), map[string]any{
+		"payment_method_id": paymentMethodID,
+		"amount":            amount,
+	})
+}
+
+func (s *KermesseHandlerTestSuite) sendPaymentEvent(event domain.PaymentEvent) *httptest.ResponseRecorder {
+	body, err := json.Marshal(event)
+	require.NoError(s.T(), err)
+
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/webhooks/stripe", bytes.NewReader(body))
+	require.NoError(s.T(), err)
+
+	return executeRequest(req, s.server)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_HandleTokenPurchase() {
+	tests := []struct {
+		name            string
+		paymentMethodID string
+		amount          int
+		wantRespCode    int
+		wantTokens      int
+		wantStatus      string
+	}{
+		{
+			name:            "201 - Payment succeeded",
+			paymentMethodID: payment.FakePaymentMethodSucceed,
+			amount:          10,
+			wantRespCode:    http.StatusCreated,
+			wantTokens:      10,
+			wantStatus:      "Completed",
+		},
+		{
+			name:            "402 - Card declined",
+			paymentMethodID: payment.FakePaymentMethodDecline,
+			amount:          10,
+			wantRespCode:    http.StatusPaymentRequired,
+			wantTokens:      0,
+			wantStatus:      "Failed",
+		},
+		{
+			name:            "202 - Payment requires action",
+			paymentMethodID: payment.FakePaymentMethodRequiresAction,
+			amount:          10,
+			wantRespCode:    http.StatusAccepted,
+			wantTokens:      0,
+			wantStatus:      "Pending",
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			defer func() {
+				s.TearDownTest()
+				s.SetupTest()
+			}()
+
+			resp := s.purchaseTokens(tt.paymentMethodID, tt.amount)
+			assert.Equal(s.T(), tt.wantRespCode, resp.Code)
+
+			if tt.wantRespCode == http.StatusCreated {
+				var got map[string]any
+				err := json.Unmarshal(resp.Body.Bytes(), &got)
+				require.NoError(s.T(), err)
+
+				assert.Equal(s.T(), float64(tt.wantTokens), got["updated_token_balance"])
+				assert.Contains(s.T(), got["payment_intent_id"], "pi_fake_")
+			}
+
+			assert.Equal(s.T(), tt.wantTokens, s.parentTokens())
+
+			// The purchase is recorded before the card is charged, and keeps
+			// the payment it was charged with.
+			var purchase struct {
+				Status           string
+				PaymentReference string
+			}
+			err := s.db.Raw(`SELECT "status", "payment_reference" FROM "token_transactions" WHERE "type" = 'Purchase'`).Scan(&purchase).Error
+			require.NoError(s.T(), err)
+			assert.Equal(s.T(), tt.wantStatus, purchase.Status)
+			assert.Contains(s.T(), purchase.PaymentReference, "pi_fake_")
+		})
+	}
+
+	s.Run("403 - Not participating", func() {
+		defer func() {
+			s.TearDownTest()
+			s.SetupTest()
+		}()
+
+		err := s.db.Exec(`DELETE FROM "kermesse_participants" WHERE "user_id" = ?`, parentUserID).Error
+		require.NoError(s.T(), err)
+
+		resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+		assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+		var count int64
+		err = s.db.Raw(`SELECT COUNT(*) FROM "token_transactions"`).Scan(&count).Error
+		require.NoError(s.T(), err)
+		assert.Zero(s.T(), count)
+	})
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_HandleStripeWebhook() {
+	tests := []struct {
+		name       string
+		eventType  string
+		status     domain.PaymentStatus
+		wantStatus string
+		wantTokens int
+	}{
+		{
+			name:       "Succeeded payment credits the tokens once",
+			eventType:  "payment_intent.succeeded",
+			status:     domain.PaymentSucceeded,
+			wantStatus: "Completed",
+			wantTokens: 10,
+		},
+		{
+			name:       "Failed payment fails the purchase",
+			eventType:  "payment_intent.payment_failed",
+			status:     domain.PaymentFailed,
+			wantStatus: "Failed",
+			wantTokens: 0,
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			defer func() {
+				s.TearDownTest()
+				s.SetupTest()
+			}()
+
+			resp := s.purchaseTokens(payment.FakePaymentMethodRequiresAction, 10)
+			require.Equal(s.T(), http.StatusAccepted, resp.Code)
+
+			var purchase struct {
+				PaymentIntentID string `json:"payment_intent_id"`
+			}
+			err := json.Unmarshal(resp.Body.Bytes(), &purchase)
+			require.NoError(s.T(), err)
+
+			event := domain.PaymentEvent{
+				ID:        "evt_" + purchase.PaymentIntentID,
+				Type:      tt.eventType,
+				PaymentID: purchase.PaymentIntentID,
+				Status:    tt.status,
+			}
+
+			// Replayed deliveries are acknowledged without being applied again.
+			for i := 0; i < 2; i++ {
+				resp = s.sendPaymentEvent(event)
+				assert.Equal(s.T(), http.StatusOK, resp.Code)
+			}
+
+			var status string
+			err = s.db.Raw(`SELECT "status" FROM "token_transactions" WHERE "payment_reference" = ?`, purchase.PaymentIntentID).Scan(&status).Error
+			require.NoError(s.T(), err)
+
+			assert.Equal(s.T(), tt.wantStatus, status)
+			assert.Equal(s.T(), tt.wantTokens, s.parentTokens())
+		})
+	}
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_HandleStripeWebhook_UnknownPayment() {
+	resp := s.sendPaymentEvent(domain.PaymentEvent{
+		ID:        "evt_unknown",
+		Type:      "payment_intent.succeeded",
+		PaymentID: "pi_unknown",
+		Status:    domain.PaymentSucceeded,
+	})
+
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_CashTokenPurchase() {
+	cashPurchasePath := fmt.Sprintf("/api/v1/kermesses/%d/token/cash-purchase", kermesseID)
+	pendingPath := fmt.Sprintf("/api/v1/kermesses/%d/token/pending", kermesseID)
+	decisionPath := func(transactionID uint, decision string) string {
+		return fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/%s", kermesseID, transactionID, decision)
+	}
+	createCashPurchase := func(userID uint, payload map[string]any) uint {
+		resp := s.sendAs(userID, http.MethodPost, cashPurchasePath, payload)
+		require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+		var transaction domain.TokenTransaction
+		err := json.Unmarshal(resp.Body.Bytes(), &transaction)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), "Pending", transaction.Status)
+		assert.Equal(s.T(), domain.PaymentMethodCash, transaction.PaymentMethod)
+
+		return transaction.ID
+	}
+
+	s.Run("Approval credits the parent and the tokens sold", func() {
+		defer func() {
+			s.TearDownTest()
+			s.SetupTest()
+		}()
+
+		transactionID := createCashPurchase(parentUserID, map[string]any{"amount": 10})
+		assert.Equal(s.T(), 0, s.parentTokens())
+
+		// Parents cannot see the cash desk queue.
+		resp := s.sendAs(parentUserID, http.MethodGet, pendingPath, nil)
+		assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+		resp = s.sendAs(organizerUserID, http.MethodGet, pendingPath, nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code)
+
+		var pending []domain.TokenTransaction
+		err := json.Unmarshal(resp.Body.Bytes(), &pending)
+		require.NoError(s.T(), err)
+		require.Len(s.T(), pending, 1)
+		assert.Equal(s.T(), transactionID, pending[0].ID)
+
+		// Parents cannot approve their own purchases.
+		resp = s.sendAs(parentUserID, http.MethodPost, decisionPath(transactionID, "approve"), nil)
+		assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+		resp = s.sendAs(organizerUserID, http.MethodPost, decisionPath(transactionID, "approve"), nil)
+		assert.Equal(s.T(), http.StatusOK, resp.Code)
+
+		resp = s.sendAs(organizerUserID, http.MethodPost, decisionPath(transactionID, "approve"), nil)
+		assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+		var tokensSold int
+		err = s.db.Raw(`SELECT "tokens_sold" FROM "kermesses" WHERE "id" = ?`, kermesseID).Scan(&tokensSold).Error
+		require.NoError(s.T(), err)
+
+		assert.Equal(s.T(), 10, s.parentTokens())
+		assert.Equal(s.T(), 10, tokensSold)
+	})
+
+	s.Run("Rejection keeps the reason", func() {
+		defer func() {
+			s.TearDownTest()
+			s.SetupTest()
+		}()
+
+		transactionID := createCashPurchase(organizerUserID, map[string]any{"amount": 5, "parent_id": parentUserID})
+
+		resp := s.sendAs(organizerUserID, http.MethodPost, decisionPath(transactionID, "reject"), map[string]any{})
+		assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+		resp = s.sendAs(organizerUserID, http.MethodPost, decisionPath(transactionID, "reject"), map[string]any{"reason": "No cash received"})
+		require.Equal(s.T(), http.StatusOK, resp.Code)
+
+		var transaction domain.TokenTransaction
+		err := json.Unmarshal(resp.Body.Bytes(), &transaction)
+		require.NoError(s.T(), err)
+
+		assert.Equal(s.T(), "Rejected", transaction.Status)
+		assert.Equal(s.T(), "No cash received", transaction.RejectionReason)
+		assert.Equal(s.T(), 0, s.parentTokens())
+	})
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_WalletsAreScopedToKermesse() {
+	const (
+		studentUserID   = 202
+		otherKermesseID = 301
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	// Seed a second kermesse the parent takes part in, and their child.
+	err := s.db.Exec(`INSERT INTO "kermesses" ("id", "name", "date", "location", "created_at", "updated_at") VALUES (?, 'Other kermesse', NOW(), 'School', NOW(), NOW())`, otherKermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, otherKermesseID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	getMe := func(query string) domain.UserWithDetails {
+		resp := s.sendAs(parentUserID, http.MethodGet, "/api/v1/me"+query, nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code)
+
+		var user domain.UserWithDetails
+		err := json.Unmarshal(resp.Body.Bytes(), &user)
+		require.NoError(s.T(), err)
+
+		return user
+	}
+
+	me := getMe("")
+	assert.Equal(s.T(), 10, me.Tokens)
+	assert.Equal(s.T(), []domain.Wallet{{KermesseID: kermesseID, Tokens: 10}}, me.Wallets)
+
+	assert.Equal(s.T(), 10, getMe(fmt.Sprintf("?kermesse_id=%d", kermesseID)).Tokens)
+	assert.Equal(s.T(), 0, getMe(fmt.Sprintf("?kermesse_id=%d", otherKermesseID)).Tokens)
+
+	resp = s.sendAs(parentUserID, http.MethodGet, "/api/v1/me?kermesse_id=abc", nil)
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	transfer := func(kermesseID uint, amount int) *httptest.ResponseRecorder {
+		return s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+			"kermesse_id": kermesseID,
+			"student_id":  studentUserID,
+			"amount":      amount,
+		})
+	}
+
+	// Tokens bought for one kermesse can't be given away in another one.
+	resp = transfer(otherKermesseID, 4)
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	resp = transfer(kermesseID, 4)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	var studentTokens int
+	err = s.db.Raw(`SELECT "balance" FROM "ledger_accounts" WHERE "type" = 'student' AND "owner_id" = ? AND "kermesse_id" = ?`, studentUserID, kermesseID).Scan(&studentTokens).Error
+	require.NoError(s.T(), err)
+
+	assert.Equal(s.T(), 4, studentTokens)
+	assert.Equal(s.T(), 6, getMe(fmt.Sprintf("?kermesse_id=%d", kermesseID)).Tokens)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_HandleCreateKermesse() {
+	tests := []struct {
+		name         string
+		payload      map[string]any
+		wantRespCode int
+	}{
+		{
+			name: "201 - Euros with packs",
+			payload: map[string]any{
+				"currency":    "EUR",
+				"token_price": 100,
+				"token_packs": []map[string]any{{"tokens": 10, "price": 800}},
+			},
+			wantRespCode: http.StatusCreated,
+		},
+		{
+			name:         "400 - Missing pricing",
+			payload:      map[string]any{},
+			wantRespCode: http.StatusBadRequest,
+		},
+		{
+			name: "400 - Unsupported currency",
+			payload: map[string]any{
+				"currency":    "btc",
+				"token_price": 100,
+			},
+			wantRespCode: http.StatusBadRequest,
+		},
+		{
+			name: "400 - Pack of a single token",
+			payload: map[string]any{
+				"currency":    "eur",
+				"token_price": 100,
+				"token_packs": []map[string]any{{"tokens": 1, "price": 90}},
+			},
+			wantRespCode: http.StatusBadRequest,
+		},
+		{
+			name: "400 - Two packs of the same size",
+			payload: map[string]any{
+				"currency":    "eur",
+				"token_price": 100,
+				"token_packs": []map[string]any{{"tokens": 10, "price": 800}, {"tokens": 10, "price": 700}},
+			},
+			wantRespCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			defer func() {
+				s.TearDownTest()
+				s.SetupTest()
+			}()
+
+			payload := map[string]any{
+				"name":     "Spring fair",
+				"date":     "21/03/2026",
+				"location": "School",
+			}
+			for key, value := range tt.payload {
+				payload[key] = value
+			}
+
+			resp := s.sendAs(organizerUserID, http.MethodPost, "/api/v1/kermesses", payload)
+			require.Equal(s.T(), tt.wantRespCode, resp.Code)
+
+			if tt.wantRespCode == http.StatusCreated {
+				var got domain.Kermesse
+				err := json.Unmarshal(resp.Body.Bytes(), &got)
+				require.NoError(s.T(), err)
+
+				assert.Equal(s.T(), domain.KermesseDraft, got.Status)
+				assert.Equal(s.T(), "eur", got.Currency)
+				assert.Equal(s.T(), int64(100), got.TokenPrice)
+				require.Len(s.T(), got.TokenPacks, 1)
+				assert.Equal(s.T(), 10, got.TokenPacks[0].Tokens)
+				assert.Equal(s.T(), int64(800), got.TokenPacks[0].Price)
+			}
+		})
+	}
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_HandleTokenPurchase_Pricing() {
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`UPDATE "kermesses" SET "currency" = 'eur', "token_price" = 100 WHERE "id" = ?`, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "token_packs" ("kermesse_id", "tokens", "price") VALUES (?, 10, 800)`, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 12)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	var got struct {
+		Transaction domain.TokenTransaction `json:"transaction"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &got)
+	require.NoError(s.T(), err)
+
+	assert.Equal(s.T(), 12, got.Transaction.Amount)
+	assert.Equal(s.T(), int64(1000), got.Transaction.MoneyAmount)
+	assert.Equal(s.T(), "eur", got.Transaction.Currency)
+
+	resp = s.purchaseTokens(payment.FakePaymentMethodSucceed, domain.MaxTokensPerPurchase+1)
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_HandleRefundPurchase() {
+	const (
+		standHolderUserID = 203
+		standID           = 400
+		stockID           = 500
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	// Seed a stand selling crêpes at 2 tokens, and its holder.
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Crêpes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Crêpe', 5, 2)`, stockID, standID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/purchase", kermesseID, standID), map[string]any{
+		"stock_id": stockID,
+		"quantity": 3,
+	})
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	var spendID uint
+	err = s.db.Raw(`SELECT "id" FROM "token_transactions" WHERE "type" = 'Spend'`).Scan(&spendID).Error
+	require.NoError(s.T(), err)
+
+	refundPath := fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/refund", kermesseID, spendID)
+
+	assertState := func(parentTokens, stock, tokensSpent int) {
+		s.T().Helper()
+
+		var gotStock, gotTokensSpent int
+		err := s.db.Raw(`SELECT "quantity" FROM "stocks" WHERE "id" = ?`, stockID).Scan(&gotStock).Error
+		require.NoError(s.T(), err)
+		err = s.db.Raw(`SELECT "tokens_spent" FROM "stands" WHERE "id" = ?`, standID).Scan(&gotTokensSpent).Error
+		require.NoError(s.T(), err)
+
+		assert.Equal(s.T(), parentTokens, s.parentTokens())
+		assert.Equal(s.T(), stock, gotStock)
+		assert.Equal(s.T(), tokensSpent, gotTokensSpent)
+	}
+	assertState(4, 2, 6)
+
+	// The buyer can't refund themself.
+	resp = s.sendAs(parentUserID, http.MethodPost, refundPath, map[string]any{"quantity": 1})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	// The stand holder gives one crêpe back.
+	resp = s.sendAs(standHolderUserID, http.MethodPost, refundPath, map[string]any{"quantity": 1})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	var refund domain.TokenTransaction
+	err = json.Unmarshal(resp.Body.Bytes(), &refund)
+	require.NoError(s.T(), err)
+
+	assert.Equal(s.T(), domain.TokenReversal, refund.Type)
+	assert.Equal(s.T(), 2, refund.Amount)
+	require.NotNil(s.T(), refund.ReversedTransactionID)
+	assert.Equal(s.T(), spendID, *refund.ReversedTransactionID)
+	assertState(6, 3, 4)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPost, refundPath, map[string]any{"quantity": 3})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	// The organizer refunds the rest.
+	resp = s.sendAs(organizerUserID, http.MethodPost, refundPath, nil)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+	assertState(10, 5, 0)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, refundPath, nil)
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	// Purchases older than the refund window can't be refunded anymore.
+	resp = s.sendAs(parentUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/purchase", kermesseID, standID), map[string]any{
+		"stock_id": stockID,
+		"quantity": 1,
+	})
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	err = s.db.Exec(`UPDATE "token_transactions" SET "created_at" = NOW() - INTERVAL '2 hours' WHERE "type" = 'Spend' AND "id" <> ?`, spendID).Error
+	require.NoError(s.T(), err)
+
+	var lateSpendID uint
+	err = s.db.Raw(`SELECT "id" FROM "token_transactions" WHERE "type" = 'Spend' AND "id" <> ?`, spendID).Scan(&lateSpendID).Error
+	require.NoError(s.T(), err)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/refund", kermesseID, lateSpendID), nil)
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/ledger/audit", kermesseID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	var audit struct {
+		Balanced bool `json:"balanced"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &audit)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), audit.Balanced)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_HandleStandCheckout() {
+	const (
+		standID      = 400
+		crepeStockID = 500
+		juiceStockID = 501
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Crêpes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Crêpe', 5, 2), (?, ?, 'Juice', 1, 1)`,
+		crepeStockID, standID, juiceStockID, standID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	checkoutPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/checkout", kermesseID, standID)
+	line := func(stockID uint, quantity int) map[string]any {
+		return map[string]any{"stock_id": stockID, "quantity": quantity}
+	}
+
+	assertStock := func(crepes, juices int) {
+		s.T().Helper()
+
+		var got []int
+		err := s.db.Raw(`SELECT "quantity" FROM "stocks" WHERE "stand_id" = ? ORDER BY "id"`, standID).Scan(&got).Error
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), []int{crepes, juices}, got)
+	}
+
+	resp = s.sendAs(parentUserID, http.MethodPost, checkoutPath, map[string]any{"lines": []any{}})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, checkoutPath, map[string]any{"lines": []any{line(crepeStockID, 1), line(999, 1)}})
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	// One juice is left: nothing of the order goes through.
+	resp = s.sendAs(parentUserID, http.MethodPost, checkoutPath, map[string]any{"lines": []any{line(crepeStockID, 2), line(juiceStockID, 2)}})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+	assertStock(5, 1)
+	assert.Equal(s.T(), 10, s.parentTokens())
+
+	// Six crêpes cost more than the parent has.
+	resp = s.sendAs(parentUserID, http.MethodPost, checkoutPath, map[string]any{"lines": []any{line(crepeStockID, 5), line(juiceStockID, 1)}})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+	assertStock(5, 1)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, checkoutPath, map[string]any{"lines": []any{line(crepeStockID, 1), line(juiceStockID, 1), line(crepeStockID, 2)}})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	var body struct {
+		Order           domain.Order `json:"order"`
+		RemainingTokens int          `json:"remaining_tokens"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &body)
+	require.NoError(s.T(), err)
+
+	assert.Equal(s.T(), 7, body.Order.TotalTokens)
+	assert.Equal(s.T(), 3, body.RemainingTokens)
+	require.Len(s.T(), body.Order.Lines, 2)
+	assert.Equal(s.T(), 3, body.Order.Lines[0].Quantity)
+	assert.Equal(s.T(), 6, body.Order.Lines[0].Tokens)
+	assert.Equal(s.T(), 1, body.Order.Lines[1].Quantity)
+	assertStock(2, 0)
+	assert.Equal(s.T(), 3, s.parentTokens())
+
+	var spends []domain.TokenTransaction
+	err = s.db.Raw(`SELECT * FROM "token_transactions" WHERE "type" = 'Spend'`).Scan(&spends).Error
+	require.NoError(s.T(), err)
+	require.Len(s.T(), spends, 1)
+	assert.Equal(s.T(), body.Order.TransactionID, spends[0].ID)
+	assert.Equal(s.T(), 7, spends[0].Amount)
+
+	// Refunding the order gives every item back.
+	resp = s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/refund", kermesseID, spends[0].ID), nil)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+	assertStock(5, 1)
+	assert.Equal(s.T(), 10, s.parentTokens())
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_StandCharges() {
+	const (
+		studentUserID     = 202
+		standHolderUserID = 203
+		standID           = 400
+		stockID           = 500
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Crêpes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Crêpe', 5, 2)`, stockID, standID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id", "short_code") VALUES (?, ?, 'ABC234')`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, kermesseID, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      10,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	// The parent lets charges of a single crêpe through.
+	settingsPath := fmt.Sprintf("/api/v1/students/%d/pos-settings", studentUserID)
+	resp = s.sendAs(standHolderUserID, http.MethodPut, settingsPath, map[string]any{"badge_id": "BADGE-1", "auto_approve_limit": 100})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPut, settingsPath, map[string]any{"badge_id": "BADGE-1", "auto_approve_limit": 2})
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	assertState := func(studentTokens, stock int) {
+		s.T().Helper()
+
+		var gotTokens, gotStock int
+		err := s.db.Raw(`SELECT "balance" FROM "ledger_accounts" WHERE "type" = 'student' AND "owner_id" = ? AND "kermesse_id" = ?`, studentUserID, kermesseID).Scan(&gotTokens).Error
+		require.NoError(s.T(), err)
+		err = s.db.Raw(`SELECT "quantity" FROM "stocks" WHERE "id" = ?`, stockID).Scan(&gotStock).Error
+		require.NoError(s.T(), err)
+
+		assert.Equal(s.T(), studentTokens, gotTokens)
+		assert.Equal(s.T(), stock, gotStock)
+	}
+
+	chargesPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/charges", kermesseID, standID)
+	charge := func(code string, quantity int) domain.Charge {
+		s.T().Helper()
+
+		resp := s.sendAs(standHolderUserID, http.MethodPost, chargesPath, map[string]any{
+			"student_code": code,
+			"lines":        []any{map[string]any{"stock_id": stockID, "quantity": quantity}},
+		})
+		require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+		var charge domain.Charge
+		err := json.Unmarshal(resp.Body.Bytes(), &charge)
+		require.NoError(s.T(), err)
+
+		return charge
+	}
+	answerPath := func(charge domain.Charge, answer string) string {
+		return fmt.Sprintf("/api/v1/kermesses/%d/charges/%d/%s", kermesseID, charge.Transaction.ID, answer)
+	}
+
+	// Only holders of the stand ring up sales, for students they can identify.
+	resp = s.sendAs(parentUserID, http.MethodPost, chargesPath, map[string]any{
+		"student_code": "ABC234",
+		"lines":        []any{map[string]any{"stock_id": stockID, "quantity": 1}},
+	})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPost, chargesPath, map[string]any{
+		"student_code": "ZZZZZZ",
+		"lines":        []any{map[string]any{"stock_id": stockID, "quantity": 1}},
+	})
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	// Within the limit, the badge is enough.
+	approved := charge("BADGE-1", 1)
+	assert.Equal(s.T(), "Validated", approved.Transaction.Status)
+	assert.Equal(s.T(), uint(studentUserID), approved.Order.BuyerID)
+	assertState(8, 4)
+
+	// Above it, the charge waits for the student, who may type their code.
+	pending := charge("abc234", 2)
+	assert.Equal(s.T(), "Pending", pending.Transaction.Status)
+	assertState(8, 4)
+
+	// A charge can't be refunded before it settles.
+	refundPath := func(charge domain.Charge) string {
+		return fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/refund", kermesseID, charge.Transaction.ID)
+	}
+	resp = s.sendAs(standHolderUserID, http.MethodPost, refundPath(pending), map[string]any{})
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+	assertState(8, 4)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPost, answerPath(pending, "confirm"), nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(studentUserID, http.MethodPost, answerPath(pending, "confirm"), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	assertState(4, 2)
+
+	resp = s.sendAs(studentUserID, http.MethodPost, answerPath(pending, "confirm"), nil)
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+	// The parent declines the next one.
+	declined := charge("ABC234", 2)
+	resp = s.sendAs(parentUserID, http.MethodPost, answerPath(declined, "decline"), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var rejected domain.TokenTransaction
+	err = json.Unmarshal(resp.Body.Bytes(), &rejected)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "Rejected", rejected.Status)
+
+	resp = s.sendAs(studentUserID, http.MethodPost, answerPath(declined, "confirm"), nil)
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+	assertState(4, 2)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, refundPath(declined), map[string]any{})
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+	assertState(4, 2)
+
+	// The stand holder cancels a charge rung up by mistake.
+	cancelled := charge("ABC234", 2)
+	resp = s.sendAs(standHolderUserID, http.MethodPost, answerPath(cancelled, "decline"), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	assertState(4, 2)
+
+	// A stand holder off the stand's staff declines as the student's parent.
+	const parentHolderUserID = 204
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'parent-holder@test.com', 'password', 'Parent holder', 'stand_holder', NOW(), NOW())`, parentHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, parentHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	declinedByHolder := charge("ABC234", 2)
+	resp = s.sendAs(parentHolderUserID, http.MethodPost, answerPath(declinedByHolder, "decline"), nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	err = s.db.Exec(`UPDATE "students" SET "parent_id" = ? WHERE "user_id" = ?`, parentHolderUserID, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp = s.sendAs(parentHolderUserID, http.MethodPost, answerPath(declinedByHolder, "decline"), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	assertState(4, 2)
+
+	// Only organizers of the kermesse can audit its ledger.
+	resp = s.sendAs(parentUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/ledger/audit", kermesseID), nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/ledger/audit", kermesseID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	var audit struct {
+		Balanced bool `json:"balanced"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &audit)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), audit.Balanced)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_PaymentRequests() {
+	const (
+		standHolderUserID = 203
+		standID           = 400
+		stockID           = 500
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Crêpes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Crêpe', 5, 2)`, stockID, standID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	requestsPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/payment-requests", kermesseID, standID)
+	payPath := fmt.Sprintf("/api/v1/kermesses/%d/payment-requests/pay", kermesseID)
+	issue := func(quantity int) domain.SignedStandPaymentRequest {
+		s.T().Helper()
+
+		resp := s.sendAs(standHolderUserID, http.MethodPost, requestsPath, map[string]any{
+			"lines": []any{map[string]any{"stock_id": stockID, "quantity": quantity}},
+		})
+		require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+		var request domain.SignedStandPaymentRequest
+		err := json.Unmarshal(resp.Body.Bytes(), &request)
+		require.NoError(s.T(), err)
+
+		return request
+	}
+
+	// Only holders of the stand issue requests, for what the cart costs.
+	resp = s.sendAs(parentUserID, http.MethodPost, requestsPath, map[string]any{
+		"lines": []any{map[string]any{"stock_id": stockID, "quantity": 1}},
+	})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPost, requestsPath, map[string]any{
+		"lines":  []any{map[string]any{"stock_id": stockID, "quantity": 1}},
+		"amount": 3,
+	})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	request := issue(2)
+	assert.Equal(s.T(), 4, request.Amount)
+	assert.True(s.T(), request.ExpiresAt.After(time.Now()))
+
+	// The stand shows it as a QR code.
+	resp = s.sendAs(standHolderUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/payment-requests/qr?size=200&payload=%s", kermesseID, url.QueryEscape(request.Payload)), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(s.T(), "image/png", resp.Header().Get("Content-Type"))
+	assert.True(s.T(), bytes.HasPrefix(resp.Body.Bytes(), []byte("\x89PNG")))
+
+	// Tampered payloads are refused.
+	resp = s.sendAs(parentUserID, http.MethodPost, payPath, map[string]any{"payload": request.Payload + "x"})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, payPath, map[string]any{"payload": request.Payload})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var paid struct {
+		Order           domain.Order `json:"order"`
+		RemainingTokens int          `json:"remaining_tokens"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &paid)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 4, paid.Order.TotalTokens)
+	assert.Equal(s.T(), uint(parentUserID), paid.Order.BuyerID)
+	assert.Equal(s.T(), 6, paid.RemainingTokens)
+
+	// A request pays for one order only.
+	resp = s.sendAs(parentUserID, http.MethodPost, payPath, map[string]any{"payload": request.Payload})
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+	// Nor can it be paid once prices changed.
+	repriced := issue(1)
+	err = s.db.Exec(`UPDATE "stocks" SET "token_cost" = 3 WHERE "id" = ?`, stockID).Error
+	require.NoError(s.T(), err)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, payPath, map[string]any{"payload": repriced.Payload})
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+	// Or once expired.
+	expired := repriced.StandPaymentRequest
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	key := (&config.APIConfig{JWTSigningKey: jwtSigningKey}).PaymentRequestKey()
+	resp = s.sendAs(parentUserID, http.MethodPost, payPath, map[string]any{"payload": expired.Sign(key)})
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+	var stock int
+	err = s.db.Raw(`SELECT "quantity" FROM "stocks" WHERE "id" = ?`, stockID).Scan(&stock).Error
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 3, stock)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_OfflineVouchers() {
+	const (
+		studentUserID     = 202
+		standHolderUserID = 203
+		standID           = 400
+		stockID           = 500
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Crêpes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Crêpe', 1, 2)`, stockID, standID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, kermesseID, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      6,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	// Allowances are for what the student's wallet holds, issued by the
+	// student or their parent.
+	allowancesPath := fmt.Sprintf("/api/v1/kermesses/%d/offline-allowances", kermesseID)
+	resp = s.sendAs(studentUserID, http.MethodPost, allowancesPath, map[string]any{"limit": 7})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPost, allowancesPath, map[string]any{"student_id": studentUserID, "limit": 5})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, allowancesPath, map[string]any{"student_id": studentUserID, "limit": 5})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var allowance domain.IssuedOfflineAllowance
+	err = json.Unmarshal(resp.Body.Bytes(), &allowance)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(studentUserID), allowance.StudentID)
+
+	secret, err := base64.RawURLEncoding.DecodeString(allowance.Secret)
+	require.NoError(s.T(), err)
+
+	// What the student's app signs at the stand while offline.
+	voucherAt := func(sequence uint, standID uint, amount int, signedAt time.Time) string {
+		return domain.OfflineVoucher{
+			AllowanceID: allowance.ID,
+			Sequence:    sequence,
+			StandID:     standID,
+			Lines:       []domain.CartLine{{StockID: stockID, Quantity: 1}},
+			Amount:      amount,
+			SignedAt:    signedAt,
+		}.Sign(secret)
+	}
+	voucher := func(sequence uint, standID uint, amount int) string {
+		return voucherAt(sequence, standID, amount, time.Now())
+	}
+	batch := []string{
+		voucher(1, standID, 2),
+		voucher(2, standID, 2),
+		voucher(3, standID, 2), // Over the limit of 5.
+		voucher(1, standID, 2), // Spent twice.
+		"kov1.garbage.garbage",
+		voucher(4, standID+1, 2),
+		voucher(5, standID, 1),
+		voucherAt(6, standID, 2, time.Now().Add(-time.Hour)), // Backdated before the allowance.
+		voucherAt(7, standID, 2, time.Now().Add(time.Hour)),  // Signed after the upload.
+	}
+
+	vouchersPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/offline-vouchers", kermesseID, standID)
+	resp = s.sendAs(parentUserID, http.MethodPost, vouchersPath, map[string]any{"vouchers": batch})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	upload := func() domain.VoucherReconciliation {
+		s.T().Helper()
+
+		resp := s.sendAs(standHolderUserID, http.MethodPost, vouchersPath, map[string]any{"vouchers": batch})
+		require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+		var report domain.VoucherReconciliation
+		err := json.Unmarshal(resp.Body.Bytes(), &report)
+		require.NoError(s.T(), err)
+		require.Len(s.T(), report.Results, len(batch))
+
+		return report
+	}
+
+	report := upload()
+	assert.Equal(s.T(), 2, report.Accepted)
+	assert.Equal(s.T(), 1, report.Duplicates)
+	assert.Equal(s.T(), 6, report.Rejected)
+	assert.Equal(s.T(), 4, report.Tokens)
+
+	reasons := make([]string, 0, len(report.Results))
+	for _, result := range report.Results {
+		reasons = append(reasons, result.Status+":"+result.Reason)
+	}
+	assert.Equal(s.T(), []string{
+		"accepted:",
+		"accepted:",
+		"rejected:limit_exceeded",
+		"duplicate:",
+		"rejected:invalid_voucher",
+		"rejected:wrong_stand",
+		"rejected:price_mismatch",
+		"rejected:invalid_signing_time",
+		"rejected:invalid_signing_time",
+	}, reasons)
+
+	// Uploading again doesn't spend twice.
+	report = upload()
+	assert.Equal(s.T(), 0, report.Accepted)
+	assert.Equal(s.T(), 3, report.Duplicates)
+
+	// The crêpes were handed over offline: the stock stops at zero.
+	var studentTokens, stock int
+	err = s.db.Raw(`SELECT "balance" FROM "ledger_accounts" WHERE "type" = 'student' AND "owner_id" = ? AND "kermesse_id" = ?`, studentUserID, kermesseID).Scan(&studentTokens).Error
+	require.NoError(s.T(), err)
+	err = s.db.Raw(`SELECT "quantity" FROM "stocks" WHERE "id" = ?`, stockID).Scan(&stock).Error
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, studentTokens)
+	assert.Equal(s.T(), 0, stock)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_Promotions() {
+	const (
+		studentUserID     = 202
+		standHolderUserID = 203
+		cashierUserID     = 204
+		standID           = 400
+		crepeStockID      = 500
+		juiceStockID      = 501
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Crêpes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Crêpe', 10, 2), (?, ?, 'Juice', 10, 1)`, crepeStockID, standID, juiceStockID, standID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'cashier@test.com', 'password', 'Cashier', 'stand_holder', NOW(), NOW())`, cashierUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, cashierUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'cashier', NOW())`, standID, cashierUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, kermesseID, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      6,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	promotionsPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/promotions", kermesseID, standID)
+	combo := map[string]any{
+		"name": "Crêpe and juice",
+		"type": "bundle",
+		"items": []map[string]any{
+			{"stock_id": crepeStockID, "quantity": 1},
+			{"stock_id": juiceStockID, "quantity": 1},
+		},
+		"bundle_price": 2,
+	}
+
+	// Only managers of the stand and organizers set its promotions, about
+	// items it sells. Cashiers only ring them up.
+	resp = s.sendAs(studentUserID, http.MethodPost, promotionsPath, combo)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(cashierUserID, http.MethodPost, promotionsPath, combo)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPost, promotionsPath, map[string]any{
+		"name":        "Free stuff",
+		"type":        "percent_off",
+		"items":       []map[string]any{{"stock_id": 999}},
+		"percent_off": 50,
+	})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPost, promotionsPath, combo)
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var promotion domain.Promotion
+	err = json.Unmarshal(resp.Body.Bytes(), &promotion)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), promotion.Active)
+	assert.Len(s.T(), promotion.Items, 2)
+
+	// A happy hour that hasn't started doesn't apply yet.
+	startsAt := time.Now().Add(time.Hour)
+	resp = s.sendAs(organizerUserID, http.MethodPost, promotionsPath, map[string]any{
+		"name":        "Happy hour",
+		"type":        "percent_off",
+		"percent_off": 50,
+		"starts_at":   startsAt,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	resp = s.sendAs(studentUserID, http.MethodGet, promotionsPath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+	var promotions []domain.Promotion
+	err = json.Unmarshal(resp.Body.Bytes(), &promotions)
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), promotions, 2)
+
+	checkoutPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/checkout", kermesseID, standID)
+	checkout := func() domain.Order {
+		s.T().Helper()
+
+		resp := s.sendAs(studentUserID, http.MethodPost, checkoutPath, map[string]any{
+			"lines": []map[string]any{
+				{"stock_id": crepeStockID, "quantity": 1},
+				{"stock_id": juiceStockID, "quantity": 1},
+			},
+		})
+		require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+		var body struct {
+			Order domain.Order `json:"order"`
+		}
+		err := json.Unmarshal(resp.Body.Bytes(), &body)
+		require.NoError(s.T(), err)
+
+		return body.Order
+	}
+
+	order := checkout()
+	assert.Equal(s.T(), 2, order.TotalTokens)
+	assert.Equal(s.T(), 1, order.Discount)
+	require.NotNil(s.T(), order.PromotionID)
+	assert.Equal(s.T(), promotion.ID, *order.PromotionID)
+
+	// The spend records the promotion too.
+	var spendPromotionID *uint
+	var spendAmount int
+	err = s.db.Raw(`SELECT "promotion_id" FROM "token_transactions" WHERE "id" = ?`, order.TransactionID).Scan(&spendPromotionID).Error
+	require.NoError(s.T(), err)
+	err = s.db.Raw(`SELECT "amount" FROM "token_transactions" WHERE "id" = ?`, order.TransactionID).Scan(&spendAmount).Error
+	require.NoError(s.T(), err)
+	require.NotNil(s.T(), spendPromotionID)
+	assert.Equal(s.T(), promotion.ID, *spendPromotionID)
+	assert.Equal(s.T(), 2, spendAmount)
+
+	// Once ended, items are back to their full price.
+	resp = s.sendAs(studentUserID, http.MethodDelete, fmt.Sprintf("%s/%d", promotionsPath, promotion.ID), nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(cashierUserID, http.MethodDelete, fmt.Sprintf("%s/%d", promotionsPath, promotion.ID), nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(standHolderUserID, http.MethodDelete, fmt.Sprintf("%s/%d", promotionsPath, promotion.ID), nil)
+	require.Equal(s.T(), http.StatusNoContent, resp.Code, resp.Body.String())
+
+	resp = s.sendAs(standHolderUserID, http.MethodDelete, fmt.Sprintf("%s/%d", promotionsPath, 9999), nil)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	order = checkout()
+	assert.Equal(s.T(), 3, order.TotalTokens)
+	assert.Equal(s.T(), 0, order.Discount)
+	assert.Nil(s.T(), order.PromotionID)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_StockReservations() {
+	const (
+		studentUserID = 202
+		standID       = 400
+		stockID       = 500
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Cakes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Cake', 1, 2)`, stockID, standID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, kermesseID, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      6,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	cart := map[string]any{"lines": []map[string]any{{"stock_id": stockID, "quantity": 1}}}
+	reservationsPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/reservations", kermesseID, standID)
+	checkoutPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/checkout", kermesseID, standID)
+	reserve := func() domain.StockReservation {
+		s.T().Helper()
+
+		resp := s.sendAs(studentUserID, http.MethodPost, reservationsPath, cart)
+		require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+		var reservations []domain.StockReservation
+		err := json.Unmarshal(resp.Body.Bytes(), &reservations)
+		require.NoError(s.T(), err)
+		require.Len(s.T(), reservations, 1)
+
+		return reservations[0]
+	}
+	stock := func() domain.Stock {
+		s.T().Helper()
+
+		resp := s.sendAs(organizerUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/stand", kermesseID), nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+		var stands []struct {
+			Stock []domain.Stock `json:"stock"`
+		}
+		err := json.Unmarshal(resp.Body.Bytes(), &stands)
+		require.NoError(s.T(), err)
+		require.Len(s.T(), stands, 1)
+		require.Len(s.T(), stands[0].Stock, 1)
+
+		return stands[0].Stock[0]
+	}
+
+	// The student holds the last cake while asking their parent.
+	reservation := reserve()
+	assert.Equal(s.T(), domain.ReservationHeld, reservation.Status)
+	assert.Equal(s.T(), domain.Stock{ID: stockID, StandID: standID, ItemName: "Cake", Quantity: 1, TokenCost: 2, Reserved: 1, Available: 0}, stock())
+
+	// Nobody else can take or hold it meanwhile.
+	resp = s.sendAs(parentUserID, http.MethodPost, checkoutPath, cart)
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+	resp = s.sendAs(parentUserID, http.MethodPost, reservationsPath, cart)
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	// Only the user holding it can release it, in its own kermesse.
+	releasePath := fmt.Sprintf("/api/v1/kermesses/%d/reservations/%d", kermesseID, reservation.ID)
+	resp = s.sendAs(parentUserID, http.MethodDelete, releasePath, nil)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+	resp = s.sendAs(studentUserID, http.MethodDelete, fmt.Sprintf("/api/v1/kermesses/%d/reservations/%d", kermesseID+1, reservation.ID), nil)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+	assert.Equal(s.T(), 0, stock().Available)
+	resp = s.sendAs(studentUserID, http.MethodDelete, releasePath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(s.T(), 1, stock().Available)
+
+	// Expired reservations are swept.
+	reservation = reserve()
+	err = s.db.Exec(`UPDATE "stock_reservations" SET "expires_at" = NOW() - INTERVAL '1 minute' WHERE "id" = ?`, reservation.ID).Error
+	require.NoError(s.T(), err)
+	released, err := dao.NewKermesseDao(s.db).ReleaseExpiredReservations(context.Background(), time.Now())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 1, released)
+	assert.Equal(s.T(), 1, stock().Available)
+
+	// The purchase confirms the reservation.
+	reservation = reserve()
+	resp = s.sendAs(studentUserID, http.MethodPost, checkoutPath, cart)
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var body struct {
+		Order domain.Order `json:"order"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &body)
+	require.NoError(s.T(), err)
+
+	var confirmed dao.StockReservation
+	err = s.db.First(&confirmed, reservation.ID).Error
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), dao.ReservationConfirmed, confirmed.Status)
+	require.NotNil(s.T(), confirmed.TransactionID)
+	assert.Equal(s.T(), body.Order.TransactionID, *confirmed.TransactionID)
+	assert.Equal(s.T(), domain.Stock{ID: stockID, StandID: standID, ItemName: "Cake", TokenCost: 2}, stock())
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_StockMovements() {
+	const (
+		studentUserID     = 202
+		standHolderUserID = 203
+		standID           = 400
+		legacyStockID     = 501
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Cakes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, kermesseID, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      6,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	// New stock comes in as a restock.
+	resp = s.sendAs(standHolderUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/stock", kermesseID, standID), map[string]any{
+		"itemName":  "Cake",
+		"quantity":  10,
+		"tokenCost": 2,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var cake domain.Stock
+	err = json.Unmarshal(resp.Body.Bytes(), &cake)
+	require.NoError(s.T(), err)
+
+	// Two cakes fell on the floor; waste can't add any.
+	updatePath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/stock/update", kermesseID, standID)
+	update := map[string]any{
+		"stock_id":   cake.ID,
+		"item_name":  "Cake",
+		"quantity":   12,
+		"token_cost": 2,
+		"reason":     "waste",
+	}
+	resp = s.sendAs(standHolderUserID, http.MethodPost, updatePath, update)
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, resp.Code)
+
+	update["quantity"] = 8
+	update["note"] = "dropped"
+	resp = s.sendAs(standHolderUserID, http.MethodPost, updatePath, update)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	// A sale, refunded by the organizer.
+	resp = s.sendAs(studentUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/checkout", kermesseID, standID), map[string]any{
+		"lines": []map[string]any{{"stock_id": cake.ID, "quantity": 1}},
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var body struct {
+		Order domain.Order `json:"order"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &body)
+	require.NoError(s.T(), err)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/refund", kermesseID, body.Order.TransactionID), nil)
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var refund domain.TokenTransaction
+	err = json.Unmarshal(resp.Body.Bytes(), &refund)
+	require.NoError(s.T(), err)
+
+	auditPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/stock/movements", kermesseID, standID)
+	audit := func(userID uint) domain.StockAudit {
+		s.T().Helper()
+
+		resp := s.sendAs(userID, http.MethodGet, auditPath, nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+		var audit domain.StockAudit
+		err := json.Unmarshal(resp.Body.Bytes(), &audit)
+		require.NoError(s.T(), err)
+
+		return audit
+	}
+
+	got := audit(standHolderUserID)
+	assert.True(s.T(), got.Reconciled)
+	assert.Equal(s.T(), []domain.StockItemAudit{{StockID: cake.ID, ItemName: "Cake", Quantity: 8, JournalQuantity: 8}}, got.Items)
+	require.Len(s.T(), got.Movements, 4)
+
+	type movement struct {
+		Delta         int
+		QuantityAfter int
+		Reason        domain.StockMovementReason
+		ActorID       uint
+		TransactionID uint
+		Note          string
+	}
+	movements := make([]movement, 0, len(got.Movements))
+	for _, m := range got.Movements {
+		var transactionID uint
+		if m.TransactionID != nil {
+			transactionID = *m.TransactionID
+		}
+		require.NotNil(s.T(), m.ActorID)
+		movements = append(movements, movement{m.Delta, m.QuantityAfter, m.Reason, *m.ActorID, transactionID, m.Note})
+	}
+	assert.Equal(s.T(), []movement{
+		{10, 10, domain.StockRestock, standHolderUserID, 0, ""},
+		{-2, 8, domain.StockWaste, standHolderUserID, 0, "dropped"},
+		{-1, 7, domain.StockSale, studentUserID, body.Order.TransactionID, ""},
+		{1, 8, domain.StockRefund, organizerUserID, refund.ID, ""},
+	}, movements)
+
+	// Stock changed behind the journal's back shows up.
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Pie', 3, 4)`, legacyStockID, standID).Error
+	require.NoError(s.T(), err)
+
+	got = audit(organizerUserID)
+	assert.False(s.T(), got.Reconciled)
+	assert.Contains(s.T(), got.Items, domain.StockItemAudit{StockID: legacyStockID, ItemName: "Pie", Quantity: 3, Difference: 3})
+
+	// Buyers can't see it.
+	resp = s.sendAs(studentUserID, http.MethodGet, auditPath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	// Organizers restock the stand too, buyers can't.
+	restock := map[string]any{
+		"stock_id":   cake.ID,
+		"item_name":  "Cake",
+		"quantity":   12,
+		"token_cost": 2,
+		"reason":     "restock",
+	}
+	resp = s.sendAs(studentUserID, http.MethodPost, updatePath, restock)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, updatePath, restock)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/stock", kermesseID, standID), map[string]any{
+		"itemName":  "Brownie",
+		"quantity":  5,
+		"tokenCost": 3,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	got = audit(organizerUserID)
+	assert.Contains(s.T(), got.Items, domain.StockItemAudit{StockID: cake.ID, ItemName: "Cake", Quantity: 12, JournalQuantity: 12})
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_LowStockAlerts() {
+	const (
+		studentUserID     = 202
+		standHolderUserID = 203
+		standID           = 400
+		stockID           = 500
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Drinks', 'drink', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost", "low_stock_threshold") VALUES (?, ?, 'Juice', 4, 2, 2)`, stockID, standID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, kermesseID, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      6,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	buyJuice := func() {
+		s.T().Helper()
+
+		resp := s.sendAs(studentUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/checkout", kermesseID, standID), map[string]any{
+			"lines": []map[string]any{{"stock_id": stockID, "quantity": 1}},
+		})
+		require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+	}
+	notifications := func(userID uint) []domain.Notification {
+		s.T().Helper()
+
+		resp := s.sendAs(userID, http.MethodGet, "/api/v1/me/notifications", nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+		var notifications []domain.Notification
+		err := json.Unmarshal(resp.Body.Bytes(), &notifications)
+		require.NoError(s.T(), err)
+
+		return notifications
+	}
+	lowStockPath := fmt.Sprintf("/api/v1/kermesses/%d/stock/low", kermesseID)
+
+	// Nothing is low yet.
+	buyJuice()
+	assert.Empty(s.T(), notifications(standHolderUserID))
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, lowStockPath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	assert.JSONEq(s.T(), `[]`, resp.Body.String())
+
+	// The sale taking the juice down to its threshold alerts the holder and
+	// the organizers, once.
+	buyJuice()
+	buyJuice()
+
+	const alert = "Low stock at Drinks: 2 Juice left (alert threshold 2)"
+	for _, userID := range []uint{standHolderUserID, organizerUserID} {
+		got := notifications(userID)
+		require.Len(s.T(), got, 1)
+		assert.Equal(s.T(), domain.NotificationLowStock, got[0].Type)
+		assert.Equal(s.T(), uint(standID), got[0].StandID)
+		assert.Equal(s.T(), alert, got[0].Message)
+	}
+	assert.Empty(s.T(), notifications(studentUserID))
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/stands/%d/messages", kermesseID, standID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var messages []domain.ChatMessage
+	err = json.Unmarshal(resp.Body.Bytes(), &messages)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), messages, 1)
+	assert.Equal(s.T(), uint(domain.SystemSenderID), messages[0].SenderID)
+	assert.Equal(s.T(), alert, messages[0].Message)
+
+	// Organizers see what's running low across the kermesse.
+	resp = s.sendAs(organizerUserID, http.MethodGet, lowStockPath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var items []domain.LowStockItem
+	err = json.Unmarshal(resp.Body.Bytes(), &items)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []domain.LowStockItem{
+		{StandID: standID, StandName: "Drinks", StockID: stockID, ItemName: "Juice", Quantity: 1, Available: 1, Threshold: 2},
+	}, items)
+
+	resp = s.sendAs(standHolderUserID, http.MethodGet, lowStockPath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_StandLifecycle() {
+	const (
+		studentUserID     = 202
+		standHolderUserID = 203
+		standID           = 400
+		cakeStockID       = 500
+		pieStockID        = 501
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Cakes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Cake', 5, 2), (?, ?, 'Pie', 3, 4)`, cakeStockID, standID, pieStockID, standID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, kermesseID, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      6,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	checkoutPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/checkout", kermesseID, standID)
+	resp = s.sendAs(studentUserID, http.MethodPost, checkoutPath, map[string]any{
+		"lines": []map[string]any{{"stock_id": cakeStockID, "quantity": 1}},
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var body struct {
+		Order domain.Order `json:"order"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &body)
+	require.NoError(s.T(), err)
+
+	standPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d", kermesseID, standID)
+	cakePath := fmt.Sprintf("%s/stock/%d", standPath, cakeStockID)
+	piePath := fmt.Sprintf("%s/stock/%d", standPath, pieStockID)
+
+	// Buyers see the stand, not its stock, and can't edit it.
+	resp = s.sendAs(studentUserID, http.MethodGet, standPath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	assert.JSONEq(s.T(), `{"id": 400, "name": "Cakes", "type": "food", "description": ""}`, resp.Body.String())
+
+	resp = s.sendAs(studentUserID, http.MethodPatch, standPath, map[string]any{"name": "Mine"})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(studentUserID, http.MethodGet, cakePath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	// Holders edit their stand; fields left out keep their value.
+	resp = s.sendAs(standHolderUserID, http.MethodPatch, standPath, map[string]any{"name": "Cake corner"})
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var stand domain.Stand
+	err = json.Unmarshal(resp.Body.Bytes(), &stand)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "Cake corner", stand.Name)
+	assert.Equal(s.T(), "food", stand.Type)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPatch, standPath, map[string]any{"type": "toys"})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	// So do organizers with stock items.
+	resp = s.sendAs(organizerUserID, http.MethodPatch, cakePath, map[string]any{"token_cost": 3})
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var cake domain.Stock
+	err = json.Unmarshal(resp.Body.Bytes(), &cake)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "Cake", cake.ItemName)
+	assert.Equal(s.T(), 3, cake.TokenCost)
+	assert.Equal(s.T(), 4, cake.Quantity)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPatch, cakePath, map[string]any{"quantity": 10, "reason": "waste"})
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, resp.Code)
+
+	resp = s.sendAs(standHolderUserID, http.MethodPatch, cakePath, map[string]any{"quantity": 10, "reason": "restock"})
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	err = json.Unmarshal(resp.Body.Bytes(), &cake)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 10, cake.Quantity)
+
+	// Archived items are off sale and out of sight, but their row stays.
+	resp = s.sendAs(standHolderUserID, http.MethodGet, piePath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	resp = s.sendAs(standHolderUserID, http.MethodDelete, piePath, nil)
+	require.Equal(s.T(), http.StatusNoContent, resp.Code, resp.Body.String())
+
+	resp = s.sendAs(standHolderUserID, http.MethodGet, piePath, nil)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	resp = s.sendAs(standHolderUserID, http.MethodDelete, piePath, nil)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	resp = s.sendAs(studentUserID, http.MethodPost, checkoutPath, map[string]any{
+		"lines": []map[string]any{{"stock_id": pieStockID, "quantity": 1}},
+	})
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, standPath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var view struct {
+		Stock []domain.Stock `json:"stock"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &view)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), view.Stock, 1)
+	assert.Equal(s.T(), uint(cakeStockID), view.Stock[0].ID)
+
+	var pies int64
+	err = s.db.Raw(`SELECT COUNT(*) FROM "stocks" WHERE "id" = ? AND "archived_at" IS NOT NULL`, pieStockID).Scan(&pies).Error
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(1), pies)
+
+	// Archived stands leave the kermesse.
+	resp = s.sendAs(studentUserID, http.MethodDelete, standPath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(standHolderUserID, http.MethodDelete, standPath, nil)
+	require.Equal(s.T(), http.StatusNoContent, resp.Code, resp.Body.String())
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, standPath, nil)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodPatch, standPath, map[string]any{"name": "Back"})
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/stand", kermesseID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	assert.JSONEq(s.T(), `null`, resp.Body.String())
+
+	resp = s.sendAs(studentUserID, http.MethodPost, checkoutPath, map[string]any{
+		"lines": []map[string]any{{"stock_id": cakeStockID, "quantity": 1}},
+	})
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	// Purchases made at it can still be refunded.
+	resp = s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/refund", kermesseID, body.Order.TransactionID), nil)
+	assert.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_KermesseLifecycle() {
+	const (
+		standHolderUserID = 203
+		otherParentUserID = 204
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`UPDATE "kermesses" SET "status" = 'draft' WHERE "id" = ?`, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'other@test.com', 'password', 'Other', 'parent', NOW(), NOW())`, otherParentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "parents" ("user_id") VALUES (?)`, otherParentUserID).Error
+	require.NoError(s.T(), err)
+
+	participatePath := fmt.Sprintf("/api/v1/kermesses/%d/participate", kermesseID)
+	standsPath := fmt.Sprintf("/api/v1/kermesses/%d/stand", kermesseID)
+	statusPath := func(action string) string {
+		return fmt.Sprintf("/api/v1/kermesses/%d/%s", kermesseID, action)
+	}
+	assertRefused := func(resp *httptest.ResponseRecorder, code int) {
+		s.T().Helper()
+
+		require.Equal(s.T(), http.StatusConflict, resp.Code, resp.Body.String())
+
+		var got response.Err
+		err := json.Unmarshal(resp.Body.Bytes(), &got)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), code, got.ErrorCode)
+	}
+	setStatus := func(action string, want domain.KermesseStatus) {
+		s.T().Helper()
+
+		resp := s.sendAs(organizerUserID, http.MethodPost, statusPath(action), nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+		var kermesse domain.Kermesse
+		err := json.Unmarshal(resp.Body.Bytes(), &kermesse)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), want, kermesse.Status)
+	}
+	createStand := func(name string) *httptest.ResponseRecorder {
+		return s.sendAs(standHolderUserID, http.MethodPost, standsPath, map[string]any{
+			"name": name,
+			"type": "food",
+		})
+	}
+
+	// Stands are set up in draft, before families can join or buy tokens.
+	resp := s.sendAs(standHolderUserID, http.MethodGet, participatePath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	resp = createStand("Cakes")
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var cakes domain.Stand
+	err = json.Unmarshal(resp.Body.Bytes(), &cakes)
+	require.NoError(s.T(), err)
+
+	// Promotions are part of setting up the stand.
+	promotionsPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d/promotions", kermesseID, cakes.ID)
+	createPromotion := func() *httptest.ResponseRecorder {
+		return s.sendAs(standHolderUserID, http.MethodPost, promotionsPath, map[string]any{
+			"name":        "Opening discount",
+			"type":        "percent_off",
+			"percent_off": 10,
+		})
+	}
+	resp = createPromotion()
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	assertRefused(s.sendAs(otherParentUserID, http.MethodGet, participatePath, nil), response.CodeKermesseNotPublished)
+	assertRefused(s.purchaseTokens(payment.FakePaymentMethodSucceed, 5), response.CodeKermesseNotPublished)
+
+	// Only organizers move the kermesse, one status at a time.
+	resp = s.sendAs(parentUserID, http.MethodPost, statusPath("publish"), nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	assertRefused(s.sendAs(organizerUserID, http.MethodPost, statusPath("open"), nil), response.CodeKermesseTransition)
+
+	// Families join once it is published, and buy tokens once it is open.
+	setStatus("publish", domain.KermessePublished)
+
+	resp = s.sendAs(otherParentUserID, http.MethodGet, participatePath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	assertRefused(s.purchaseTokens(payment.FakePaymentMethodSucceed, 5), response.CodeKermesseNotOpen)
+
+	setStatus("open", domain.KermesseOpen)
+
+	resp = s.purchaseTokens(payment.FakePaymentMethodSucceed, 5)
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	resp = s.sendAs(parentUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/cash-purchase", kermesseID), map[string]any{"amount": 5})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var cashPurchase domain.TokenTransaction
+	err = json.Unmarshal(resp.Body.Bytes(), &cashPurchase)
+	require.NoError(s.T(), err)
+
+	var spendID uint
+	err = s.db.Raw(`INSERT INTO "token_transactions" ("kermesse_id", "from_id", "from_type", "to_id", "to_type", "amount", "type", "stand_id", "status", "quantity", "created_at", "updated_at") SELECT ?, ?, 'parent', "id", 'Stand', 2, 'Spend', "id", 'Validated', 1, NOW(), NOW() FROM "stands" WHERE "kermesse_id" = ? RETURNING "id"`, kermesseID, parentUserID, kermesseID).Scan(&spendID).Error
+	require.NoError(s.T(), err)
+
+	// Closing freezes balances and stands.
+	setStatus("close", domain.KermesseClosed)
+
+	assertRefused(s.purchaseTokens(payment.FakePaymentMethodSucceed, 5), response.CodeKermesseClosed)
+	assertRefused(s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/approve", kermesseID, cashPurchase.ID), nil), response.CodeKermesseClosed)
+	assertRefused(s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/refund", kermesseID, spendID), map[string]any{}), response.CodeKermesseClosed)
+	assertRefused(createStand("Pies"), response.CodeKermesseClosed)
+	assertRefused(createPromotion(), response.CodeKermesseClosed)
+	assertRefused(s.sendAs(organizerUserID, http.MethodPost, statusPath("close"), nil), response.CodeKermesseTransition)
+
+	setStatus("archive", domain.KermesseArchived)
+
+	assertRefused(s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  202,
+		"amount":      1,
+	}), response.CodeKermesseArchived)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_UpdateAndCancelKermesse() {
+	const standHolderUserID = 203
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.sendAs(standHolderUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/participate", kermesseID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	resp = s.sendAs(standHolderUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/stand", kermesseID), map[string]any{
+		"name": "Cakes",
+		"type": "food",
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	resp = s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	kermessePath := fmt.Sprintf("/api/v1/kermesses/%d", kermesseID)
+	cancelPath := fmt.Sprintf("/api/v1/kermesses/%d/cancel", kermesseID)
+	notifications := func(userID uint) []domain.Notification {
+		s.T().Helper()
+
+		resp := s.sendAs(userID, http.MethodGet, "/api/v1/me/notifications", nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+		var notifications []domain.Notification
+		err := json.Unmarshal(resp.Body.Bytes(), &notifications)
+		require.NoError(s.T(), err)
+
+		return notifications
+	}
+	assertRefused := func(resp *httptest.ResponseRecorder, code int) {
+		s.T().Helper()
+
+		require.Equal(s.T(), http.StatusConflict, resp.Code, resp.Body.String())
+
+		var got response.Err
+		err := json.Unmarshal(resp.Body.Bytes(), &got)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), code, got.ErrorCode)
+	}
+
+	// Only organizers edit the kermesse.
+	resp = s.sendAs(parentUserID, http.MethodPatch, kermessePath, map[string]any{"version": 1, "description": "Games"})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodPatch, kermessePath, map[string]any{"version": 1, "date": "2026-06-20"})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	// A new description doesn't bother families.
+	resp = s.sendAs(organizerUserID, http.MethodPatch, kermessePath, map[string]any{"version": 1, "description": "Games"})
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var kermesse domain.Kermesse
+	err = json.Unmarshal(resp.Body.Bytes(), &kermesse)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "Games", kermesse.Description)
+	assert.Equal(s.T(), "School", kermesse.Location)
+	assert.Equal(s.T(), 2, kermesse.Version)
+	assert.Empty(s.T(), notifications(parentUserID))
+
+	// Edits made from an older version are refused.
+	assertRefused(s.sendAs(organizerUserID, http.MethodPatch, kermessePath, map[string]any{"version": 1, "location": "Gym"}), response.CodeKermesseVersion)
+
+	// Moving the kermesse tells participants and stand holders.
+	resp = s.sendAs(organizerUserID, http.MethodPatch, kermessePath, map[string]any{"version": 2, "date": "20/06/2026", "location": "Gym"})
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	err = json.Unmarshal(resp.Body.Bytes(), &kermesse)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "Gym", kermesse.Location)
+	assert.Equal(s.T(), "Games", kermesse.Description)
+	assert.Equal(s.T(), 3, kermesse.Version)
+
+	for _, userID := range []uint{parentUserID, standHolderUserID} {
+		got := notifications(userID)
+		require.Len(s.T(), got, 1)
+		assert.Equal(s.T(), domain.NotificationKermesseUpdated, got[0].Type)
+		assert.Equal(s.T(), "Kermesse now takes place on 20/06/2026 at Gym", got[0].Message)
+	}
+	assert.Empty(s.T(), notifications(organizerUserID))
+
+	// Only organizers cancel the kermesse, which refunds the tokens paid by
+	// card right away.
+	resp = s.sendAs(parentUserID, http.MethodPost, cancelPath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, cancelPath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var cancellation domain.KermesseCancellation
+	err = json.Unmarshal(resp.Body.Bytes(), &cancellation)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), domain.KermesseCancelled, cancellation.Kermesse.Status)
+	assert.True(s.T(), cancellation.Kermesse.IsClosed())
+	require.NotNil(s.T(), cancellation.Refunds)
+	assert.Equal(s.T(), 10, cancellation.Refunds.RefundedTokens)
+	assert.Equal(s.T(), int64(1000), cancellation.Refunds.RefundedAmount)
+	assert.Equal(s.T(), 0, s.parentTokens())
+
+	for _, userID := range []uint{parentUserID, standHolderUserID} {
+		got := notifications(userID)
+		require.Len(s.T(), got, 2)
+		assert.Equal(s.T(), domain.NotificationKermesseCancelled, got[0].Type)
+		assert.Equal(s.T(), "Kermesse is cancelled", got[0].Message)
+		assert.Equal(s.T(), uint(kermesseID), got[0].KermesseID)
+	}
+
+	// A cancelled kermesse takes no edits, tokens or second cancellation,
+	// but can be archived.
+	assertRefused(s.sendAs(organizerUserID, http.MethodPatch, kermessePath, map[string]any{"version": 4, "location": "School"}), response.CodeKermesseCancelled)
+	assertRefused(s.purchaseTokens(payment.FakePaymentMethodSucceed, 5), response.CodeKermesseCancelled)
+	assertRefused(s.sendAs(organizerUserID, http.MethodPost, cancelPath, nil), response.CodeKermesseTransition)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/archive", kermesseID), nil)
+	assert.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_KermesseSchedule() {
+	const (
+		studentUserID     = 202
+		standHolderUserID = 203
+		standID           = 400
+		cakeStockID       = 500
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	createKermesse := func(fields map[string]any) *httptest.ResponseRecorder {
+		payload := map[string]any{
+			"name":        "Summer fair",
+			"location":    "School",
+			"currency":    "eur",
+			"token_price": 100,
+		}
+		for key, value := range fields {
+			payload[key] = value
+		}
+
+		return s.sendAs(organizerUserID, http.MethodPost, "/api/v1/kermesses", payload)
+	}
+
+	// Kermesses take hours in any offset, and render them with the offset
+	// of their time zone.
+	resp := createKermesse(map[string]any{
+		"starts_at": "2026-06-20T08:00:00Z",
+		"ends_at":   "2026-06-20T16:00:00Z",
+		"time_zone": "Europe/Paris",
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var created map[string]any
+	err := json.Unmarshal(resp.Body.Bytes(), &created)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "2026-06-20T10:00:00+02:00", created["starts_at"])
+	assert.Equal(s.T(), "2026-06-20T18:00:00+02:00", created["ends_at"])
+	assert.Equal(s.T(), "Europe/Paris", created["time_zone"])
+	assert.Equal(s.T(), "2026-06-20T00:00:00+02:00", created["Date"])
+
+	resp = createKermesse(map[string]any{"date": "20/06/2026", "time_zone": "Mars/Olympus"})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	resp = createKermesse(map[string]any{"starts_at": "2026-06-20T10:00:00+02:00"})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	resp = createKermesse(map[string]any{
+		"starts_at": "2026-06-20T18:00:00+02:00",
+		"ends_at":   "2026-06-20T10:00:00+02:00",
+	})
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, resp.Code)
+
+	err = s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Cakes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stocks" ("id", "stand_id", "item_name", "quantity", "token_cost") VALUES (?, ?, 'Cake', 10, 1)`, cakeStockID, standID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'holder@test.com', 'password', 'Holder', 'stand_holder', NOW(), NOW())`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?)`, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, standHolderUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "kermesse_participants" ("kermesse_id", "user_id") VALUES (?, ?)`, kermesseID, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp = s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      10,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	standPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d", kermesseID, standID)
+	checkout := func() *httptest.ResponseRecorder {
+		return s.sendAs(studentUserID, http.MethodPost, standPath+"/checkout", map[string]any{
+			"lines": []map[string]any{{"stock_id": cakeStockID, "quantity": 1}},
+		})
+	}
+	assertClosed := func(resp *httptest.ResponseRecorder) {
+		s.T().Helper()
+
+		require.Equal(s.T(), http.StatusConflict, resp.Code, resp.Body.String())
+
+		var got response.Err
+		err := json.Unmarshal(resp.Body.Bytes(), &got)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), response.CodeStandClosed, got.ErrorCode)
+	}
+	setHours := func(startsIn, endsIn string) {
+		s.T().Helper()
+
+		err := s.db.Exec(`UPDATE "kermesses" SET "starts_at" = NOW() + ?::interval, "ends_at" = NOW() + ?::interval, "time_zone" = 'Asia/Kolkata' WHERE "id" = ?`, startsIn, endsIn, kermesseID).Error
+		require.NoError(s.T(), err)
+	}
+	patchStand := func(fields map[string]any) *httptest.ResponseRecorder {
+		return s.sendAs(standHolderUserID, http.MethodPatch, standPath, fields)
+	}
+
+	// Stands take no sales before the kermesse starts or after it ends.
+	setHours("1 hour", "5 hours")
+	assertClosed(checkout())
+
+	setHours("-5 hours", "-1 hour")
+	assertClosed(checkout())
+
+	setHours("-1 hour", "5 hours")
+	resp = checkout()
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	// Stands can close earlier than the kermesse, and go back to its hours.
+	resp = patchStand(map[string]any{"closes_at": time.Now().Add(-30 * time.Minute).Format(time.RFC3339)})
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var stand map[string]any
+	err = json.Unmarshal(resp.Body.Bytes(), &stand)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), strings.HasSuffix(stand["closes_at"].(string), "+05:30"), stand["closes_at"])
+
+	assertClosed(checkout())
+
+	resp = patchStand(map[string]any{"closes_at": ""})
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	resp = checkout()
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	// A stand can't be open only outside the hours of its kermesse.
+	resp = patchStand(map[string]any{"opens_at": time.Now().Add(6 * time.Hour).Format(time.RFC3339)})
+	assert.Equal(s.T(), http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+
+	// Transactions of the kermesse are rendered with its offset.
+	resp = s.sendAs(organizerUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/transactions", kermesseID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var page struct {
+		Transactions []map[string]any `json:"transactions"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &page)
+	require.NoError(s.T(), err)
+	require.NotEmpty(s.T(), page.Transactions)
+	for _, transaction := range page.Transactions {
+		assert.True(s.T(), strings.HasSuffix(transaction["CreatedAt"].(string), "+05:30"), transaction["CreatedAt"])
+	}
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_StandStaff() {
+	const (
+		managerUserID = 202
+		cashierUserID = 203
+		otherUserID   = 204
+		standID       = 400
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "stands" ("id", "name", "type", "kermesse_id", "created_at", "updated_at") VALUES (?, 'Cakes', 'food', ?, NOW(), NOW())`, standID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'manager@test.com', 'password', 'Manager', 'stand_holder', NOW(), NOW()), (?, 'cashier@test.com', 'password', 'Cashier', 'stand_holder', NOW(), NOW()), (?, 'other@test.com', 'password', 'Other', 'stand_holder', NOW(), NOW())`, managerUserID, cashierUserID, otherUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_holders" ("user_id") VALUES (?), (?), (?)`, managerUserID, cashierUserID, otherUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "stand_staffs" ("stand_id", "user_id", "role", "created_at") VALUES (?, ?, 'manager', NOW())`, standID, managerUserID).Error
+	require.NoError(s.T(), err)
+
+	standPath := fmt.Sprintf("/api/v1/kermesses/%d/stand/%d", kermesseID, standID)
+	staffPath := standPath + "/staff"
+
+	// Only managers and organizers invite.
+	resp := s.sendAs(otherUserID, http.MethodPost, staffPath+"/invitations", map[string]any{"email": "cashier@test.com", "role": "cashier"})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(managerUserID, http.MethodPost, staffPath+"/invitations", map[string]any{"email": "cashier@test.com", "role": "owner"})
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	resp = s.sendAs(managerUserID, http.MethodPost, staffPath+"/invitations", map[string]any{"email": "Cashier@test.com", "role": "cashier"})
+	require.Equal(s.T(), http.StatusCreated, resp.Code, resp.Body.String())
+
+	var invitation domain.StandInvitation
+	err = json.Unmarshal(resp.Body.Bytes(), &invitation)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "cashier@test.com", invitation.Email)
+	assert.Equal(s.T(), domain.StandCashier, invitation.Role)
+	assert.NotContains(s.T(), resp.Body.String(), "code")
+
+	var code string
+	err = s.db.Raw(`SELECT code FROM stand_invitations WHERE id = ?`, invitation.ID).Scan(&code).Error
+	require.NoError(s.T(), err)
+
+	// The code only works for the address it was sent to, and once.
+	acceptPath := "/api/v1/stand-invitations/accept"
+	resp = s.sendAs(otherUserID, http.MethodPost, acceptPath, map[string]any{"code": code})
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	resp = s.sendAs(cashierUserID, http.MethodPost, acceptPath, map[string]any{"code": strings.ToLower(code)})
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var member domain.StandStaff
+	err = json.Unmarshal(resp.Body.Bytes(), &member)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), uint(cashierUserID), member.UserID)
+	assert.Equal(s.T(), uint(kermesseID), member.KermesseID)
+	assert.Equal(s.T(), domain.StandCashier, member.Role)
+
+	resp = s.sendAs(cashierUserID, http.MethodPost, acceptPath, map[string]any{"code": code})
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+	// Cashiers see the staff but can't edit the stand.
+	resp = s.sendAs(cashierUserID, http.MethodGet, staffPath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+	var staff []domain.StandStaff
+	err = json.Unmarshal(resp.Body.Bytes(), &staff)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), staff, 2)
+	assert.Equal(s.T(), uint(managerUserID), staff[0].UserID)
+	assert.Equal(s.T(), domain.StandManager, staff[0].Role)
+	assert.Equal(s.T(), uint(cashierUserID), staff[1].UserID)
+
+	resp = s.sendAs(otherUserID, http.MethodGet, staffPath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(cashierUserID, http.MethodPatch, standPath, map[string]any{"name": "Mine"})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	// Stand holders see the stands they work at.
+	resp = s.sendAs(cashierUserID, http.MethodGet, "/api/v1/me", nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	var me domain.UserWithDetails
+	err = json.Unmarshal(resp.Body.Bytes(), &me)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), me.Stands, 1)
+	assert.Equal(s.T(), uint(standID), me.Stands[0].StandID)
+	assert.Equal(s.T(), domain.StandCashier, me.Stands[0].Role)
+
+	// A stand keeps at least one manager.
+	resp = s.sendAs(managerUserID, http.MethodDelete, fmt.Sprintf("%s/%d", staffPath, managerUserID), nil)
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+	resp = s.sendAs(cashierUserID, http.MethodDelete, fmt.Sprintf("%s/%d", staffPath, managerUserID), nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(managerUserID, http.MethodDelete, fmt.Sprintf("%s/%d", staffPath, cashierUserID), nil)
+	assert.Equal(s.T(), http.StatusNoContent, resp.Code)
+
+	resp = s.sendAs(cashierUserID, http.MethodGet, staffPath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_KermesseRefunds() {
+	const studentUserID = 202
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	// The parent pays 10 then 5 tokens by card, and 3 in cash, and gives 4
+	// tokens to their child.
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+	resp = s.purchaseTokens(payment.FakePaymentMethodSucceed, 5)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/cash-purchase", kermesseID), map[string]any{"amount": 3})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	var cashPurchase domain.TokenTransaction
+	err = json.Unmarshal(resp.Body.Bytes(), &cashPurchase)
+	require.NoError(s.T(), err)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/token/transactions/%d/approve", kermesseID, cashPurchase.ID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      4,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+	require.Equal(s.T(), 14, s.parentTokens())
+
+	closePath := fmt.Sprintf("/api/v1/kermesses/%d/close", kermesseID)
+	refundsPath := fmt.Sprintf("/api/v1/kermesses/%d/refunds", kermesseID)
+
+	// Refunds wait for the kermesse to be closed, by one of its organizers.
+	resp = s.sendAs(organizerUserID, http.MethodPost, refundsPath, nil)
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, closePath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, closePath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	var kermesse domain.Kermesse
+	err = json.Unmarshal(resp.Body.Bytes(), &kermesse)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), kermesse.IsClosed())
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, closePath, nil)
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+	// Tokens can no longer be bought once the kermesse is closed.
+	resp = s.purchaseTokens(payment.FakePaymentMethodSucceed, 5)
+	assert.Equal(s.T(), http.StatusConflict, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, refundsPath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+
+	runRefunds := func() domain.RefundRunReport {
+		resp := s.sendAs(organizerUserID, http.MethodPost, refundsPath, nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code)
+
+		var report domain.RefundRunReport
+		err := json.Unmarshal(resp.Body.Bytes(), &report)
+		require.NoError(s.T(), err)
+
+		return report
+	}
+
+	// The 15 tokens paid by card are refunded at the default price, the 3
+	// paid in cash are left, in the child's wallet since the parent's is
+	// emptied first.
+	want := domain.RefundRunReport{
+		KermesseID: kermesseID,
+		Currency:   "usd",
+		Parents: []domain.ParentRefunds{
+			{ParentID: parentUserID, RefundedTokens: 15, RefundedAmount: 1500},
+		},
+		RefundedTokens:     15,
+		RefundedAmount:     1500,
+		PendingRefunds:     []uint{},
+		DeclinedRefunds:    []uint{},
+		UnrefundableTokens: 3,
+	}
+	assert.Equal(s.T(), want, runRefunds())
+	assert.Equal(s.T(), 0, s.parentTokens())
+
+	var studentTokens int
+	err = s.db.Raw(`SELECT "balance" FROM "ledger_accounts" WHERE "type" = 'student' AND "owner_id" = ? AND "kermesse_id" = ?`, studentUserID, kermesseID).Scan(&studentTokens).Error
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 3, studentTokens)
+
+	// No purchase is refunded for more than it cost.
+	var overRefunded int
+	err = s.db.Raw(`SELECT COUNT(*) FROM "token_transactions" AS "p" WHERE "p"."type" = 'Purchase' AND "p"."money_amount" < (SELECT COALESCE(SUM("r"."money_amount"), 0) FROM "token_transactions" AS "r" WHERE "r"."type" = 'Refund' AND "r"."reversed_transaction_id" = "p"."id")`).Scan(&overRefunded).Error
+	require.NoError(s.T(), err)
+	assert.Zero(s.T(), overRefunded)
+
+	// Running again refunds nothing more.
+	assert.Equal(s.T(), want, runRefunds())
+
+	var refunds int
+	err = s.db.Raw(`SELECT COUNT(*) FROM "token_transactions" WHERE "type" = 'Refund'`).Scan(&refunds).Error
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 3, refunds)
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, refundsPath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	var report domain.RefundRunReport
+	err = json.Unmarshal(resp.Body.Bytes(), &report)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), want, report)
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/ledger/audit", kermesseID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	var audit struct {
+		Balanced bool `json:"balanced"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &audit)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), audit.Balanced)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_DeclinedKermesseRefunds() {
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	// The card of the newest purchase can no longer be refunded.
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+	resp = s.purchaseTokens(payment.FakePaymentMethodRefundDecline, 5)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(organizerUserID, http.MethodPost, fmt.Sprintf("/api/v1/kermesses/%d/close", kermesseID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	refundsPath := fmt.Sprintf("/api/v1/kermesses/%d/refunds", kermesseID)
+	runRefunds := func() domain.RefundRunReport {
+		resp := s.sendAs(organizerUserID, http.MethodPost, refundsPath, nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code)
+
+		var report domain.RefundRunReport
+		err := json.Unmarshal(resp.Body.Bytes(), &report)
+		require.NoError(s.T(), err)
+
+		return report
+	}
+
+	report := runRefunds()
+	require.Len(s.T(), report.DeclinedRefunds, 1)
+
+	// The declined refund is left for the organizers to pay back by hand, its
+	// tokens set aside rather than refunded against the other purchase.
+	want := domain.RefundRunReport{
+		KermesseID: kermesseID,
+		Currency:   "usd",
+		Parents: []domain.ParentRefunds{
+			{ParentID: parentUserID, RefundedTokens: 10, RefundedAmount: 1000, DeclinedTokens: 5, DeclinedAmount: 500},
+		},
+		RefundedTokens:  10,
+		RefundedAmount:  1000,
+		PendingRefunds:  []uint{},
+		DeclinedRefunds: report.DeclinedRefunds,
+		DeclinedAmount:  500,
+	}
+	assert.Equal(s.T(), want, report)
+	assert.Equal(s.T(), 0, s.parentTokens())
+
+	var declined struct {
+		Status          string
+		RejectionReason string
+	}
+	err := s.db.Raw(`SELECT "status", "rejection_reason" FROM "token_transactions" WHERE "id" = ?`, report.DeclinedRefunds[0]).Scan(&declined).Error
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "Failed", declined.Status)
+	assert.Equal(s.T(), "expired_or_canceled_card", declined.RejectionReason)
+
+	// Running again doesn't retry it.
+	assert.Equal(s.T(), want, runRefunds())
+
+	var refunds int
+	err = s.db.Raw(`SELECT COUNT(*) FROM "token_transactions" WHERE "type" = 'Refund'`).Scan(&refunds).Error
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, refunds)
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, fmt.Sprintf("/api/v1/kermesses/%d/ledger/audit", kermesseID), nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	var audit struct {
+		Balanced bool `json:"balanced"`
+	}
+	err = json.Unmarshal(resp.Body.Bytes(), &audit)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), audit.Balanced)
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_TransactionHistory() {
+	const (
+		studentUserID     = 202
+		otherParentUserID = 204
+	)
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	// Another family's purchase, that only organizers see.
+	err = s.db.Exec(`INSERT INTO "token_transactions" ("kermesse_id", "from_id", "from_type", "to_id", "to_type", "amount", "type", "status", "created_at", "updated_at") VALUES (?, ?, 'parent', ?, 'kermess', 7, 'Purchase', 'Pending', NOW(), NOW())`, kermesseID, otherParentUserID, kermesseID).Error
+	require.NoError(s.T(), err)
+
+	for _, amount := range []int{10, 5, 3} {
+		resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, amount)
+		require.Equal(s.T(), http.StatusCreated, resp.Code)
+	}
+
+	resp := s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      4,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	getPage := func(userID uint, path string) domain.TransactionPage {
+		s.T().Helper()
+
+		resp := s.sendAs(userID, http.MethodGet, path, nil)
+		require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+
+		var page domain.TransactionPage
+		err := json.Unmarshal(resp.Body.Bytes(), &page)
+		require.NoError(s.T(), err)
+
+		return page
+	}
+	amounts := func(page domain.TransactionPage) []int {
+		var amounts []int
+		for _, transaction := range page.Transactions {
+			amounts = append(amounts, transaction.Amount)
+		}
+		return amounts
+	}
+
+	// Pages chain through their cursor, newest first.
+	page := getPage(parentUserID, "/api/v1/me/transactions?limit=3")
+	assert.Equal(s.T(), []int{4, 3, 5}, amounts(page))
+	require.NotEmpty(s.T(), page.NextCursor)
+
+	page = getPage(parentUserID, "/api/v1/me/transactions?limit=3&cursor="+page.NextCursor)
+	assert.Equal(s.T(), []int{10}, amounts(page))
+	assert.Empty(s.T(), page.NextCursor)
+
+	page = getPage(parentUserID, "/api/v1/me/transactions?order=asc&type=Purchase,Spend")
+	assert.Equal(s.T(), []int{10, 5, 3}, amounts(page))
+
+	page = getPage(parentUserID, "/api/v1/me/transactions?type=Distribution&status=Completed")
+	assert.Equal(s.T(), []int{4}, amounts(page))
+
+	page = getPage(parentUserID, "/api/v1/me/transactions?from="+url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)))
+	assert.Empty(s.T(), page.Transactions)
+
+	// Children only see their own transactions.
+	page = getPage(studentUserID, "/api/v1/me/transactions")
+	assert.Equal(s.T(), []int{4}, amounts(page))
+
+	// Organizers see every transaction of the kermesse, parents only theirs.
+	page = getPage(organizerUserID, fmt.Sprintf("/api/v1/kermesses/%d/transactions", kermesseID))
+	assert.Equal(s.T(), []int{4, 3, 5, 10, 7}, amounts(page))
+
+	page = getPage(parentUserID, fmt.Sprintf("/api/v1/kermesses/%d/transactions", kermesseID))
+	assert.Equal(s.T(), []int{4, 3, 5, 10}, amounts(page))
+
+	resp = s.sendAs(organizerUserID, http.MethodGet, "/api/v1/kermesses/999/transactions", nil)
+	assert.Equal(s.T(), http.StatusNotFound, resp.Code)
+
+	for _, query := range []string{"type=Gift", "order=up", "limit=1000", "from=yesterday", "cursor=nope"} {
+		resp = s.sendAs(parentUserID, http.MethodGet, "/api/v1/me/transactions?"+query, nil)
+		assert.Equal(s.T(), http.StatusBadRequest, resp.Code, query)
+	}
+}
+
+func (s *KermesseHandlerTestSuite) TestKermesseHandler_HandleGetFamilyStatement() {
+	const studentUserID = 202
+
+	defer func() {
+		s.TearDownTest()
+		s.SetupTest()
+	}()
+
+	err := s.db.Exec(`INSERT INTO "users" ("id", "email", "password", "name", "role", "created_at", "updated_at") VALUES (?, 'student@test.com', 'password', 'Student', 'student', NOW(), NOW())`, studentUserID).Error
+	require.NoError(s.T(), err)
+
+	err = s.db.Exec(`INSERT INTO "students" ("user_id", "parent_id") VALUES (?, ?)`, studentUserID, parentUserID).Error
+	require.NoError(s.T(), err)
+
+	resp := s.purchaseTokens(payment.FakePaymentMethodSucceed, 10)
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	resp = s.sendAs(parentUserID, http.MethodPost, "/api/v1/token/transferToChild", map[string]any{
+		"kermesse_id": kermesseID,
+		"student_id":  studentUserID,
+		"amount":      4,
+	})
+	require.Equal(s.T(), http.StatusCreated, resp.Code)
+
+	statementPath := fmt.Sprintf("/api/v1/kermesses/%d/statement", kermesseID)
+
+	resp = s.sendAs(parentUserID, http.MethodGet, statementPath, nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+	assert.Equal(s.T(), "text/csv; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Contains(s.T(), resp.Header().Get("Content-Disposition"), "statement-kermesse-300.csv")
+	assert.Contains(s.T(), resp.Body.String(), ",Parent,,,,10,10.00,USD,Completed,")
+	assert.Contains(s.T(), resp.Body.String(), ",Student,,,,4,,,,")
+	assert.Contains(s.T(), resp.Body.String(), "balance,,Parent,,,,6,,,,\n")
+	assert.Contains(s.T(), resp.Body.String(), "balance,,Student,,,,4,,,,\n")
+
+	resp = s.sendAs(parentUserID, http.MethodGet, statementPath+"?format=pdf", nil)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+	assert.Equal(s.T(), "application/pdf", resp.Header().Get("Content-Type"))
+	assert.True(s.T(), bytes.HasPrefix(resp.Body.Bytes(), []byte("%PDF-")))
+
+	resp = s.sendAs(parentUserID, http.MethodGet, statementPath+"?format=xls", nil)
+	assert.Equal(s.T(), http.StatusBadRequest, resp.Code)
+
+	resp = s.sendAs(studentUserID, http.MethodGet, statementPath, nil)
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code)
+}
@@ -1,9 +1,43 @@
 DO $$
+    DECLARE
+        table_name text;
     BEGIN
-        -- Check if the table exists
-        IF EXISTS (SELECT FROM pg_catalog.pg_tables
-                   WHERE schemaname = 'public' AND tablename  = 'users') THEN
-            -- If the table exists, delete all rows from it
-            EXECUTE 'DELETE FROM public.users';
-        END IF;
+        FOREACH table_name IN ARRAY ARRAY[
+            'notifications',
+            'stock_movements',
+            'stock_reservations',
+            'promotion_items',
+            'promotions',
+            'offline_vouchers',
+            'offline_allowances',
+            'stand_payment_requests',
+            'order_lines',
+            'orders',
+            'idempotency_keys',
+            'payment_events',
+            'ledger_entries',
+            'ledger_accounts',
+            'token_transactions',
+            'chat_messages',
+            'kermesse_participants',
+            'organizer_kermesses',
+            'stand_invitations',
+            'stand_staffs',
+            'stand_holders',
+            'token_packs',
+            'stocks',
+            'stands',
+            'kermesses',
+            'students',
+            'parents',
+            'organizers',
+            'users'
+        ] LOOP
+            -- Check if the table exists
+            IF EXISTS (SELECT FROM pg_catalog.pg_tables
+                       WHERE schemaname = 'public' AND tablename = table_name) THEN
+                -- If the table exists, delete all rows from it
+                EXECUTE format('DELETE FROM public.%I', table_name);
+            END IF;
+        END LOOP;
     END$$;
@@ -0,0 +1,28 @@
+package mail
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// LogMailer writes emails to the log instead of sending them, for local runs
+// and tests.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(_ context.Context, email domain.Email) error {
+	zap.L().Info(
+		"email not sent, mail provider is log",
+		zap.String("to", email.To),
+		zap.String("subject", email.Subject),
+		zap.String("body", email.Body),
+	)
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/config"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// SMTPMailer sends emails through an SMTP server, authenticating when a
+// username is configured.
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(conf *config.MailConfig) *SMTPMailer {
+	mailer := &SMTPMailer{
+		addr: net.JoinHostPort(conf.Host, conf.Port),
+		from: conf.From,
+	}
+	if conf.Username != "" {
+		mailer.auth = smtp.PlainAuth("", conf.Username, conf.Password, conf.Host)
+	}
+
+	return mailer
+}
+
+func (m *SMTPMailer) Send(_ context.Context, email domain.Email) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{email.To}, m.message(email)); err != nil {
+		return fmt.Errorf("smtp.SendMail -> %w", err)
+	}
+
+	return nil
+}
+
+// message renders email as an RFC 5322 message.
+func (m *SMTPMailer) message(email domain.Email) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", email.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(email.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
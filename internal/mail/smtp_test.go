@@ -0,0 +1,31 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/config"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+func TestSMTPMailer_message(t *testing.T) {
+	mailer := NewSMTPMailer(&config.MailConfig{Host: "localhost", Port: "25", From: "kermesse@test.com"})
+	assert.Equal(t, "localhost:25", mailer.addr)
+	assert.Nil(t, mailer.auth)
+
+	got := mailer.message(domain.Email{
+		To:      "holder@test.com",
+		Subject: "Join the Crêpes stand",
+		Body:    "Hello,\nYour code is ABCD2345.",
+	})
+
+	want := "From: kermesse@test.com\r\n" +
+		"To: holder@test.com\r\n" +
+		"Subject: =?utf-8?q?Join_the_Cr=C3=AApes_stand?=\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Hello,\r\nYour code is ABCD2345."
+	assert.Equal(t, want, string(got))
+}
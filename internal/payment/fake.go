@@ -0,0 +1,165 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// Payment method IDs understood by FakeProvider out of the box.
+const (
+	FakePaymentMethodSucceed        = "pm_fake_success"
+	FakePaymentMethodDecline        = "pm_fake_decline"
+	FakePaymentMethodRequiresAction = "pm_fake_requires_action"
+	// FakePaymentMethodRefundDecline pays, but refunds of its payments are
+	// declined, as for a card closed since.
+	FakePaymentMethodRefundDecline = "pm_fake_refund_decline"
+)
+
+// FakeProvider is a deterministic in-process PaymentProvider for local runs and
+// tests. The outcome of a charge is picked from its payment method ID, and
+// other IDs can be scripted with Script. Unknown payment methods are declined.
+type FakeProvider struct {
+	mu       sync.Mutex
+	outcomes map[string]domain.PaymentStatus
+	charges  []domain.PaymentRequest
+	refunds  map[string]domain.PaymentRefund // By idempotency key.
+	refunded []domain.RefundRequest
+	canceled []string
+	// unrefundable are the IDs of the payments whose refunds are declined.
+	unrefundable map[string]bool
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		outcomes: map[string]domain.PaymentStatus{
+			FakePaymentMethodSucceed:        domain.PaymentSucceeded,
+			FakePaymentMethodDecline:        domain.PaymentFailed,
+			FakePaymentMethodRequiresAction: domain.PaymentRequiresAction,
+			FakePaymentMethodRefundDecline:  domain.PaymentSucceeded,
+		},
+		refunds:      map[string]domain.PaymentRefund{},
+		unrefundable: map[string]bool{},
+	}
+}
+
+// Script makes every later charge with paymentMethodID end with status.
+func (p *FakeProvider) Script(paymentMethodID string, status domain.PaymentStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.outcomes[paymentMethodID] = status
+}
+
+// Charges returns the requests received so far, in order.
+func (p *FakeProvider) Charges() []domain.PaymentRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]domain.PaymentRequest(nil), p.charges...)
+}
+
+func (p *FakeProvider) Charge(_ context.Context, req domain.PaymentRequest) (domain.Payment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.charges = append(p.charges, req)
+	id := fmt.Sprintf("pi_fake_%d", len(p.charges))
+
+	status, ok := p.outcomes[req.PaymentMethodID]
+	if !ok {
+		status = domain.PaymentFailed
+	}
+
+	payment := domain.Payment{
+		ID:       id,
+		Status:   status,
+		Amount:   req.Amount,
+		Currency: req.Currency,
+	}
+
+	if req.PaymentMethodID == FakePaymentMethodRefundDecline {
+		p.unrefundable[id] = true
+	}
+
+	switch status {
+	case domain.PaymentFailed:
+		payment.FailureReason = "Your card was declined."
+	case domain.PaymentRequiresAction:
+		payment.ClientSecret = id + "_secret"
+	}
+
+	return payment, nil
+}
+
+// Refunds returns the refunds issued so far, in order. Replays of an
+// idempotency key are not repeated.
+func (p *FakeProvider) Refunds() []domain.RefundRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]domain.RefundRequest(nil), p.refunded...)
+}
+
+// Refund succeeds, unless the payment was made with
+// FakePaymentMethodRefundDecline, and answers a known idempotency key with the
+// refund it created first, like Stripe does.
+func (p *FakeProvider) Refund(_ context.Context, req domain.RefundRequest) (domain.PaymentRefund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if refund, ok := p.refunds[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		return refund, nil
+	}
+
+	p.refunded = append(p.refunded, req)
+	refund := domain.PaymentRefund{
+		ID:     fmt.Sprintf("re_fake_%d", len(p.refunded)),
+		Status: domain.PaymentSucceeded,
+		Amount: req.Amount,
+	}
+	if p.unrefundable[req.PaymentID] {
+		refund.Status = domain.PaymentFailed
+		refund.FailureReason = "expired_or_canceled_card"
+	}
+	if req.IdempotencyKey != "" {
+		p.refunds[req.IdempotencyKey] = refund
+	}
+
+	return refund, nil
+}
+
+// Canceled returns the IDs of the payments canceled so far, in order.
+func (p *FakeProvider) Canceled() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.canceled...)
+}
+
+// Cancel always succeeds.
+func (p *FakeProvider) Cancel(_ context.Context, paymentID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.canceled = append(p.canceled, paymentID)
+
+	return nil
+}
+
+// ParseEvent reads a domain.PaymentEvent encoded as JSON. Signatures are not
+// checked, which lets tests and local runs post events by hand.
+func (p *FakeProvider) ParseEvent(payload []byte, _ string) (domain.PaymentEvent, error) {
+	var event domain.PaymentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return domain.PaymentEvent{}, fmt.Errorf("%w: %w", domain.ErrInvalidPaymentEvent, err)
+	}
+	if event.ID == "" {
+		return domain.PaymentEvent{}, fmt.Errorf("%w: missing event ID", domain.ErrInvalidPaymentEvent)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,187 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/paymentintent"
+	"github.com/stripe/stripe-go/v72/refund"
+	"github.com/stripe/stripe-go/v72/webhook"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/config"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// StripeProvider charges cards through Stripe PaymentIntents. Unlike the
+// package-level Stripe functions, it does not touch the global stripe.Key.
+type StripeProvider struct {
+	paymentIntents paymentintent.Client
+	refunds        refund.Client
+	webhookSecret  string
+}
+
+func NewStripeProvider(conf *config.StripeConfig) *StripeProvider {
+	var secretKey, webhookSecret string
+	if conf != nil {
+		secretKey = conf.SecretKey
+		webhookSecret = conf.WebhookSecret
+	}
+
+	return &StripeProvider{
+		paymentIntents: paymentintent.Client{
+			B:   stripe.GetBackend(stripe.APIBackend),
+			Key: secretKey,
+		},
+		refunds: refund.Client{
+			B:   stripe.GetBackend(stripe.APIBackend),
+			Key: secretKey,
+		},
+		webhookSecret: webhookSecret,
+	}
+}
+
+func (p *StripeProvider) Charge(ctx context.Context, req domain.PaymentRequest) (domain.Payment, error) {
+	params := &stripe.PaymentIntentParams{
+		Amount:             stripe.Int64(req.Amount),
+		Currency:           stripe.String(req.Currency),
+		PaymentMethod:      stripe.String(req.PaymentMethodID),
+		Description:        stripe.String(req.Description),
+		ConfirmationMethod: stripe.String(string(stripe.PaymentIntentConfirmationMethodAutomatic)),
+		Confirm:            stripe.Bool(true),
+	}
+	params.Context = ctx
+
+	pi, err := p.paymentIntents.New(params)
+	if err != nil {
+		// Card declines come back as errors, but they are an outcome of the
+		// payment rather than a failure to talk to Stripe.
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.Type == stripe.ErrorTypeCard {
+			payment := domain.Payment{
+				Status:        domain.PaymentFailed,
+				Amount:        req.Amount,
+				Currency:      req.Currency,
+				FailureReason: stripeErr.Msg,
+			}
+			if stripeErr.PaymentIntent != nil {
+				payment.ID = stripeErr.PaymentIntent.ID
+			}
+
+			return payment, nil
+		}
+
+		return domain.Payment{}, fmt.Errorf("failed to create payment intent: %w", err)
+	}
+
+	return paymentIntentToDomain(pi), nil
+}
+
+// Refund refunds part of a PaymentIntent. Stripe replays the original response
+// for a known idempotency key, so a refund retried after a crash is only
+// issued once.
+func (p *StripeProvider) Refund(ctx context.Context, req domain.RefundRequest) (domain.PaymentRefund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(req.PaymentID),
+		Amount:        stripe.Int64(req.Amount),
+	}
+	params.Context = ctx
+	if req.IdempotencyKey != "" {
+		params.SetIdempotencyKey(req.IdempotencyKey)
+	}
+
+	re, err := p.refunds.New(params)
+	if err != nil {
+		return domain.PaymentRefund{}, fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	paymentRefund := domain.PaymentRefund{
+		ID:     re.ID,
+		Amount: re.Amount,
+	}
+
+	switch re.Status {
+	case stripe.RefundStatusSucceeded:
+		paymentRefund.Status = domain.PaymentSucceeded
+	case stripe.RefundStatusPending:
+		paymentRefund.Status = domain.PaymentProcessing
+	default:
+		paymentRefund.Status = domain.PaymentFailed
+		paymentRefund.FailureReason = fmt.Sprintf("refund status %s", re.Status)
+		if re.FailureReason != "" {
+			paymentRefund.FailureReason = string(re.FailureReason)
+		}
+	}
+
+	return paymentRefund, nil
+}
+
+// Cancel cancels a PaymentIntent that has not succeeded yet.
+func (p *StripeProvider) Cancel(ctx context.Context, paymentID string) error {
+	params := &stripe.PaymentIntentCancelParams{}
+	params.Context = ctx
+
+	if _, err := p.paymentIntents.Cancel(paymentID, params); err != nil {
+		return fmt.Errorf("failed to cancel payment intent: %w", err)
+	}
+
+	return nil
+}
+
+// ParseEvent verifies the Stripe-Signature header of a webhook payload and
+// converts the event. Only payment_intent.succeeded and
+// payment_intent.payment_failed carry a status.
+func (p *StripeProvider) ParseEvent(payload []byte, signature string) (domain.PaymentEvent, error) {
+	event, err := webhook.ConstructEvent(payload, signature, p.webhookSecret)
+	if err != nil {
+		return domain.PaymentEvent{}, fmt.Errorf("%w: %w", domain.ErrInvalidPaymentEvent, err)
+	}
+
+	paymentEvent := domain.PaymentEvent{
+		ID:   event.ID,
+		Type: event.Type,
+	}
+
+	switch event.Type {
+	case "payment_intent.succeeded", "payment_intent.payment_failed":
+		var pi stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+			return domain.PaymentEvent{}, fmt.Errorf("%w: %w", domain.ErrInvalidPaymentEvent, err)
+		}
+
+		payment := paymentIntentToDomain(&pi)
+		paymentEvent.PaymentID = payment.ID
+		paymentEvent.Status = payment.Status
+		paymentEvent.FailureReason = payment.FailureReason
+	}
+
+	return paymentEvent, nil
+}
+
+func paymentIntentToDomain(pi *stripe.PaymentIntent) domain.Payment {
+	payment := domain.Payment{
+		ID:           pi.ID,
+		Amount:       pi.Amount,
+		Currency:     string(pi.Currency),
+		ClientSecret: pi.ClientSecret,
+	}
+
+	switch pi.Status {
+	case stripe.PaymentIntentStatusSucceeded:
+		payment.Status = domain.PaymentSucceeded
+	case stripe.PaymentIntentStatusRequiresAction:
+		payment.Status = domain.PaymentRequiresAction
+	case stripe.PaymentIntentStatusProcessing:
+		payment.Status = domain.PaymentProcessing
+	default:
+		payment.Status = domain.PaymentFailed
+		payment.FailureReason = fmt.Sprintf("payment intent status %s", pi.Status)
+		if pi.LastPaymentError != nil {
+			payment.FailureReason = pi.LastPaymentError.Msg
+		}
+	}
+
+	return payment
+}
@@ -0,0 +1,118 @@
+package payment
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v72/webhook"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/config"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+const testWebhookSecret = "whsec_test_secret"
+
+// signPayload builds a Stripe-Signature header the way Stripe does.
+func signPayload(payload []byte, secret string, at time.Time) string {
+	signature := webhook.ComputeSignature(at, payload, secret)
+
+	return fmt.Sprintf("t=%d,v1=%s", at.Unix(), hex.EncodeToString(signature))
+}
+
+func TestStripeProvider_ParseEvent(t *testing.T) {
+	provider := NewStripeProvider(&config.StripeConfig{
+		SecretKey:     "sk_test_key",
+		WebhookSecret: testWebhookSecret,
+	})
+
+	tests := []struct {
+		name      string
+		fixture   string
+		sign      func(payload []byte) string
+		want      domain.PaymentEvent
+		wantErrIs error
+	}{
+		{
+			name:    "payment_intent.succeeded",
+			fixture: "testdata/payment_intent_succeeded.json",
+			sign: func(payload []byte) string {
+				return signPayload(payload, testWebhookSecret, time.Now())
+			},
+			want: domain.PaymentEvent{
+				ID:        "evt_1PqSucceeded",
+				Type:      "payment_intent.succeeded",
+				PaymentID: "pi_3PqSucceeded",
+				Status:    domain.PaymentSucceeded,
+			},
+		},
+		{
+			name:    "payment_intent.payment_failed",
+			fixture: "testdata/payment_intent_payment_failed.json",
+			sign: func(payload []byte) string {
+				return signPayload(payload, testWebhookSecret, time.Now())
+			},
+			want: domain.PaymentEvent{
+				ID:            "evt_1PqFailed",
+				Type:          "payment_intent.payment_failed",
+				PaymentID:     "pi_3PqFailed",
+				Status:        domain.PaymentFailed,
+				FailureReason: "Your card was declined.",
+			},
+		},
+		{
+			name:    "Other event types carry no status",
+			fixture: "testdata/charge_refunded.json",
+			sign: func(payload []byte) string {
+				return signPayload(payload, testWebhookSecret, time.Now())
+			},
+			want: domain.PaymentEvent{
+				ID:   "evt_1PqRefunded",
+				Type: "charge.refunded",
+			},
+		},
+		{
+			name:    "Signed with another secret",
+			fixture: "testdata/payment_intent_succeeded.json",
+			sign: func(payload []byte) string {
+				return signPayload(payload, "whsec_other_secret", time.Now())
+			},
+			wantErrIs: domain.ErrInvalidPaymentEvent,
+		},
+		{
+			name:    "Signature too old",
+			fixture: "testdata/payment_intent_succeeded.json",
+			sign: func(payload []byte) string {
+				return signPayload(payload, testWebhookSecret, time.Now().Add(-time.Hour))
+			},
+			wantErrIs: domain.ErrInvalidPaymentEvent,
+		},
+		{
+			name:    "Missing signature",
+			fixture: "testdata/payment_intent_succeeded.json",
+			sign: func(payload []byte) string {
+				return ""
+			},
+			wantErrIs: domain.ErrInvalidPaymentEvent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := os.ReadFile(tt.fixture)
+			require.NoError(t, err)
+
+			got, err := provider.ParseEvent(payload, tt.sign(payload))
+			if tt.wantErrIs != nil {
+				assert.ErrorIs(t, err, tt.wantErrIs)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
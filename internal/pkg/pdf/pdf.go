@@ -0,0 +1,192 @@
+// Package pdf writes simple text documents as PDF: titles, paragraphs and
+// table rows on A4 pages, in the Helvetica fonts every PDF reader ships with.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	pageWidth  = 595.0 // A4, in points.
+	pageHeight = 842.0
+	margin     = 50.0
+
+	// ContentWidth is the width available between the margins.
+	ContentWidth = pageWidth - 2*margin
+
+	fontSize   = 10.0
+	titleSize  = 16.0
+	lineHeight = 14.0
+	// charWidth approximates the average Helvetica glyph width, in ems, to
+	// keep table cells within their column.
+	charWidth = 0.52
+)
+
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+type Document struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func New() *Document {
+	d := &Document{}
+	d.newPage()
+
+	return d
+}
+
+// Title writes a line in large bold type.
+func (d *Document) Title(text string) {
+	d.ensureSpace(titleSize + lineHeight)
+	d.y -= titleSize
+	d.text(fontBold, titleSize, margin, d.y, text)
+	d.y -= lineHeight / 2
+}
+
+// Heading writes a bold line, preceded by some space.
+func (d *Document) Heading(text string) {
+	d.Space()
+	d.ensureSpace(2 * lineHeight)
+	d.y -= lineHeight
+	d.text(fontBold, fontSize+1, margin, d.y, text)
+}
+
+// Text writes a line of regular text.
+func (d *Document) Text(text string) {
+	d.ensureSpace(lineHeight)
+	d.y -= lineHeight
+	d.text(fontRegular, fontSize, margin, d.y, text)
+}
+
+// Row writes cells side by side, each in a column of the given width.
+// Cells too long for their column are shortened.
+func (d *Document) Row(widths []float64, bold bool, cells ...string) {
+	font := fontRegular
+	if bold {
+		font = fontBold
+	}
+
+	d.ensureSpace(lineHeight)
+	d.y -= lineHeight
+	x := margin
+	for i, cell := range cells {
+		if i >= len(widths) {
+			break
+		}
+		d.text(font, fontSize, x, d.y, fit(cell, widths[i]))
+		x += widths[i]
+	}
+}
+
+// Space leaves a blank half line.
+func (d *Document) Space() {
+	d.y -= lineHeight / 2
+}
+
+// WriteTo writes the document as a PDF file.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1 to 4 are the catalog, the page tree and the fonts, then
+	// every page is followed by its content stream.
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.WriteTo(w)
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+func (d *Document) ensureSpace(height float64) {
+	if d.y-height < margin {
+		d.newPage()
+	}
+}
+
+func (d *Document) text(font string, size, x, y float64, text string) {
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %g Tf %g %g Td (%s) Tj ET\n", font, size, x, y, escape(encode(text)))
+}
+
+// fit shortens text to about width points.
+func fit(text string, width float64) string {
+	maxChars := int(width / (fontSize * charWidth))
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	if maxChars <= 3 {
+		return string(runes[:max(maxChars, 0)])
+	}
+
+	return string(runes[:maxChars-3]) + "..."
+}
+
+// encode converts text to WinAnsiEncoding, which the standard fonts use.
+// Characters it lacks become question marks.
+func encode(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '€':
+			encoded = append(encoded, 0x80)
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			encoded = append(encoded, byte(r))
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+
+	return encoded
+}
+
+func escape(text []byte) string {
+	var b strings.Builder
+	for _, c := range text {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n', '\r':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocument_WriteTo(t *testing.T) {
+	doc := New()
+	doc.Title("Statement (draft)")
+	doc.Heading("Purchases")
+	doc.Row([]float64{100, 100}, true, "Date", "Amount")
+	for i := 0; i < 100; i++ {
+		doc.Row([]float64{100, 100}, false, fmt.Sprintf("Line %d", i), "12,50 €")
+	}
+
+	var out bytes.Buffer
+	_, err := doc.WriteTo(&out)
+	require.NoError(t, err)
+	pdf := out.Bytes()
+
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdf), `(Statement \(draft\)) Tj`)
+	assert.Contains(t, string(pdf), "(12,50 \x80) Tj")
+
+	// A hundred rows don't fit on one page.
+	assert.Contains(t, string(pdf), "/Count 2")
+
+	// The cross-reference table points at every object.
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	require.NotNil(t, startxref)
+	xref, err := strconv.Atoi(string(startxref[1]))
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(pdf[xref:], []byte("xref\n")))
+
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf, -1)
+	require.Len(t, offsets, 4+2*2)
+	for i, offset := range offsets {
+		at, err := strconv.Atoi(string(offset[1]))
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(pdf[at:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), "object %d", i+1)
+	}
+}
+
+func TestFit(t *testing.T) {
+	assert.Equal(t, "Crêpes", fit("Crêpes", 100))
+	assert.Equal(t, "Barbe à ...", fit("Barbe à papa géante", 60))
+}
@@ -0,0 +1,179 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" at version 1-M, from the worked example of the standard.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	assert.Equal(t, want, reedSolomonRemainder(data, reedSolomonDivisor(10)))
+}
+
+func TestFormatBits(t *testing.T) {
+	assert.Equal(t, 0b111011111000100, formatBits(Low, 0))
+	assert.Equal(t, 0b101010000010010, formatBits(Medium, 0))
+	assert.Equal(t, 0b110011000101111, formatBits(Low, 4))
+}
+
+func TestNumDataCodewords(t *testing.T) {
+	assert.Equal(t, 19, numDataCodewords(1, Low))
+	assert.Equal(t, 16, numDataCodewords(1, Medium))
+	assert.Equal(t, 62, numDataCodewords(5, Quartile))
+	assert.Equal(t, 216, numDataCodewords(10, Medium))
+	assert.Equal(t, 2956, numDataCodewords(40, Low))
+}
+
+func TestAlignmentPatternPositions(t *testing.T) {
+	assert.Nil(t, alignmentPatternPositions(1))
+	assert.Equal(t, []int{6, 18}, alignmentPatternPositions(2))
+	assert.Equal(t, []int{6, 22, 38}, alignmentPatternPositions(7))
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, alignmentPatternPositions(32))
+}
+
+func TestEncode(t *testing.T) {
+	// Fourteen bytes is all version 1-M holds.
+	code, err := Encode([]byte(strings.Repeat("a", 14)), Medium)
+	require.NoError(t, err)
+	assert.Equal(t, 1, code.Version)
+	assert.Equal(t, 21, code.Size)
+
+	code, err = Encode([]byte(strings.Repeat("a", 15)), Medium)
+	require.NoError(t, err)
+	assert.Equal(t, 2, code.Version)
+
+	// Finder patterns sit in three corners.
+	for _, corner := range [][2]int{{0, 0}, {code.Size - 7, 0}, {0, code.Size - 7}} {
+		x, y := corner[0], corner[1]
+		assert.True(t, code.Dark(x, y))
+		assert.True(t, code.Dark(x+6, y+6))
+		assert.False(t, code.Dark(x+1, y+1))
+		assert.True(t, code.Dark(x+3, y+3))
+	}
+
+	// The two copies of the format information agree.
+	var first, second int
+	for i := 0; i <= 5; i++ {
+		first |= b2i(code.Dark(8, i)) << i
+	}
+	first |= b2i(code.Dark(8, 7))<<6 | b2i(code.Dark(8, 8))<<7 | b2i(code.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		first |= b2i(code.Dark(14-i, 8)) << i
+	}
+	for i := 0; i < 8; i++ {
+		second |= b2i(code.Dark(code.Size-1-i, 8)) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= b2i(code.Dark(8, code.Size-15+i)) << i
+	}
+	assert.Equal(t, first, second)
+
+	found := false
+	for mask := 0; mask < 8; mask++ {
+		found = found || first == formatBits(Medium, mask)
+	}
+	assert.True(t, found, "format bits %015b", first)
+
+	_, err = Encode(make([]byte, 3000), Low)
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+// The reference matrices in testdata were made with Kazuhiko Arase's QRCode
+// for JavaScript, one for each of the eight masks, rows top to bottom with
+// '#' for dark modules.
+func TestEncode_ReferenceMatrices(t *testing.T) {
+	payload := strings.Repeat("kermesse token payment 0123456789 ", 4)
+
+	tests := []struct {
+		file    string
+		data    string
+		level   Level
+		version int
+	}{
+		{file: "v1-L.txt", data: "HELLO WORLD", level: Low, version: 1},
+		{file: "v1-H.txt", data: "token", level: High, version: 1},
+		{file: "v2-M.txt", data: "https://example.com", level: Medium, version: 2},
+		{file: "v5-Q.txt", data: payload[:60], level: Quartile, version: 5},
+		{file: "v7-M.txt", data: payload[:112], level: Medium, version: 7},
+		{file: "v10-H.txt", data: payload[:119], level: High, version: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			require.NoError(t, err)
+			references := strings.Split(strings.TrimSpace(string(raw)), "\n\n")
+			require.Len(t, references, 8)
+
+			for mask, reference := range references {
+				code := newCode(tt.version)
+				code.drawFunctionPatterns()
+				code.drawCodewords(encodeCodewords([]byte(tt.data), tt.version, tt.level))
+				code.applyMask(mask)
+				code.drawFormatBits(tt.level, mask)
+
+				assert.Equal(t, reference, matrix(code), "mask %d", mask)
+			}
+
+			// Encode picks the smallest version and one of the masks.
+			code, err := Encode([]byte(tt.data), tt.level)
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, code.Version)
+			assert.Contains(t, references, matrix(code))
+		})
+	}
+}
+
+func TestCode_WritePNG(t *testing.T) {
+	code, err := Encode([]byte("https://example.com"), Medium)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, code.WritePNG(&out, 4))
+
+	img, err := png.Decode(&out)
+	require.NoError(t, err)
+	width := (code.Size + 2*QuietZone) * 4
+	assert.Equal(t, width, img.Bounds().Dx())
+	assert.Equal(t, width, img.Bounds().Dy())
+
+	// The quiet zone is light and the top left finder dark.
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+	r, _, _, _ = img.At(QuietZone*4, QuietZone*4).RGBA()
+	assert.Zero(t, r)
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func matrix(code *Code) string {
+	rows := make([]string, code.Size)
+	for y := range rows {
+		var row strings.Builder
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		rows[y] = row.String()
+	}
+
+	return strings.Join(rows, "\n")
+}
@@ -0,0 +1,100 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TransactionParty struct {
+	Type string
+	IDs  []uint
+}
+
+// TransactionQuery selects token transactions. KermesseIDs and Parties limit
+// what the caller may see; the other fields are filters.
+type TransactionQuery struct {
+	KermesseIDs []uint
+	Parties     []TransactionParty
+
+	KermesseID uint
+	Types      []string
+	Statuses   []string
+	StandID    uint
+	From       time.Time
+	To         time.Time
+	Ascending  bool
+	Limit      int
+	// AfterCreatedAt and AfterID resume the query past a transaction.
+	AfterCreatedAt time.Time
+	AfterID        uint
+}
+
+// FindTokenTransactions lists transactions ordered by creation time then ID,
+// which keeps keyset pagination stable.
+func (d *KermesseDao) FindTokenTransactions(ctx context.Context, q TransactionQuery) ([]TokenTransaction, error) {
+	db := d.db.WithContext(ctx).Model(&TokenTransaction{}).Where(visibleTransactions(d.db, q))
+
+	if q.KermesseID != 0 {
+		db = db.Where("kermesse_id = ?", q.KermesseID)
+	}
+	if len(q.Types) > 0 {
+		db = db.Where("type IN ?", q.Types)
+	}
+	if len(q.Statuses) > 0 {
+		db = db.Where("status IN ?", q.Statuses)
+	}
+	if q.StandID != 0 {
+		db = db.Where("(stand_id = ? OR (LOWER(to_type) = 'stand' AND to_id = ?) OR (LOWER(from_type) = 'stand' AND from_id = ?))", q.StandID, q.StandID, q.StandID)
+	}
+	if !q.From.IsZero() {
+		db = db.Where("created_at >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		db = db.Where("created_at < ?", q.To)
+	}
+
+	order := "created_at DESC, id DESC"
+	if q.Ascending {
+		order = "created_at, id"
+	}
+	if q.AfterID != 0 {
+		if q.Ascending {
+			db = db.Where("(created_at, id) > (?, ?)", q.AfterCreatedAt, q.AfterID)
+		} else {
+			db = db.Where("(created_at, id) < (?, ?)", q.AfterCreatedAt, q.AfterID)
+		}
+	}
+
+	var transactions []TokenTransaction
+	if err := db.Order(order).Limit(q.Limit).Find(&transactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to find token transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// visibleTransactions builds the condition matching transactions of the
+// query's kermesses, or with one of its parties on either side. Types are
+// compared case-insensitively, as older transactions were recorded with
+// capitalized ones.
+func visibleTransactions(db *gorm.DB, q TransactionQuery) *gorm.DB {
+	scope := db.Session(&gorm.Session{NewDB: true}).Where("1 = 0")
+	if len(q.KermesseIDs) > 0 {
+		scope = scope.Or("kermesse_id IN ?", q.KermesseIDs)
+	}
+	for _, party := range q.Parties {
+		if len(party.IDs) == 0 {
+			continue
+		}
+		partyType := strings.ToLower(party.Type)
+		scope = scope.
+			Or("(LOWER(from_type) = ? AND from_id IN ?)", partyType, party.IDs).
+			Or("(LOWER(to_type) = ? AND to_id IN ?)", partyType, party.IDs)
+	}
+
+	return scope
+}
@@ -0,0 +1,98 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdempotencyKeyExists   = errors.New("idempotency key already exists")
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+)
+
+type IdempotencyKey struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	Key          string `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	RequestHash  string `gorm:"not null"`
+	StatusCode   int
+	ResponseBody []byte
+	CompletedAt  *time.Time
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type IdempotencyDAO struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyDAO(db *gorm.DB) *IdempotencyDAO {
+	return &IdempotencyDAO{
+		db: db,
+	}
+}
+
+func (d *IdempotencyDAO) Insert(ctx context.Context, key IdempotencyKey) (IdempotencyKey, error) {
+	result := d.db.WithContext(ctx).Create(&key)
+	if result.Error != nil {
+		var err *pgconn.PgError
+		if errors.As(result.Error, &err) && err.Code == pgerrcode.UniqueViolation {
+			return IdempotencyKey{}, ErrIdempotencyKeyExists
+		}
+
+		return IdempotencyKey{}, result.Error
+	}
+
+	return key, nil
+}
+
+func (d *IdempotencyDAO) FindByUserAndKey(ctx context.Context, userID uint, key string) (IdempotencyKey, error) {
+	var found IdempotencyKey
+	err := d.db.WithContext(ctx).Where("user_id = ? AND key = ?", userID, key).First(&found).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return IdempotencyKey{}, ErrIdempotencyKeyNotFound
+		}
+		return IdempotencyKey{}, fmt.Errorf("failed to find idempotency key: %w", err)
+	}
+
+	return found, nil
+}
+
+func (d *IdempotencyDAO) Complete(ctx context.Context, id uint, statusCode int, responseBody []byte) error {
+	now := time.Now()
+	err := d.db.WithContext(ctx).Model(&IdempotencyKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status_code":   statusCode,
+		"response_body": responseBody,
+		"completed_at":  &now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (d *IdempotencyDAO) Delete(ctx context.Context, id uint) error {
+	if err := d.db.WithContext(ctx).Delete(&IdempotencyKey{}, id).Error; err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (d *IdempotencyDAO) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := d.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&IdempotencyKey{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
@@ -11,7 +11,7 @@ func InitTables(db *gorm.DB) error {
 	//if err := dropAllTables(db); err != nil {
 	//	return err
 	//}
-	return db.AutoMigrate(
+	err := db.AutoMigrate(
 		&User{},
 		&Student{},
 		&Parent{},
@@ -19,10 +19,48 @@ func InitTables(db *gorm.DB) error {
 		&Organizer{},
 		&Stand{},
 		&Kermesse{},
+		&TokenPack{},
 		&Stock{},
 		&ChatMessage{},
 		&TokenTransaction{},
+		&LedgerAccount{},
+		&LedgerEntry{},
+		&IdempotencyKey{},
+		&PaymentEvent{},
+		&Order{},
+		&OrderLine{},
+		&StandPaymentRequest{},
+		&OfflineAllowance{},
+		&OfflineVoucher{},
+		&Promotion{},
+		&PromotionItem{},
+		&StockReservation{},
+		&StockMovement{},
+		&Notification{},
+		&StandStaff{},
+		&StandInvitation{},
 	)
+	if err != nil {
+		return err
+	}
+
+	if err := migrateKermesseStatuses(db); err != nil {
+		return err
+	}
+
+	if err := migrateStandStaff(db); err != nil {
+		return err
+	}
+
+	if err := migrateStudentCodes(db); err != nil {
+		return err
+	}
+
+	if err := migrateLegacyBalances(db); err != nil {
+		return err
+	}
+
+	return migrateLedgerWallets(db)
 }
 
 func dropAllTables(db *gorm.DB) error {
@@ -21,6 +21,7 @@ var (
 	ErrInvalidUserRole          = errors.New("invalid user role")
 	ErrInvalidTransaction       = errors.New("invalid transaction")
 	ErrStockNotFound            = errors.New("stock not found")
+	ErrStandNotFound            = errors.New("stand not found")
 )
 
 type Stand struct {
@@ -35,6 +36,9 @@ type Stand struct {
 	PointsGiven int      `gorm:"default:0"` // Only for activity stands
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	ArchivedAt  *time.Time `gorm:"index"`
+	OpensAt     *time.Time
+	ClosesAt    *time.Time
 }
 
 type Stock struct {
@@ -42,7 +46,11 @@ type Stock struct {
 	StandID   uint   `gorm:"not null"`
 	ItemName  string `gorm:"not null"`
 	Quantity  int    `gorm:"not null"`
-	TokenCost int    `gorm:"not null"` // Cost in tokens
+	TokenCost int    `gorm:"not null"`           // Cost in tokens
+	Reserved  int    `gorm:"not null;default:0"` // Held by stock reservations
+	// LowStockThreshold is where low-stock alerts go out, 0 for never.
+	LowStockThreshold int `gorm:"not null;default:0"`
+	ArchivedAt        *time.Time
 }
 
 type Kermesse struct {
@@ -55,8 +63,26 @@ type Kermesse struct {
 	Participants []User      `gorm:"many2many:kermesse_participants;"`
 	Stands       []Stand     `gorm:"foreignKey:KermesseID"`
 	TokensSold   int         `gorm:"default:0"`
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	Currency     string      `gorm:"not null;default:'usd'"`
+	TokenPrice   int64       `gorm:"not null;default:100"`
+	TokenPacks   []TokenPack `gorm:"foreignKey:KermesseID"`
+	// Status is one of draft, published, open, closed, cancelled or
+	// archived. Kermesses from before statuses were kept are open.
+	Status    string `gorm:"not null;default:'open'"`
+	ClosedAt  *time.Time
+	Version   int `gorm:"not null;default:1"`
+	StartsAt  *time.Time
+	EndsAt    *time.Time
+	TimeZone  string `gorm:"not null;default:'UTC'"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type TokenPack struct {
+	ID         uint  `gorm:"primaryKey"`
+	KermesseID uint  `gorm:"not null;index"`
+	Tokens     int   `gorm:"not null"`
+	Price      int64 `gorm:"not null"`
 }
 
 type Tombola struct {
@@ -123,7 +149,7 @@ func NewKermesseDao(db *gorm.DB) *KermesseDao {
 
 func (d *KermesseDao) GetByID(id uint) (Kermesse, error) {
 	var kermesse Kermesse
-	err := d.db.First(&kermesse, id).Error
+	err := d.db.Preload("TokenPacks").First(&kermesse, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return Kermesse{}, ErrKermessNotFound
@@ -148,7 +174,7 @@ func (d *KermesseDao) GetStandByID(standID uint) (Stand, error) {
 	result := d.db.Preload("Stock").First(&stand, standID)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return Stand{}, fmt.Errorf("stand with ID %d not found", standID)
+			return Stand{}, fmt.Errorf("stand with ID %d: %w", standID, ErrStandNotFound)
 		}
 		return Stand{}, fmt.Errorf("error fetching stand: %w", result.Error)
 	}
@@ -182,6 +208,7 @@ func (d *KermesseDao) GetAllKermesses() ([]Kermesse, error) {
 		Preload("Participants").
 		Preload("Stands").
 		Preload("Stands.Stock").
+		Preload("TokenPacks").
 		Find(&kermesses).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch kermesses: %w", err)
@@ -191,7 +218,7 @@ func (d *KermesseDao) GetAllKermesses() ([]Kermesse, error) {
 
 func (d *KermesseDao) FindByUserID(user User) ([]Kermesse, error) {
 	var kermesses []Kermesse
-	query := d.db.Model(&Kermesse{})
+	query := d.db.Model(&Kermesse{}).Preload("TokenPacks")
 
 	if user.Role == "organizer" {
 		err := query.
@@ -269,18 +296,6 @@ func (d *KermesseDao) AddParticipant(ctx context.Context, kermesseID, userID uin
 	return nil
 }
 
-func (d *KermesseDao) UpdateTokenBalances(parentUserID, studentUserID uint, amount int) error {
-	return d.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Model(&Parent{}).Where("user_id = ?", parentUserID).Update("tokens", gorm.Expr("tokens - ?", amount)).Error; err != nil {
-			return err
-		}
-		if err := tx.Model(&Student{}).Where("user_id = ?", studentUserID).Update("tokens", gorm.Expr("tokens + ?", amount)).Error; err != nil {
-			return err
-		}
-		return nil
-	})
-}
-
 func (d *KermesseDao) CreateStand(ctx context.Context, stand Stand, stock []Stock, standHolderID uint) (Stand, error) {
 	tx := d.db.WithContext(ctx).Begin()
 	if tx.Error != nil {
@@ -305,22 +320,27 @@ func (d *KermesseDao) CreateStand(ctx context.Context, stand Stand, stock []Stoc
 		}
 	}
 
-	// Update the StandHolder's StandID
-	result := tx.Model(&StandHolder{}).
-		Where("user_id = ?", standHolderID).
-		Update("stand_id", stand.ID)
-
-	if result.Error != nil {
+	if err := journalStock(tx, initialStock(stock, standHolderID), nil); err != nil {
 		tx.Rollback()
-		return Stand{}, result.Error
+		return Stand{}, err
 	}
 
-	if result.RowsAffected == 0 {
-		// If no rows were affected, it means there's no existing StandHolder
+	// The stand holder creating the stand becomes its manager
+	var holders int64
+	if err := tx.Model(&StandHolder{}).Where("user_id = ?", standHolderID).Count(&holders).Error; err != nil {
+		tx.Rollback()
+		return Stand{}, err
+	}
+	if holders == 0 {
 		tx.Rollback()
 		return Stand{}, fmt.Errorf("standHolder not found for user ID: %d", standHolderID)
 	}
 
+	if err := tx.Create(&StandStaff{StandID: stand.ID, UserID: standHolderID, Role: standManager}).Error; err != nil {
+		tx.Rollback()
+		return Stand{}, err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return Stand{}, err
 	}
@@ -360,34 +380,6 @@ func (d *KermesseDao) IsUserKermesseOrganizer(kermesseID uint, userID uint) (boo
 	return count > 0, nil
 }
 
-func (d *KermesseDao) IncrementParentTokens(transactionFromID uint, transactionAmount int) error {
-	var transactionFrom TokenTransaction
-	if err := d.db.First(&transactionFrom, transactionFromID).Error; err != nil {
-		return fmt.Errorf("failed to find transaction: %w", err)
-	}
-
-	var user User
-	if err := d.db.First(&user, transactionFrom.FromID).Error; err != nil {
-		return fmt.Errorf("failed to find user: %w", err)
-	}
-
-	var parent Parent
-	err := d.db.Where("user_id = ?", user.ID).First(&parent).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("parent not found for user ID %d", user.ID)
-		}
-		return fmt.Errorf("failed to find parent: %w", err)
-	}
-
-	parent.Tokens += transactionAmount
-	if err := d.db.Save(&parent).Error; err != nil {
-		return fmt.Errorf("failed to update parent: %w", err)
-	}
-
-	return nil
-}
-
 func (d *KermesseDao) IncrementKermesseTokensSold(kermesseID uint, transactionAmount int) error {
 	var kermesse Kermesse
 	if err := d.db.First(&kermesse, kermesseID).Error; err != nil {
@@ -416,15 +408,17 @@ func (d *KermesseDao) UpdateStand(ctx context.Context, stand Stand) (Stand, erro
 	return stand, nil
 }
 
-func (d *KermesseDao) UpdateStock(ctx context.Context, stock Stock) (Stock, error) {
-	if err := d.db.WithContext(ctx).Save(&stock).Error; err != nil {
-		return Stock{}, err
-	}
-	return stock, nil
-}
+// CreateStock adds stock to a stand, journaling its quantity as a restock
+// by actorID.
+func (d *KermesseDao) CreateStock(ctx context.Context, stockDAO Stock, actorID uint) (Stock, error) {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&stockDAO).Error; err != nil {
+			return err
+		}
 
-func (d *KermesseDao) CreateStock(ctx context.Context, stockDAO Stock) (Stock, error) {
-	if err := d.db.WithContext(ctx).Create(&stockDAO).Error; err != nil {
+		return journalStock(tx, initialStock([]Stock{stockDAO}, actorID), nil)
+	})
+	if err != nil {
 		return Stock{}, err
 	}
 	return stockDAO, nil
@@ -468,17 +462,6 @@ func (d *KermesseDao) GetStandsByKermesseID(kermesseID uint) ([]Stand, error) {
 	return stands, nil
 }
 
-func (d *KermesseDao) IsUserStandHolder(standID, userID uint) (bool, error) {
-	var count int64
-	result := d.db.Model(&StandHolder{}).
-		Where("stand_id = ? AND user_id = ?", standID, userID).
-		Count(&count)
-	if result.Error != nil {
-		return false, fmt.Errorf("failed to check if user is stand holder: %w", result.Error)
-	}
-	return count > 0, nil
-}
-
 func (d *KermesseDao) SaveChatMessage(message ChatMessage) (ChatMessage, error) {
 	result := d.db.Create(&message)
 	if result.Error != nil {
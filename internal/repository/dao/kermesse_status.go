@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrKermesseClosed is returned when the kermesse is closed.
+	ErrKermesseClosed = errors.New("kermesse is closed")
+	// ErrKermesseStatusChanged is returned when the status of a kermesse
+	// changed since it was read.
+	ErrKermesseStatusChanged = errors.New("kermesse status changed")
+	// ErrKermesseVersionConflict is returned when a kermesse was changed
+	// since the version being edited.
+	ErrKermesseVersionConflict = errors.New("kermesse version conflict")
+)
+
+const (
+	kermesseClosed    = "closed"
+	kermesseCancelled = "cancelled"
+)
+
+// SetKermesseStatus moves a kermesse in status from to status to. Closing or
+// cancelling it also stamps when.
+func (d *KermesseDao) SetKermesseStatus(ctx context.Context, kermesseID uint, from, to string) (Kermesse, error) {
+	updates := map[string]interface{}{
+		"status":     to,
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": time.Now(),
+	}
+	if to == kermesseClosed || to == kermesseCancelled {
+		updates["closed_at"] = time.Now()
+	}
+
+	result := d.db.WithContext(ctx).Model(&Kermesse{}).
+		Where("id = ? AND status = ?", kermesseID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return Kermesse{}, fmt.Errorf("failed to update kermesse status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return Kermesse{}, ErrKermesseStatusChanged
+	}
+
+	return d.GetByID(kermesseID)
+}
+
+// UpdateKermesseDetails saves the name, date, location, description and
+// schedule of a kermesse, provided it is still at the version they were read at.
+func (d *KermesseDao) UpdateKermesseDetails(ctx context.Context, kermesse Kermesse) (Kermesse, error) {
+	result := d.db.WithContext(ctx).Model(&Kermesse{}).
+		Where("id = ? AND version = ?", kermesse.ID, kermesse.Version).
+		Updates(map[string]interface{}{
+			"name":        kermesse.Name,
+			"date":        kermesse.Date,
+			"location":    kermesse.Location,
+			"description": kermesse.Description,
+			"starts_at":   kermesse.StartsAt,
+			"ends_at":     kermesse.EndsAt,
+			"time_zone":   kermesse.TimeZone,
+			"version":     gorm.Expr("version + 1"),
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return Kermesse{}, fmt.Errorf("failed to update kermesse: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return Kermesse{}, ErrKermesseVersionConflict
+	}
+
+	return d.GetByID(kermesse.ID)
+}
+
+// migrateKermesseStatuses marks the kermesses closed before statuses were
+// kept as closed.
+func migrateKermesseStatuses(db *gorm.DB) error {
+	return db.Model(&Kermesse{}).
+		Where("closed_at IS NOT NULL AND status = ?", "open").
+		Update("status", kermesseClosed).Error
+}
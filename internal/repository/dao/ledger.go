@@ -0,0 +1,489 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	LedgerDebit  = "debit"
+	LedgerCredit = "credit"
+)
+
+type LedgerAccount struct {
+	ID         uint   `gorm:"primaryKey"`
+	Type       string `gorm:"not null;uniqueIndex:idx_ledger_accounts_wallet"`
+	OwnerID    uint   `gorm:"not null;uniqueIndex:idx_ledger_accounts_wallet"`
+	KermesseID uint   `gorm:"not null;default:0;uniqueIndex:idx_ledger_accounts_wallet"`
+	Balance    int    `gorm:"not null;default:0"` // Cached sum of the account's entries.
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type LedgerEntry struct {
+	ID            uint   `gorm:"primaryKey"`
+	TransactionID uint   `gorm:"not null;index"`
+	AccountID     uint   `gorm:"not null;index"`
+	Direction     string `gorm:"not null"` // "debit" or "credit"
+	Amount        int    `gorm:"not null"`
+	CreatedAt     time.Time
+}
+
+type LedgerAccountKey struct {
+	Type           string
+	OwnerID        uint
+	KermesseID     uint
+	AllowOverdraft bool
+}
+
+type LedgerAccountMismatch struct {
+	AccountID     uint
+	CachedBalance int
+	LedgerBalance int
+}
+
+type LedgerAudit struct {
+	Accounts               int
+	Entries                int
+	UnbalancedTransactions []uint
+	MismatchedTransactions []uint
+	UnpostedTransactions   []uint
+	MismatchedAccounts     []LedgerAccountMismatch
+}
+
+// postedStatuses are the transaction statuses that must have ledger entries.
+var postedStatuses = []string{"Completed", "Validated", "Approved"}
+
+const signedAmountSQL = "CASE WHEN ledger_entries.direction = 'credit' THEN ledger_entries.amount ELSE -ledger_entries.amount END"
+
+func findOrCreateLedgerAccount(tx *gorm.DB, key LedgerAccountKey) (LedgerAccount, error) {
+	account := LedgerAccount{Type: key.Type, OwnerID: key.OwnerID, KermesseID: key.KermesseID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return LedgerAccount{}, fmt.Errorf("failed to create ledger account: %w", err)
+	}
+
+	if err := tx.Where("type = ? AND owner_id = ? AND kermesse_id = ?", key.Type, key.OwnerID, key.KermesseID).First(&account).Error; err != nil {
+		return LedgerAccount{}, fmt.Errorf("failed to find ledger account: %w", err)
+	}
+
+	return account, nil
+}
+
+// postLedgerEntries writes the balanced debit/credit pair of a transaction and
+// moves the cached balances accordingly. It must run inside a DB transaction.
+func postLedgerEntries(tx *gorm.DB, transactionID uint, debit, credit LedgerAccountKey, amount int) error {
+	if amount <= 0 {
+		return ErrInvalidTransaction
+	}
+
+	debitAccount, err := findOrCreateLedgerAccount(tx, debit)
+	if err != nil {
+		return err
+	}
+
+	creditAccount, err := findOrCreateLedgerAccount(tx, credit)
+	if err != nil {
+		return err
+	}
+
+	query := tx.Model(&LedgerAccount{}).Where("id = ?", debitAccount.ID)
+	if !debit.AllowOverdraft {
+		query = query.Where("balance >= ?", amount)
+	}
+	result := query.Updates(map[string]interface{}{
+		"balance":    gorm.Expr("balance - ?", amount),
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to debit ledger account: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientTokens
+	}
+
+	result = tx.Model(&LedgerAccount{}).Where("id = ?", creditAccount.ID).Updates(map[string]interface{}{
+		"balance":    gorm.Expr("balance + ?", amount),
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to credit ledger account: %w", result.Error)
+	}
+
+	entries := []LedgerEntry{
+		{TransactionID: transactionID, AccountID: debitAccount.ID, Direction: LedgerDebit, Amount: amount},
+		{TransactionID: transactionID, AccountID: creditAccount.ID, Direction: LedgerCredit, Amount: amount},
+	}
+	if err := tx.Create(&entries).Error; err != nil {
+		return fmt.Errorf("failed to create ledger entries: %w", err)
+	}
+
+	return nil
+}
+
+func findLedgerBalance(db *gorm.DB, accountType string, ownerID, kermesseID uint) (int, error) {
+	var balances []int
+	err := db.Model(&LedgerAccount{}).
+		Where("type = ? AND owner_id = ? AND kermesse_id = ?", accountType, ownerID, kermesseID).
+		Pluck("balance", &balances).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find ledger balance: %w", err)
+	}
+
+	if len(balances) == 0 {
+		return 0, nil
+	}
+
+	return balances[0], nil
+}
+
+// CreatePostedTokenTransaction stores the transaction and its ledger entries atomically.
+func (d *KermesseDao) CreatePostedTokenTransaction(ctx context.Context, transaction TokenTransaction, debit, credit LedgerAccountKey) (TokenTransaction, error) {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&transaction).Error; err != nil {
+			return err
+		}
+
+		return postLedgerEntries(tx, transaction.ID, debit, credit, transaction.Amount)
+	})
+	if err != nil {
+		return TokenTransaction{}, err
+	}
+
+	return transaction, nil
+}
+
+// PostTokenTransaction saves an existing transaction, typically moving out of
+// "Pending", together with its ledger entries.
+func (d *KermesseDao) PostTokenTransaction(ctx context.Context, transaction TokenTransaction, debit, credit LedgerAccountKey) (TokenTransaction, error) {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var posted int64
+		if err := tx.Model(&LedgerEntry{}).Where("transaction_id = ?", transaction.ID).Count(&posted).Error; err != nil {
+			return err
+		}
+		if posted > 0 {
+			return ErrInvalidTransactionStatus
+		}
+
+		if err := tx.Save(&transaction).Error; err != nil {
+			return err
+		}
+
+		return postLedgerEntries(tx, transaction.ID, debit, credit, transaction.Amount)
+	})
+	if err != nil {
+		return TokenTransaction{}, err
+	}
+
+	return transaction, nil
+}
+
+func (d *KermesseDao) GetLedgerAccount(ctx context.Context, key LedgerAccountKey) (LedgerAccount, error) {
+	var accounts []LedgerAccount
+	err := d.db.WithContext(ctx).
+		Where("type = ? AND owner_id = ? AND kermesse_id = ?", key.Type, key.OwnerID, key.KermesseID).
+		Limit(1).
+		Find(&accounts).Error
+	if err != nil {
+		return LedgerAccount{}, fmt.Errorf("failed to find ledger account: %w", err)
+	}
+
+	if len(accounts) == 0 {
+		return LedgerAccount{Type: key.Type, OwnerID: key.OwnerID, KermesseID: key.KermesseID}, nil
+	}
+
+	return accounts[0], nil
+}
+
+func (d *KermesseDao) GetLedgerEntries(ctx context.Context, transactionID uint) ([]LedgerEntry, error) {
+	var entries []LedgerEntry
+	err := d.db.WithContext(ctx).
+		Where("transaction_id = ?", transactionID).
+		Order("id").
+		Find(&entries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ledger entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// AuditLedger cross-checks the ledger of a kermesse against itself and
+// against the token transactions it is supposed to mirror.
+func (d *KermesseDao) AuditLedger(ctx context.Context, kermesseID uint) (LedgerAudit, error) {
+	db := d.db.WithContext(ctx)
+	var audit LedgerAudit
+
+	var accounts, entries int64
+	if err := db.Model(&LedgerAccount{}).Where("kermesse_id = ?", kermesseID).Count(&accounts).Error; err != nil {
+		return LedgerAudit{}, fmt.Errorf("failed to count ledger accounts: %w", err)
+	}
+	err := db.Model(&LedgerEntry{}).
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = ledger_entries.account_id").
+		Where("ledger_accounts.kermesse_id = ?", kermesseID).
+		Count(&entries).Error
+	if err != nil {
+		return LedgerAudit{}, fmt.Errorf("failed to count ledger entries: %w", err)
+	}
+	audit.Accounts = int(accounts)
+	audit.Entries = int(entries)
+
+	err = db.Model(&LedgerEntry{}).
+		Where("transaction_id IN (?)", db.Model(&TokenTransaction{}).Select("id").Where("kermesse_id = ?", kermesseID)).
+		Group("transaction_id").
+		Having("SUM("+signedAmountSQL+") <> 0").
+		Pluck("transaction_id", &audit.UnbalancedTransactions).Error
+	if err != nil {
+		return LedgerAudit{}, fmt.Errorf("failed to find unbalanced transactions: %w", err)
+	}
+
+	err = db.Model(&TokenTransaction{}).
+		Joins("JOIN ledger_entries ON ledger_entries.transaction_id = token_transactions.id AND ledger_entries.direction = ?", LedgerCredit).
+		Where("token_transactions.kermesse_id = ?", kermesseID).
+		Group("token_transactions.id, token_transactions.amount").
+		Having("SUM(ledger_entries.amount) <> token_transactions.amount").
+		Pluck("token_transactions.id", &audit.MismatchedTransactions).Error
+	if err != nil {
+		return LedgerAudit{}, fmt.Errorf("failed to find mismatched transactions: %w", err)
+	}
+
+	err = db.Model(&TokenTransaction{}).
+		Where("kermesse_id = ? AND status IN ?", kermesseID, postedStatuses).
+		Where("NOT EXISTS (SELECT 1 FROM ledger_entries WHERE ledger_entries.transaction_id = token_transactions.id)").
+		Pluck("id", &audit.UnpostedTransactions).Error
+	if err != nil {
+		return LedgerAudit{}, fmt.Errorf("failed to find unposted transactions: %w", err)
+	}
+
+	err = db.Model(&LedgerAccount{}).
+		Select("ledger_accounts.id AS account_id, ledger_accounts.balance AS cached_balance, COALESCE(SUM("+signedAmountSQL+"), 0) AS ledger_balance").
+		Joins("LEFT JOIN ledger_entries ON ledger_entries.account_id = ledger_accounts.id").
+		Where("ledger_accounts.kermesse_id = ?", kermesseID).
+		Group("ledger_accounts.id, ledger_accounts.balance").
+		Having("ledger_accounts.balance <> COALESCE(SUM(" + signedAmountSQL + "), 0)").
+		Scan(&audit.MismatchedAccounts).Error
+	if err != nil {
+		return LedgerAudit{}, fmt.Errorf("failed to find mismatched accounts: %w", err)
+	}
+
+	return audit, nil
+}
+
+// migrateLegacyBalances moves the balances of the former parents.tokens and
+// students.tokens columns into the ledger as opening balances, then drops the
+// columns so they cannot drift again. Each balance is opened on the kermesse
+// picked by legacyBalanceKermesse.
+func migrateLegacyBalances(db *gorm.DB) error {
+	legacyTables := []struct {
+		model       interface{}
+		table       string
+		accountType string
+	}{
+		{model: &Parent{}, table: "parents", accountType: "parent"},
+		{model: &Student{}, table: "students", accountType: "student"},
+	}
+
+	for _, legacy := range legacyTables {
+		if !db.Migrator().HasColumn(legacy.model, "tokens") {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var balances []struct {
+				UserID uint
+				Tokens int
+			}
+			if err := tx.Table(legacy.table).Select("user_id, tokens").Where("tokens > 0").Scan(&balances).Error; err != nil {
+				return err
+			}
+
+			for _, balance := range balances {
+				kermesseID, err := legacyBalanceKermesse(tx, legacy.accountType, balance.UserID)
+				if err != nil {
+					return err
+				}
+
+				transaction := TokenTransaction{
+					KermesseID: kermesseID,
+					FromType:   "payment_clearing",
+					ToID:       balance.UserID,
+					ToType:     legacy.accountType,
+					Amount:     balance.Tokens,
+					Type:       TokenOpeningBalance,
+					Status:     "Completed",
+				}
+				if err := tx.Create(&transaction).Error; err != nil {
+					return err
+				}
+
+				debit := LedgerAccountKey{Type: "payment_clearing", OwnerID: kermesseID, KermesseID: kermesseID, AllowOverdraft: true}
+				credit := LedgerAccountKey{Type: legacy.accountType, OwnerID: balance.UserID, KermesseID: kermesseID}
+				if err := postLedgerEntries(tx, transaction.ID, debit, credit, balance.Tokens); err != nil {
+					return err
+				}
+			}
+
+			return tx.Migrator().DropColumn(legacy.model, "tokens")
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s balances: %w", legacy.table, err)
+		}
+	}
+
+	return nil
+}
+
+// legacyBalanceKermesse picks the kermesse a balance from before per-kermesse
+// wallets is moved to, since tokens can only be spent in their kermesse: the
+// latest kermesse its owner, or the parent of a student, takes part in, and
+// failing that the latest kermesse. It returns 0 when there is no kermesse at
+// all, leaving the balance where nothing can spend it; this is logged.
+func legacyBalanceKermesse(tx *gorm.DB, accountType string, ownerID uint) (uint, error) {
+	participations := tx.Table("kermesse_participants").Select("kermesse_id").Where("user_id = ?", ownerID)
+	if accountType == "student" {
+		participations = participations.Or("user_id IN (?)", tx.Model(&Student{}).Select("parent_id").Where("user_id = ?", ownerID))
+	}
+
+	var kermesseIDs []uint
+	err := tx.Model(&Kermesse{}).
+		Where("id IN (?)", participations).
+		Order("date DESC, id DESC").
+		Limit(1).
+		Pluck("id", &kermesseIDs).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find the kermesses of %s %d: %w", accountType, ownerID, err)
+	}
+
+	if len(kermesseIDs) == 0 {
+		err := tx.Model(&Kermesse{}).Order("date DESC, id DESC").Limit(1).Pluck("id", &kermesseIDs).Error
+		if err != nil {
+			return 0, fmt.Errorf("failed to find the latest kermesse: %w", err)
+		}
+	}
+
+	if len(kermesseIDs) == 0 {
+		zap.L().Warn("no kermesse to move a legacy token balance to",
+			zap.String("account_type", accountType),
+			zap.Uint("owner_id", ownerID),
+		)
+		return 0, nil
+	}
+
+	return kermesseIDs[0], nil
+}
+
+// migrateLedgerWallets splits the accounts of the former global balances into
+// one account per kermesse. Legacy opening balances, which have no kermesse,
+// are first moved to the kermesse picked by legacyBalanceKermesse. Entries
+// follow the kermesse of their transaction and cached balances are recomputed
+// from the entries.
+//
+// A wallet funded in one kermesse and spent in another under global balances
+// ends up negative in the kermesse it was spent in. The recomputed balances
+// still match the entries, but such wallets are logged so that organizers can
+// settle them.
+func migrateLedgerWallets(db *gorm.DB) error {
+	const legacyIndex = "idx_ledger_accounts_owner"
+	if !db.Migrator().HasIndex(&LedgerAccount{}, legacyIndex) {
+		return nil
+	}
+
+	var negative []LedgerAccount
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The old index allows a single account per owner.
+		if err := tx.Migrator().DropIndex(&LedgerAccount{}, legacyIndex); err != nil {
+			return err
+		}
+
+		// Cash desk and clearing accounts are already owned by their kermesse.
+		err := tx.Model(&LedgerAccount{}).
+			Where("type IN ?", []string{"kermesse", "payment_clearing"}).
+			Update("kermesse_id", gorm.Expr("owner_id")).Error
+		if err != nil {
+			return err
+		}
+
+		var openings []TokenTransaction
+		if err := tx.Where("kermesse_id = 0 AND type = ?", TokenOpeningBalance).Find(&openings).Error; err != nil {
+			return err
+		}
+
+		for _, opening := range openings {
+			kermesseID, err := legacyBalanceKermesse(tx, opening.ToType, opening.ToID)
+			if err != nil {
+				return err
+			}
+			if kermesseID == 0 {
+				continue
+			}
+
+			if err := tx.Model(&TokenTransaction{}).Where("id = ?", opening.ID).Update("kermesse_id", kermesseID).Error; err != nil {
+				return err
+			}
+		}
+
+		// The clearing account the legacy opening balances were funded from
+		// is the only one left without a kermesse besides the wallets.
+		var accounts []LedgerAccount
+		if err := tx.Where("kermesse_id = 0").Find(&accounts).Error; err != nil {
+			return err
+		}
+
+		for _, account := range accounts {
+			var kermesseIDs []uint
+			err := tx.Model(&LedgerEntry{}).
+				Joins("JOIN token_transactions ON token_transactions.id = ledger_entries.transaction_id").
+				Where("ledger_entries.account_id = ? AND token_transactions.kermesse_id <> 0", account.ID).
+				Distinct().
+				Pluck("token_transactions.kermesse_id", &kermesseIDs).Error
+			if err != nil {
+				return err
+			}
+
+			for _, kermesseID := range kermesseIDs {
+				key := LedgerAccountKey{Type: account.Type, OwnerID: account.OwnerID, KermesseID: kermesseID}
+				if account.Type == "kermesse" || account.Type == "payment_clearing" {
+					key.OwnerID = kermesseID
+				}
+
+				wallet, err := findOrCreateLedgerAccount(tx, key)
+				if err != nil {
+					return err
+				}
+
+				err = tx.Model(&LedgerEntry{}).
+					Where("account_id = ? AND transaction_id IN (?)", account.ID, tx.Model(&TokenTransaction{}).Select("id").Where("kermesse_id = ?", kermesseID)).
+					Update("account_id", wallet.ID).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err = tx.Exec("UPDATE ledger_accounts SET balance = COALESCE((SELECT SUM(" + signedAmountSQL + ") FROM ledger_entries WHERE ledger_entries.account_id = ledger_accounts.id), 0)").Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("type NOT IN ? AND balance < 0", []string{"kermesse", "payment_clearing"}).Order("id").Find(&negative).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate ledger wallets: %w", err)
+	}
+
+	for _, account := range negative {
+		zap.L().Warn("ledger wallet migrated with a negative balance",
+			zap.Uint("account_id", account.ID),
+			zap.String("account_type", account.Type),
+			zap.Uint("owner_id", account.OwnerID),
+			zap.Uint("kermesse_id", account.KermesseID),
+			zap.Int("balance", account.Balance),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Notification struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null;index"`
+	KermesseID uint   `gorm:"not null"`
+	StandID    uint   `gorm:"not null"` // 0 for kermesse-wide notifications.
+	Type       string `gorm:"not null"`
+	Message    string `gorm:"not null"`
+	CreatedAt  time.Time
+}
+
+// GetStandAlertRecipients returns the users told about what happens at a
+// stand: its staff and the organizers of its kermesse.
+func (d *KermesseDao) GetStandAlertRecipients(ctx context.Context, kermesseID, standID uint) ([]uint, error) {
+	var userIDs []uint
+	err := d.db.WithContext(ctx).Raw(`
+		SELECT user_id FROM stand_staffs WHERE stand_id = ?
+		UNION
+		SELECT organizer_user_id FROM organizer_kermesses WHERE kermesse_id = ?
+		ORDER BY 1`, standID, kermesseID).
+		Scan(&userIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stand alert recipients: %w", err)
+	}
+
+	return userIDs, nil
+}
+
+// PostStandAlert posts message to the stand chat and stores notifications
+// of it, all or nothing.
+func (d *KermesseDao) PostStandAlert(ctx context.Context, message ChatMessage, notifications []Notification) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return fmt.Errorf("failed to save chat message: %w", err)
+		}
+
+		if len(notifications) == 0 {
+			return nil
+		}
+		if err := tx.Create(&notifications).Error; err != nil {
+			return fmt.Errorf("failed to create notifications: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// GetKermesseAudience returns the users told about changes to a kermesse:
+// its participants and the staff of its stands.
+func (d *KermesseDao) GetKermesseAudience(ctx context.Context, kermesseID uint) ([]uint, error) {
+	var userIDs []uint
+	err := d.db.WithContext(ctx).Raw(`
+		SELECT user_id FROM kermesse_participants WHERE kermesse_id = ?
+		UNION
+		SELECT ss.user_id FROM stand_staffs ss
+		JOIN stands s ON s.id = ss.stand_id
+		WHERE s.kermesse_id = ?
+		ORDER BY 1`, kermesseID, kermesseID).
+		Scan(&userIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find kermesse audience: %w", err)
+	}
+
+	return userIDs, nil
+}
+
+func (d *KermesseDao) CreateNotifications(ctx context.Context, notifications []Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	if err := d.db.WithContext(ctx).Create(&notifications).Error; err != nil {
+		return fmt.Errorf("failed to create notifications: %w", err)
+	}
+
+	return nil
+}
+
+func (d *KermesseDao) GetNotifications(ctx context.Context, userID uint, limit int) ([]Notification, error) {
+	var notifications []Notification
+	err := d.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&notifications).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find notifications: %w", err)
+	}
+
+	return notifications, nil
+}
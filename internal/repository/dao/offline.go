@@ -0,0 +1,135 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrAllowanceNotFound = errors.New("offline allowance not found")
+	// ErrAllowanceExceeded is returned when a voucher would take an
+	// allowance over its limit.
+	ErrAllowanceExceeded = errors.New("offline allowance exceeded")
+	// ErrVoucherRedeemed is returned for vouchers already uploaded.
+	ErrVoucherRedeemed = errors.New("offline voucher already redeemed")
+)
+
+type OfflineAllowance struct {
+	ID         uint      `gorm:"primaryKey"`
+	KermesseID uint      `gorm:"not null;index"`
+	StudentID  uint      `gorm:"not null;index"`
+	Limit      int       `gorm:"column:spending_limit;not null"`
+	Spent      int       `gorm:"not null;default:0"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	CreatedAt  time.Time
+}
+
+// OfflineVoucher is a redeemed voucher. The unique allowance and sequence
+// pair is what rejects double spends.
+type OfflineVoucher struct {
+	ID            uint      `gorm:"primaryKey"`
+	AllowanceID   uint      `gorm:"not null;uniqueIndex:idx_offline_vouchers_allowance_sequence"`
+	Sequence      uint      `gorm:"not null;uniqueIndex:idx_offline_vouchers_allowance_sequence"`
+	StandID       uint      `gorm:"not null;index"`
+	TransactionID uint      `gorm:"not null;uniqueIndex"`
+	Amount        int       `gorm:"not null"`
+	SignedAt      time.Time `gorm:"not null"`
+	CreatedAt     time.Time
+}
+
+func (d *KermesseDao) CreateOfflineAllowance(ctx context.Context, allowance OfflineAllowance) (OfflineAllowance, error) {
+	if err := d.db.WithContext(ctx).Create(&allowance).Error; err != nil {
+		return OfflineAllowance{}, fmt.Errorf("failed to create offline allowance: %w", err)
+	}
+
+	return allowance, nil
+}
+
+func (d *KermesseDao) GetOfflineAllowance(ctx context.Context, id uint) (OfflineAllowance, error) {
+	var allowance OfflineAllowance
+	if err := d.db.WithContext(ctx).First(&allowance, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return OfflineAllowance{}, ErrAllowanceNotFound
+		}
+		return OfflineAllowance{}, fmt.Errorf("failed to find offline allowance: %w", err)
+	}
+
+	return allowance, nil
+}
+
+func (d *KermesseDao) IsOfflineVoucherRedeemed(ctx context.Context, allowanceID, sequence uint) (bool, error) {
+	var count int64
+	err := d.db.WithContext(ctx).Model(&OfflineVoucher{}).
+		Where("allowance_id = ? AND sequence = ?", allowanceID, sequence).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to find offline voucher: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// RedeemOfflineVoucher checks order out for the voucher, without trackStock
+// failing it: the items were handed over while offline, so the stock only
+// goes down as far as zero. The voucher is recorded and counted against its
+// allowance in the same database transaction.
+func (d *KermesseDao) RedeemOfflineVoucher(ctx context.Context, voucher OfflineVoucher, order Order, transaction TokenTransaction, debit, credit LedgerAccountKey, trackStock bool) (Order, error) {
+	return d.checkout(ctx, order, transaction, debit, credit, false, func(tx *gorm.DB, order Order) error {
+		voucher.TransactionID = order.TransactionID
+		if err := tx.Create(&voucher).Error; err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+				return ErrVoucherRedeemed
+			}
+			return fmt.Errorf("failed to record offline voucher: %w", err)
+		}
+
+		result := tx.Model(&OfflineAllowance{}).
+			Where("id = ? AND spent + ? <= spending_limit", voucher.AllowanceID, voucher.Amount).
+			Update("spent", gorm.Expr("spent + ?", voucher.Amount))
+		if result.Error != nil {
+			return fmt.Errorf("failed to update offline allowance: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrAllowanceExceeded
+		}
+
+		if !trackStock {
+			return nil
+		}
+		movements := make([]StockMovement, 0, len(order.Lines))
+		for _, line := range order.Lines {
+			var stock Stock
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND stand_id = ?", line.StockID, order.StandID).
+				First(&stock).Error
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return fmt.Errorf("failed to find stock: %w", err)
+			}
+
+			taken := min(stock.Quantity, line.Quantity)
+			if taken <= 0 {
+				continue
+			}
+			movement, _, err := moveStock(tx,
+				StockMovement{StandID: order.StandID, StockID: line.StockID, Delta: -taken, Reason: StockSale, ActorID: &order.BuyerID},
+				nil, "quantity >= ?", taken)
+			if err != nil {
+				return err
+			}
+			movements = append(movements, movement)
+		}
+
+		return journalStock(tx, movements, &order.TransactionID)
+	})
+}
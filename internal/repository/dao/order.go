@@ -0,0 +1,140 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Order struct {
+	ID            uint   `gorm:"primaryKey"`
+	KermesseID    uint   `gorm:"not null;index"`
+	StandID       uint   `gorm:"not null;index"`
+	BuyerID       uint   `gorm:"not null"`
+	BuyerType     string `gorm:"not null"`
+	TransactionID uint   `gorm:"not null;uniqueIndex"`
+	TotalTokens   int    `gorm:"not null"`
+	PromotionID   *uint  `gorm:"index"`
+	Discount      int    `gorm:"not null;default:0"`
+	Lines         []OrderLine
+	CreatedAt     time.Time
+}
+
+type OrderLine struct {
+	ID       uint   `gorm:"primaryKey"`
+	OrderID  uint   `gorm:"not null;index"`
+	StockID  uint   `gorm:"not null"`
+	ItemName string `gorm:"not null"`
+	Quantity int    `gorm:"not null"`
+	UnitCost int    `gorm:"not null"`
+	Tokens   int    `gorm:"not null"`
+}
+
+// Checkout runs a stand order in a single database transaction: the items
+// leave the stock, transaction pays for them and the order is recorded with
+// the ID of transaction.
+//
+// The buyer's reservations of the items at the stand are confirmed, and
+// their units used before the unreserved ones.
+//
+// Rows are touched in a fixed order (reservations, stocks by ID, buyer
+// account, stand account, stand) and every change is a conditional update,
+// so that concurrent checkouts can neither oversell the stock nor overdraw
+// the buyer. order's lines must be sorted by stock ID.
+func (d *KermesseDao) Checkout(ctx context.Context, order Order, transaction TokenTransaction, debit, credit LedgerAccountKey, trackStock bool) (Order, error) {
+	return d.checkout(ctx, order, transaction, debit, credit, trackStock, nil)
+}
+
+// checkout is Checkout, calling then with the recorded order before
+// committing. An error from then rolls the checkout back.
+func (d *KermesseDao) checkout(ctx context.Context, order Order, transaction TokenTransaction, debit, credit LedgerAccountKey, trackStock bool, then func(tx *gorm.DB, order Order) error) (Order, error) {
+	if transaction.StandID == nil || *transaction.StandID != order.StandID || len(order.Lines) == 0 {
+		return Order{}, ErrInvalidTransaction
+	}
+
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var reservations []StockReservation
+		var movements []StockMovement
+		if trackStock {
+			var err error
+			reservations, movements, err = takeStock(tx, order)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&transaction).Error; err != nil {
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+
+		if err := postLedgerEntries(tx, transaction.ID, debit, credit, transaction.Amount); err != nil {
+			return err
+		}
+
+		if err := recordSale(tx, reservations, movements, transaction.ID); err != nil {
+			return err
+		}
+
+		err := tx.Model(&Stand{}).
+			Where("id = ?", order.StandID).
+			Update("tokens_spent", gorm.Expr("tokens_spent + ?", transaction.Amount)).Error
+		if err != nil {
+			return fmt.Errorf("failed to update stand tokens spent: %w", err)
+		}
+
+		order.TransactionID = transaction.ID
+		if err := tx.Create(&order).Error; err != nil {
+			return fmt.Errorf("failed to create order: %w", err)
+		}
+
+		if then != nil {
+			return then(tx, order)
+		}
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrInsufficientStock) || errors.Is(err, ErrInsufficientTokens) {
+			return Order{}, fmt.Errorf("%w: %w", ErrPurchaseConflict, err)
+		}
+		if isConcurrencyError(err) {
+			return Order{}, fmt.Errorf("%w: %w", ErrPurchaseConflict, err)
+		}
+
+		return Order{}, err
+	}
+
+	return order, nil
+}
+
+// restockOrder puts back in stock the items of the order paid by
+// transactionID, returning the refunds to journal. Spends recorded before
+// orders existed have none.
+func restockOrder(tx *gorm.DB, transactionID, standID, actorID uint) ([]StockMovement, error) {
+	var order Order
+	err := tx.Preload("Lines").Where("transaction_id = ?", transactionID).First(&order).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find order: %w", err)
+	}
+
+	movements := make([]StockMovement, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		movement, ok, err := moveStock(tx,
+			StockMovement{StandID: standID, StockID: line.StockID, Delta: line.Quantity, Reason: StockRefund, ActorID: &actorID},
+			nil)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			movements = append(movements, movement)
+		}
+	}
+
+	return movements, nil
+}
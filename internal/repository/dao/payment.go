@@ -0,0 +1,131 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPaymentEventProcessed is returned when a payment provider event was
+// already handled, e.g. because the provider delivered it twice.
+var ErrPaymentEventProcessed = errors.New("payment event already processed")
+
+// PaymentEvent records a payment provider event that has been applied, so that
+// replayed deliveries are recognized.
+type PaymentEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	EventID   string `gorm:"not null;uniqueIndex"`
+	Type      string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+func (d *KermesseDao) GetTokenTransactionByPaymentReference(ctx context.Context, reference string) (TokenTransaction, error) {
+	var transaction TokenTransaction
+	err := d.db.WithContext(ctx).Where("payment_reference = ? AND type = ?", reference, TokenPurchase).First(&transaction).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return TokenTransaction{}, ErrTransactionNotFound
+		}
+		return TokenTransaction{}, fmt.Errorf("failed to find token transaction: %w", err)
+	}
+
+	return transaction, nil
+}
+
+// AttachPayment records the provider payment charged for a pending token
+// purchase. It fails with ErrInvalidTransactionStatus once the purchase is no
+// longer pending.
+func (d *KermesseDao) AttachPayment(ctx context.Context, transactionID uint, reference string) error {
+	result := d.db.WithContext(ctx).Model(&TokenTransaction{}).
+		Where("id = ? AND type = ? AND status = ?", transactionID, TokenPurchase, "Pending").
+		Updates(map[string]interface{}{
+			"payment_reference": reference,
+			"updated_at":        time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to attach payment: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransactionStatus
+	}
+
+	return nil
+}
+
+// GetPendingTokenPurchases lists the purchases of a kermesse paid with method
+// that still wait for a decision, oldest first.
+func (d *KermesseDao) GetPendingTokenPurchases(ctx context.Context, kermesseID uint, method string) ([]TokenTransaction, error) {
+	var transactions []TokenTransaction
+	err := d.db.WithContext(ctx).
+		Where("kermesse_id = ? AND type = ? AND status = ? AND payment_method = ?", kermesseID, TokenPurchase, "Pending", method).
+		Order("created_at, id").
+		Find(&transactions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pending token purchases: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// SettleTokenPurchase moves a pending token purchase to its final status in a
+// single database transaction. Purchases moving to a posted status are
+// credited through the ledger and counted in the kermesse's tokens sold.
+//
+// A non-empty eventID is recorded alongside, and ErrPaymentEventProcessed is
+// returned without touching anything if it was seen before. A purchase that is
+// no longer pending is left as is and reported through settled.
+func (d *KermesseDao) SettleTokenPurchase(ctx context.Context, eventID, eventType string, transaction TokenTransaction, debit, credit LedgerAccountKey) (settled bool, err error) {
+	err = d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if eventID != "" {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&PaymentEvent{EventID: eventID, Type: eventType})
+			if result.Error != nil {
+				return fmt.Errorf("failed to record payment event: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return ErrPaymentEventProcessed
+			}
+		}
+
+		result := tx.Model(&TokenTransaction{}).
+			Where("id = ? AND status = ?", transaction.ID, "Pending").
+			Updates(map[string]interface{}{
+				"status":           transaction.Status,
+				"rejection_reason": transaction.RejectionReason,
+				"updated_at":       time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to update token transaction: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		settled = true
+
+		if !slices.Contains(postedStatuses, transaction.Status) {
+			return nil
+		}
+
+		if err := postLedgerEntries(tx, transaction.ID, debit, credit, transaction.Amount); err != nil {
+			return err
+		}
+
+		err := tx.Model(&Kermesse{}).
+			Where("id = ?", transaction.KermesseID).
+			Update("tokens_sold", gorm.Expr("tokens_sold + ?", transaction.Amount)).Error
+		if err != nil {
+			return fmt.Errorf("failed to increment tokens sold: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return settled, nil
+}
@@ -0,0 +1,46 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// ErrPaymentRequestUsed is returned when a payment request was already paid.
+var ErrPaymentRequestUsed = errors.New("payment request already paid")
+
+// StandPaymentRequest is a paid payment request. Requests are signed
+// payloads that live with the buyer until they are paid, so only paid ones
+// are stored, which is what keeps them single use.
+type StandPaymentRequest struct {
+	ID            string    `gorm:"primaryKey"`
+	KermesseID    uint      `gorm:"not null;index"`
+	StandID       uint      `gorm:"not null;index"`
+	TransactionID uint      `gorm:"not null;uniqueIndex"`
+	Amount        int       `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null"`
+	CreatedAt     time.Time
+}
+
+// PayPaymentRequest checks order out like Checkout and marks request paid in
+// the same database transaction, so that a request can't pay for two
+// orders even when scanned twice at the same time.
+func (d *KermesseDao) PayPaymentRequest(ctx context.Context, request StandPaymentRequest, order Order, transaction TokenTransaction, debit, credit LedgerAccountKey, trackStock bool) (Order, error) {
+	return d.checkout(ctx, order, transaction, debit, credit, trackStock, func(tx *gorm.DB, order Order) error {
+		request.TransactionID = order.TransactionID
+		if err := tx.Create(&request).Error; err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+				return ErrPaymentRequestUsed
+			}
+			return fmt.Errorf("failed to record payment request: %w", err)
+		}
+
+		return nil
+	})
+}
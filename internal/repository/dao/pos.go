@@ -0,0 +1,228 @@
+package dao
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+const (
+	// studentCodeAlphabet leaves out characters easily mistaken for one
+	// another, such as 0 and O, when read out at a stand.
+	studentCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	studentCodeLength   = 6
+)
+
+func newStudentCode() (string, error) {
+	code := make([]byte, studentCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(studentCodeAlphabet))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate student code: %w", err)
+		}
+		code[i] = studentCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// migrateStudentCodes gives a short code to the students created before
+// stands had a point of sale.
+func migrateStudentCodes(db *gorm.DB) error {
+	var students []Student
+	if err := db.Where("short_code IS NULL").Find(&students).Error; err != nil {
+		return err
+	}
+
+	for _, student := range students {
+		code, err := newStudentCode()
+		if err != nil {
+			return err
+		}
+		err = db.Model(&Student{}).Where("user_id = ?", student.UserID).Update("short_code", code).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindStudentByCode finds the student whose short code or badge ID is code.
+// Short codes are matched regardless of case.
+func (d *UserDAO) FindStudentByCode(ctx context.Context, code string) (Student, error) {
+	var student Student
+	result := d.db.WithContext(ctx).
+		Where("short_code = ? OR badge_id = ?", strings.ToUpper(code), code).
+		Preload("User").
+		First(&student)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return Student{}, ErrStudentNotFound
+		}
+		return Student{}, fmt.Errorf("failed to find student: %w", result.Error)
+	}
+
+	return student, nil
+}
+
+// UpdateStudentPOSSettings sets the badge ID and the auto-approve limit of a
+// student. An empty badge ID removes the badge.
+func (d *UserDAO) UpdateStudentPOSSettings(ctx context.Context, studentID uint, badgeID *string, autoApproveLimit int) (Student, error) {
+	if badgeID != nil && *badgeID == "" {
+		badgeID = nil
+	}
+
+	result := d.db.WithContext(ctx).Model(&Student{}).
+		Where("user_id = ?", studentID).
+		Updates(map[string]interface{}{
+			"badge_id":           badgeID,
+			"auto_approve_limit": autoApproveLimit,
+		})
+	if result.Error != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(result.Error, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return Student{}, ErrBadgeIDTaken
+		}
+		return Student{}, fmt.Errorf("failed to update student: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return Student{}, ErrStudentNotFound
+	}
+
+	return d.FindStudentByUserID(ctx, studentID)
+}
+
+// CreateCharge records an order a stand holder rang up, waiting for the
+// buyer to confirm it. Neither the stock nor the ledger move before that.
+func (d *KermesseDao) CreateCharge(ctx context.Context, order Order, transaction TokenTransaction) (Order, error) {
+	if transaction.StandID == nil || *transaction.StandID != order.StandID || len(order.Lines) == 0 {
+		return Order{}, ErrInvalidTransaction
+	}
+
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&transaction).Error; err != nil {
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+
+		order.TransactionID = transaction.ID
+		if err := tx.Create(&order).Error; err != nil {
+			return fmt.Errorf("failed to create order: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Order{}, err
+	}
+
+	return order, nil
+}
+
+// ConfirmCharge settles a pending charge as Checkout settles an order: the
+// items leave the stock and the tokens go from the buyer to the stand, in a
+// single database transaction.
+//
+// The charge only moves out of Pending once, so that confirming it twice, or
+// confirming it while it is declined, fails with ErrInvalidTransactionStatus.
+func (d *KermesseDao) ConfirmCharge(ctx context.Context, order Order, debit, credit LedgerAccountKey, trackStock bool) (TokenTransaction, error) {
+	var transaction TokenTransaction
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&TokenTransaction{}).
+			Where("id = ? AND type = ? AND status = ?", order.TransactionID, TokenSpend, "Pending").
+			Updates(map[string]interface{}{
+				"status":     "Validated",
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to confirm charge: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTransactionStatus
+		}
+
+		if trackStock {
+			reservations, movements, err := takeStock(tx, order)
+			if err != nil {
+				return err
+			}
+			if err := recordSale(tx, reservations, movements, order.TransactionID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.First(&transaction, order.TransactionID).Error; err != nil {
+			return fmt.Errorf("failed to find transaction: %w", err)
+		}
+
+		if err := postLedgerEntries(tx, transaction.ID, debit, credit, transaction.Amount); err != nil {
+			return err
+		}
+
+		err := tx.Model(&Stand{}).
+			Where("id = ?", order.StandID).
+			Update("tokens_spent", gorm.Expr("tokens_spent + ?", transaction.Amount)).Error
+		if err != nil {
+			return fmt.Errorf("failed to update stand tokens spent: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrInsufficientStock) || errors.Is(err, ErrInsufficientTokens) {
+			return TokenTransaction{}, fmt.Errorf("%w: %w", ErrPurchaseConflict, err)
+		}
+		if isConcurrencyError(err) {
+			return TokenTransaction{}, fmt.Errorf("%w: %w", ErrPurchaseConflict, err)
+		}
+
+		return TokenTransaction{}, err
+	}
+
+	return transaction, nil
+}
+
+// RejectPendingTransaction rejects a transaction still waiting for an
+// answer. It fails with ErrInvalidTransactionStatus once the transaction was
+// settled.
+func (d *KermesseDao) RejectPendingTransaction(ctx context.Context, transactionID uint) (TokenTransaction, error) {
+	result := d.db.WithContext(ctx).Model(&TokenTransaction{}).
+		Where("id = ? AND status = ?", transactionID, "Pending").
+		Updates(map[string]interface{}{
+			"status":     "Rejected",
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return TokenTransaction{}, fmt.Errorf("failed to reject transaction: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return TokenTransaction{}, ErrInvalidTransactionStatus
+	}
+
+	return d.GetTokenTransactionByID(transactionID)
+}
+
+func (d *KermesseDao) GetOrderByTransactionID(ctx context.Context, transactionID uint) (Order, error) {
+	var order Order
+	err := d.db.WithContext(ctx).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("stock_id") }).
+		Where("transaction_id = ?", transactionID).
+		First(&order).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Order{}, ErrTransactionNotFound
+		}
+		return Order{}, fmt.Errorf("failed to find order: %w", err)
+	}
+
+	return order, nil
+}
@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrPromotionNotFound = errors.New("promotion not found")
+
+type Promotion struct {
+	ID          uint   `gorm:"primaryKey"`
+	StandID     uint   `gorm:"not null;index"`
+	Name        string `gorm:"not null"`
+	Type        string `gorm:"not null"`
+	BundlePrice int    `gorm:"not null;default:0"`
+	PercentOff  int    `gorm:"not null;default:0"`
+	BuyQuantity int    `gorm:"not null;default:0"`
+	GetQuantity int    `gorm:"not null;default:0"`
+	StartsAt    *time.Time
+	EndsAt      *time.Time
+	Active      bool `gorm:"not null"`
+	Items       []PromotionItem
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type PromotionItem struct {
+	ID          uint `gorm:"primaryKey"`
+	PromotionID uint `gorm:"not null;index"`
+	StockID     uint `gorm:"not null"`
+	Quantity    int  `gorm:"not null;default:0"`
+}
+
+func (d *KermesseDao) CreatePromotion(ctx context.Context, promotion Promotion) (Promotion, error) {
+	if err := d.db.WithContext(ctx).Create(&promotion).Error; err != nil {
+		return Promotion{}, fmt.Errorf("failed to create promotion: %w", err)
+	}
+
+	return promotion, nil
+}
+
+// GetPromotions returns the promotions of a stand, only those still active
+// when activeOnly is set.
+func (d *KermesseDao) GetPromotions(ctx context.Context, standID uint, activeOnly bool) ([]Promotion, error) {
+	query := d.db.WithContext(ctx).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("stand_id = ?", standID)
+	if activeOnly {
+		query = query.Where("active")
+	}
+
+	var promotions []Promotion
+	if err := query.Order("id").Find(&promotions).Error; err != nil {
+		return nil, fmt.Errorf("failed to find promotions: %w", err)
+	}
+
+	return promotions, nil
+}
+
+// DeactivatePromotion turns a promotion of the stand off. It is kept for the
+// orders that got their price from it.
+func (d *KermesseDao) DeactivatePromotion(ctx context.Context, standID, promotionID uint) error {
+	result := d.db.WithContext(ctx).Model(&Promotion{}).
+		Where("id = ? AND stand_id = ?", promotionID, standID).
+		Update("active", false)
+	if result.Error != nil {
+		return fmt.Errorf("failed to deactivate promotion: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPromotionNotFound
+	}
+
+	return nil
+}
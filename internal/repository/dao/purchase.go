@@ -0,0 +1,112 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// ErrPurchaseConflict is returned when a purchase lost a race against another
+// one touching the same wallet, stand or stock row. It may wrap the reason,
+// e.g. ErrInsufficientStock when the last item was sold in the meantime.
+var ErrPurchaseConflict = errors.New("purchase conflicted with a concurrent update")
+
+// RefundPurchase posts refund, which gives back items of spend, in a single
+// database transaction: the spend's refunded quantity, the stock, the ledger
+// and the stand's tokens spent move together. The items back in stock are
+// journaled as refunds by actorID.
+//
+// The spend is only updated if it is settled and nobody refunded it since it
+// was read, so that concurrent refunds can't give back more than was bought,
+// nor anything of a charge still pending or declined.
+func (d *KermesseDao) RefundPurchase(ctx context.Context, spend, refund TokenTransaction, debit, credit LedgerAccountKey, trackStock bool, actorID uint) (TokenTransaction, error) {
+	if refund.StandID == nil || refund.ReversedTransactionID == nil || *refund.ReversedTransactionID != spend.ID {
+		return TokenTransaction{}, ErrInvalidTransaction
+	}
+
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&TokenTransaction{}).
+			Where("id = ? AND type = ? AND status IN ? AND refunded_quantity = ?", spend.ID, TokenSpend, []string{"Completed", "Validated"}, spend.RefundedQuantity).
+			Updates(map[string]interface{}{
+				"refunded_quantity": gorm.Expr("refunded_quantity + ?", refund.Quantity),
+				"updated_at":        time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to update refunded quantity: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrPurchaseConflict
+		}
+
+		var movements []StockMovement
+		if trackStock && refund.StockID != nil {
+			movement, ok, err := moveStock(tx,
+				StockMovement{StandID: *refund.StandID, StockID: *refund.StockID, Delta: refund.Quantity, Reason: StockRefund, ActorID: &actorID},
+				nil)
+			if err != nil {
+				return err
+			}
+			if ok {
+				movements = append(movements, movement)
+			}
+		} else if trackStock {
+			// Orders of several items are only refunded as a whole.
+			restocked, err := restockOrder(tx, spend.ID, *refund.StandID, actorID)
+			if err != nil {
+				return err
+			}
+			movements = restocked
+		}
+
+		if err := tx.Create(&refund).Error; err != nil {
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+
+		if err := journalStock(tx, movements, &refund.ID); err != nil {
+			return err
+		}
+
+		if err := postLedgerEntries(tx, refund.ID, debit, credit, refund.Amount); err != nil {
+			return err
+		}
+
+		err := tx.Model(&Stand{}).
+			Where("id = ?", *refund.StandID).
+			Update("tokens_spent", gorm.Expr("tokens_spent - ?", refund.Amount)).Error
+		if err != nil {
+			return fmt.Errorf("failed to update stand tokens spent: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		if isConcurrencyError(err) {
+			return TokenTransaction{}, fmt.Errorf("%w: %w", ErrPurchaseConflict, err)
+		}
+
+		return TokenTransaction{}, err
+	}
+
+	return refund, nil
+}
+
+// isConcurrencyError reports whether Postgres aborted the statement because of
+// a concurrent transaction.
+func isConcurrencyError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	switch pgErr.Code {
+	case pgerrcode.SerializationFailure, pgerrcode.DeadlockDetected, pgerrcode.LockNotAvailable:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetKermesseWallets returns the parent and student accounts of a kermesse
+// that still hold tokens.
+func (d *KermesseDao) GetKermesseWallets(ctx context.Context, kermesseID uint) ([]LedgerAccount, error) {
+	var accounts []LedgerAccount
+	err := d.db.WithContext(ctx).
+		Where("kermesse_id = ? AND type IN ? AND balance > 0", kermesseID, []string{"parent", "student"}).
+		Order("type, owner_id").
+		Find(&accounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find wallets: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// GetRefundablePurchases lists the card purchases of parentID in a kermesse
+// that were not fully refunded, newest first.
+func (d *KermesseDao) GetRefundablePurchases(ctx context.Context, kermesseID, parentID uint) ([]TokenTransaction, error) {
+	var transactions []TokenTransaction
+	err := d.db.WithContext(ctx).
+		Where("kermesse_id = ? AND type = ? AND from_id = ? AND LOWER(from_type) = ?", kermesseID, TokenPurchase, parentID, "parent").
+		Where("status = ? AND payment_method = ? AND payment_reference <> '' AND money_amount > 0", "Completed", "card").
+		Where("refunded_quantity < amount").
+		Order("created_at DESC, id DESC").
+		Find(&transactions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find refundable purchases: %w", err)
+	}
+
+	return transactions, nil
+}
+
+func (d *KermesseDao) GetRefunds(ctx context.Context, kermesseID uint) ([]TokenTransaction, error) {
+	var transactions []TokenTransaction
+	err := d.db.WithContext(ctx).
+		Where("kermesse_id = ? AND type = ?", kermesseID, TokenRefund).
+		Order("id").
+		Find(&transactions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find refunds: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// CreateRefund records a pending refund of purchase and sets its tokens aside
+// in a single database transaction, before any money moves. The purchase is
+// only updated if nobody refunded it since it was read, so that its refunds
+// never add up to more than was paid.
+func (d *KermesseDao) CreateRefund(ctx context.Context, purchase, refund TokenTransaction, debit, credit LedgerAccountKey) (TokenTransaction, error) {
+	if refund.ReversedTransactionID == nil || *refund.ReversedTransactionID != purchase.ID {
+		return TokenTransaction{}, ErrInvalidTransaction
+	}
+
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&TokenTransaction{}).
+			Where("id = ? AND type = ? AND refunded_quantity = ? AND refunded_quantity + ? <= amount", purchase.ID, TokenPurchase, purchase.RefundedQuantity, refund.Amount).
+			Updates(map[string]interface{}{
+				"refunded_quantity": gorm.Expr("refunded_quantity + ?", refund.Amount),
+				"updated_at":        time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to update refunded tokens: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrPurchaseConflict
+		}
+
+		if err := tx.Create(&refund).Error; err != nil {
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+
+		return postLedgerEntries(tx, refund.ID, debit, credit, refund.Amount)
+	})
+	if err != nil {
+		if isConcurrencyError(err) {
+			return TokenTransaction{}, fmt.Errorf("%w: %w", ErrPurchaseConflict, err)
+		}
+
+		return TokenTransaction{}, err
+	}
+
+	return refund, nil
+}
+
+// CompleteRefund marks a pending refund as paid back by the payment provider
+// under reference.
+func (d *KermesseDao) CompleteRefund(ctx context.Context, refundID uint, reference string) error {
+	result := d.db.WithContext(ctx).Model(&TokenTransaction{}).
+		Where("id = ? AND type = ? AND status = ?", refundID, TokenRefund, "Pending").
+		Updates(map[string]interface{}{
+			"status":            "Completed",
+			"payment_reference": reference,
+			"updated_at":        time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to complete refund: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransactionStatus
+	}
+
+	return nil
+}
+
+// FailRefund marks a pending refund as declined for good by the payment
+// provider. Its tokens stay set aside: the money is owed to the parent, and
+// has to be paid back by hand.
+func (d *KermesseDao) FailRefund(ctx context.Context, refundID uint, reason string) error {
+	result := d.db.WithContext(ctx).Model(&TokenTransaction{}).
+		Where("id = ? AND type = ? AND status = ?", refundID, TokenRefund, "Pending").
+		Updates(map[string]interface{}{
+			"status":           "Failed",
+			"rejection_reason": reason,
+			"updated_at":       time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to fail refund: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransactionStatus
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrReservationNotFound = errors.New("stock reservation not found")
+
+type ReservationStatus string
+
+const (
+	ReservationHeld      ReservationStatus = "held"
+	ReservationConfirmed ReservationStatus = "confirmed"
+	ReservationReleased  ReservationStatus = "released"
+)
+
+type StockReservation struct {
+	ID            uint              `gorm:"primaryKey"`
+	KermesseID    uint              `gorm:"not null;index"`
+	StandID       uint              `gorm:"not null;index"`
+	StockID       uint              `gorm:"not null;index"`
+	UserID        uint              `gorm:"not null;index"`
+	Quantity      int               `gorm:"not null"`
+	Status        ReservationStatus `gorm:"not null;index"`
+	ExpiresAt     time.Time         `gorm:"not null;index"`
+	TransactionID *uint             `gorm:"index"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// ReserveStock sets the units of reservations aside from the available stock,
+// all of them or none. reservations must be sorted by stock ID.
+func (d *KermesseDao) ReserveStock(ctx context.Context, reservations []StockReservation) ([]StockReservation, error) {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, reservation := range reservations {
+			result := tx.Model(&Stock{}).
+				Where("id = ? AND stand_id = ? AND quantity - reserved >= ?", reservation.StockID, reservation.StandID, reservation.Quantity).
+				Update("reserved", gorm.Expr("reserved + ?", reservation.Quantity))
+			if result.Error != nil {
+				return fmt.Errorf("failed to reserve stock: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return ErrInsufficientStock
+			}
+		}
+
+		if err := tx.Create(&reservations).Error; err != nil {
+			return fmt.Errorf("failed to create stock reservations: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		if isConcurrencyError(err) {
+			return nil, fmt.Errorf("%w: %w", ErrPurchaseConflict, err)
+		}
+
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// GetHeldReservations returns the reservations the user still holds at the
+// stand.
+func (d *KermesseDao) GetHeldReservations(ctx context.Context, userID, standID uint) ([]StockReservation, error) {
+	var reservations []StockReservation
+	err := d.db.WithContext(ctx).
+		Where("user_id = ? AND stand_id = ? AND status = ? AND expires_at > ?", userID, standID, ReservationHeld, time.Now()).
+		Order("id").
+		Find(&reservations).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stock reservations: %w", err)
+	}
+
+	return reservations, nil
+}
+
+// ReleaseReservation gives a reservation the user holds in a kermesse back to
+// the stock.
+func (d *KermesseDao) ReleaseReservation(ctx context.Context, kermesseID, reservationID, userID uint) (StockReservation, error) {
+	var released []StockReservation
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&released).Clauses(clause.Returning{}).
+			Where("id = ? AND kermesse_id = ? AND user_id = ? AND status = ?", reservationID, kermesseID, userID, ReservationHeld).
+			Updates(map[string]interface{}{
+				"status":     ReservationReleased,
+				"updated_at": time.Now(),
+			}).Error
+		if err != nil {
+			return fmt.Errorf("failed to release stock reservation: %w", err)
+		}
+		if len(released) == 0 {
+			return ErrReservationNotFound
+		}
+
+		return unreserveStock(tx, released)
+	})
+	if err != nil {
+		return StockReservation{}, err
+	}
+
+	return released[0], nil
+}
+
+// ReleaseExpiredReservations gives the reservations expired at now back to
+// the stock, returning how many there were.
+func (d *KermesseDao) ReleaseExpiredReservations(ctx context.Context, now time.Time) (int, error) {
+	var released []StockReservation
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&released).Clauses(clause.Returning{}).
+			Where("status = ? AND expires_at <= ?", ReservationHeld, now).
+			Updates(map[string]interface{}{
+				"status":     ReservationReleased,
+				"updated_at": now,
+			}).Error
+		if err != nil {
+			return fmt.Errorf("failed to release stock reservations: %w", err)
+		}
+
+		return unreserveStock(tx, released)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(released), nil
+}
+
+// unreserveStock takes the units of reservations off the reserved stock,
+// touching stocks by ID.
+func unreserveStock(tx *gorm.DB, reservations []StockReservation) error {
+	held := heldByStock(reservations)
+	stockIDs := make([]uint, 0, len(held))
+	for stockID := range held {
+		stockIDs = append(stockIDs, stockID)
+	}
+	slices.Sort(stockIDs)
+
+	for _, stockID := range stockIDs {
+		err := tx.Model(&Stock{}).
+			Where("id = ?", stockID).
+			Update("reserved", gorm.Expr("GREATEST(reserved - ?, 0)", held[stockID])).Error
+		if err != nil {
+			return fmt.Errorf("failed to unreserve stock: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// takeStock takes the items of order out of the stock. The buyer's own
+// reservations of the items are confirmed and their units used first; the
+// other units must not be reserved by anyone. It returns the confirmed
+// reservations and the sales to journal, which recordSale does once the
+// spend exists.
+func takeStock(tx *gorm.DB, order Order) ([]StockReservation, []StockMovement, error) {
+	stockIDs := make([]uint, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		stockIDs = append(stockIDs, line.StockID)
+	}
+
+	var confirmed []StockReservation
+	err := tx.Model(&confirmed).Clauses(clause.Returning{}).
+		Where("user_id = ? AND stand_id = ? AND stock_id IN ? AND status = ? AND expires_at > ?",
+			order.BuyerID, order.StandID, stockIDs, ReservationHeld, time.Now()).
+		Updates(map[string]interface{}{
+			"status":     ReservationConfirmed,
+			"updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to confirm stock reservations: %w", err)
+	}
+
+	held := heldByStock(confirmed)
+	movements := make([]StockMovement, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		movement, ok, err := moveStock(tx,
+			StockMovement{StandID: order.StandID, StockID: line.StockID, Delta: -line.Quantity, Reason: StockSale, ActorID: &order.BuyerID},
+			map[string]interface{}{"reserved": gorm.Expr("GREATEST(reserved - ?, 0)", held[line.StockID])},
+			"quantity - GREATEST(reserved - ?, 0) >= ?", held[line.StockID], line.Quantity)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			return nil, nil, ErrInsufficientStock
+		}
+		movements = append(movements, movement)
+	}
+
+	return confirmed, movements, nil
+}
+
+// recordSale journals the stock movements of a sale and records the spend
+// that bought reservations.
+func recordSale(tx *gorm.DB, reservations []StockReservation, movements []StockMovement, transactionID uint) error {
+	if err := journalStock(tx, movements, &transactionID); err != nil {
+		return err
+	}
+	if len(reservations) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(reservations))
+	for _, reservation := range reservations {
+		ids = append(ids, reservation.ID)
+	}
+
+	err := tx.Model(&StockReservation{}).Where("id IN ?", ids).Update("transaction_id", transactionID).Error
+	if err != nil {
+		return fmt.Errorf("failed to link stock reservations: %w", err)
+	}
+
+	return nil
+}
+
+func heldByStock(reservations []StockReservation) map[uint]int {
+	held := map[uint]int{}
+	for _, reservation := range reservations {
+		held[reservation.StockID] += reservation.Quantity
+	}
+
+	return held
+}
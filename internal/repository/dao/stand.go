@@ -0,0 +1,88 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// UpdateStandDetails renames, re-types or re-describes a stand that isn't
+// archived, leaving its counters alone.
+func (d *KermesseDao) UpdateStandDetails(ctx context.Context, stand Stand) (Stand, error) {
+	result := d.db.WithContext(ctx).Model(&Stand{}).
+		Where("id = ? AND archived_at IS NULL", stand.ID).
+		Updates(map[string]interface{}{
+			"name":        stand.Name,
+			"type":        stand.Type,
+			"description": stand.Description,
+			"opens_at":    stand.OpensAt,
+			"closes_at":   stand.ClosesAt,
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return Stand{}, fmt.Errorf("failed to update stand: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return Stand{}, ErrStandNotFound
+	}
+
+	return d.GetStandByID(stand.ID)
+}
+
+// ArchiveStand takes a stand off the kermesse. Its row stays for the
+// transactions that refer to it.
+func (d *KermesseDao) ArchiveStand(ctx context.Context, standID uint) error {
+	result := d.db.WithContext(ctx).Model(&Stand{}).
+		Where("id = ? AND archived_at IS NULL", standID).
+		Updates(map[string]interface{}{
+			"archived_at": time.Now(),
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to archive stand: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrStandNotFound
+	}
+
+	return nil
+}
+
+// UpdateStockDetails renames or re-prices a stock item that isn't archived,
+// leaving its quantities alone.
+func (d *KermesseDao) UpdateStockDetails(ctx context.Context, stock Stock) (Stock, error) {
+	var updated []Stock
+	result := d.db.WithContext(ctx).Model(&updated).Clauses(clause.Returning{}).
+		Where("id = ? AND stand_id = ? AND archived_at IS NULL", stock.ID, stock.StandID).
+		Updates(map[string]interface{}{
+			"item_name":           stock.ItemName,
+			"token_cost":          stock.TokenCost,
+			"low_stock_threshold": stock.LowStockThreshold,
+		})
+	if result.Error != nil {
+		return Stock{}, fmt.Errorf("failed to update stock: %w", result.Error)
+	}
+	if len(updated) == 0 {
+		return Stock{}, ErrStockNotFound
+	}
+
+	return updated[0], nil
+}
+
+// ArchiveStock takes a stock item off sale. Its row stays for the orders and
+// movements that refer to it.
+func (d *KermesseDao) ArchiveStock(ctx context.Context, standID, stockID uint) error {
+	result := d.db.WithContext(ctx).Model(&Stock{}).
+		Where("id = ? AND stand_id = ? AND archived_at IS NULL", stockID, standID).
+		Update("archived_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to archive stock: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrStockNotFound
+	}
+
+	return nil
+}
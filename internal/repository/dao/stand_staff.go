@@ -0,0 +1,275 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const standManager = "manager"
+
+var (
+	ErrStandStaffNotFound      = errors.New("stand staff member not found")
+	ErrStandInvitationNotFound = errors.New("stand invitation not found")
+	// ErrStandInvitationUsed is returned for invitations already accepted.
+	ErrStandInvitationUsed = errors.New("stand invitation already accepted")
+	// ErrLastStandManager is returned when removing the only manager of a
+	// stand.
+	ErrLastStandManager = errors.New("stand needs at least one manager")
+)
+
+// StandStaff links a user to a stand they work at. A user can work several
+// stands, and a stand can have several staff.
+type StandStaff struct {
+	ID        uint   `gorm:"primaryKey"`
+	StandID   uint   `gorm:"not null;uniqueIndex:idx_stand_staffs_stand_user"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_stand_staffs_stand_user;index"`
+	Role      string `gorm:"not null"` // "manager" or "cashier"
+	CreatedAt time.Time
+}
+
+// StandStaffMember is a staff row along with its user and the kermesse of
+// its stand.
+type StandStaffMember struct {
+	StandStaff
+	KermesseID uint
+	Name       string
+	Email      string
+}
+
+type StandInvitation struct {
+	ID         uint      `gorm:"primaryKey"`
+	StandID    uint      `gorm:"not null;index"`
+	Email      string    `gorm:"not null"`
+	Role       string    `gorm:"not null"`
+	Code       string    `gorm:"not null;uniqueIndex"`
+	InvitedBy  uint      `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	AcceptedBy *uint
+	AcceptedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// StandInvitationWithStand is an invitation along with the kermesse of its
+// stand.
+type StandInvitationWithStand struct {
+	StandInvitation
+	KermesseID uint
+}
+
+// standStaffMembers selects staff rows with their user and kermesse.
+func standStaffMembers(db *gorm.DB) *gorm.DB {
+	return db.Table("stand_staffs").
+		Select("stand_staffs.*, stands.kermesse_id, users.name, users.email").
+		Joins("JOIN stands ON stands.id = stand_staffs.stand_id").
+		Joins("JOIN users ON users.id = stand_staffs.user_id")
+}
+
+// migrateStandStaff moves the stand of each stand holder, from the time a
+// holder had a single stand, to the staff of that stand as its manager.
+// Stands created along with holders at signup never belonged to a kermesse
+// and are left out.
+func migrateStandStaff(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&StandHolder{}, "stand_id") {
+		return nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO stand_staffs (stand_id, user_id, role, created_at)
+			SELECT sh.stand_id, sh.user_id, ?, NOW() FROM stand_holders sh
+			JOIN stands s ON s.id = sh.stand_id
+			WHERE s.kermesse_id <> 0
+			ON CONFLICT DO NOTHING`, standManager).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropColumn(&StandHolder{}, "stand_id")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate stand holders: %w", err)
+	}
+
+	return nil
+}
+
+// IsUserStandHolder tells whether the user is on the staff of the stand,
+// whatever their role.
+func (d *KermesseDao) IsUserStandHolder(standID, userID uint) (bool, error) {
+	var count int64
+	result := d.db.Model(&StandStaff{}).
+		Where("stand_id = ? AND user_id = ?", standID, userID).
+		Count(&count)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to check if user is stand holder: %w", result.Error)
+	}
+	return count > 0, nil
+}
+
+func (d *KermesseDao) GetStandStaffMember(ctx context.Context, standID, userID uint) (StandStaffMember, error) {
+	return findStandStaffMember(d.db.WithContext(ctx), standID, userID)
+}
+
+func findStandStaffMember(db *gorm.DB, standID, userID uint) (StandStaffMember, error) {
+	var members []StandStaffMember
+	err := standStaffMembers(db).
+		Where("stand_staffs.stand_id = ? AND stand_staffs.user_id = ?", standID, userID).
+		Scan(&members).Error
+	if err != nil {
+		return StandStaffMember{}, fmt.Errorf("failed to find stand staff member: %w", err)
+	}
+	if len(members) == 0 {
+		return StandStaffMember{}, ErrStandStaffNotFound
+	}
+
+	return members[0], nil
+}
+
+// GetStandStaff returns the staff of a stand, managers first.
+func (d *KermesseDao) GetStandStaff(ctx context.Context, standID uint) ([]StandStaffMember, error) {
+	var members []StandStaffMember
+	err := standStaffMembers(d.db.WithContext(ctx)).
+		Where("stand_staffs.stand_id = ?", standID).
+		Order("stand_staffs.role DESC, stand_staffs.created_at, stand_staffs.id").
+		Scan(&members).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stand staff: %w", err)
+	}
+
+	return members, nil
+}
+
+// RemoveStandStaff takes a user off the staff of a stand, unless they are
+// its last manager.
+func (d *KermesseDao) RemoveStandStaff(ctx context.Context, standID, userID uint) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the staff of the stand keeps two managers from removing
+		// each other at once.
+		var staff []StandStaff
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("stand_id = ?", standID).
+			Find(&staff).Error
+		if err != nil {
+			return fmt.Errorf("failed to lock stand staff: %w", err)
+		}
+
+		var removed *StandStaff
+		managers := 0
+		for i := range staff {
+			if staff[i].UserID == userID {
+				removed = &staff[i]
+			}
+			if staff[i].Role == standManager {
+				managers++
+			}
+		}
+		if removed == nil {
+			return ErrStandStaffNotFound
+		}
+		if removed.Role == standManager && managers == 1 {
+			return ErrLastStandManager
+		}
+
+		if err := tx.Delete(&StandStaff{}, removed.ID).Error; err != nil {
+			return fmt.Errorf("failed to remove stand staff member: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (d *KermesseDao) CreateStandInvitation(ctx context.Context, invitation StandInvitation) (StandInvitation, error) {
+	if err := d.db.WithContext(ctx).Create(&invitation).Error; err != nil {
+		return StandInvitation{}, fmt.Errorf("failed to create stand invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// DeleteStandInvitation deletes an invitation not accepted yet.
+func (d *KermesseDao) DeleteStandInvitation(ctx context.Context, invitationID uint) error {
+	err := d.db.WithContext(ctx).
+		Where("id = ? AND accepted_at IS NULL", invitationID).
+		Delete(&StandInvitation{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete stand invitation: %w", err)
+	}
+
+	return nil
+}
+
+func (d *KermesseDao) GetStandInvitationByCode(ctx context.Context, code string) (StandInvitationWithStand, error) {
+	var invitations []StandInvitationWithStand
+	err := d.db.WithContext(ctx).Table("stand_invitations").
+		Select("stand_invitations.*, stands.kermesse_id").
+		Joins("JOIN stands ON stands.id = stand_invitations.stand_id").
+		Where("stand_invitations.code = ?", code).
+		Scan(&invitations).Error
+	if err != nil {
+		return StandInvitationWithStand{}, fmt.Errorf("failed to find stand invitation: %w", err)
+	}
+	if len(invitations) == 0 {
+		return StandInvitationWithStand{}, ErrStandInvitationNotFound
+	}
+
+	return invitations[0], nil
+}
+
+// AcceptStandInvitation marks an invitation accepted by the user and adds
+// them to the staff of its stand. Invitations add or promote staff, they
+// never demote a manager.
+func (d *KermesseDao) AcceptStandInvitation(ctx context.Context, invitation StandInvitation, userID uint) (StandStaffMember, error) {
+	var member StandStaffMember
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&StandInvitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Updates(map[string]interface{}{
+				"accepted_by": userID,
+				"accepted_at": time.Now(),
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to accept stand invitation: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrStandInvitationUsed
+		}
+
+		err := tx.Exec(`
+			INSERT INTO stand_staffs (stand_id, user_id, role, created_at)
+			VALUES (?, ?, ?, NOW())
+			ON CONFLICT (stand_id, user_id) DO UPDATE SET role = EXCLUDED.role
+			WHERE stand_staffs.role <> ?`, invitation.StandID, userID, invitation.Role, standManager).Error
+		if err != nil {
+			return fmt.Errorf("failed to add stand staff member: %w", err)
+		}
+
+		member, err = findStandStaffMember(tx, invitation.StandID, userID)
+
+		return err
+	})
+	if err != nil {
+		return StandStaffMember{}, err
+	}
+
+	return member, nil
+}
+
+// FindStandStaffByUserID returns the stands the user works at, leaving out
+// archived ones.
+func (d *UserDAO) FindStandStaffByUserID(ctx context.Context, userID uint) ([]StandStaffMember, error) {
+	var members []StandStaffMember
+	err := standStaffMembers(d.db.WithContext(ctx)).
+		Where("stand_staffs.user_id = ? AND stands.archived_at IS NULL", userID).
+		Order("stands.kermesse_id, stand_staffs.stand_id").
+		Scan(&members).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stands of staff member: %w", err)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,156 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StockMovementReason string
+
+const (
+	StockSale       StockMovementReason = "sale"
+	StockRestock    StockMovementReason = "restock"
+	StockAdjustment StockMovementReason = "adjustment"
+	StockWaste      StockMovementReason = "waste"
+	StockRefund     StockMovementReason = "refund"
+)
+
+type StockMovement struct {
+	ID            uint                `gorm:"primaryKey"`
+	StandID       uint                `gorm:"not null;index"`
+	StockID       uint                `gorm:"not null;index"`
+	Delta         int                 `gorm:"not null"`
+	QuantityAfter int                 `gorm:"not null"`
+	Reason        StockMovementReason `gorm:"not null"`
+	ActorID       *uint
+	TransactionID *uint `gorm:"index"`
+	Note          string
+	CreatedAt     time.Time
+}
+
+func (d *KermesseDao) GetStockMovements(ctx context.Context, standID uint) ([]StockMovement, error) {
+	var movements []StockMovement
+	err := d.db.WithContext(ctx).Where("stand_id = ?", standID).Order("id").Find(&movements).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stock movements: %w", err)
+	}
+
+	return movements, nil
+}
+
+// GetTransactionStockMovements returns the stock movements a transaction
+// made, e.g. the items sold by a spend.
+func (d *KermesseDao) GetTransactionStockMovements(ctx context.Context, transactionID uint) ([]StockMovement, error) {
+	var movements []StockMovement
+	err := d.db.WithContext(ctx).Where("transaction_id = ?", transactionID).Order("id").Find(&movements).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stock movements: %w", err)
+	}
+
+	return movements, nil
+}
+
+// UpdateStock updates stock, its quantity included, and journals the change
+// of quantity as movement, which gives the reason, actor and note.
+func (d *KermesseDao) UpdateStock(ctx context.Context, stock Stock, movement StockMovement) (Stock, error) {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current Stock
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND stand_id = ? AND archived_at IS NULL", stock.ID, stock.StandID).
+			First(&current).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrStockNotFound
+			}
+			return fmt.Errorf("failed to find stock: %w", err)
+		}
+
+		// Reservations and archiving move on their own.
+		stock.Reserved = current.Reserved
+		if err := tx.Omit("Reserved", "ArchivedAt").Save(&stock).Error; err != nil {
+			return fmt.Errorf("failed to update stock: %w", err)
+		}
+
+		if stock.Quantity == current.Quantity {
+			return nil
+		}
+		movement.StandID = stock.StandID
+		movement.StockID = stock.ID
+		movement.Delta = stock.Quantity - current.Quantity
+		movement.QuantityAfter = stock.Quantity
+
+		return journalStock(tx, []StockMovement{movement}, nil)
+	})
+	if err != nil {
+		return Stock{}, err
+	}
+
+	return stock, nil
+}
+
+// moveStock changes the quantity of the stock item of movement by its delta,
+// along with updates, if the row matches conds. It returns movement as it
+// is to be journaled, or false if the row didn't match.
+func moveStock(tx *gorm.DB, movement StockMovement, updates map[string]interface{}, conds ...interface{}) (StockMovement, bool, error) {
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["quantity"] = gorm.Expr("quantity + ?", movement.Delta)
+
+	var moved []Stock
+	query := tx.Model(&moved).Clauses(clause.Returning{}).
+		Where("id = ? AND stand_id = ?", movement.StockID, movement.StandID)
+	if len(conds) > 0 {
+		query = query.Where(conds[0], conds[1:]...)
+	}
+	if err := query.Updates(updates).Error; err != nil {
+		return StockMovement{}, false, fmt.Errorf("failed to move stock: %w", err)
+	}
+	if len(moved) == 0 {
+		return StockMovement{}, false, nil
+	}
+	movement.QuantityAfter = moved[0].Quantity
+
+	return movement, true, nil
+}
+
+// initialStock returns the restocks that bring new stock to its quantity.
+func initialStock(stock []Stock, actorID uint) []StockMovement {
+	movements := make([]StockMovement, 0, len(stock))
+	for _, item := range stock {
+		if item.Quantity == 0 {
+			continue
+		}
+		movements = append(movements, StockMovement{
+			StandID:       item.StandID,
+			StockID:       item.ID,
+			Delta:         item.Quantity,
+			QuantityAfter: item.Quantity,
+			Reason:        StockRestock,
+			ActorID:       &actorID,
+		})
+	}
+
+	return movements
+}
+
+// journalStock records movements, made for the transaction if any.
+func journalStock(tx *gorm.DB, movements []StockMovement, transactionID *uint) error {
+	if len(movements) == 0 {
+		return nil
+	}
+
+	for i := range movements {
+		movements[i].TransactionID = transactionID
+	}
+	if err := tx.Create(&movements).Error; err != nil {
+		return fmt.Errorf("failed to journal stock movements: %w", err)
+	}
+
+	return nil
+}
@@ -7,24 +7,37 @@ import (
 type TokenTransactionType string
 
 const (
-	TokenPurchase     TokenTransactionType = "Purchase"
-	TokenDistribution TokenTransactionType = "Distribution"
-	TokenSpend        TokenTransactionType = "Spend"
+	TokenPurchase       TokenTransactionType = "Purchase"
+	TokenDistribution   TokenTransactionType = "Distribution"
+	TokenSpend          TokenTransactionType = "Spend"
+	TokenOpeningBalance TokenTransactionType = "OpeningBalance"
+	TokenReversal       TokenTransactionType = "Reversal"
+	TokenRefund         TokenTransactionType = "Refund"
 )
 
 type TokenTransaction struct {
-	ID         uint                 `gorm:"primaryKey"`
-	KermesseID uint                 `gorm:"not null"`
-	FromID     uint                 `gorm:"not null"`
-	FromType   string               `gorm:"not null"`
-	ToID       uint                 `gorm:"not null"`
-	ToType     string               `gorm:"not null"`
-	Amount     int                  `gorm:"not null"`
-	Type       TokenTransactionType `gorm:"not null"`
-	StandID    *uint
-	Status     string `gorm:"not null"`
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	ID                    uint                 `gorm:"primaryKey"`
+	KermesseID            uint                 `gorm:"not null"`
+	FromID                uint                 `gorm:"not null"`
+	FromType              string               `gorm:"not null"`
+	ToID                  uint                 `gorm:"not null"`
+	ToType                string               `gorm:"not null"`
+	Amount                int                  `gorm:"not null"`
+	Type                  TokenTransactionType `gorm:"not null"`
+	StandID               *uint
+	Status                string `gorm:"not null"`
+	PaymentReference      string `gorm:"index"`
+	PaymentMethod         string
+	MoneyAmount           int64
+	Currency              string
+	RejectionReason       string
+	StockID               *uint
+	Quantity              int   `gorm:"not null;default:0"`
+	RefundedQuantity      int   `gorm:"not null;default:0"`
+	ReversedTransactionID *uint `gorm:"index"`
+	PromotionID           *uint
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
 }
 
 func (TokenTransaction) TableName() string {
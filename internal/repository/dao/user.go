@@ -17,6 +17,7 @@ var (
 	ErrUserEmailExists = errors.New("user already exists")
 	ErrUserNotFound    = errors.New("user not found")
 	ErrStudentNotFound = errors.New("student not found")
+	ErrBadgeIDTaken    = errors.New("badge ID already assigned to another student")
 )
 
 type User struct {
@@ -33,22 +34,27 @@ type Student struct {
 	UserID   uint `gorm:"primaryKey"`
 	User     User `gorm:"foreignKey:UserID"`
 	Points   int  `json:"points" default:"0"`
-	Tokens   int  `json:"tokens" default:"0"`
 	ParentID uint `json:"parent_id" default:"null"`
 	IsActive bool `json:"is_active" default:"false"`
+	// ShortCode and BadgeID identify the student at the point of sale of a
+	// stand.
+	ShortCode *string `json:"short_code" gorm:"uniqueIndex"`
+	BadgeID   *string `json:"badge_id" gorm:"uniqueIndex"`
+	// AutoApproveLimit is the largest charge, in tokens, that goes through
+	// without the student or their parent confirming it.
+	AutoApproveLimit int `json:"auto_approve_limit" gorm:"not null;default:0"`
 }
 
 type Parent struct {
 	UserID uint `gorm:"primaryKey"`
 	User   User `gorm:"foreignKey:UserID"`
-	Tokens int  `gorm:"not null" default:"0"`
 }
 
+// StandHolder is a user who can work at stands. The stands they work at are
+// in StandStaff.
 type StandHolder struct {
-	UserID  uint `gorm:"primaryKey"`
-	User    User `gorm:"foreignKey:UserID"`
-	StandID uint
-	Stand   Stand `gorm:"foreignKey:StandID"`
+	UserID uint `gorm:"primaryKey"`
+	User   User `gorm:"foreignKey:UserID"`
 }
 
 type Organizer struct {
@@ -105,6 +111,14 @@ func (d *UserDAO) InsertStudent(ctx context.Context, user User, student Student)
 
 	// Set the UserID for the student
 	student.UserID = user.ID
+	if student.ShortCode == nil {
+		code, err := newStudentCode()
+		if err != nil {
+			tx.Rollback()
+			return Student{}, err
+		}
+		student.ShortCode = &code
+	}
 
 	// Now insert the Student
 	if err := tx.Create(&student).Error; err != nil {
@@ -128,8 +142,6 @@ func (d *UserDAO) InsertStudent(ctx context.Context, user User, student Student)
 
 func (d *UserDAO) UpdateStudent(ctx context.Context, user User, student Student) (Student, error) {
 	tx := d.db.WithContext(ctx).Begin()
-
-	fmt.Printf("Student here: ", student.UserID)
 	if tx.Error != nil {
 		return Student{}, tx.Error
 	}
@@ -225,12 +237,10 @@ func (d *UserDAO) InsertParent(ctx context.Context, user User, parent Parent) (P
 		return Parent{}, err
 	}
 
-	fmt.Printf("completedParent UserId: ", completeParent.UserID)
-
 	return completeParent, nil
 }
 
-func (d *UserDAO) InsertStandHolder(ctx context.Context, user User, stand Stand, standHolder StandHolder) (StandHolder, error) {
+func (d *UserDAO) InsertStandHolder(ctx context.Context, user User, standHolder StandHolder) (StandHolder, error) {
 	tx := d.db.WithContext(ctx).Begin()
 	if tx.Error != nil {
 		return StandHolder{}, tx.Error
@@ -245,14 +255,6 @@ func (d *UserDAO) InsertStandHolder(ctx context.Context, user User, stand Stand,
 	// Set the UserID for the stand holder
 	standHolder.UserID = user.ID
 
-	if err := tx.Create(&stand).Error; err != nil {
-		tx.Rollback()
-		return StandHolder{}, err
-	}
-
-	// Set the StandID for the stand holder
-	standHolder.StandID = stand.ID
-
 	// Now insert the Stand Holder
 	if err := tx.Create(&standHolder).Error; err != nil {
 		tx.Rollback()
@@ -268,7 +270,6 @@ func (d *UserDAO) InsertStandHolder(ctx context.Context, user User, stand Stand,
 	var completeStandHolder StandHolder
 	if err := d.db.WithContext(ctx).
 		Preload("User").
-		Preload("Stand").
 		First(&completeStandHolder, standHolder.UserID).Error; err != nil {
 		return StandHolder{}, err
 	}
@@ -484,7 +485,6 @@ func (d *UserDAO) FindStandHolderByUserID(ctx context.Context, id uint) (StandHo
 	result := d.db.WithContext(ctx).
 		Where("user_id = ?", id).
 		Preload("User").
-		Preload("Stand").
 		First(&standHolder)
 
 	if result.Error != nil {
@@ -496,3 +496,21 @@ func (d *UserDAO) FindStandHolderByUserID(ctx context.Context, id uint) (StandHo
 
 	return standHolder, nil
 }
+
+func (d *UserDAO) FindAccountBalance(ctx context.Context, accountType string, ownerID, kermesseID uint) (int, error) {
+	return findLedgerBalance(d.db.WithContext(ctx), accountType, ownerID, kermesseID)
+}
+
+// FindWallets returns the accounts of type held by ownerID, one per kermesse.
+func (d *UserDAO) FindWallets(ctx context.Context, accountType string, ownerID uint) ([]LedgerAccount, error) {
+	var accounts []LedgerAccount
+	err := d.db.WithContext(ctx).
+		Where("type = ? AND owner_id = ?", accountType, ownerID).
+		Order("kermesse_id").
+		Find(&accounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find wallets: %w", err)
+	}
+
+	return accounts, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+// FindTokenTransactions returns a page of the transactions of scope matching
+// filter.
+func (r *KermesseRepository) FindTokenTransactions(ctx context.Context, scope domain.TransactionScope, filter domain.TransactionFilter) (domain.TransactionPage, error) {
+	page := domain.TransactionPage{Transactions: []domain.TokenTransaction{}}
+	if scope.IsEmpty() {
+		return page, nil
+	}
+
+	q := dao.TransactionQuery{
+		KermesseIDs: scope.KermesseIDs,
+		KermesseID:  filter.KermesseID,
+		Statuses:    filter.Statuses,
+		StandID:     filter.StandID,
+		From:        filter.From,
+		To:          filter.To,
+		Ascending:   filter.Ascending,
+		// One more than asked tells whether there is a next page.
+		Limit: filter.Limit + 1,
+	}
+	for _, party := range scope.Parties {
+		q.Parties = append(q.Parties, dao.TransactionParty{Type: party.Type, IDs: party.IDs})
+	}
+	for _, transactionType := range filter.Types {
+		q.Types = append(q.Types, string(transactionType))
+	}
+	if filter.After != nil {
+		q.AfterCreatedAt = filter.After.CreatedAt
+		q.AfterID = filter.After.ID
+	}
+
+	transactions, err := r.dao.FindTokenTransactions(ctx, q)
+	if err != nil {
+		return domain.TransactionPage{}, fmt.Errorf("r.dao.FindTokenTransactions -> %w", err)
+	}
+
+	if len(transactions) > filter.Limit {
+		transactions = transactions[:filter.Limit]
+		last := transactions[len(transactions)-1]
+		page.NextCursor = domain.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	page.Transactions = r.tokenTransactionsDaoToDomain(transactions)
+
+	return page, nil
+}
+
+// GetChildrenIDs returns the user IDs of the children of a parent.
+func (r *KermesseRepository) GetChildrenIDs(parentID uint) ([]uint, error) {
+	children, err := r.dao.GetChildrenByParentID(parentID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetChildrenByParentID -> %w", err)
+	}
+
+	ids := make([]uint, 0, len(children))
+	for _, child := range children {
+		ids = append(ids, child.UserID)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+var (
+	ErrIdempotencyKeyExists   = dao.ErrIdempotencyKeyExists
+	ErrIdempotencyKeyNotFound = dao.ErrIdempotencyKeyNotFound
+)
+
+type IdempotencyDAO interface {
+	Insert(ctx context.Context, key dao.IdempotencyKey) (dao.IdempotencyKey, error)
+	FindByUserAndKey(ctx context.Context, userID uint, key string) (dao.IdempotencyKey, error)
+	Complete(ctx context.Context, id uint, statusCode int, responseBody []byte) error
+	Delete(ctx context.Context, id uint) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type IdempotencyRepository struct {
+	dao IdempotencyDAO
+}
+
+func NewIdempotencyRepository(dao IdempotencyDAO) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		dao: dao,
+	}
+}
+
+func (r *IdempotencyRepository) daoToDomain(k dao.IdempotencyKey) domain.IdempotencyKey {
+	return domain.IdempotencyKey{
+		ID:           k.ID,
+		UserID:       k.UserID,
+		Key:          k.Key,
+		RequestHash:  k.RequestHash,
+		StatusCode:   k.StatusCode,
+		ResponseBody: k.ResponseBody,
+		CompletedAt:  k.CompletedAt,
+		ExpiresAt:    k.ExpiresAt,
+		CreatedAt:    k.CreatedAt,
+	}
+}
+
+func (r *IdempotencyRepository) Create(ctx context.Context, key domain.IdempotencyKey) (domain.IdempotencyKey, error) {
+	created, err := r.dao.Insert(ctx, dao.IdempotencyKey{
+		UserID:      key.UserID,
+		Key:         key.Key,
+		RequestHash: key.RequestHash,
+		ExpiresAt:   key.ExpiresAt,
+	})
+	if err != nil {
+		return domain.IdempotencyKey{}, fmt.Errorf("r.dao.Insert -> %w", err)
+	}
+
+	return r.daoToDomain(created), nil
+}
+
+func (r *IdempotencyRepository) FindByUserAndKey(ctx context.Context, userID uint, key string) (domain.IdempotencyKey, error) {
+	found, err := r.dao.FindByUserAndKey(ctx, userID, key)
+	if err != nil {
+		return domain.IdempotencyKey{}, fmt.Errorf("r.dao.FindByUserAndKey -> %w", err)
+	}
+
+	return r.daoToDomain(found), nil
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, id uint, statusCode int, responseBody []byte) error {
+	if err := r.dao.Complete(ctx, id, statusCode, responseBody); err != nil {
+		return fmt.Errorf("r.dao.Complete -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *IdempotencyRepository) Delete(ctx context.Context, id uint) error {
+	if err := r.dao.Delete(ctx, id); err != nil {
+		return fmt.Errorf("r.dao.Delete -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	deleted, err := r.dao.DeleteExpired(ctx, now)
+	if err != nil {
+		return 0, fmt.Errorf("r.dao.DeleteExpired -> %w", err)
+	}
+
+	return deleted, nil
+}
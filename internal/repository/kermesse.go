@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
+
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
 	"gorm.io/gorm"
@@ -21,6 +23,23 @@ var (
 	ErrInvalidUserRole          = dao.ErrInvalidUserRole
 	ErrInsufficientStock        = dao.ErrInsufficientStock
 	ErrInvalidTransaction       = dao.ErrInvalidTransaction
+	ErrPurchaseConflict         = dao.ErrPurchaseConflict
+	ErrPaymentEventProcessed    = dao.ErrPaymentEventProcessed
+	ErrKermesseClosed           = dao.ErrKermesseClosed
+	ErrKermesseStatusChanged    = dao.ErrKermesseStatusChanged
+	ErrKermesseVersionConflict  = dao.ErrKermesseVersionConflict
+	ErrStandNotFound            = dao.ErrStandNotFound
+	ErrPaymentRequestUsed       = dao.ErrPaymentRequestUsed
+	ErrAllowanceNotFound        = dao.ErrAllowanceNotFound
+	ErrAllowanceExceeded        = dao.ErrAllowanceExceeded
+	ErrVoucherRedeemed          = dao.ErrVoucherRedeemed
+	ErrPromotionNotFound        = dao.ErrPromotionNotFound
+	ErrReservationNotFound      = dao.ErrReservationNotFound
+	ErrStockNotFound            = dao.ErrStockNotFound
+	ErrStandStaffNotFound       = dao.ErrStandStaffNotFound
+	ErrStandInvitationNotFound  = dao.ErrStandInvitationNotFound
+	ErrStandInvitationUsed      = dao.ErrStandInvitationUsed
+	ErrLastStandManager         = dao.ErrLastStandManager
 )
 
 type KermesseDAO interface {
@@ -33,21 +52,73 @@ type KermesseDAO interface {
 	CreateTokenTransaction(transaction dao.TokenTransaction) (dao.TokenTransaction, error)
 	GetTokenTransactionByID(transactionID uint) (dao.TokenTransaction, error)
 	IsUserKermesseOrganizer(kermesseID uint, userID uint) (bool, error)
-	IncrementParentTokens(transactionFromID uint, transactionAmount int) error
 	IncrementKermesseTokensSold(kermesseID uint, transactionAmount int) error
 	UpdateTokenTransaction(transactionDAO dao.TokenTransaction) (dao.TokenTransaction, error)
-	UpdateTokenBalances(parentUserID, studentUserID uint, amount int) error
+	CreatePostedTokenTransaction(ctx context.Context, transaction dao.TokenTransaction, debit, credit dao.LedgerAccountKey) (dao.TokenTransaction, error)
+	PostTokenTransaction(ctx context.Context, transaction dao.TokenTransaction, debit, credit dao.LedgerAccountKey) (dao.TokenTransaction, error)
+	GetLedgerAccount(ctx context.Context, key dao.LedgerAccountKey) (dao.LedgerAccount, error)
+	GetLedgerEntries(ctx context.Context, transactionID uint) ([]dao.LedgerEntry, error)
+	AuditLedger(ctx context.Context, kermesseID uint) (dao.LedgerAudit, error)
+	RefundPurchase(ctx context.Context, spend, refund dao.TokenTransaction, debit, credit dao.LedgerAccountKey, trackStock bool, actorID uint) (dao.TokenTransaction, error)
+	SetKermesseStatus(ctx context.Context, kermesseID uint, from, to string) (dao.Kermesse, error)
+	UpdateKermesseDetails(ctx context.Context, kermesse dao.Kermesse) (dao.Kermesse, error)
+	GetKermesseWallets(ctx context.Context, kermesseID uint) ([]dao.LedgerAccount, error)
+	GetRefundablePurchases(ctx context.Context, kermesseID, parentID uint) ([]dao.TokenTransaction, error)
+	GetRefunds(ctx context.Context, kermesseID uint) ([]dao.TokenTransaction, error)
+	CreateRefund(ctx context.Context, purchase, refund dao.TokenTransaction, debit, credit dao.LedgerAccountKey) (dao.TokenTransaction, error)
+	CompleteRefund(ctx context.Context, refundID uint, reference string) error
+	FailRefund(ctx context.Context, refundID uint, reason string) error
+	FindTokenTransactions(ctx context.Context, q dao.TransactionQuery) ([]dao.TokenTransaction, error)
+	Checkout(ctx context.Context, order dao.Order, transaction dao.TokenTransaction, debit, credit dao.LedgerAccountKey, trackStock bool) (dao.Order, error)
+	PayPaymentRequest(ctx context.Context, request dao.StandPaymentRequest, order dao.Order, transaction dao.TokenTransaction, debit, credit dao.LedgerAccountKey, trackStock bool) (dao.Order, error)
+	CreateOfflineAllowance(ctx context.Context, allowance dao.OfflineAllowance) (dao.OfflineAllowance, error)
+	GetOfflineAllowance(ctx context.Context, id uint) (dao.OfflineAllowance, error)
+	IsOfflineVoucherRedeemed(ctx context.Context, allowanceID, sequence uint) (bool, error)
+	RedeemOfflineVoucher(ctx context.Context, voucher dao.OfflineVoucher, order dao.Order, transaction dao.TokenTransaction, debit, credit dao.LedgerAccountKey, trackStock bool) (dao.Order, error)
+	CreatePromotion(ctx context.Context, promotion dao.Promotion) (dao.Promotion, error)
+	GetPromotions(ctx context.Context, standID uint, activeOnly bool) ([]dao.Promotion, error)
+	DeactivatePromotion(ctx context.Context, standID, promotionID uint) error
+	ReserveStock(ctx context.Context, reservations []dao.StockReservation) ([]dao.StockReservation, error)
+	GetHeldReservations(ctx context.Context, userID, standID uint) ([]dao.StockReservation, error)
+	ReleaseReservation(ctx context.Context, kermesseID, reservationID, userID uint) (dao.StockReservation, error)
+	ReleaseExpiredReservations(ctx context.Context, now time.Time) (int, error)
+	CreateCharge(ctx context.Context, order dao.Order, transaction dao.TokenTransaction) (dao.Order, error)
+	ConfirmCharge(ctx context.Context, order dao.Order, debit, credit dao.LedgerAccountKey, trackStock bool) (dao.TokenTransaction, error)
+	RejectPendingTransaction(ctx context.Context, transactionID uint) (dao.TokenTransaction, error)
+	GetOrderByTransactionID(ctx context.Context, transactionID uint) (dao.Order, error)
+	GetTokenTransactionByPaymentReference(ctx context.Context, reference string) (dao.TokenTransaction, error)
+	AttachPayment(ctx context.Context, transactionID uint, reference string) error
+	GetPendingTokenPurchases(ctx context.Context, kermesseID uint, method string) ([]dao.TokenTransaction, error)
+	SettleTokenPurchase(ctx context.Context, eventID, eventType string, transaction dao.TokenTransaction, debit, credit dao.LedgerAccountKey) (bool, error)
 	GetStandByID(standID uint) (dao.Stand, error)
 	GetStockItem(standID uint, stockID uint) (dao.Stock, error)
 	UpdateStand(ctx context.Context, stand dao.Stand) (dao.Stand, error)
-	UpdateStock(ctx context.Context, stock dao.Stock) (dao.Stock, error)
-	CreateStock(ctx context.Context, stockDAO dao.Stock) (dao.Stock, error)
+	UpdateStock(ctx context.Context, stock dao.Stock, movement dao.StockMovement) (dao.Stock, error)
+	CreateStock(ctx context.Context, stockDAO dao.Stock, actorID uint) (dao.Stock, error)
+	GetStockMovements(ctx context.Context, standID uint) ([]dao.StockMovement, error)
+	GetTransactionStockMovements(ctx context.Context, transactionID uint) ([]dao.StockMovement, error)
+	GetStandAlertRecipients(ctx context.Context, kermesseID, standID uint) ([]uint, error)
+	PostStandAlert(ctx context.Context, message dao.ChatMessage, notifications []dao.Notification) error
+	GetKermesseAudience(ctx context.Context, kermesseID uint) ([]uint, error)
+	CreateNotifications(ctx context.Context, notifications []dao.Notification) error
+	GetNotifications(ctx context.Context, userID uint, limit int) ([]dao.Notification, error)
+	UpdateStandDetails(ctx context.Context, stand dao.Stand) (dao.Stand, error)
+	ArchiveStand(ctx context.Context, standID uint) error
+	UpdateStockDetails(ctx context.Context, stock dao.Stock) (dao.Stock, error)
+	ArchiveStock(ctx context.Context, standID, stockID uint) error
 	GetChildrenByParentID(parentID uint) ([]dao.Student, error)
 	GetChildrenTransactions(childrenIDs []uint) ([]dao.TokenTransaction, error)
 	GetStockByID(ctx context.Context, stockID uint) (dao.Stock, error)
 	GetStandsByKermesseID(kermesseID uint) ([]dao.Stand, error)
 	SaveChatMessage(message dao.ChatMessage) (dao.ChatMessage, error)
 	IsUserStandHolder(standID, userID uint) (bool, error)
+	GetStandStaffMember(ctx context.Context, standID, userID uint) (dao.StandStaffMember, error)
+	GetStandStaff(ctx context.Context, standID uint) ([]dao.StandStaffMember, error)
+	RemoveStandStaff(ctx context.Context, standID, userID uint) error
+	CreateStandInvitation(ctx context.Context, invitation dao.StandInvitation) (dao.StandInvitation, error)
+	DeleteStandInvitation(ctx context.Context, invitationID uint) error
+	GetStandInvitationByCode(ctx context.Context, code string) (dao.StandInvitationWithStand, error)
+	AcceptStandInvitation(ctx context.Context, invitation dao.StandInvitation, userID uint) (dao.StandStaffMember, error)
 	GetChatMessages(kermesseID, standID uint, limit, offset int) ([]dao.ChatMessage, error)
 	AttributePointsToStudent(ctx context.Context, studentID uint, points int) (dao.PointAttributionResult, error)
 	IncrementStandPointsGiven(ctx context.Context, standID uint, points int) error
@@ -73,6 +144,15 @@ func (r *KermesseRepository) domainToDao(k domain.Kermesse) dao.Kermesse {
 		Location:    k.Location,
 		Description: k.Description,
 		TokensSold:  k.TokensSold,
+		Currency:    k.Currency,
+		TokenPrice:  k.TokenPrice,
+		TokenPacks:  r.tokenPacksDomainToDao(k.TokenPacks),
+		Status:      string(k.Status),
+		ClosedAt:    k.ClosedAt,
+		Version:     k.Version,
+		StartsAt:    k.StartsAt,
+		EndsAt:      k.EndsAt,
+		TimeZone:    k.TimeZone,
 		CreatedAt:   k.CreatedAt,
 		UpdatedAt:   k.UpdatedAt,
 	}
@@ -86,9 +166,34 @@ func (r *KermesseRepository) daoToDomain(k dao.Kermesse) domain.Kermesse {
 		Location:    k.Location,
 		Description: k.Description,
 		TokensSold:  k.TokensSold,
+		Currency:    k.Currency,
+		TokenPrice:  k.TokenPrice,
+		TokenPacks:  r.tokenPacksDaoToDomain(k.TokenPacks),
+		Status:      domain.KermesseStatus(k.Status),
+		ClosedAt:    k.ClosedAt,
+		Version:     k.Version,
+		StartsAt:    k.StartsAt,
+		EndsAt:      k.EndsAt,
+		TimeZone:    k.TimeZone,
 		CreatedAt:   k.CreatedAt,
 		UpdatedAt:   k.UpdatedAt,
+	}.InLocation()
+}
+
+func (r *KermesseRepository) tokenPacksDomainToDao(packs []domain.TokenPack) []dao.TokenPack {
+	daoPacks := make([]dao.TokenPack, len(packs))
+	for i, pack := range packs {
+		daoPacks[i] = dao.TokenPack{ID: pack.ID, Tokens: pack.Tokens, Price: pack.Price}
 	}
+	return daoPacks
+}
+
+func (r *KermesseRepository) tokenPacksDaoToDomain(packs []dao.TokenPack) []domain.TokenPack {
+	domainPacks := make([]domain.TokenPack, len(packs))
+	for i, pack := range packs {
+		domainPacks[i] = domain.TokenPack{ID: pack.ID, Tokens: pack.Tokens, Price: pack.Price}
+	}
+	return domainPacks
 }
 
 func (r *KermesseRepository) daoToDomainKermesse(daoKermesse []dao.Kermesse) []domain.Kermesse {
@@ -101,12 +206,21 @@ func (r *KermesseRepository) daoToDomainKermesse(daoKermesse []dao.Kermesse) []d
 			Location:     k.Location,
 			Description:  k.Description,
 			TokensSold:   k.TokensSold,
+			Currency:     k.Currency,
+			TokenPrice:   k.TokenPrice,
+			TokenPacks:   r.tokenPacksDaoToDomain(k.TokenPacks),
+			Status:       domain.KermesseStatus(k.Status),
+			ClosedAt:     k.ClosedAt,
+			Version:      k.Version,
+			StartsAt:     k.StartsAt,
+			EndsAt:       k.EndsAt,
+			TimeZone:     k.TimeZone,
 			CreatedAt:    k.CreatedAt,
 			UpdatedAt:    k.UpdatedAt,
 			Stands:       r.standsDaoToDomain(k.Stands),
 			Organizers:   r.uRepo.organizersDaoToDomain(k.Organizers),
 			Participants: r.uRepo.daosToDomain(k.Participants),
-		})
+		}.InLocation())
 	}
 	return kermesses
 }
@@ -138,6 +252,9 @@ func (r *KermesseRepository) standDomainToDao(stand domain.Stand) dao.Stand {
 		PointsGiven: stand.PointsGiven,
 		CreatedAt:   stand.CreatedAt,
 		UpdatedAt:   stand.UpdatedAt,
+		ArchivedAt:  stand.ArchivedAt,
+		OpensAt:     stand.OpensAt,
+		ClosesAt:    stand.ClosesAt,
 	}
 }
 
@@ -145,11 +262,12 @@ func (r *KermesseRepository) stockDomainToDao(stocks []domain.Stock) []dao.Stock
 	daoStocks := make([]dao.Stock, len(stocks))
 	for i, stock := range stocks {
 		daoStocks[i] = dao.Stock{
-			ID:        stock.ID,
-			StandID:   stock.StandID,
-			ItemName:  stock.ItemName,
-			Quantity:  stock.Quantity,
-			TokenCost: stock.TokenCost,
+			ID:                stock.ID,
+			StandID:           stock.StandID,
+			ItemName:          stock.ItemName,
+			Quantity:          stock.Quantity,
+			TokenCost:         stock.TokenCost,
+			LowStockThreshold: stock.LowStockThreshold,
 		}
 	}
 	return daoStocks
@@ -157,11 +275,14 @@ func (r *KermesseRepository) stockDomainToDao(stocks []domain.Stock) []dao.Stock
 
 func (r *KermesseRepository) domainToDaoStock(stock domain.Stock) dao.Stock {
 	return dao.Stock{
-		ID:        stock.ID,
-		StandID:   stock.StandID,
-		ItemName:  stock.ItemName,
-		Quantity:  stock.Quantity,
-		TokenCost: stock.TokenCost,
+		ID:                stock.ID,
+		StandID:           stock.StandID,
+		ItemName:          stock.ItemName,
+		Quantity:          stock.Quantity,
+		TokenCost:         stock.TokenCost,
+		Reserved:          stock.Reserved,
+		LowStockThreshold: stock.LowStockThreshold,
+		ArchivedAt:        stock.ArchivedAt,
 	}
 }
 
@@ -203,6 +324,9 @@ func (r *KermesseRepository) standDaoToDomain(stand dao.Stand) domain.Stand {
 	if !stand.UpdatedAt.IsZero() {
 		domainStand.UpdatedAt = stand.UpdatedAt
 	}
+	domainStand.ArchivedAt = stand.ArchivedAt
+	domainStand.OpensAt = stand.OpensAt
+	domainStand.ClosesAt = stand.ClosesAt
 
 	if len(stand.Stock) > 0 {
 		domainStand.Stock = make([]domain.Stock, 0, len(stand.Stock))
@@ -243,40 +367,70 @@ func (r *KermesseRepository) daoToDomainStock(stock dao.Stock) domain.Stock {
 		domainStock.TokenCost = stock.TokenCost
 	}
 
+	if stock.Reserved != 0 {
+		domainStock.Reserved = stock.Reserved
+	}
+
+	if stock.LowStockThreshold != 0 {
+		domainStock.LowStockThreshold = stock.LowStockThreshold
+	}
+	domainStock.ArchivedAt = stock.ArchivedAt
+	domainStock.Available = domainStock.AvailableQuantity()
+
 	return domainStock
 }
 
 func (r *KermesseRepository) domainToDAOTokenTransaction(dt domain.TokenTransaction) dao.TokenTransaction {
 	return dao.TokenTransaction{
-		ID:         dt.ID,
-		KermesseID: dt.KermesseID,
-		FromID:     dt.FromID,
-		FromType:   dt.FromType,
-		ToID:       dt.ToID,
-		ToType:     dt.ToType,
-		Amount:     dt.Amount,
-		Type:       dao.TokenTransactionType(dt.Type),
-		StandID:    dt.StandID,
-		Status:     dt.Status,
-		CreatedAt:  dt.CreatedAt,
-		UpdatedAt:  dt.UpdatedAt,
+		ID:                    dt.ID,
+		KermesseID:            dt.KermesseID,
+		FromID:                dt.FromID,
+		FromType:              dt.FromType,
+		ToID:                  dt.ToID,
+		ToType:                dt.ToType,
+		Amount:                dt.Amount,
+		Type:                  dao.TokenTransactionType(dt.Type),
+		StandID:               dt.StandID,
+		Status:                dt.Status,
+		PaymentReference:      dt.PaymentReference,
+		PaymentMethod:         string(dt.PaymentMethod),
+		MoneyAmount:           dt.MoneyAmount,
+		Currency:              dt.Currency,
+		StockID:               dt.StockID,
+		Quantity:              dt.Quantity,
+		RefundedQuantity:      dt.RefundedQuantity,
+		ReversedTransactionID: dt.ReversedTransactionID,
+		PromotionID:           dt.PromotionID,
+		RejectionReason:       dt.RejectionReason,
+		CreatedAt:             dt.CreatedAt,
+		UpdatedAt:             dt.UpdatedAt,
 	}
 }
 
 func (r *KermesseRepository) daoToDomainTokenTransaction(dt dao.TokenTransaction) domain.TokenTransaction {
 	return domain.TokenTransaction{
-		ID:         dt.ID,
-		KermesseID: dt.KermesseID,
-		FromID:     dt.FromID,
-		FromType:   dt.FromType,
-		ToID:       dt.ToID,
-		ToType:     dt.ToType,
-		Amount:     dt.Amount,
-		Type:       domain.TokenTransactionType(dt.Type),
-		StandID:    dt.StandID,
-		Status:     dt.Status,
-		CreatedAt:  dt.CreatedAt,
-		UpdatedAt:  dt.UpdatedAt,
+		ID:                    dt.ID,
+		KermesseID:            dt.KermesseID,
+		FromID:                dt.FromID,
+		FromType:              dt.FromType,
+		ToID:                  dt.ToID,
+		ToType:                dt.ToType,
+		Amount:                dt.Amount,
+		Type:                  domain.TokenTransactionType(dt.Type),
+		StandID:               dt.StandID,
+		Status:                dt.Status,
+		PaymentReference:      dt.PaymentReference,
+		PaymentMethod:         domain.PaymentMethod(dt.PaymentMethod),
+		MoneyAmount:           dt.MoneyAmount,
+		Currency:              dt.Currency,
+		StockID:               dt.StockID,
+		Quantity:              dt.Quantity,
+		RefundedQuantity:      dt.RefundedQuantity,
+		ReversedTransactionID: dt.ReversedTransactionID,
+		PromotionID:           dt.PromotionID,
+		RejectionReason:       dt.RejectionReason,
+		CreatedAt:             dt.CreatedAt,
+		UpdatedAt:             dt.UpdatedAt,
 	}
 }
 
@@ -397,10 +551,6 @@ func (r *KermesseRepository) GetChatMessages(kermesseID, standID uint, limit, of
 	return messages, nil
 }
 
-func (r *KermesseRepository) IsUserStandHolder(standID, userID uint) (bool, error) {
-	return r.dao.IsUserStandHolder(standID, userID)
-}
-
 func (r *KermesseRepository) chatMessageDomainToDAO(message domain.ChatMessage) dao.ChatMessage {
 	return dao.ChatMessage{
 		ID:         message.ID,
@@ -425,10 +575,6 @@ func (r *KermesseRepository) chatMessageDAOToDomain(message dao.ChatMessage) dom
 	}
 }
 
-func (r *KermesseRepository) IncrementParentTokens(transactionFromID uint, transactionAmount int) error {
-	return r.dao.IncrementParentTokens(transactionFromID, transactionAmount)
-}
-
 func (r *KermesseRepository) IncrementKermesseTokensSold(transactionFromID uint, transactionAmount int) error {
 	return r.dao.IncrementKermesseTokensSold(transactionFromID, transactionAmount)
 }
@@ -442,14 +588,6 @@ func (r *KermesseRepository) UpdateTokenTransaction(transaction domain.TokenTran
 	return r.daoToDomainTokenTransaction(updatedTransactionDAO), nil
 }
 
-func (r *KermesseRepository) UpdateTokenBalances(parentUserID, studentUserID uint, amount int) error {
-	err := r.dao.UpdateTokenBalances(parentUserID, studentUserID, amount)
-	if err != nil {
-		return fmt.Errorf("r.dao.UpdateTokenBalances -> %w", err)
-	}
-	return nil
-}
-
 func (r *KermesseRepository) GetStandByID(standID uint) (domain.Stand, error) {
 	stand, err := r.dao.GetStandByID(standID)
 	if err != nil {
@@ -466,18 +604,20 @@ func (r *KermesseRepository) GetStockByID(ctx context.Context, stockID uint) (do
 	return r.daoToDomainStock(stock), nil
 }
 
-func (r *KermesseRepository) UpdateStock(ctx context.Context, updatedStock domain.Stock) (domain.Stock, error) {
+// UpdateStock updates a stock item, journaling the change of its quantity
+// as movement.
+func (r *KermesseRepository) UpdateStock(ctx context.Context, updatedStock domain.Stock, movement domain.StockMovement) (domain.Stock, error) {
 	stockDAO := r.domainToDaoStock(updatedStock)
-	updatedStockDAO, err := r.dao.UpdateStock(ctx, stockDAO)
+	updatedStockDAO, err := r.dao.UpdateStock(ctx, stockDAO, stockMovementDomainToDAO(movement))
 	if err != nil {
 		return domain.Stock{}, fmt.Errorf("r.dao.UpdateStock -> %w", err)
 	}
 	return r.daoToDomainStock(updatedStockDAO), nil
 }
 
-func (r *KermesseRepository) CreateStock(ctx context.Context, stock domain.Stock) (domain.Stock, error) {
+func (r *KermesseRepository) CreateStock(ctx context.Context, stock domain.Stock, actorID uint) (domain.Stock, error) {
 	stockDAO := r.domainToDaoStock(stock)
-	createdStock, err := r.dao.CreateStock(ctx, stockDAO)
+	createdStock, err := r.dao.CreateStock(ctx, stockDAO, actorID)
 	if err != nil {
 		return domain.Stock{}, fmt.Errorf("r.dao.CreateStock -> %w", err)
 	}
@@ -526,7 +666,9 @@ func (r *KermesseRepository) UpdateStandTokensSpent(ctx context.Context, standID
 	return nil
 }
 
-func (r *KermesseRepository) UpdateStockQuantity(ctx context.Context, standID uint, stockID uint, quantityChange int) error {
+// UpdateStockQuantity adjusts the quantity of a stock item by quantityChange,
+// journaled as an adjustment by actorID.
+func (r *KermesseRepository) UpdateStockQuantity(ctx context.Context, standID uint, stockID uint, quantityChange int, actorID uint) error {
 	stock, err := r.GetStockItem(standID, stockID)
 	if err != nil {
 		return fmt.Errorf("r.GetStockItem -> %w", err)
@@ -537,9 +679,7 @@ func (r *KermesseRepository) UpdateStockQuantity(ctx context.Context, standID ui
 		return ErrInsufficientStock
 	}
 
-	daoStock := r.domainToDaoStock(stock)
-
-	_, err = r.dao.UpdateStock(ctx, daoStock)
+	_, err = r.UpdateStock(ctx, stock, domain.StockMovement{Reason: domain.StockAdjustment, ActorID: &actorID})
 	if err != nil {
 		return fmt.Errorf("r.UpdateStock -> %w", err)
 	}
@@ -547,6 +687,20 @@ func (r *KermesseRepository) UpdateStockQuantity(ctx context.Context, standID ui
 	return nil
 }
 
+func (r *KermesseRepository) RefundPurchase(ctx context.Context, spend, refund domain.TokenTransaction, trackStock bool, actorID uint) (domain.TokenTransaction, error) {
+	debit, credit, err := r.ledgerLegs(refund)
+	if err != nil {
+		return domain.TokenTransaction{}, err
+	}
+
+	created, err := r.dao.RefundPurchase(ctx, r.domainToDAOTokenTransaction(spend), r.domainToDAOTokenTransaction(refund), debit, credit, trackStock, actorID)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("r.dao.RefundPurchase -> %w", err)
+	}
+
+	return r.daoToDomainTokenTransaction(created), nil
+}
+
 func (r *KermesseRepository) GetChildrenTransactions(parentID uint) ([]domain.TokenTransaction, error) {
 	// First, get all children of the parent
 	childrenDAOs, err := r.dao.GetChildrenByParentID(parentID)
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+func (r *KermesseRepository) ledgerKeyDomainToDao(key domain.LedgerAccountKey) dao.LedgerAccountKey {
+	return dao.LedgerAccountKey{
+		Type:           string(key.Type),
+		OwnerID:        key.OwnerID,
+		KermesseID:     key.KermesseID,
+		AllowOverdraft: key.AllowsOverdraft(),
+	}
+}
+
+func (r *KermesseRepository) ledgerAccountDaoToDomain(account dao.LedgerAccount) domain.LedgerAccount {
+	return domain.LedgerAccount{
+		ID:         account.ID,
+		Type:       domain.LedgerAccountType(account.Type),
+		OwnerID:    account.OwnerID,
+		KermesseID: account.KermesseID,
+		Balance:    account.Balance,
+		CreatedAt:  account.CreatedAt,
+		UpdatedAt:  account.UpdatedAt,
+	}
+}
+
+func (r *KermesseRepository) ledgerEntryDaoToDomain(entry dao.LedgerEntry) domain.LedgerEntry {
+	return domain.LedgerEntry{
+		ID:            entry.ID,
+		TransactionID: entry.TransactionID,
+		AccountID:     entry.AccountID,
+		Direction:     domain.LedgerEntryDirection(entry.Direction),
+		Amount:        entry.Amount,
+		CreatedAt:     entry.CreatedAt,
+	}
+}
+
+func (r *KermesseRepository) ledgerLegs(transaction domain.TokenTransaction) (dao.LedgerAccountKey, dao.LedgerAccountKey, error) {
+	debit, credit, err := transaction.LedgerAccounts()
+	if err != nil {
+		return dao.LedgerAccountKey{}, dao.LedgerAccountKey{}, fmt.Errorf("transaction.LedgerAccounts -> %w", err)
+	}
+
+	return r.ledgerKeyDomainToDao(debit), r.ledgerKeyDomainToDao(credit), nil
+}
+
+// CreatePostedTokenTransaction stores a transaction whose tokens move right away,
+// writing its ledger entries in the same database transaction.
+func (r *KermesseRepository) CreatePostedTokenTransaction(ctx context.Context, transaction domain.TokenTransaction) (domain.TokenTransaction, error) {
+	debit, credit, err := r.ledgerLegs(transaction)
+	if err != nil {
+		return domain.TokenTransaction{}, err
+	}
+
+	created, err := r.dao.CreatePostedTokenTransaction(ctx, r.domainToDAOTokenTransaction(transaction), debit, credit)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("r.dao.CreatePostedTokenTransaction -> %w", err)
+	}
+
+	return r.daoToDomainTokenTransaction(created), nil
+}
+
+// PostTokenTransaction saves a previously pending transaction and writes its ledger entries.
+func (r *KermesseRepository) PostTokenTransaction(ctx context.Context, transaction domain.TokenTransaction) (domain.TokenTransaction, error) {
+	debit, credit, err := r.ledgerLegs(transaction)
+	if err != nil {
+		return domain.TokenTransaction{}, err
+	}
+
+	posted, err := r.dao.PostTokenTransaction(ctx, r.domainToDAOTokenTransaction(transaction), debit, credit)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("r.dao.PostTokenTransaction -> %w", err)
+	}
+
+	return r.daoToDomainTokenTransaction(posted), nil
+}
+
+func (r *KermesseRepository) GetLedgerAccount(ctx context.Context, key domain.LedgerAccountKey) (domain.LedgerAccount, error) {
+	account, err := r.dao.GetLedgerAccount(ctx, r.ledgerKeyDomainToDao(key))
+	if err != nil {
+		return domain.LedgerAccount{}, fmt.Errorf("r.dao.GetLedgerAccount -> %w", err)
+	}
+
+	return r.ledgerAccountDaoToDomain(account), nil
+}
+
+func (r *KermesseRepository) GetLedgerEntries(ctx context.Context, transactionID uint) ([]domain.LedgerEntry, error) {
+	entriesDAO, err := r.dao.GetLedgerEntries(ctx, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetLedgerEntries -> %w", err)
+	}
+
+	entries := make([]domain.LedgerEntry, len(entriesDAO))
+	for i, entry := range entriesDAO {
+		entries[i] = r.ledgerEntryDaoToDomain(entry)
+	}
+
+	return entries, nil
+}
+
+func (r *KermesseRepository) AuditLedger(ctx context.Context, kermesseID uint) (domain.LedgerAudit, error) {
+	audit, err := r.dao.AuditLedger(ctx, kermesseID)
+	if err != nil {
+		return domain.LedgerAudit{}, fmt.Errorf("r.dao.AuditLedger -> %w", err)
+	}
+
+	mismatchedAccounts := make([]domain.LedgerAccountMismatch, len(audit.MismatchedAccounts))
+	for i, mismatch := range audit.MismatchedAccounts {
+		mismatchedAccounts[i] = domain.LedgerAccountMismatch{
+			AccountID:     mismatch.AccountID,
+			CachedBalance: mismatch.CachedBalance,
+			LedgerBalance: mismatch.LedgerBalance,
+		}
+	}
+
+	return domain.LedgerAudit{
+		Accounts:               audit.Accounts,
+		Entries:                audit.Entries,
+		UnbalancedTransactions: nonNilIDs(audit.UnbalancedTransactions),
+		MismatchedTransactions: nonNilIDs(audit.MismatchedTransactions),
+		UnpostedTransactions:   nonNilIDs(audit.UnpostedTransactions),
+		MismatchedAccounts:     mismatchedAccounts,
+	}, nil
+}
+
+func nonNilIDs(ids []uint) []uint {
+	if ids == nil {
+		return []uint{}
+	}
+	return ids
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+func (r *KermesseRepository) GetStandAlertRecipients(ctx context.Context, kermesseID, standID uint) ([]uint, error) {
+	userIDs, err := r.dao.GetStandAlertRecipients(ctx, kermesseID, standID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetStandAlertRecipients -> %w", err)
+	}
+
+	return userIDs, nil
+}
+
+func (r *KermesseRepository) PostStandAlert(ctx context.Context, message domain.ChatMessage, notifications []domain.Notification) error {
+	if err := r.dao.PostStandAlert(ctx, r.chatMessageDomainToDAO(message), r.notificationsDomainToDAO(notifications)); err != nil {
+		return fmt.Errorf("r.dao.PostStandAlert -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *KermesseRepository) GetKermesseAudience(ctx context.Context, kermesseID uint) ([]uint, error) {
+	userIDs, err := r.dao.GetKermesseAudience(ctx, kermesseID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetKermesseAudience -> %w", err)
+	}
+
+	return userIDs, nil
+}
+
+func (r *KermesseRepository) CreateNotifications(ctx context.Context, notifications []domain.Notification) error {
+	if err := r.dao.CreateNotifications(ctx, r.notificationsDomainToDAO(notifications)); err != nil {
+		return fmt.Errorf("r.dao.CreateNotifications -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *KermesseRepository) GetNotifications(ctx context.Context, userID uint, limit int) ([]domain.Notification, error) {
+	notifications, err := r.dao.GetNotifications(ctx, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetNotifications -> %w", err)
+	}
+
+	result := make([]domain.Notification, 0, len(notifications))
+	for _, notification := range notifications {
+		result = append(result, domain.Notification{
+			ID:         notification.ID,
+			UserID:     notification.UserID,
+			KermesseID: notification.KermesseID,
+			StandID:    notification.StandID,
+			Type:       domain.NotificationType(notification.Type),
+			Message:    notification.Message,
+			CreatedAt:  notification.CreatedAt,
+		})
+	}
+
+	return result, nil
+}
+
+func (r *KermesseRepository) notificationsDomainToDAO(notifications []domain.Notification) []dao.Notification {
+	daoNotifications := make([]dao.Notification, 0, len(notifications))
+	for _, notification := range notifications {
+		daoNotifications = append(daoNotifications, dao.Notification{
+			UserID:     notification.UserID,
+			KermesseID: notification.KermesseID,
+			StandID:    notification.StandID,
+			Type:       string(notification.Type),
+			Message:    notification.Message,
+		})
+	}
+
+	return daoNotifications
+}
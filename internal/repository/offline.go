@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+func (r *KermesseRepository) CreateOfflineAllowance(ctx context.Context, allowance domain.OfflineAllowance) (domain.OfflineAllowance, error) {
+	created, err := r.dao.CreateOfflineAllowance(ctx, dao.OfflineAllowance{
+		KermesseID: allowance.KermesseID,
+		StudentID:  allowance.StudentID,
+		Limit:      allowance.Limit,
+		ExpiresAt:  allowance.ExpiresAt,
+	})
+	if err != nil {
+		return domain.OfflineAllowance{}, fmt.Errorf("r.dao.CreateOfflineAllowance -> %w", err)
+	}
+
+	return allowanceDaoToDomain(created), nil
+}
+
+func (r *KermesseRepository) GetOfflineAllowance(ctx context.Context, id uint) (domain.OfflineAllowance, error) {
+	allowance, err := r.dao.GetOfflineAllowance(ctx, id)
+	if err != nil {
+		return domain.OfflineAllowance{}, fmt.Errorf("r.dao.GetOfflineAllowance -> %w", err)
+	}
+
+	return allowanceDaoToDomain(allowance), nil
+}
+
+func (r *KermesseRepository) IsOfflineVoucherRedeemed(ctx context.Context, voucher domain.OfflineVoucher) (bool, error) {
+	redeemed, err := r.dao.IsOfflineVoucherRedeemed(ctx, voucher.AllowanceID, voucher.Sequence)
+	if err != nil {
+		return false, fmt.Errorf("r.dao.IsOfflineVoucherRedeemed -> %w", err)
+	}
+
+	return redeemed, nil
+}
+
+// RedeemOfflineVoucher checks order out for voucher and counts it against
+// its allowance, failing with ErrVoucherRedeemed for double spends and
+// ErrAllowanceExceeded past the allowance's limit.
+func (r *KermesseRepository) RedeemOfflineVoucher(ctx context.Context, voucher domain.OfflineVoucher, order domain.Order, trackStock bool) (domain.Order, error) {
+	transaction := order.Spend()
+	debit, credit, err := r.ledgerLegs(transaction)
+	if err != nil {
+		return domain.Order{}, err
+	}
+
+	redeemed := dao.OfflineVoucher{
+		AllowanceID: voucher.AllowanceID,
+		Sequence:    voucher.Sequence,
+		StandID:     voucher.StandID,
+		Amount:      voucher.Amount,
+		SignedAt:    voucher.SignedAt,
+	}
+	created, err := r.dao.RedeemOfflineVoucher(ctx, redeemed, r.orderDomainToDAO(order), r.domainToDAOTokenTransaction(transaction), debit, credit, trackStock)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("r.dao.RedeemOfflineVoucher -> %w", err)
+	}
+
+	return r.orderDaoToDomain(created), nil
+}
+
+func allowanceDaoToDomain(allowance dao.OfflineAllowance) domain.OfflineAllowance {
+	return domain.OfflineAllowance{
+		ID:         allowance.ID,
+		KermesseID: allowance.KermesseID,
+		StudentID:  allowance.StudentID,
+		Limit:      allowance.Limit,
+		Spent:      allowance.Spent,
+		ExpiresAt:  allowance.ExpiresAt,
+		CreatedAt:  allowance.CreatedAt,
+	}
+}
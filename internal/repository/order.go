@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+// Checkout atomically debits the buyer, credits the stand, records the order
+// and, when trackStock is set, takes its items out of the stock.
+func (r *KermesseRepository) Checkout(ctx context.Context, order domain.Order, trackStock bool) (domain.Order, error) {
+	transaction := order.Spend()
+	debit, credit, err := r.ledgerLegs(transaction)
+	if err != nil {
+		return domain.Order{}, err
+	}
+
+	created, err := r.dao.Checkout(ctx, r.orderDomainToDAO(order), r.domainToDAOTokenTransaction(transaction), debit, credit, trackStock)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("r.dao.Checkout -> %w", err)
+	}
+
+	return r.orderDaoToDomain(created), nil
+}
+
+func (r *KermesseRepository) orderDomainToDAO(order domain.Order) dao.Order {
+	lines := make([]dao.OrderLine, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		lines = append(lines, dao.OrderLine{
+			ID:       line.ID,
+			OrderID:  order.ID,
+			StockID:  line.StockID,
+			ItemName: line.ItemName,
+			Quantity: line.Quantity,
+			UnitCost: line.UnitCost,
+			Tokens:   line.Tokens,
+		})
+	}
+
+	return dao.Order{
+		ID:            order.ID,
+		KermesseID:    order.KermesseID,
+		StandID:       order.StandID,
+		BuyerID:       order.BuyerID,
+		BuyerType:     order.BuyerType,
+		TransactionID: order.TransactionID,
+		TotalTokens:   order.TotalTokens,
+		PromotionID:   order.PromotionID,
+		Discount:      order.Discount,
+		Lines:         lines,
+		CreatedAt:     order.CreatedAt,
+	}
+}
+
+func (r *KermesseRepository) orderDaoToDomain(order dao.Order) domain.Order {
+	lines := make([]domain.OrderLine, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		lines = append(lines, domain.OrderLine{
+			ID:       line.ID,
+			StockID:  line.StockID,
+			ItemName: line.ItemName,
+			Quantity: line.Quantity,
+			UnitCost: line.UnitCost,
+			Tokens:   line.Tokens,
+		})
+	}
+
+	return domain.Order{
+		ID:            order.ID,
+		KermesseID:    order.KermesseID,
+		StandID:       order.StandID,
+		BuyerID:       order.BuyerID,
+		BuyerType:     order.BuyerType,
+		TransactionID: order.TransactionID,
+		TotalTokens:   order.TotalTokens,
+		PromotionID:   order.PromotionID,
+		Discount:      order.Discount,
+		Lines:         lines,
+		CreatedAt:     order.CreatedAt,
+	}
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+func (r *KermesseRepository) GetTokenTransactionByPaymentReference(ctx context.Context, reference string) (domain.TokenTransaction, error) {
+	transaction, err := r.dao.GetTokenTransactionByPaymentReference(ctx, reference)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("r.dao.GetTokenTransactionByPaymentReference -> %w", err)
+	}
+
+	return r.daoToDomainTokenTransaction(transaction), nil
+}
+
+func (r *KermesseRepository) AttachPayment(ctx context.Context, transactionID uint, reference string) error {
+	if err := r.dao.AttachPayment(ctx, transactionID, reference); err != nil {
+		return fmt.Errorf("r.dao.AttachPayment -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *KermesseRepository) GetPendingTokenPurchases(ctx context.Context, kermesseID uint, method domain.PaymentMethod) ([]domain.TokenTransaction, error) {
+	transactions, err := r.dao.GetPendingTokenPurchases(ctx, kermesseID, string(method))
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetPendingTokenPurchases -> %w", err)
+	}
+
+	pending := make([]domain.TokenTransaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		pending = append(pending, r.daoToDomainTokenTransaction(transaction))
+	}
+
+	return pending, nil
+}
+
+// SettleTokenPurchase applies the final status of a pending token purchase,
+// recording eventID so that the same provider event is applied only once.
+func (r *KermesseRepository) SettleTokenPurchase(ctx context.Context, eventID, eventType string, transaction domain.TokenTransaction) (bool, error) {
+	debit, credit, err := r.ledgerLegs(transaction)
+	if err != nil {
+		return false, err
+	}
+
+	settled, err := r.dao.SettleTokenPurchase(ctx, eventID, eventType, r.domainToDAOTokenTransaction(transaction), debit, credit)
+	if err != nil {
+		return false, fmt.Errorf("r.dao.SettleTokenPurchase -> %w", err)
+	}
+
+	return settled, nil
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+// PayPaymentRequest checks order out like Checkout and marks request paid,
+// failing with ErrPaymentRequestUsed if it already was.
+func (r *KermesseRepository) PayPaymentRequest(ctx context.Context, request domain.StandPaymentRequest, order domain.Order, trackStock bool) (domain.Order, error) {
+	transaction := order.Spend()
+	debit, credit, err := r.ledgerLegs(transaction)
+	if err != nil {
+		return domain.Order{}, err
+	}
+
+	paid := dao.StandPaymentRequest{
+		ID:         request.ID,
+		KermesseID: request.KermesseID,
+		StandID:    request.StandID,
+		Amount:     request.Amount,
+		ExpiresAt:  request.ExpiresAt,
+	}
+	created, err := r.dao.PayPaymentRequest(ctx, paid, r.orderDomainToDAO(order), r.domainToDAOTokenTransaction(transaction), debit, credit, trackStock)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("r.dao.PayPaymentRequest -> %w", err)
+	}
+
+	return r.orderDaoToDomain(created), nil
+}
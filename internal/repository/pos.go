@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+func (r *UserRepository) FindStudentByCode(ctx context.Context, code string) (domain.Student, error) {
+	student, err := r.dao.FindStudentByCode(ctx, code)
+	if err != nil {
+		return domain.Student{}, fmt.Errorf("r.dao.FindStudentByCode -> %w", err)
+	}
+
+	return r.studentDaoToDomain(student), nil
+}
+
+func (r *UserRepository) UpdateStudentPOSSettings(ctx context.Context, studentID uint, badgeID string, autoApproveLimit int) (domain.Student, error) {
+	student, err := r.dao.UpdateStudentPOSSettings(ctx, studentID, &badgeID, autoApproveLimit)
+	if err != nil {
+		return domain.Student{}, fmt.Errorf("r.dao.UpdateStudentPOSSettings -> %w", err)
+	}
+
+	return r.studentDaoToDomain(student), nil
+}
+
+// CreateCharge records order and its spend, pending until the buyer
+// confirms it.
+func (r *KermesseRepository) CreateCharge(ctx context.Context, order domain.Order) (domain.Charge, error) {
+	transaction := order.Spend()
+	transaction.Status = "Pending"
+
+	created, err := r.dao.CreateCharge(ctx, r.orderDomainToDAO(order), r.domainToDAOTokenTransaction(transaction))
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("r.dao.CreateCharge -> %w", err)
+	}
+
+	return r.GetCharge(ctx, created.TransactionID)
+}
+
+// ConfirmCharge settles the pending charge paid by order's spend, taking its
+// items out of the stock when trackStock is set.
+func (r *KermesseRepository) ConfirmCharge(ctx context.Context, order domain.Order, trackStock bool) (domain.Charge, error) {
+	debit, credit, err := r.ledgerLegs(order.Spend())
+	if err != nil {
+		return domain.Charge{}, err
+	}
+
+	transaction, err := r.dao.ConfirmCharge(ctx, r.orderDomainToDAO(order), debit, credit, trackStock)
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("r.dao.ConfirmCharge -> %w", err)
+	}
+
+	return domain.Charge{Order: order, Transaction: r.daoToDomainTokenTransaction(transaction)}, nil
+}
+
+func (r *KermesseRepository) RejectPendingTransaction(ctx context.Context, transactionID uint) (domain.TokenTransaction, error) {
+	transaction, err := r.dao.RejectPendingTransaction(ctx, transactionID)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("r.dao.RejectPendingTransaction -> %w", err)
+	}
+
+	return r.daoToDomainTokenTransaction(transaction), nil
+}
+
+// GetCharge returns the order paid by the spend transactionID, and the spend.
+func (r *KermesseRepository) GetCharge(ctx context.Context, transactionID uint) (domain.Charge, error) {
+	order, err := r.dao.GetOrderByTransactionID(ctx, transactionID)
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("r.dao.GetOrderByTransactionID -> %w", err)
+	}
+
+	transaction, err := r.dao.GetTokenTransactionByID(transactionID)
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("r.dao.GetTokenTransactionByID -> %w", err)
+	}
+
+	return domain.Charge{Order: r.orderDaoToDomain(order), Transaction: r.daoToDomainTokenTransaction(transaction)}, nil
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
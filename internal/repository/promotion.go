@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+func (r *KermesseRepository) CreatePromotion(ctx context.Context, promotion domain.Promotion) (domain.Promotion, error) {
+	created, err := r.dao.CreatePromotion(ctx, promotionDomainToDAO(promotion))
+	if err != nil {
+		return domain.Promotion{}, fmt.Errorf("r.dao.CreatePromotion -> %w", err)
+	}
+
+	return promotionDaoToDomain(created), nil
+}
+
+func (r *KermesseRepository) GetPromotions(ctx context.Context, standID uint, activeOnly bool) ([]domain.Promotion, error) {
+	promotions, err := r.dao.GetPromotions(ctx, standID, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetPromotions -> %w", err)
+	}
+
+	result := make([]domain.Promotion, 0, len(promotions))
+	for _, promotion := range promotions {
+		result = append(result, promotionDaoToDomain(promotion))
+	}
+
+	return result, nil
+}
+
+func (r *KermesseRepository) DeactivatePromotion(ctx context.Context, standID, promotionID uint) error {
+	if err := r.dao.DeactivatePromotion(ctx, standID, promotionID); err != nil {
+		return fmt.Errorf("r.dao.DeactivatePromotion -> %w", err)
+	}
+
+	return nil
+}
+
+func promotionDomainToDAO(promotion domain.Promotion) dao.Promotion {
+	items := make([]dao.PromotionItem, 0, len(promotion.Items))
+	for _, item := range promotion.Items {
+		items = append(items, dao.PromotionItem{
+			PromotionID: promotion.ID,
+			StockID:     item.StockID,
+			Quantity:    item.Quantity,
+		})
+	}
+
+	return dao.Promotion{
+		ID:          promotion.ID,
+		StandID:     promotion.StandID,
+		Name:        promotion.Name,
+		Type:        string(promotion.Type),
+		BundlePrice: promotion.BundlePrice,
+		PercentOff:  promotion.PercentOff,
+		BuyQuantity: promotion.BuyQuantity,
+		GetQuantity: promotion.GetQuantity,
+		StartsAt:    promotion.StartsAt,
+		EndsAt:      promotion.EndsAt,
+		Active:      promotion.Active,
+		Items:       items,
+		CreatedAt:   promotion.CreatedAt,
+	}
+}
+
+func promotionDaoToDomain(promotion dao.Promotion) domain.Promotion {
+	items := make([]domain.PromotionItem, 0, len(promotion.Items))
+	for _, item := range promotion.Items {
+		items = append(items, domain.PromotionItem{
+			StockID:  item.StockID,
+			Quantity: item.Quantity,
+		})
+	}
+
+	return domain.Promotion{
+		ID:          promotion.ID,
+		StandID:     promotion.StandID,
+		Name:        promotion.Name,
+		Type:        domain.PromotionType(promotion.Type),
+		Items:       items,
+		BundlePrice: promotion.BundlePrice,
+		PercentOff:  promotion.PercentOff,
+		BuyQuantity: promotion.BuyQuantity,
+		GetQuantity: promotion.GetQuantity,
+		StartsAt:    promotion.StartsAt,
+		EndsAt:      promotion.EndsAt,
+		Active:      promotion.Active,
+		CreatedAt:   promotion.CreatedAt,
+	}
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+func (r *KermesseRepository) SetKermesseStatus(ctx context.Context, kermesseID uint, from, to domain.KermesseStatus) (domain.Kermesse, error) {
+	kermesse, err := r.dao.SetKermesseStatus(ctx, kermesseID, string(from), string(to))
+	if err != nil {
+		return domain.Kermesse{}, fmt.Errorf("r.dao.SetKermesseStatus -> %w", err)
+	}
+
+	return r.daoToDomain(kermesse), nil
+}
+
+func (r *KermesseRepository) UpdateKermesseDetails(ctx context.Context, kermesse domain.Kermesse) (domain.Kermesse, error) {
+	updated, err := r.dao.UpdateKermesseDetails(ctx, r.domainToDao(kermesse))
+	if err != nil {
+		return domain.Kermesse{}, fmt.Errorf("r.dao.UpdateKermesseDetails -> %w", err)
+	}
+
+	return r.daoToDomain(updated), nil
+}
+
+func (r *KermesseRepository) GetKermesseWallets(ctx context.Context, kermesseID uint) ([]domain.LedgerAccount, error) {
+	accounts, err := r.dao.GetKermesseWallets(ctx, kermesseID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetKermesseWallets -> %w", err)
+	}
+
+	wallets := make([]domain.LedgerAccount, 0, len(accounts))
+	for _, account := range accounts {
+		wallets = append(wallets, r.ledgerAccountDaoToDomain(account))
+	}
+
+	return wallets, nil
+}
+
+func (r *KermesseRepository) GetRefundablePurchases(ctx context.Context, kermesseID, parentID uint) ([]domain.TokenTransaction, error) {
+	transactions, err := r.dao.GetRefundablePurchases(ctx, kermesseID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetRefundablePurchases -> %w", err)
+	}
+
+	return r.tokenTransactionsDaoToDomain(transactions), nil
+}
+
+func (r *KermesseRepository) GetRefunds(ctx context.Context, kermesseID uint) ([]domain.TokenTransaction, error) {
+	transactions, err := r.dao.GetRefunds(ctx, kermesseID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetRefunds -> %w", err)
+	}
+
+	return r.tokenTransactionsDaoToDomain(transactions), nil
+}
+
+// CreateRefund records a pending refund of purchase, taking its tokens out of
+// the holder's wallet.
+func (r *KermesseRepository) CreateRefund(ctx context.Context, purchase, refund domain.TokenTransaction) (domain.TokenTransaction, error) {
+	debit, credit, err := r.ledgerLegs(refund)
+	if err != nil {
+		return domain.TokenTransaction{}, err
+	}
+
+	created, err := r.dao.CreateRefund(ctx, r.domainToDAOTokenTransaction(purchase), r.domainToDAOTokenTransaction(refund), debit, credit)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("r.dao.CreateRefund -> %w", err)
+	}
+
+	return r.daoToDomainTokenTransaction(created), nil
+}
+
+func (r *KermesseRepository) CompleteRefund(ctx context.Context, refundID uint, reference string) error {
+	if err := r.dao.CompleteRefund(ctx, refundID, reference); err != nil {
+		return fmt.Errorf("r.dao.CompleteRefund -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *KermesseRepository) FailRefund(ctx context.Context, refundID uint, reason string) error {
+	if err := r.dao.FailRefund(ctx, refundID, reason); err != nil {
+		return fmt.Errorf("r.dao.FailRefund -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *KermesseRepository) tokenTransactionsDaoToDomain(transactions []dao.TokenTransaction) []domain.TokenTransaction {
+	domainTransactions := make([]domain.TokenTransaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		domainTransactions = append(domainTransactions, r.daoToDomainTokenTransaction(transaction))
+	}
+
+	return domainTransactions
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+func (r *KermesseRepository) ReserveStock(ctx context.Context, reservations []domain.StockReservation) ([]domain.StockReservation, error) {
+	daoReservations := make([]dao.StockReservation, 0, len(reservations))
+	for _, reservation := range reservations {
+		daoReservations = append(daoReservations, dao.StockReservation{
+			KermesseID: reservation.KermesseID,
+			StandID:    reservation.StandID,
+			StockID:    reservation.StockID,
+			UserID:     reservation.UserID,
+			Quantity:   reservation.Quantity,
+			Status:     dao.ReservationStatus(reservation.Status),
+			ExpiresAt:  reservation.ExpiresAt,
+		})
+	}
+
+	created, err := r.dao.ReserveStock(ctx, daoReservations)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.ReserveStock -> %w", err)
+	}
+
+	return reservationsDaoToDomain(created), nil
+}
+
+func (r *KermesseRepository) GetHeldReservations(ctx context.Context, userID, standID uint) ([]domain.StockReservation, error) {
+	reservations, err := r.dao.GetHeldReservations(ctx, userID, standID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetHeldReservations -> %w", err)
+	}
+
+	return reservationsDaoToDomain(reservations), nil
+}
+
+func (r *KermesseRepository) ReleaseReservation(ctx context.Context, kermesseID, reservationID, userID uint) (domain.StockReservation, error) {
+	released, err := r.dao.ReleaseReservation(ctx, kermesseID, reservationID, userID)
+	if err != nil {
+		return domain.StockReservation{}, fmt.Errorf("r.dao.ReleaseReservation -> %w", err)
+	}
+
+	return reservationDaoToDomain(released), nil
+}
+
+func (r *KermesseRepository) ReleaseExpiredReservations(ctx context.Context, now time.Time) (int, error) {
+	released, err := r.dao.ReleaseExpiredReservations(ctx, now)
+	if err != nil {
+		return 0, fmt.Errorf("r.dao.ReleaseExpiredReservations -> %w", err)
+	}
+
+	return released, nil
+}
+
+func reservationsDaoToDomain(reservations []dao.StockReservation) []domain.StockReservation {
+	result := make([]domain.StockReservation, 0, len(reservations))
+	for _, reservation := range reservations {
+		result = append(result, reservationDaoToDomain(reservation))
+	}
+
+	return result
+}
+
+func reservationDaoToDomain(reservation dao.StockReservation) domain.StockReservation {
+	return domain.StockReservation{
+		ID:            reservation.ID,
+		KermesseID:    reservation.KermesseID,
+		StandID:       reservation.StandID,
+		StockID:       reservation.StockID,
+		UserID:        reservation.UserID,
+		Quantity:      reservation.Quantity,
+		Status:        domain.ReservationStatus(reservation.Status),
+		ExpiresAt:     reservation.ExpiresAt,
+		TransactionID: reservation.TransactionID,
+		CreatedAt:     reservation.CreatedAt,
+	}
+}
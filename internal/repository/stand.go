@@ -1,5 +1,12 @@
 package repository
 
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
 type StandDAO interface {
 }
 
@@ -12,3 +19,37 @@ func NewStandRepository(dao StandDAO) *StandRepository {
 		dao: dao,
 	}
 }
+
+func (r *KermesseRepository) UpdateStandDetails(ctx context.Context, stand domain.Stand) (domain.Stand, error) {
+	updated, err := r.dao.UpdateStandDetails(ctx, r.standDomainToDao(stand))
+	if err != nil {
+		return domain.Stand{}, fmt.Errorf("r.dao.UpdateStandDetails -> %w", err)
+	}
+
+	return r.standDaoToDomain(updated), nil
+}
+
+func (r *KermesseRepository) ArchiveStand(ctx context.Context, standID uint) error {
+	if err := r.dao.ArchiveStand(ctx, standID); err != nil {
+		return fmt.Errorf("r.dao.ArchiveStand -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *KermesseRepository) UpdateStockDetails(ctx context.Context, stock domain.Stock) (domain.Stock, error) {
+	updated, err := r.dao.UpdateStockDetails(ctx, r.domainToDaoStock(stock))
+	if err != nil {
+		return domain.Stock{}, fmt.Errorf("r.dao.UpdateStockDetails -> %w", err)
+	}
+
+	return r.daoToDomainStock(updated), nil
+}
+
+func (r *KermesseRepository) ArchiveStock(ctx context.Context, standID, stockID uint) error {
+	if err := r.dao.ArchiveStock(ctx, standID, stockID); err != nil {
+		return fmt.Errorf("r.dao.ArchiveStock -> %w", err)
+	}
+
+	return nil
+}
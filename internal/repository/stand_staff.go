@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+func (r *KermesseRepository) IsUserStandHolder(standID, userID uint) (bool, error) {
+	return r.dao.IsUserStandHolder(standID, userID)
+}
+
+func (r *KermesseRepository) GetStandStaffMember(ctx context.Context, standID, userID uint) (domain.StandStaff, error) {
+	member, err := r.dao.GetStandStaffMember(ctx, standID, userID)
+	if err != nil {
+		return domain.StandStaff{}, fmt.Errorf("r.dao.GetStandStaffMember -> %w", err)
+	}
+
+	return standStaffMemberDaoToDomain(member), nil
+}
+
+func (r *KermesseRepository) GetStandStaff(ctx context.Context, standID uint) ([]domain.StandStaff, error) {
+	members, err := r.dao.GetStandStaff(ctx, standID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetStandStaff -> %w", err)
+	}
+
+	return standStaffDaoToDomain(members), nil
+}
+
+func (r *KermesseRepository) RemoveStandStaff(ctx context.Context, standID, userID uint) error {
+	if err := r.dao.RemoveStandStaff(ctx, standID, userID); err != nil {
+		return fmt.Errorf("r.dao.RemoveStandStaff -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *KermesseRepository) CreateStandInvitation(ctx context.Context, invitation domain.StandInvitation) (domain.StandInvitation, error) {
+	created, err := r.dao.CreateStandInvitation(ctx, dao.StandInvitation{
+		StandID:   invitation.StandID,
+		Email:     invitation.Email,
+		Role:      string(invitation.Role),
+		Code:      invitation.Code,
+		InvitedBy: invitation.InvitedBy,
+		ExpiresAt: invitation.ExpiresAt,
+	})
+	if err != nil {
+		return domain.StandInvitation{}, fmt.Errorf("r.dao.CreateStandInvitation -> %w", err)
+	}
+
+	return standInvitationDaoToDomain(created, invitation.KermesseID), nil
+}
+
+func (r *KermesseRepository) DeleteStandInvitation(ctx context.Context, invitationID uint) error {
+	if err := r.dao.DeleteStandInvitation(ctx, invitationID); err != nil {
+		return fmt.Errorf("r.dao.DeleteStandInvitation -> %w", err)
+	}
+
+	return nil
+}
+
+func (r *KermesseRepository) GetStandInvitationByCode(ctx context.Context, code string) (domain.StandInvitation, error) {
+	found, err := r.dao.GetStandInvitationByCode(ctx, code)
+	if err != nil {
+		return domain.StandInvitation{}, fmt.Errorf("r.dao.GetStandInvitationByCode -> %w", err)
+	}
+
+	return standInvitationDaoToDomain(found.StandInvitation, found.KermesseID), nil
+}
+
+func (r *KermesseRepository) AcceptStandInvitation(ctx context.Context, invitation domain.StandInvitation, userID uint) (domain.StandStaff, error) {
+	member, err := r.dao.AcceptStandInvitation(ctx, dao.StandInvitation{
+		ID:      invitation.ID,
+		StandID: invitation.StandID,
+		Role:    string(invitation.Role),
+	}, userID)
+	if err != nil {
+		return domain.StandStaff{}, fmt.Errorf("r.dao.AcceptStandInvitation -> %w", err)
+	}
+
+	return standStaffMemberDaoToDomain(member), nil
+}
+
+func standStaffDaoToDomain(members []dao.StandStaffMember) []domain.StandStaff {
+	staff := make([]domain.StandStaff, len(members))
+	for i, member := range members {
+		staff[i] = standStaffMemberDaoToDomain(member)
+	}
+
+	return staff
+}
+
+func standStaffMemberDaoToDomain(member dao.StandStaffMember) domain.StandStaff {
+	return domain.StandStaff{
+		StandID:    member.StandID,
+		KermesseID: member.KermesseID,
+		UserID:     member.UserID,
+		Name:       member.Name,
+		Email:      member.Email,
+		Role:       domain.StandRole(member.Role),
+		CreatedAt:  member.CreatedAt,
+	}
+}
+
+func standInvitationDaoToDomain(invitation dao.StandInvitation, kermesseID uint) domain.StandInvitation {
+	return domain.StandInvitation{
+		ID:         invitation.ID,
+		StandID:    invitation.StandID,
+		KermesseID: kermesseID,
+		Email:      invitation.Email,
+		Role:       domain.StandRole(invitation.Role),
+		Code:       invitation.Code,
+		InvitedBy:  invitation.InvitedBy,
+		ExpiresAt:  invitation.ExpiresAt,
+		AcceptedBy: invitation.AcceptedBy,
+		AcceptedAt: invitation.AcceptedAt,
+		CreatedAt:  invitation.CreatedAt,
+	}
+}
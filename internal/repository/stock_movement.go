@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository/dao"
+)
+
+func (r *KermesseRepository) GetStockMovements(ctx context.Context, standID uint) ([]domain.StockMovement, error) {
+	movements, err := r.dao.GetStockMovements(ctx, standID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetStockMovements -> %w", err)
+	}
+
+	result := make([]domain.StockMovement, 0, len(movements))
+	for _, movement := range movements {
+		result = append(result, stockMovementDaoToDomain(movement))
+	}
+
+	return result, nil
+}
+
+func (r *KermesseRepository) GetTransactionStockMovements(ctx context.Context, transactionID uint) ([]domain.StockMovement, error) {
+	movements, err := r.dao.GetTransactionStockMovements(ctx, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("r.dao.GetTransactionStockMovements -> %w", err)
+	}
+
+	result := make([]domain.StockMovement, 0, len(movements))
+	for _, movement := range movements {
+		result = append(result, stockMovementDaoToDomain(movement))
+	}
+
+	return result, nil
+}
+
+func stockMovementDomainToDAO(movement domain.StockMovement) dao.StockMovement {
+	return dao.StockMovement{
+		ID:            movement.ID,
+		StandID:       movement.StandID,
+		StockID:       movement.StockID,
+		Delta:         movement.Delta,
+		QuantityAfter: movement.QuantityAfter,
+		Reason:        dao.StockMovementReason(movement.Reason),
+		ActorID:       movement.ActorID,
+		TransactionID: movement.TransactionID,
+		Note:          movement.Note,
+		CreatedAt:     movement.CreatedAt,
+	}
+}
+
+func stockMovementDaoToDomain(movement dao.StockMovement) domain.StockMovement {
+	return domain.StockMovement{
+		ID:            movement.ID,
+		StandID:       movement.StandID,
+		StockID:       movement.StockID,
+		Delta:         movement.Delta,
+		QuantityAfter: movement.QuantityAfter,
+		Reason:        domain.StockMovementReason(movement.Reason),
+		ActorID:       movement.ActorID,
+		TransactionID: movement.TransactionID,
+		Note:          movement.Note,
+		CreatedAt:     movement.CreatedAt,
+	}
+}
@@ -11,6 +11,8 @@ import (
 var (
 	ErrUserEmailExists = dao.ErrUserEmailExists
 	ErrUserNotFound    = dao.ErrUserNotFound
+	ErrStudentNotFound = dao.ErrStudentNotFound
+	ErrBadgeIDTaken    = dao.ErrBadgeIDTaken
 )
 
 type UserDAO interface {
@@ -20,16 +22,21 @@ type UserDAO interface {
 	InsertStudent(ctx context.Context, user dao.User, student dao.Student) (dao.Student, error)
 	UpdateStudent(ctx context.Context, user dao.User, student dao.Student) (dao.Student, error)
 	InsertParent(ctx context.Context, user dao.User, parent dao.Parent) (dao.Parent, error)
-	InsertStandHolder(ctx context.Context, user dao.User, stand dao.Stand, standHolder dao.StandHolder) (dao.StandHolder, error)
+	InsertStandHolder(ctx context.Context, user dao.User, standHolder dao.StandHolder) (dao.StandHolder, error)
 	InsertOrganizer(ctx context.Context, user dao.User) (dao.Organizer, error)
 	FindStudentByEmail(ctx context.Context, email string) (dao.Student, error)
 	FindStudentByUserID(ctx context.Context, id uint) (dao.Student, error)
 	FindParentByUserID(ctx context.Context, id uint) (dao.Parent, error)
 	FindStandHolderByUserID(ctx context.Context, id uint) (dao.StandHolder, error)
+	FindStandStaffByUserID(ctx context.Context, userID uint) ([]dao.StandStaffMember, error)
 	UpdateParent(ctx context.Context, user dao.User, parent dao.Parent) (dao.Parent, error)
 	FindStudentOnlyByUserID(ctx context.Context, userID uint) (dao.Student, error)
 	FindParentOnlyByUserID(ctx context.Context, userID uint) (dao.Parent, error)
 	FindStudentsByParentID(ctx context.Context, parentID uint) ([]dao.Student, error)
+	FindAccountBalance(ctx context.Context, accountType string, ownerID, kermesseID uint) (int, error)
+	FindWallets(ctx context.Context, accountType string, ownerID uint) ([]dao.LedgerAccount, error)
+	FindStudentByCode(ctx context.Context, code string) (dao.Student, error)
+	UpdateStudentPOSSettings(ctx context.Context, studentID uint, badgeID *string, autoApproveLimit int) (dao.Student, error)
 }
 
 type UserRepository struct {
@@ -62,7 +69,11 @@ func (r *UserRepository) FindByID(ctx context.Context, id uint) (domain.User, er
 
 	return r.daoToDomain(found), nil
 }
-func (r *UserRepository) FindByIDWithDetails(ctx context.Context, id uint) (domain.UserWithDetails, error) {
+
+// FindByIDWithDetails loads the user with their role details. Token balances
+// are those of the wallets of kermesseID, or the sums of all wallets when
+// kermesseID is 0.
+func (r *UserRepository) FindByIDWithDetails(ctx context.Context, id, kermesseID uint) (domain.UserWithDetails, error) {
 	user, err := r.dao.FindByID(ctx, id)
 	if err != nil {
 		return domain.UserWithDetails{}, fmt.Errorf("r.dao.FindByID -> %w", err)
@@ -78,25 +89,36 @@ func (r *UserRepository) FindByIDWithDetails(ctx context.Context, id uint) (doma
 		if err != nil {
 			return domain.UserWithDetails{}, fmt.Errorf("r.dao.FindStudentByUserID -> %w", err)
 		}
-		userWithDetails.Tokens = student.Tokens
+		userWithDetails.Wallets, userWithDetails.Tokens, err = r.findWallets(ctx, "student", student.UserID, kermesseID)
+		if err != nil {
+			return domain.UserWithDetails{}, err
+		}
 	case "parent":
 		parent, err := r.dao.FindParentByUserID(ctx, id)
 		if err != nil {
 			return domain.UserWithDetails{}, fmt.Errorf("r.dao.FindParentByUserID -> %w", err)
 		}
-		userWithDetails.Tokens = parent.Tokens
+		userWithDetails.Wallets, userWithDetails.Tokens, err = r.findWallets(ctx, "parent", parent.UserID, kermesseID)
+		if err != nil {
+			return domain.UserWithDetails{}, err
+		}
 
 		students, err := r.dao.FindStudentsByParentID(ctx, id)
 		if err != nil {
 			return domain.UserWithDetails{}, fmt.Errorf("r.dao.FindStudentsByParentID -> %w", err)
 		}
 		userWithDetails.Students = r.studentsDaoToDomain(students)
+		for i := range userWithDetails.Students {
+			if err := r.fillStudentTokens(ctx, &userWithDetails.Students[i], kermesseID); err != nil {
+				return domain.UserWithDetails{}, err
+			}
+		}
 	case "stand_holder":
-		standHolder, err := r.dao.FindStandHolderByUserID(ctx, id)
+		standHolder, err := r.FindStandHolderByUserID(ctx, id)
 		if err != nil {
-			return domain.UserWithDetails{}, fmt.Errorf("r.dao.FindStandHolderByUserID -> %w", err)
+			return domain.UserWithDetails{}, err
 		}
-		userWithDetails.StandID = standHolder.StandID
+		userWithDetails.Stands = standHolder.Stands
 	}
 
 	return userWithDetails, nil
@@ -108,7 +130,12 @@ func (r *UserRepository) FindStudentByUserID(ctx context.Context, id uint) (doma
 		return domain.Student{}, fmt.Errorf("r.dao.FindStudentByID -> %w", err)
 	}
 
-	return r.studentDaoToDomain(found), nil
+	student := r.studentDaoToDomain(found)
+	if err := r.fillStudentTokens(ctx, &student, 0); err != nil {
+		return domain.Student{}, err
+	}
+
+	return student, nil
 }
 
 func (r *UserRepository) FindParentByUserID(ctx context.Context, id uint) (domain.Parent, error) {
@@ -117,25 +144,51 @@ func (r *UserRepository) FindParentByUserID(ctx context.Context, id uint) (domai
 		return domain.Parent{}, fmt.Errorf("r.dao.FindParentByID -> %w", err)
 	}
 
-	return r.parentDaoToDomain(found), nil
-}
+	parent := r.parentDaoToDomain(found)
+	parent.Wallets, parent.Tokens, err = r.findWallets(ctx, "parent", parent.UserID, 0)
+	if err != nil {
+		return domain.Parent{}, err
+	}
 
-func (r *UserRepository) UpdateParent(ctx context.Context, parent domain.Parent) (domain.Parent, error) {
-	parentDAO := r.parentDomainToDao(parent)
+	return parent, nil
+}
 
-	userDao := dao.User{
-		ID:       parent.User.ID,
-		Email:    parent.User.Email,
-		Name:     parent.User.Name,
-		Role:     parent.User.Role,
-		Password: parent.User.Password,
+// FindWalletTokens returns the balance of the wallet ownerID holds for kermesseID.
+func (r *UserRepository) FindWalletTokens(ctx context.Context, accountType string, ownerID, kermesseID uint) (int, error) {
+	tokens, err := r.dao.FindAccountBalance(ctx, accountType, ownerID, kermesseID)
+	if err != nil {
+		return 0, fmt.Errorf("r.dao.FindAccountBalance -> %w", err)
 	}
 
-	updated, err := r.dao.UpdateParent(ctx, userDao, parentDAO)
+	return tokens, nil
+}
+
+// findWallets lists the wallets of ownerID along with the balance of the
+// wallet of kermesseID, or the sum of all of them when kermesseID is 0.
+func (r *UserRepository) findWallets(ctx context.Context, accountType string, ownerID, kermesseID uint) ([]domain.Wallet, int, error) {
+	accounts, err := r.dao.FindWallets(ctx, accountType, ownerID)
 	if err != nil {
-		return domain.Parent{}, fmt.Errorf("r.dao.UpdateParent -> %w", err)
+		return nil, 0, fmt.Errorf("r.dao.FindWallets -> %w", err)
+	}
+
+	var tokens int
+	wallets := make([]domain.Wallet, 0, len(accounts))
+	for _, account := range accounts {
+		wallets = append(wallets, domain.Wallet{KermesseID: account.KermesseID, Tokens: account.Balance})
+		if kermesseID == 0 || account.KermesseID == kermesseID {
+			tokens += account.Balance
+		}
 	}
-	return r.parentDaoToDomain(updated), nil
+
+	return wallets, tokens, nil
+}
+
+// fillStudentTokens sets the student's wallets from their ledger accounts.
+func (r *UserRepository) fillStudentTokens(ctx context.Context, student *domain.Student, kermesseID uint) error {
+	var err error
+	student.Wallets, student.Tokens, err = r.findWallets(ctx, "student", student.UserID, kermesseID)
+
+	return err
 }
 
 func (r *UserRepository) FindStandHolderByUserID(ctx context.Context, id uint) (domain.StandHolder, error) {
@@ -144,7 +197,15 @@ func (r *UserRepository) FindStandHolderByUserID(ctx context.Context, id uint) (
 		return domain.StandHolder{}, fmt.Errorf("r.dao.FindStandHolderByID -> %w", err)
 	}
 
-	return r.standHolderDaoToDomain(found), nil
+	staff, err := r.dao.FindStandStaffByUserID(ctx, id)
+	if err != nil {
+		return domain.StandHolder{}, fmt.Errorf("r.dao.FindStandStaffByUserID -> %w", err)
+	}
+
+	standHolder := r.standHolderDaoToDomain(found)
+	standHolder.Stands = standStaffDaoToDomain(staff)
+
+	return standHolder, nil
 }
 
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (domain.User, error) {
@@ -163,7 +224,12 @@ func (r *UserRepository) FindStudentByEmail(ctx context.Context, email string) (
 		return domain.Student{}, fmt.Errorf("r.dao.FindByEmail -> %w", err)
 	}
 
-	return r.studentDaoToDomain(found), nil
+	student := r.studentDaoToDomain(found)
+	if err := r.fillStudentTokens(ctx, &student, 0); err != nil {
+		return domain.Student{}, err
+	}
+
+	return student, nil
 }
 
 func (r *UserRepository) daoToDomain(u dao.User) domain.User {
@@ -187,21 +253,17 @@ func (r *UserRepository) daosToDomain(us []dao.User) []domain.User {
 	return users
 }
 
-func (r *UserRepository) parentDomainToDao(p domain.Parent) dao.Parent {
-	return dao.Parent{
-		UserID: p.UserID,
-		Tokens: p.Tokens,
-	}
-}
-
 func (r *UserRepository) studentDaoToDomain(s dao.Student) domain.Student {
 	return domain.Student{
 		User:     r.daoToDomain(s.User),
 		UserID:   s.UserID,
 		Points:   s.Points,
-		Tokens:   s.Tokens,
 		ParentID: s.ParentID,
 		IsActive: s.IsActive,
+		// Codes are optional in the database only.
+		ShortCode:        stringOrEmpty(s.ShortCode),
+		BadgeID:          stringOrEmpty(s.BadgeID),
+		AutoApproveLimit: s.AutoApproveLimit,
 	}
 }
 
@@ -218,21 +280,13 @@ func (r *UserRepository) parentDaoToDomain(p dao.Parent) domain.Parent {
 	return domain.Parent{
 		User:   r.daoToDomain(p.User),
 		UserID: p.UserID,
-		Tokens: p.Tokens,
 	}
 }
 
 func (r *UserRepository) standHolderDaoToDomain(s dao.StandHolder) domain.StandHolder {
 	return domain.StandHolder{
-		User:    r.daoToDomain(s.User),
-		UserID:  s.UserID,
-		StandID: s.StandID,
-		Stand: domain.Stand{
-			ID:          s.Stand.ID,
-			Name:        s.Stand.Name,
-			Type:        s.Stand.Type,
-			Description: s.Stand.Description,
-		},
+		User:   r.daoToDomain(s.User),
+		UserID: s.UserID,
 	}
 }
 
@@ -262,7 +316,6 @@ func (r *UserRepository) CreateStudent(ctx context.Context, student domain.Stude
 
 	daoStudent := dao.Student{
 		Points:   student.Points,
-		Tokens:   student.Tokens,
 		ParentID: student.ParentID,
 		IsActive: student.IsActive,
 	}
@@ -283,9 +336,7 @@ func (r *UserRepository) CreateParent(ctx context.Context, parent domain.Parent)
 		Role:     "parent",
 	}
 
-	daoParent := dao.Parent{
-		Tokens: 0,
-	}
+	daoParent := dao.Parent{}
 
 	created, err := r.dao.InsertParent(ctx, daoUser, daoParent)
 	if err != nil {
@@ -303,15 +354,9 @@ func (r *UserRepository) CreateStandHolder(ctx context.Context, standHolder doma
 		Role:     "stand_holder",
 	}
 
-	daoStand := dao.Stand{
-		Name:        standHolder.Stand.Name,
-		Type:        standHolder.Stand.Type,
-		Description: standHolder.Stand.Description,
-	}
-
 	daoStandHolder := dao.StandHolder{}
 
-	created, err := r.dao.InsertStandHolder(ctx, daoUser, daoStand, daoStandHolder)
+	created, err := r.dao.InsertStandHolder(ctx, daoUser, daoStandHolder)
 	if err != nil {
 		return domain.StandHolder{}, fmt.Errorf("r.dao.InsertStandHolder -> %w", err)
 	}
@@ -345,7 +390,6 @@ func (r *UserRepository) UpdateStudent(ctx context.Context, student domain.Stude
 	daoStudent := dao.Student{
 		UserID:   student.UserID,
 		Points:   student.Points,
-		Tokens:   student.Tokens,
 		ParentID: student.ParentID,
 		IsActive: student.IsActive,
 	}
@@ -357,36 +401,3 @@ func (r *UserRepository) UpdateStudent(ctx context.Context, student domain.Stude
 
 	return r.studentDaoToDomain(updated), nil
 }
-
-func (r *UserRepository) UpdateUserTokens(ctx context.Context, userID uint, amount int) error {
-	user, err := r.dao.FindByID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("r.userDao.FindByID -> %w", err)
-	}
-
-	if user.Role == "parent" {
-		parent, err := r.dao.FindParentByUserID(ctx, userID)
-		if err != nil {
-			return fmt.Errorf("r.userDao.FindParentByUserID -> %w", err)
-		}
-		parent.Tokens += amount
-		_, err = r.dao.UpdateParent(ctx, user, parent)
-		if err != nil {
-			return fmt.Errorf("r.userDao.UpdateParent -> %w", err)
-		}
-	} else if user.Role == "student" {
-		student, err := r.dao.FindStudentByUserID(ctx, userID)
-		if err != nil {
-			return fmt.Errorf("r.userDao.FindStudentByUserID -> %w", err)
-		}
-		student.Tokens += amount
-		_, err = r.dao.UpdateStudent(ctx, user, student)
-		if err != nil {
-			return fmt.Errorf("r.userDao.UpdateStudent -> %w", err)
-		}
-	} else {
-		return ErrInvalidUserRole
-	}
-
-	return nil
-}
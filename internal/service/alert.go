@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"go.uber.org/zap"
+)
+
+// MaxNotifications bounds the notifications returned at once, newest first.
+const MaxNotifications = 100
+
+// GetLowStockItems returns the items the stands of a kermesse are running
+// low on. Only its organizers can see them.
+func (s *KermesseService) GetLowStockItems(ctx context.Context, kermesseID uint, user domain.User) ([]domain.LowStockItem, error) {
+	if _, err := s.repo.GetByID(kermesseID); err != nil {
+		return nil, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+	if err := s.checkOrganizer(kermesseID, user); err != nil {
+		return nil, err
+	}
+
+	stands, err := s.repo.GetStandsByKermesseID(kermesseID)
+	if err != nil {
+		return nil, fmt.Errorf("s.repo.GetStandsByKermesseID -> %w", err)
+	}
+
+	return domain.LowStockItems(stands), nil
+}
+
+// GetNotifications returns the latest notifications of user.
+func (s *KermesseService) GetNotifications(ctx context.Context, user domain.User) ([]domain.Notification, error) {
+	notifications, err := s.repo.GetNotifications(ctx, user.ID, MaxNotifications)
+	if err != nil {
+		return nil, fmt.Errorf("s.repo.GetNotifications -> %w", err)
+	}
+
+	return notifications, nil
+}
+
+// alertLowStock tells the staff of stand about the items the sale paid by
+// transactionID took down to their low-stock threshold. The sale went
+// through already, so failing to alert is only logged.
+func (s *KermesseService) alertLowStock(ctx context.Context, stand domain.Stand, transactionID uint) {
+	if err := s.postLowStockAlerts(ctx, stand, transactionID); err != nil {
+		zap.L().Warn(fmt.Sprintf("s.postLowStockAlerts -> %v", err))
+	}
+}
+
+func (s *KermesseService) postLowStockAlerts(ctx context.Context, stand domain.Stand, transactionID uint) error {
+	if stand.Type == "activity" {
+		return nil
+	}
+
+	movements, err := s.repo.GetTransactionStockMovements(ctx, transactionID)
+	if err != nil {
+		return fmt.Errorf("s.repo.GetTransactionStockMovements -> %w", err)
+	}
+	items := domain.CrossedLowStock(stand, movements)
+	if len(items) == 0 {
+		return nil
+	}
+
+	recipients, err := s.repo.GetStandAlertRecipients(ctx, stand.KermesseID, stand.ID)
+	if err != nil {
+		return fmt.Errorf("s.repo.GetStandAlertRecipients -> %w", err)
+	}
+
+	for _, item := range items {
+		message := domain.ChatMessage{
+			KermesseID: stand.KermesseID,
+			StandID:    stand.ID,
+			SenderID:   domain.SystemSenderID,
+			Message:    item.Message(),
+			Timestamp:  time.Now(),
+		}
+
+		notifications := make([]domain.Notification, 0, len(recipients))
+		for _, userID := range recipients {
+			notifications = append(notifications, domain.Notification{
+				UserID:     userID,
+				KermesseID: stand.KermesseID,
+				StandID:    stand.ID,
+				Type:       domain.NotificationLowStock,
+				Message:    message.Message,
+			})
+		}
+
+		if err := s.repo.PostStandAlert(ctx, message, notifications); err != nil {
+			return fmt.Errorf("s.repo.PostStandAlert -> %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// GetMyTransactions returns the transactions visible to user across all
+// kermesses: parents see theirs and their children's, students theirs, stand
+// holders their stand's and organizers those of the kermesses they organize.
+func (s *KermesseService) GetMyTransactions(ctx context.Context, user domain.User, filter domain.TransactionFilter) (domain.TransactionPage, error) {
+	scope, err := s.transactionScope(ctx, user)
+	if err != nil {
+		return domain.TransactionPage{}, err
+	}
+
+	return s.findTokenTransactions(ctx, scope, filter)
+}
+
+// GetKermesseTransactions returns the transactions of a kermesse visible to
+// user, all of them for its organizers, in the time zone of the kermesse.
+func (s *KermesseService) GetKermesseTransactions(ctx context.Context, kermesseID uint, user domain.User, filter domain.TransactionFilter) (domain.TransactionPage, error) {
+	kermesse, err := s.repo.GetByID(kermesseID)
+	if err != nil {
+		return domain.TransactionPage{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+
+	var scope domain.TransactionScope
+	if user.Role == "organizer" {
+		if err := s.checkOrganizer(kermesseID, user); err != nil {
+			return domain.TransactionPage{}, err
+		}
+		scope.KermesseIDs = []uint{kermesseID}
+	} else {
+		if scope, err = s.transactionScope(ctx, user); err != nil {
+			return domain.TransactionPage{}, err
+		}
+	}
+
+	filter.KermesseID = kermesseID
+
+	page, err := s.findTokenTransactions(ctx, scope, filter)
+	if err != nil {
+		return domain.TransactionPage{}, err
+	}
+
+	return page.InLocation(kermesse.Zone()), nil
+}
+
+func (s *KermesseService) transactionScope(ctx context.Context, user domain.User) (domain.TransactionScope, error) {
+	switch user.Role {
+	case "parent":
+		childrenIDs, err := s.repo.GetChildrenIDs(user.ID)
+		if err != nil {
+			return domain.TransactionScope{}, fmt.Errorf("s.repo.GetChildrenIDs -> %w", err)
+		}
+		return domain.TransactionScope{Parties: []domain.TransactionParty{
+			{Type: "parent", IDs: []uint{user.ID}},
+			{Type: "student", IDs: childrenIDs},
+		}}, nil
+	case "student":
+		return domain.TransactionScope{Parties: []domain.TransactionParty{
+			{Type: "student", IDs: []uint{user.ID}},
+		}}, nil
+	case "stand_holder":
+		standHolder, err := s.userRepo.FindStandHolderByUserID(ctx, user.ID)
+		if err != nil {
+			return domain.TransactionScope{}, fmt.Errorf("s.userRepo.FindStandHolderByUserID -> %w", err)
+		}
+		return domain.TransactionScope{Parties: []domain.TransactionParty{
+			{Type: "stand", IDs: standHolder.StandIDs()},
+		}}, nil
+	case "organizer":
+		kermesses, err := s.repo.FindByUserID(user)
+		if err != nil {
+			return domain.TransactionScope{}, fmt.Errorf("s.repo.FindByUserID -> %w", err)
+		}
+		var scope domain.TransactionScope
+		for _, kermesse := range kermesses {
+			scope.KermesseIDs = append(scope.KermesseIDs, kermesse.ID)
+		}
+		return scope, nil
+	default:
+		return domain.TransactionScope{}, ErrInvalidUserRole
+	}
+}
+
+func (s *KermesseService) findTokenTransactions(ctx context.Context, scope domain.TransactionScope, filter domain.TransactionFilter) (domain.TransactionPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = domain.DefaultTransactionPageSize
+	}
+	filter.Limit = min(filter.Limit, domain.MaxTransactionPageSize)
+
+	page, err := s.repo.FindTokenTransactions(ctx, scope, filter)
+	if err != nil {
+		return domain.TransactionPage{}, fmt.Errorf("s.repo.FindTokenTransactions -> %w", err)
+	}
+
+	return page, nil
+}
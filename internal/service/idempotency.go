@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository"
+)
+
+var (
+	ErrIdempotencyKeyMismatch   = domain.ErrIdempotencyKeyMismatch
+	ErrIdempotencyKeyInProgress = domain.ErrIdempotencyKeyInProgress
+)
+
+type IdempotencyRepository interface {
+	Create(ctx context.Context, key domain.IdempotencyKey) (domain.IdempotencyKey, error)
+	FindByUserAndKey(ctx context.Context, userID uint, key string) (domain.IdempotencyKey, error)
+	Complete(ctx context.Context, id uint, statusCode int, responseBody []byte) error
+	Delete(ctx context.Context, id uint) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type IdempotencyService struct {
+	repo IdempotencyRepository
+	ttl  time.Duration
+}
+
+func NewIdempotencyService(repo IdempotencyRepository, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{
+		repo: repo,
+		ttl:  ttl,
+	}
+}
+
+// Begin reserves the key for the user's request. When the key was already used
+// for the same request and that request completed, the stored key is returned
+// with replay set so that its response can be sent again.
+func (s *IdempotencyService) Begin(ctx context.Context, userID uint, key, requestHash string) (domain.IdempotencyKey, bool, error) {
+	now := time.Now()
+	newKey := domain.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+
+	created, err := s.repo.Create(ctx, newKey)
+	if err == nil {
+		return created, false, nil
+	}
+	if !errors.Is(err, repository.ErrIdempotencyKeyExists) {
+		return domain.IdempotencyKey{}, false, fmt.Errorf("s.repo.Create -> %w", err)
+	}
+
+	existing, err := s.repo.FindByUserAndKey(ctx, userID, key)
+	if err != nil {
+		if errors.Is(err, repository.ErrIdempotencyKeyNotFound) {
+			// Released by a failed attempt in the meantime.
+			return domain.IdempotencyKey{}, false, ErrIdempotencyKeyInProgress
+		}
+		return domain.IdempotencyKey{}, false, fmt.Errorf("s.repo.FindByUserAndKey -> %w", err)
+	}
+
+	// Expired keys are only deleted by the sweep, so one may still be around:
+	// it no longer counts and the request runs anew.
+	if !existing.ExpiresAt.After(now) {
+		if err := s.repo.Delete(ctx, existing.ID); err != nil {
+			return domain.IdempotencyKey{}, false, fmt.Errorf("s.repo.Delete -> %w", err)
+		}
+
+		created, err := s.repo.Create(ctx, newKey)
+		if err != nil {
+			if errors.Is(err, repository.ErrIdempotencyKeyExists) {
+				return domain.IdempotencyKey{}, false, ErrIdempotencyKeyInProgress
+			}
+			return domain.IdempotencyKey{}, false, fmt.Errorf("s.repo.Create -> %w", err)
+		}
+
+		return created, false, nil
+	}
+
+	if existing.RequestHash != requestHash {
+		return domain.IdempotencyKey{}, false, ErrIdempotencyKeyMismatch
+	}
+
+	if !existing.IsCompleted() {
+		return domain.IdempotencyKey{}, false, ErrIdempotencyKeyInProgress
+	}
+
+	return existing, true, nil
+}
+
+// Complete stores the response to replay for later requests with the same key.
+func (s *IdempotencyService) Complete(ctx context.Context, key domain.IdempotencyKey, statusCode int, responseBody []byte) error {
+	if err := s.repo.Complete(ctx, key.ID, statusCode, responseBody); err != nil {
+		return fmt.Errorf("s.repo.Complete -> %w", err)
+	}
+
+	return nil
+}
+
+// Release frees the key so that the request can be retried, e.g. after a
+// server error.
+func (s *IdempotencyService) Release(ctx context.Context, key domain.IdempotencyKey) error {
+	if err := s.repo.Delete(ctx, key.ID); err != nil {
+		return fmt.Errorf("s.repo.Delete -> %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes the keys expired by now, and tells how many there
+// were.
+func (s *IdempotencyService) DeleteExpired(ctx context.Context) (int64, error) {
+	deleted, err := s.repo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("s.repo.DeleteExpired -> %w", err)
+	}
+
+	return deleted, nil
+}
+
+// SweepExpired deletes expired keys every interval until ctx is done. Begin
+// ignores expired keys anyway, the sweep only keeps the table small.
+func (s *IdempotencyService) SweepExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.DeleteExpired(ctx)
+			if err != nil {
+				zap.L().Warn(fmt.Sprintf("s.DeleteExpired -> %v", err))
+				continue
+			}
+			if deleted > 0 {
+				zap.L().Debug(fmt.Sprintf("deleted %d expired idempotency keys", deleted))
+			}
+		}
+	}
+}
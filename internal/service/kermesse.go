@@ -4,26 +4,69 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/stripe/stripe-go/v72"
-	"github.com/stripe/stripe-go/v72/paymentintent"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/request"
-	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/config"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
 	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository"
+	"go.uber.org/zap"
+	"time"
 )
 
 var (
-	ErrKermesseNotFound         = repository.ErrKermessNotFound
-	ErrUserNotParticipant       = repository.ErrUserNotParticipant
-	ErrTransactionNotFound      = repository.ErrTransactionNotFound
-	ErrUnauthorizedOrganizer    = repository.ErrUnauthorizedOrganizer
-	ErrInvalidTransactionStatus = repository.ErrInvalidTransactionStatus
-	ErrNotParentOfStudent       = repository.ErrNotParentOfStudent
-	ErrInsufficientTokens       = repository.ErrInsufficientTokens
-	ErrStandNotInKermesse       = repository.ErrStandNotInKermesse
-	ErrInsufficientStock        = repository.ErrInsufficientStock
-	ErrInvalidUserRole          = repository.ErrInvalidUserRole
-	ErrInvalidTransaction       = repository.ErrInvalidTransaction
+	ErrKermesseNotFound          = repository.ErrKermessNotFound
+	ErrUserNotParticipant        = repository.ErrUserNotParticipant
+	ErrTransactionNotFound       = repository.ErrTransactionNotFound
+	ErrUnauthorizedOrganizer     = repository.ErrUnauthorizedOrganizer
+	ErrInvalidTransactionStatus  = repository.ErrInvalidTransactionStatus
+	ErrNotParentOfStudent        = repository.ErrNotParentOfStudent
+	ErrInsufficientTokens        = repository.ErrInsufficientTokens
+	ErrStandNotInKermesse        = repository.ErrStandNotInKermesse
+	ErrInsufficientStock         = repository.ErrInsufficientStock
+	ErrInvalidUserRole           = repository.ErrInvalidUserRole
+	ErrInvalidTransaction        = repository.ErrInvalidTransaction
+	ErrPurchaseConflict          = repository.ErrPurchaseConflict
+	ErrPaymentEventProcessed     = repository.ErrPaymentEventProcessed
+	ErrInvalidPaymentEvent       = domain.ErrInvalidPaymentEvent
+	ErrInvalidTokenAmount        = domain.ErrInvalidTokenAmount
+	ErrPaymentDeclined           = errors.New("payment declined")
+	ErrInvalidRefund             = domain.ErrInvalidRefund
+	ErrRefundNotAllowed          = errors.New("user may not refund this purchase")
+	ErrRefundWindowExpired       = errors.New("refund window expired")
+	ErrKermesseClosed            = repository.ErrKermesseClosed
+	ErrKermesseNotClosed         = errors.New("kermesse is not closed")
+	ErrKermesseNotPublished      = errors.New("kermesse is not published yet")
+	ErrKermesseNotOpen           = errors.New("kermesse is not open")
+	ErrKermesseArchived          = errors.New("kermesse is archived")
+	ErrKermesseCancelled         = errors.New("kermesse is cancelled")
+	ErrKermesseVersionConflict   = repository.ErrKermesseVersionConflict
+	ErrInvalidKermesseTransition = domain.ErrInvalidKermesseTransition
+	ErrKermesseStatusChanged     = repository.ErrKermesseStatusChanged
+	ErrInvalidCart               = domain.ErrInvalidCart
+	ErrItemNotInStand            = domain.ErrItemNotInStand
+	ErrStandNotFound             = repository.ErrStandNotFound
+	ErrUnknownStudentCode        = errors.New("no student has this code")
+	ErrNotStandHolder            = errors.New("user is not a holder of the stand")
+	ErrChargeNotAllowed          = errors.New("user may not answer this charge")
+	ErrInvalidPaymentRequest     = domain.ErrInvalidPaymentRequest
+	ErrPaymentRequestExpired     = domain.ErrPaymentRequestExpired
+	ErrPaymentRequestUsed        = repository.ErrPaymentRequestUsed
+	ErrPaymentRequestAmount      = errors.New("amount doesn't match the cart")
+	ErrPaymentRequestRepriced    = errors.New("prices changed since the payment request was issued")
+	ErrInvalidAllowance          = errors.New("invalid offline allowance limit")
+	ErrAllowanceNotAllowed       = errors.New("user may not issue an offline allowance for this student")
+	ErrInvalidPromotion          = domain.ErrInvalidPromotion
+	ErrPromotionNotFound         = repository.ErrPromotionNotFound
+	ErrReservationNotFound       = repository.ErrReservationNotFound
+	ErrNothingToReserve          = errors.New("activity stands don't run out of stock")
+	ErrInvalidStockMovement      = domain.ErrInvalidStockMovement
+	ErrStockNotFound             = repository.ErrStockNotFound
+	ErrInvalidSchedule           = domain.ErrInvalidSchedule
+	ErrStandClosed               = domain.ErrStandClosed
+	ErrNotStandManager           = errors.New("user is not a manager of the stand")
+	ErrStandStaffNotFound        = repository.ErrStandStaffNotFound
+	ErrLastStandManager          = repository.ErrLastStandManager
+	ErrInvitationNotFound        = domain.ErrInvitationNotFound
+	ErrInvitationExpired         = domain.ErrInvitationExpired
+	ErrInvitationUsed            = domain.ErrInvitationUsed
 )
 
 type KermesseRepository interface {
@@ -33,40 +76,126 @@ type KermesseRepository interface {
 	GetByID(id uint) (domain.Kermesse, error)
 	CreateStand(ctx context.Context, stand domain.Stand, stock []domain.Stock, standHolderID uint) (domain.Stand, error)
 	CreateTokenTransaction(transaction domain.TokenTransaction) (domain.TokenTransaction, error)
+	CreatePostedTokenTransaction(ctx context.Context, transaction domain.TokenTransaction) (domain.TokenTransaction, error)
+	PostTokenTransaction(ctx context.Context, transaction domain.TokenTransaction) (domain.TokenTransaction, error)
+	GetLedgerAccount(ctx context.Context, key domain.LedgerAccountKey) (domain.LedgerAccount, error)
+	AuditLedger(ctx context.Context, kermesseID uint) (domain.LedgerAudit, error)
 	GetTokenTransactionByID(transactionID uint) (domain.TokenTransaction, error)
 	IsUserKermesseOrganizer(kermesseID, userID uint) (bool, error)
-	IncrementParentTokens(transactionFromID uint, transactionAmount int) error
 	IncrementKermesseTokensSold(transactionFromID uint, transactionAmount int) error
 	UpdateTokenTransaction(transaction domain.TokenTransaction) (domain.TokenTransaction, error)
-	UpdateTokenBalances(parentUserID, studentUserID uint, amount int) error
 	GetStandByID(standID uint) (domain.Stand, error)
 	UpdateTransactionStatus(transactionID uint, status string) error
 	UpdateStand(ctx context.Context, stand domain.Stand) (domain.Stand, error)
-	UpdateStockQuantity(ctx context.Context, standID uint, stockID uint, quantityChange int) error
+	UpdateStockQuantity(ctx context.Context, standID uint, stockID uint, quantityChange int, actorID uint) error
+	Checkout(ctx context.Context, order domain.Order, trackStock bool) (domain.Order, error)
+	PayPaymentRequest(ctx context.Context, request domain.StandPaymentRequest, order domain.Order, trackStock bool) (domain.Order, error)
+	CreateOfflineAllowance(ctx context.Context, allowance domain.OfflineAllowance) (domain.OfflineAllowance, error)
+	GetOfflineAllowance(ctx context.Context, id uint) (domain.OfflineAllowance, error)
+	IsOfflineVoucherRedeemed(ctx context.Context, voucher domain.OfflineVoucher) (bool, error)
+	RedeemOfflineVoucher(ctx context.Context, voucher domain.OfflineVoucher, order domain.Order, trackStock bool) (domain.Order, error)
+	CreatePromotion(ctx context.Context, promotion domain.Promotion) (domain.Promotion, error)
+	GetPromotions(ctx context.Context, standID uint, activeOnly bool) ([]domain.Promotion, error)
+	DeactivatePromotion(ctx context.Context, standID, promotionID uint) error
+	ReserveStock(ctx context.Context, reservations []domain.StockReservation) ([]domain.StockReservation, error)
+	GetHeldReservations(ctx context.Context, userID, standID uint) ([]domain.StockReservation, error)
+	ReleaseReservation(ctx context.Context, kermesseID, reservationID, userID uint) (domain.StockReservation, error)
+	ReleaseExpiredReservations(ctx context.Context, now time.Time) (int, error)
+	CreateCharge(ctx context.Context, order domain.Order) (domain.Charge, error)
+	ConfirmCharge(ctx context.Context, order domain.Order, trackStock bool) (domain.Charge, error)
+	RejectPendingTransaction(ctx context.Context, transactionID uint) (domain.TokenTransaction, error)
+	GetCharge(ctx context.Context, transactionID uint) (domain.Charge, error)
+	RefundPurchase(ctx context.Context, spend, refund domain.TokenTransaction, trackStock bool, actorID uint) (domain.TokenTransaction, error)
+	GetTokenTransactionByPaymentReference(ctx context.Context, reference string) (domain.TokenTransaction, error)
+	AttachPayment(ctx context.Context, transactionID uint, reference string) error
+	GetPendingTokenPurchases(ctx context.Context, kermesseID uint, method domain.PaymentMethod) ([]domain.TokenTransaction, error)
+	SettleTokenPurchase(ctx context.Context, eventID, eventType string, transaction domain.TokenTransaction) (bool, error)
 	GetChildrenTransactions(parentID uint) ([]domain.TokenTransaction, error)
 	GetStockByID(ctx context.Context, stockID uint) (domain.Stock, error)
-	UpdateStock(ctx context.Context, updatedStock domain.Stock) (domain.Stock, error)
-	CreateStock(ctx context.Context, stock domain.Stock) (domain.Stock, error)
+	UpdateStock(ctx context.Context, updatedStock domain.Stock, movement domain.StockMovement) (domain.Stock, error)
+	CreateStock(ctx context.Context, stock domain.Stock, actorID uint) (domain.Stock, error)
+	GetStockMovements(ctx context.Context, standID uint) ([]domain.StockMovement, error)
+	GetTransactionStockMovements(ctx context.Context, transactionID uint) ([]domain.StockMovement, error)
+	GetStandAlertRecipients(ctx context.Context, kermesseID, standID uint) ([]uint, error)
+	PostStandAlert(ctx context.Context, message domain.ChatMessage, notifications []domain.Notification) error
+	GetNotifications(ctx context.Context, userID uint, limit int) ([]domain.Notification, error)
+	GetKermesseAudience(ctx context.Context, kermesseID uint) ([]uint, error)
+	CreateNotifications(ctx context.Context, notifications []domain.Notification) error
 	GetStandsByKermesseID(kermesseID uint) ([]domain.Stand, error)
+	UpdateStandDetails(ctx context.Context, stand domain.Stand) (domain.Stand, error)
+	ArchiveStand(ctx context.Context, standID uint) error
+	UpdateStockDetails(ctx context.Context, stock domain.Stock) (domain.Stock, error)
+	ArchiveStock(ctx context.Context, standID, stockID uint) error
 	SaveChatMessage(message domain.ChatMessage) (domain.ChatMessage, error)
 	GetChatMessages(kermesseID, standID uint, limit, offset int) ([]domain.ChatMessage, error)
 	IsUserStandHolder(standID, userID uint) (bool, error)
+	GetStandStaffMember(ctx context.Context, standID, userID uint) (domain.StandStaff, error)
+	GetStandStaff(ctx context.Context, standID uint) ([]domain.StandStaff, error)
+	RemoveStandStaff(ctx context.Context, standID, userID uint) error
+	CreateStandInvitation(ctx context.Context, invitation domain.StandInvitation) (domain.StandInvitation, error)
+	DeleteStandInvitation(ctx context.Context, invitationID uint) error
+	GetStandInvitationByCode(ctx context.Context, code string) (domain.StandInvitation, error)
+	AcceptStandInvitation(ctx context.Context, invitation domain.StandInvitation, userID uint) (domain.StandStaff, error)
 	AttributePointsToStudent(ctx context.Context, studentID uint, points int) (domain.PointAttributionResult, error)
 	IncrementStandPointsGiven(ctx context.Context, standID uint, points int) error
 	GetAllKermesses() ([]domain.Kermesse, error)
+	SetKermesseStatus(ctx context.Context, kermesseID uint, from, to domain.KermesseStatus) (domain.Kermesse, error)
+	UpdateKermesseDetails(ctx context.Context, kermesse domain.Kermesse) (domain.Kermesse, error)
+	GetKermesseWallets(ctx context.Context, kermesseID uint) ([]domain.LedgerAccount, error)
+	GetRefundablePurchases(ctx context.Context, kermesseID, parentID uint) ([]domain.TokenTransaction, error)
+	GetRefunds(ctx context.Context, kermesseID uint) ([]domain.TokenTransaction, error)
+	CreateRefund(ctx context.Context, purchase, refund domain.TokenTransaction) (domain.TokenTransaction, error)
+	CompleteRefund(ctx context.Context, refundID uint, reference string) error
+	FailRefund(ctx context.Context, refundID uint, reason string) error
+	FindTokenTransactions(ctx context.Context, scope domain.TransactionScope, filter domain.TransactionFilter) (domain.TransactionPage, error)
+	GetChildrenIDs(parentID uint) ([]uint, error)
+}
+
+// PaymentProvider charges parents for the tokens they buy, reports how
+// payments that did not complete right away end up, and refunds unused tokens.
+type PaymentProvider interface {
+	Charge(ctx context.Context, req domain.PaymentRequest) (domain.Payment, error)
+	// ParseEvent authenticates and decodes a webhook payload.
+	ParseEvent(payload []byte, signature string) (domain.PaymentEvent, error)
+	// Refund gives money of a payment back. Retrying with the same
+	// idempotency key must not refund twice.
+	Refund(ctx context.Context, req domain.RefundRequest) (domain.PaymentRefund, error)
+	// Cancel voids a payment not captured yet, e.g. one still waiting for
+	// 3-D Secure.
+	Cancel(ctx context.Context, paymentID string) error
+}
+
+// Mailer sends emails, such as the codes of stand staff invitations.
+type Mailer interface {
+	Send(ctx context.Context, email domain.Email) error
 }
 
 type KermesseService struct {
-	repo         KermesseRepository
-	userRepo     UserRepository
-	stripeConfig *config.StripeConfig
+	repo     KermesseRepository
+	userRepo UserRepository
+	payments PaymentProvider
+	// refundWindow is how long after a stand purchase it can be refunded.
+	refundWindow    time.Duration
+	paymentRequests PaymentRequestSettings
+	offline         OfflineAllowanceSettings
+	// reservationTTL is how long stock reservations hold items.
+	reservationTTL time.Duration
+	mailer         Mailer
+	// invitationTTL is how long stand staff invitations can be accepted.
+	invitationTTL time.Duration
 }
 
-func NewKermesseService(repo KermesseRepository, userRepo UserRepository, stripeConfig *config.StripeConfig) *KermesseService {
+func NewKermesseService(repo KermesseRepository, userRepo UserRepository, payments PaymentProvider, refundWindow time.Duration, paymentRequests PaymentRequestSettings, offline OfflineAllowanceSettings, reservationTTL time.Duration, mailer Mailer, invitationTTL time.Duration) *KermesseService {
 	return &KermesseService{
-		repo:         repo,
-		userRepo:     userRepo,
-		stripeConfig: stripeConfig,
+		repo:            repo,
+		userRepo:        userRepo,
+		payments:        payments,
+		refundWindow:    refundWindow,
+		paymentRequests: paymentRequests,
+		offline:         offline,
+		reservationTTL:  reservationTTL,
+		mailer:          mailer,
+		invitationTTL:   invitationTTL,
 	}
 }
 
@@ -76,10 +205,6 @@ func (s *KermesseService) IsParticipating(kermessID uint, userID uint) (bool, er
 		return false, fmt.Errorf("s.repo.FindKermessesByUserID -> %w", err)
 	}
 
-	fmt.Printf("kermesses: %v\n", kermesses)
-	fmt.Printf("kermessID: %d\n", kermessID)
-	fmt.Printf("userID: %d\n", userID)
-
 	for _, k := range kermesses {
 		if k.ID == kermessID {
 			return true, nil
@@ -89,32 +214,139 @@ func (s *KermesseService) IsParticipating(kermessID uint, userID uint) (bool, er
 	return false, nil
 }
 
-func (s *KermesseService) ProcessStripePayment(paymentMethodID string, amount int) (*stripe.PaymentIntent, error) {
-	stripe.Key = s.stripeConfig.SecretKey
+// PurchaseTokens charges the parent for amount tokens at the price of the
+// kermesse, its token packs included (see domain.Kermesse.PriceTokens), in the
+// kermesse's currency, and records the purchase as a pending transaction tied
+// to the payment. The tokens are credited as soon as the payment succeeds, which
+// may only be known later through HandlePaymentEvent, e.g. after 3-D Secure.
+//
+// The transaction is recorded before the card is charged, so that no payment
+// goes through for a purchase that can't be recorded; should the payment fail
+// to be attached to it, the payment is voided. Declined payments fail the
+// transaction and return ErrPaymentDeclined.
+func (s *KermesseService) PurchaseTokens(ctx context.Context, kermesseID uint, user domain.User, paymentMethodID string, amount int) (domain.TokenTransaction, domain.Payment, error) {
+	kermesse, err := s.openKermesse(kermesseID)
+	if err != nil {
+		return domain.TokenTransaction{}, domain.Payment{}, err
+	}
 
-	params := &stripe.PaymentIntentParams{
-		Amount:             stripe.Int64(int64(amount * 100)), // amount in cents
-		Currency:           stripe.String(string(stripe.CurrencyUSD)),
-		PaymentMethod:      stripe.String(paymentMethodID),
-		Description:        stripe.String("Token purchase for Kermesse"),
-		ConfirmationMethod: stripe.String(string(stripe.PaymentIntentConfirmationMethodAutomatic)),
-		Confirm:            stripe.Bool(true),
+	price, err := kermesse.PriceTokens(amount)
+	if err != nil {
+		return domain.TokenTransaction{}, domain.Payment{}, fmt.Errorf("kermesse.PriceTokens -> %w", err)
+	}
+
+	transaction, err := s.CreateTokenTransaction(ctx, domain.TokenTransaction{
+		KermesseID:    kermesseID,
+		FromID:        user.ID,
+		FromType:      "parent",
+		ToID:          kermesseID,
+		ToType:        "kermess",
+		Amount:        amount,
+		Type:          domain.TokenPurchase,
+		Status:        "Pending",
+		PaymentMethod: domain.PaymentMethodCard,
+		MoneyAmount:   price,
+		Currency:      kermesse.Currency,
+	}, user)
+	if err != nil {
+		return domain.TokenTransaction{}, domain.Payment{}, fmt.Errorf("s.CreateTokenTransaction -> %w", err)
 	}
 
-	pi, err := paymentintent.New(params)
+	payment, err := s.payments.Charge(ctx, domain.PaymentRequest{
+		PaymentMethodID: paymentMethodID,
+		Amount:          price,
+		Currency:        kermesse.Currency,
+		Description:     fmt.Sprintf("%d tokens for %s", amount, kermesse.Name),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create payment intent: %w", err)
+		s.failTokenPurchase(ctx, transaction, "payment could not be processed")
+		return domain.TokenTransaction{}, domain.Payment{}, fmt.Errorf("s.payments.Charge -> %w", err)
+	}
+
+	if payment.ID != "" {
+		if err := s.repo.AttachPayment(ctx, transaction.ID, payment.ID); err != nil {
+			s.voidPayment(ctx, transaction, payment)
+			s.failTokenPurchase(ctx, transaction, "payment could not be recorded")
+			return domain.TokenTransaction{}, payment, fmt.Errorf("s.repo.AttachPayment -> %w", err)
+		}
+		transaction.PaymentReference = payment.ID
 	}
 
-	if pi.Status == stripe.PaymentIntentStatusRequiresAction {
-		return nil, fmt.Errorf("payment requires additional action")
+	switch payment.Status {
+	case domain.PaymentFailed:
+		s.failTokenPurchase(ctx, transaction, payment.FailureReason)
+		return domain.TokenTransaction{}, payment, fmt.Errorf("%w: %s", ErrPaymentDeclined, payment.FailureReason)
+	case domain.PaymentSucceeded:
+		transaction.Status = "Completed"
+		if _, err := s.repo.SettleTokenPurchase(ctx, "", "", transaction); err != nil {
+			return domain.TokenTransaction{}, payment, fmt.Errorf("s.repo.SettleTokenPurchase -> %w", err)
+		}
 	}
 
-	if pi.Status != stripe.PaymentIntentStatusSucceeded {
-		return nil, fmt.Errorf("payment failed with status: %s", pi.Status)
+	return transaction, payment, nil
+}
+
+// failTokenPurchase fails a pending card purchase whose payment didn't go
+// through. Errors are only logged: the caller is already reporting one.
+func (s *KermesseService) failTokenPurchase(ctx context.Context, transaction domain.TokenTransaction, reason string) {
+	transaction.Status = "Failed"
+	transaction.RejectionReason = reason
+	if _, err := s.repo.SettleTokenPurchase(ctx, "", "", transaction); err != nil {
+		zap.L().Error(fmt.Sprintf("s.repo.SettleTokenPurchase -> %v", err), zap.Uint("transaction_id", transaction.ID))
 	}
+}
 
-	return pi, nil
+// voidPayment gives back a payment that went through for a purchase that
+// couldn't be recorded: succeeded payments are refunded, the others canceled.
+func (s *KermesseService) voidPayment(ctx context.Context, transaction domain.TokenTransaction, payment domain.Payment) {
+	var err error
+	switch payment.Status {
+	case domain.PaymentFailed:
+		return
+	case domain.PaymentSucceeded:
+		_, err = s.payments.Refund(ctx, domain.RefundRequest{
+			PaymentID:      payment.ID,
+			Amount:         payment.Amount,
+			IdempotencyKey: fmt.Sprintf("void-purchase-%d", transaction.ID),
+		})
+	default:
+		err = s.payments.Cancel(ctx, payment.ID)
+	}
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("failed to void payment -> %v", err), zap.String("payment_id", payment.ID), zap.Uint("transaction_id", transaction.ID))
+	}
+}
+
+// HandlePaymentEvent applies a payment provider webhook to the token purchase
+// it is about. Each event is applied at most once: replays return
+// ErrPaymentEventProcessed. Events that do not settle a payment are ignored.
+func (s *KermesseService) HandlePaymentEvent(ctx context.Context, payload []byte, signature string) (domain.PaymentEvent, error) {
+	event, err := s.payments.ParseEvent(payload, signature)
+	if err != nil {
+		return domain.PaymentEvent{}, fmt.Errorf("s.payments.ParseEvent -> %w", err)
+	}
+
+	var status string
+	switch event.Status {
+	case domain.PaymentSucceeded:
+		status = "Completed"
+	case domain.PaymentFailed:
+		status = "Failed"
+	default:
+		return event, nil
+	}
+
+	transaction, err := s.repo.GetTokenTransactionByPaymentReference(ctx, event.PaymentID)
+	if err != nil {
+		return event, fmt.Errorf("s.repo.GetTokenTransactionByPaymentReference -> %w", err)
+	}
+
+	transaction.Status = status
+	if _, err := s.repo.SettleTokenPurchase(ctx, event.ID, event.Type, transaction); err != nil {
+		return event, fmt.Errorf("s.repo.SettleTokenPurchase -> %w", err)
+	}
+
+	return event, nil
 }
 
 func (s *KermesseService) SaveChatMessage(message domain.ChatMessage) (domain.ChatMessage, error) {
@@ -150,22 +382,18 @@ func (s *KermesseService) GetChatMessages(kermesseID, standID uint, limit, offse
 	return messages, nil
 }
 
+// IsStandHolder tells whether the user is on the staff of the stand.
 func (s *KermesseService) IsStandHolder(userID, standID uint) (bool, error) {
-	stand, err := s.repo.GetStandByID(standID)
-	if err != nil {
+	if _, err := s.repo.GetStandByID(standID); err != nil {
 		return false, fmt.Errorf("s.repo.GetStandByID -> %w", err)
 	}
 
-	standHolder, err := s.userRepo.FindStandHolderByUserID(context.Background(), userID)
+	isStandHolder, err := s.repo.IsUserStandHolder(standID, userID)
 	if err != nil {
-		return false, fmt.Errorf("s.userRepo.FindStandHolderByUserID -> %w", err)
+		return false, fmt.Errorf("s.repo.IsUserStandHolder -> %w", err)
 	}
 
-	if standHolder.StandID != stand.ID {
-		return false, nil
-	}
-
-	return true, nil
+	return isStandHolder, nil
 }
 
 func (s *KermesseService) GetStandsByKermesseID(kermesseID uint) ([]domain.Stand, error) {
@@ -179,7 +407,12 @@ func (s *KermesseService) GetStandsByKermesseID(kermesseID uint) ([]domain.Stand
 		return []domain.Stand{}, fmt.Errorf("s.repo.GetStandsByKermesseID -> %w", err)
 	}
 
-	return stands, nil
+	live := domain.LiveStands(stands)
+	for i, stand := range live {
+		live[i] = stand.InLocation(kermesse.Zone())
+	}
+
+	return live, nil
 }
 
 func (s *KermesseService) IsKermesseOrganizer(kermesseID, userID uint) (bool, error) {
@@ -204,7 +437,14 @@ func (s *KermesseService) GetTokenTransactionByID(transactionID uint) (domain.To
 	return transaction, nil
 }
 
+// CreateKermesse creates a kermesse in draft, for its stands to be set up
+// before families can join.
 func (s *KermesseService) CreateKermesse(ctx context.Context, kermesse domain.Kermesse, organizerID uint) (domain.Kermesse, error) {
+	if err := kermesse.CheckSchedule(); err != nil {
+		return domain.Kermesse{}, err
+	}
+
+	kermesse.Status = domain.KermesseDraft
 	createdKermesse, err := s.repo.CreateKermess(ctx, kermesse, organizerID)
 	if err != nil {
 		return domain.Kermesse{}, fmt.Errorf("s.repo.Create -> %w", err)
@@ -213,14 +453,33 @@ func (s *KermesseService) CreateKermesse(ctx context.Context, kermesse domain.Ke
 	return createdKermesse, nil
 }
 
+// AddParticipantToKermesse lets a user join a kermesse once it is published.
+// Stand holders can join its draft already, to set up their stands.
 func (s *KermesseService) AddParticipantToKermesse(ctx context.Context, kermesseID, userID uint) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("s.userRepo.FindByID -> %w", err)
+	}
+
+	statuses := []domain.KermesseStatus{domain.KermessePublished, domain.KermesseOpen}
+	if user.Role == "stand_holder" {
+		statuses = append(statuses, domain.KermesseDraft)
+	}
+	if _, err := s.kermesseIn(kermesseID, statuses...); err != nil {
+		return err
+	}
+
 	return s.repo.AddParticipant(ctx, kermesseID, userID)
 }
 
 func (s *KermesseService) CreateStand(ctx context.Context, stand domain.Stand, stock []domain.Stock, standHolderID uint) (domain.Stand, error) {
-	// Check if the kermesse exists
-	if _, err := s.repo.GetByID(stand.KermesseID); err != nil {
-		return domain.Stand{}, fmt.Errorf("kermesse not found: %w", err)
+	// Stands can be set up from the draft until the kermesse closes
+	kermesse, err := s.kermesseIn(stand.KermesseID, domain.KermesseDraft, domain.KermessePublished, domain.KermesseOpen)
+	if err != nil {
+		return domain.Stand{}, err
+	}
+	if err := stand.CheckOpeningHours(kermesse); err != nil {
+		return domain.Stand{}, err
 	}
 
 	// Check if the stand holder exists and is a valid user
@@ -233,10 +492,10 @@ func (s *KermesseService) CreateStand(ctx context.Context, stand domain.Stand, s
 		return domain.Stand{}, fmt.Errorf("s.repo.CreateStand -> %w", err)
 	}
 
-	return createdStand, nil
+	return createdStand.InLocation(kermesse.Zone()), nil
 }
 
-func (s *KermesseService) CreateTokenTransaction(transaction domain.TokenTransaction, user domain.User) (domain.TokenTransaction, error) {
+func (s *KermesseService) CreateTokenTransaction(ctx context.Context, transaction domain.TokenTransaction, user domain.User) (domain.TokenTransaction, error) {
 	// Check if the kermesse exists and if the parent is participating
 	isParticipating, err := s.IsParticipating(transaction.KermesseID, user.ID)
 	if err != nil {
@@ -249,16 +508,101 @@ func (s *KermesseService) CreateTokenTransaction(transaction domain.TokenTransac
 		return domain.TokenTransaction{}, ErrUserNotParticipant
 	}
 
-	// Create the transaction
-	createdTransaction, err := s.repo.CreateTokenTransaction(transaction)
+	// Pending transactions only reach the ledger once validated
+	if transaction.Status == "Pending" {
+		createdTransaction, err := s.repo.CreateTokenTransaction(transaction)
+		if err != nil {
+			return domain.TokenTransaction{}, fmt.Errorf("s.repo.CreateTokenTransaction -> %w", err)
+		}
+
+		return createdTransaction, nil
+	}
+
+	createdTransaction, err := s.repo.CreatePostedTokenTransaction(ctx, transaction)
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.CreateTokenTransaction -> %w", err)
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.CreatePostedTokenTransaction -> %w", err)
 	}
 
 	return createdTransaction, nil
 }
 
-func (s *KermesseService) ValidateTokenTransaction(transactionID uint, user domain.User) (domain.TokenTransaction, error) {
+// CreateCashTokenPurchase records tokens paid in cash at the entrance as a
+// pending purchase. Parents record their own purchases, organizers of the
+// kermesse record them on behalf of parentID. Nothing is credited until an
+// organizer approves the purchase with ValidateTokenTransaction.
+func (s *KermesseService) CreateCashTokenPurchase(ctx context.Context, kermesseID uint, user domain.User, parentID uint, amount int) (domain.TokenTransaction, error) {
+	switch user.Role {
+	case "parent":
+		parentID = user.ID
+	case "organizer":
+		isOrganizer, err := s.repo.IsUserKermesseOrganizer(kermesseID, user.ID)
+		if err != nil {
+			return domain.TokenTransaction{}, fmt.Errorf("s.repo.IsUserKermesseOrganizer -> %w", err)
+		}
+		if !isOrganizer {
+			return domain.TokenTransaction{}, ErrUnauthorizedOrganizer
+		}
+	default:
+		return domain.TokenTransaction{}, ErrInvalidUserRole
+	}
+
+	kermesse, err := s.openKermesse(kermesseID)
+	if err != nil {
+		return domain.TokenTransaction{}, err
+	}
+
+	price, err := kermesse.PriceTokens(amount)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("kermesse.PriceTokens -> %w", err)
+	}
+
+	parent, err := s.userRepo.FindParentByUserID(ctx, parentID)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("s.userRepo.FindParentByUserID -> %w", err)
+	}
+
+	transaction, err := s.CreateTokenTransaction(ctx, domain.TokenTransaction{
+		KermesseID:    kermesseID,
+		FromID:        parent.UserID,
+		FromType:      "parent",
+		ToID:          kermesseID,
+		ToType:        "kermess",
+		Amount:        amount,
+		Type:          domain.TokenPurchase,
+		Status:        "Pending",
+		PaymentMethod: domain.PaymentMethodCash,
+		MoneyAmount:   price,
+		Currency:      kermesse.Currency,
+	}, domain.User{ID: parent.UserID})
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("s.CreateTokenTransaction -> %w", err)
+	}
+
+	return transaction, nil
+}
+
+// GetPendingCashPurchases lists the cash purchases of a kermesse waiting for
+// an organizer's decision.
+func (s *KermesseService) GetPendingCashPurchases(ctx context.Context, kermesseID uint, user domain.User) ([]domain.TokenTransaction, error) {
+	isOrganizer, err := s.repo.IsUserKermesseOrganizer(kermesseID, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("s.repo.IsUserKermesseOrganizer -> %w", err)
+	}
+	if !isOrganizer {
+		return nil, ErrUnauthorizedOrganizer
+	}
+
+	transactions, err := s.repo.GetPendingTokenPurchases(ctx, kermesseID, domain.PaymentMethodCash)
+	if err != nil {
+		return nil, fmt.Errorf("s.repo.GetPendingTokenPurchases -> %w", err)
+	}
+
+	return transactions, nil
+}
+
+// pendingCashPurchase loads a cash purchase of kermesseID that user, an
+// organizer of the kermesse, may still approve or reject.
+func (s *KermesseService) pendingCashPurchase(kermesseID, transactionID uint, user domain.User) (domain.TokenTransaction, error) {
 	transaction, err := s.repo.GetTokenTransactionByID(transactionID)
 	if err != nil {
 		if errors.Is(err, repository.ErrTransactionNotFound) {
@@ -266,6 +610,9 @@ func (s *KermesseService) ValidateTokenTransaction(transactionID uint, user doma
 		}
 		return domain.TokenTransaction{}, fmt.Errorf("s.repo.GetTokenTransactionByID -> %w", err)
 	}
+	if transaction.KermesseID != kermesseID {
+		return domain.TokenTransaction{}, ErrTransactionNotFound
+	}
 
 	// Check if the user is an organizer of this kermesse
 	isOrganizer, err := s.repo.IsUserKermesseOrganizer(transaction.KermesseID, user.ID)
@@ -276,42 +623,74 @@ func (s *KermesseService) ValidateTokenTransaction(transactionID uint, user doma
 		return domain.TokenTransaction{}, ErrUnauthorizedOrganizer
 	}
 
-	// Check if the transaction is in a valid state for validation
-	if transaction.Status != "Pending" || transaction.Type != domain.TokenPurchase {
+	// Check if the transaction is in a valid state for a decision. Card
+	// payments are settled by the payment provider, not by organizers.
+	if transaction.Status != "Pending" || transaction.Type != domain.TokenPurchase || transaction.PaymentMethod != domain.PaymentMethodCash {
 		return domain.TokenTransaction{}, ErrInvalidTransactionStatus
 	}
 
-	// Update transaction status
-	transaction.Status = "Validated"
+	return transaction, nil
+}
 
-	// Update parent's token balance
-	err = s.repo.IncrementParentTokens(transaction.FromID, transaction.Amount)
+// ValidateTokenTransaction approves a pending cash purchase: the parent is
+// credited and the kermesse's tokens sold go up in the same database transaction.
+// Balances are frozen once the kermesse closes, so it must still be open.
+func (s *KermesseService) ValidateTokenTransaction(ctx context.Context, kermesseID, transactionID uint, user domain.User) (domain.TokenTransaction, error) {
+	if _, err := s.openKermesse(kermesseID); err != nil {
+		return domain.TokenTransaction{}, err
+	}
+
+	transaction, err := s.pendingCashPurchase(kermesseID, transactionID, user)
+	if err != nil {
+		return domain.TokenTransaction{}, err
+	}
+
+	transaction.Status = "Validated"
+	settled, err := s.repo.SettleTokenPurchase(ctx, "", "", transaction)
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.IncrementParentTokens -> %w", err)
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.SettleTokenPurchase -> %w", err)
 	}
+	if !settled {
+		// Another organizer decided first.
+		return domain.TokenTransaction{}, ErrInvalidTransactionStatus
+	}
+
+	return transaction, nil
+}
 
-	// Update kermesse's tokens sold
-	err = s.repo.IncrementKermesseTokensSold(transaction.KermesseID, transaction.Amount)
+// RejectTokenTransaction rejects a pending cash purchase, keeping reason on
+// the transaction.
+func (s *KermesseService) RejectTokenTransaction(ctx context.Context, kermesseID, transactionID uint, user domain.User, reason string) (domain.TokenTransaction, error) {
+	transaction, err := s.pendingCashPurchase(kermesseID, transactionID, user)
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.IncrementKermesseTokensSold -> %w", err)
+		return domain.TokenTransaction{}, err
 	}
 
-	// Save updated transaction
-	updatedTransaction, err := s.repo.UpdateTokenTransaction(transaction)
+	transaction.Reject(reason)
+	settled, err := s.repo.SettleTokenPurchase(ctx, "", "", transaction)
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.UpdateTokenTransaction -> %w", err)
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.SettleTokenPurchase -> %w", err)
+	}
+	if !settled {
+		return domain.TokenTransaction{}, ErrInvalidTransactionStatus
 	}
 
-	return updatedTransaction, nil
+	return transaction, nil
 }
 
 func (s *KermesseService) CreateParentToChildTokenTransaction(ctx context.Context, transaction domain.TokenTransaction, user domain.User) (domain.TokenTransaction, error) {
-	// Check if the parent has enough tokens
-	parent, err := s.userRepo.FindParentByUserID(ctx, user.ID)
+	// Check if the parent has enough tokens in the wallet of the kermesse
+	if transaction.KermesseID == 0 {
+		return domain.TokenTransaction{}, ErrInvalidTransaction
+	}
+	if _, err := s.openKermesse(transaction.KermesseID); err != nil {
+		return domain.TokenTransaction{}, err
+	}
+	parentTokens, err := s.userRepo.FindWalletTokens(ctx, "parent", user.ID, transaction.KermesseID)
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.GetParentByUserID -> %w", err)
+		return domain.TokenTransaction{}, fmt.Errorf("s.userRepo.FindWalletTokens -> %w", err)
 	}
-	if parent.Tokens < transaction.Amount {
+	if parentTokens < transaction.Amount {
 		return domain.TokenTransaction{}, ErrInsufficientTokens
 	}
 
@@ -337,16 +716,14 @@ func (s *KermesseService) CreateParentToChildTokenTransaction(ctx context.Contex
 	//	return domain.TokenTransaction{}, ErrUserNotParticipant
 	//}
 
-	// Create the transaction
-	createdTransaction, err := s.repo.CreateTokenTransaction(transaction)
-	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.CreateTokenTransaction -> %w", err)
-	}
-
-	// Update parent's and student's token balances
-	err = s.repo.UpdateTokenBalances(parent.UserID, student.UserID, transaction.Amount)
+	// Create the transaction, moving the tokens from the parent to the student
+	transaction.Status = "Completed"
+	createdTransaction, err := s.repo.CreatePostedTokenTransaction(ctx, transaction)
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.UpdateTokenBalances -> %w", err)
+		if errors.Is(err, repository.ErrInsufficientTokens) {
+			return domain.TokenTransaction{}, ErrInsufficientTokens
+		}
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.CreatePostedTokenTransaction -> %w", err)
 	}
 
 	return createdTransaction, nil
@@ -367,8 +744,6 @@ func (s *KermesseService) GetStockItem(standID uint, stockId uint) (domain.Stock
 		return domain.Stock{}, fmt.Errorf("s.GetStandByID -> %w", err)
 	}
 
-	fmt.Printf("stand: %v\n", stand)
-
 	for _, stock := range stand.Stock {
 		if stock.ID == stockId {
 			return stock, nil
@@ -378,118 +753,95 @@ func (s *KermesseService) GetStockItem(standID uint, stockId uint) (domain.Stock
 	return domain.Stock{}, fmt.Errorf("stock item not found")
 }
 
-func (s *KermesseService) PerformPurchase(ctx context.Context, userID, kermesseID, standID uint, stockID uint, quantity int, totalCost int) (domain.TokenTransaction, error) {
-	// Check if the stand exists and belongs to the kermesse
-	stand, err := s.repo.GetStandByID(standID)
+// PerformPurchase buys quantity items of a stand's stock: a checkout of a
+// single line, returning the spend paying for it.
+func (s *KermesseService) PerformPurchase(ctx context.Context, userID, kermesseID, standID uint, stockID uint, quantity int) (domain.TokenTransaction, error) {
+	order, err := s.Checkout(ctx, userID, kermesseID, standID, []domain.CartLine{{StockID: stockID, Quantity: quantity}})
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.GetStandByID -> %w", err)
-	}
-	if stand.KermesseID != kermesseID {
-		return domain.TokenTransaction{}, ErrStandNotInKermesse
+		return domain.TokenTransaction{}, fmt.Errorf("s.Checkout -> %w", err)
 	}
 
-	// Get the stock item
-	stockItem, err := s.GetStockItem(standID, stockID)
+	spend, err := s.repo.GetTokenTransactionByID(order.TransactionID)
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.GetStockItem -> %w", err)
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.GetTokenTransactionByID -> %w", err)
 	}
 
-	// Check if there's enough stock (skip for activity stands)
-	if stand.Type != "activity" {
-		if stockItem.Quantity < quantity {
-			return domain.TokenTransaction{}, ErrInsufficientStock
-		}
+	return spend, nil
+}
+
+// RefundPurchase gives back quantity items of a stand purchase, or all the
+// items not refunded yet when quantity is 0. The buyer gets their tokens back
+// and the items return to the stock. Stand holders of the stand and
+// organizers of the kermesse can refund within the refund window, while the
+// kermesse is open.
+func (s *KermesseService) RefundPurchase(ctx context.Context, kermesseID, transactionID uint, user domain.User, quantity int) (domain.TokenTransaction, error) {
+	if _, err := s.openKermesse(kermesseID); err != nil {
+		return domain.TokenTransaction{}, err
 	}
 
-	// Check if user has enough tokens
-	user, err := s.userRepo.FindByID(ctx, userID)
+	spend, err := s.repo.GetTokenTransactionByID(transactionID)
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.userRepo.FindUserByID -> %w", err)
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.GetTokenTransactionByID -> %w", err)
+	}
+	if spend.KermesseID != kermesseID || spend.Type != domain.TokenSpend || spend.StandID == nil {
+		return domain.TokenTransaction{}, ErrTransactionNotFound
 	}
 
-	var userTokens int
-	var fromType string
-	switch user.Role {
-	case "student":
-		student, err := s.userRepo.FindStudentByUserID(ctx, userID)
+	isOrganizer, err := s.repo.IsUserKermesseOrganizer(kermesseID, user.ID)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.IsUserKermesseOrganizer -> %w", err)
+	}
+	if !isOrganizer {
+		isStandHolder, err := s.repo.IsUserStandHolder(*spend.StandID, user.ID)
 		if err != nil {
-			return domain.TokenTransaction{}, fmt.Errorf("s.userRepo.FindStudentByUserID -> %w", err)
+			return domain.TokenTransaction{}, fmt.Errorf("s.repo.IsUserStandHolder -> %w", err)
 		}
-		userTokens = student.Tokens
-		fromType = "Student"
-	case "parent":
-		parent, err := s.userRepo.FindParentByUserID(ctx, userID)
-		if err != nil {
-			return domain.TokenTransaction{}, fmt.Errorf("s.userRepo.FindParentByUserID -> %w", err)
+		if !isStandHolder {
+			return domain.TokenTransaction{}, ErrRefundNotAllowed
 		}
-		userTokens = parent.Tokens
-		fromType = "Parent"
-	default:
-		return domain.TokenTransaction{}, ErrInvalidUserRole
 	}
 
-	if userTokens < totalCost {
-		return domain.TokenTransaction{}, ErrInsufficientTokens
+	if !spend.Settled() {
+		return domain.TokenTransaction{}, ErrInvalidTransactionStatus
 	}
-
-	// Create pending TokenTransaction
-	transaction := domain.TokenTransaction{
-		KermesseID: kermesseID,
-		FromID:     userID,
-		FromType:   fromType,
-		ToID:       standID,
-		ToType:     "Stand",
-		Amount:     totalCost,
-		Type:       domain.TokenSpend,
-		StandID:    &standID,
-		Status:     "Validated",
+	if time.Since(spend.CreatedAt) > s.refundWindow {
+		return domain.TokenTransaction{}, ErrRefundWindowExpired
 	}
 
-	if !transaction.IsValid() {
-		return domain.TokenTransaction{}, ErrInvalidTransaction
+	if quantity == 0 {
+		quantity = spend.RefundableQuantity()
 	}
-
-	// Create the transaction
-	createdTransaction, err := s.repo.CreateTokenTransaction(transaction)
+	refund, err := spend.Reverse(quantity)
 	if err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.CreateTokenTransaction -> %w", err)
+		return domain.TokenTransaction{}, fmt.Errorf("spend.Reverse -> %w", err)
 	}
 
-	if err := s.userRepo.UpdateUserTokens(ctx, transaction.FromID, -transaction.Amount); err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.userRepo.UpdateUserTokens -> %w", err)
-	}
-
-	stand.TokensSpent += transaction.Amount
-
-	if _, err := s.repo.UpdateStand(ctx, stand); err != nil {
-		return domain.TokenTransaction{}, fmt.Errorf("s.repo.UpdateStandTokensSpent -> %w", err)
+	stand, err := s.repo.GetStandByID(*spend.StandID)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.GetStandByID -> %w", err)
 	}
 
-	if stand.Type != "activity" {
-		if err := s.repo.UpdateStockQuantity(ctx, *transaction.StandID, stockID, -quantity); err != nil {
-			return domain.TokenTransaction{}, fmt.Errorf("s.repo.UpdateStockQuantity -> %w", err)
-		}
+	createdRefund, err := s.repo.RefundPurchase(ctx, spend, refund, stand.Type != "activity", user.ID)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.RefundPurchase -> %w", err)
 	}
 
-	return createdTransaction, nil
+	return createdRefund, nil
 }
 
+// IsStandHolderAssociatedWithStand tells whether the stand holder is on the
+// staff of the stand, whatever their role.
 func (s *KermesseService) IsStandHolderAssociatedWithStand(ctx context.Context, standHolderID, standID uint) (bool, error) {
-	stand, err := s.GetStandByID(standID)
-	if err != nil {
+	if _, err := s.GetStandByID(standID); err != nil {
 		return false, fmt.Errorf("s.GetStandByID -> %w", err)
 	}
 
-	standHolder, err := s.userRepo.FindStandHolderByUserID(ctx, standHolderID)
+	isStandHolder, err := s.repo.IsUserStandHolder(standID, standHolderID)
 	if err != nil {
-		return false, fmt.Errorf("s.userRepo.FindStandHolderByUserID -> %w", err)
-	}
-
-	if standHolder.StandID != stand.ID {
-		return false, nil
+		return false, fmt.Errorf("s.repo.IsUserStandHolder -> %w", err)
 	}
 
-	return true, nil
+	return isStandHolder, nil
 }
 
 //func (s *KermesseService) ApproveTransaction(ctx context.Context, transactionID uint, standholderID uint, itemName string, quantity int) error {
@@ -538,25 +890,46 @@ func (s *KermesseService) IsStandHolderAssociatedWithStand(ctx context.Context,
 //	return nil
 //}
 
-func (s *KermesseService) RejectTransaction(ctx context.Context, transactionID uint, standholderID uint) error {
+// RejectTransaction declines a pending stand charge. Staff of the stand can
+// cancel it, and the student charged or their parent can decline it, whatever
+// their role.
+func (s *KermesseService) RejectTransaction(ctx context.Context, kermesseID, transactionID uint, userID uint) (domain.TokenTransaction, error) {
 	transaction, err := s.repo.GetTokenTransactionByID(transactionID)
 	if err != nil {
-		return fmt.Errorf("s.repo.GetTokenTransactionByID -> %w", err)
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.GetTokenTransactionByID -> %w", err)
+	}
+	if transaction.KermesseID != kermesseID || transaction.Type != domain.TokenSpend || transaction.StandID == nil {
+		return domain.TokenTransaction{}, ErrTransactionNotFound
+	}
+	if transaction.Status != "Pending" {
+		return domain.TokenTransaction{}, ErrInvalidTransactionStatus
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("s.userRepo.FindByID -> %w", err)
 	}
 
-	isAssociated, err := s.IsStandHolderAssociatedWithStand(ctx, standholderID, *transaction.StandID)
+	allowed, err := s.IsStandHolderAssociatedWithStand(ctx, userID, *transaction.StandID)
 	if err != nil {
-		return fmt.Errorf("s.IsStandholderAssociatedWithStand -> %w", err)
+		return domain.TokenTransaction{}, fmt.Errorf("s.IsStandholderAssociatedWithStand -> %w", err)
+	}
+	if !allowed {
+		allowed, err = s.isChargedStudentOrParent(ctx, transaction, user)
+		if err != nil {
+			return domain.TokenTransaction{}, err
+		}
 	}
-	if !isAssociated {
-		return ErrUnauthorizedOrganizer
+	if !allowed {
+		return domain.TokenTransaction{}, ErrChargeNotAllowed
 	}
 
-	if err := s.repo.UpdateTransactionStatus(transactionID, "Rejected"); err != nil {
-		return fmt.Errorf("s.repo.UpdateTransactionStatus -> %w", err)
+	rejected, err := s.repo.RejectPendingTransaction(ctx, transactionID)
+	if err != nil {
+		return domain.TokenTransaction{}, fmt.Errorf("s.repo.RejectPendingTransaction -> %w", err)
 	}
 
-	return nil
+	return rejected, nil
 }
 
 func (s *KermesseService) GetChildrenTransactions(ctx context.Context, userID uint) ([]domain.TokenTransaction, error) {
@@ -575,24 +948,14 @@ func (s *KermesseService) GetChildrenTransactions(ctx context.Context, userID ui
 	return transactions, nil
 }
 
-func (s *KermesseService) CreateStock(ctx context.Context, stock domain.Stock, userID uint) (domain.Stock, error) {
-	stand, err := s.GetStandByID(stock.StandID)
-	if err != nil {
-		return domain.Stock{}, fmt.Errorf("s.GetStandByID -> %w", err)
-	}
-
-	standHolder, err := s.userRepo.FindStandHolderByUserID(ctx, userID)
-	if err != nil {
-		return domain.Stock{}, fmt.Errorf("s.userRepo.FindStandHolderByUserID -> %w", err)
-	}
-
-	fmt.Printf("standHolder.StandID: %d, stand.ID: %d\n", standHolder.StandID, stand.ID)
-
-	if standHolder.StandID != stand.ID {
-		return domain.Stock{}, ErrUnauthorizedOrganizer
+// CreateStock adds a stock item to a stand. Managers of the stand and
+// organizers of the kermesse can add one.
+func (s *KermesseService) CreateStock(ctx context.Context, kermesseID uint, user domain.User, stock domain.Stock) (domain.Stock, error) {
+	if _, err := s.managedStand(ctx, kermesseID, stock.StandID, user); err != nil {
+		return domain.Stock{}, err
 	}
 
-	createdStock, err := s.repo.CreateStock(ctx, stock)
+	createdStock, err := s.repo.CreateStock(ctx, stock, user.ID)
 	if err != nil {
 		return domain.Stock{}, fmt.Errorf("s.repo.CreateStock -> %w", err)
 	}
@@ -600,42 +963,40 @@ func (s *KermesseService) CreateStock(ctx context.Context, stock domain.Stock, u
 	return createdStock, nil
 }
 
-func (s *KermesseService) UpdateStock(ctx context.Context, req request.StockUpdateRequest, userID uint, standID uint) error {
-	stand, err := s.GetStandByID(standID)
+// UpdateStock replaces a stock item of a stand. Managers of the stand and
+// organizers of the kermesse can update it, e.g. to restock.
+func (s *KermesseService) UpdateStock(ctx context.Context, kermesseID, standID uint, user domain.User, req request.StockUpdateRequest) error {
+	existingStock, err := s.standStock(ctx, kermesseID, standID, req.StockID, user, true)
 	if err != nil {
-		return fmt.Errorf("s.GetStandByID -> %w", err)
+		return err
 	}
 
-	standHolder, err := s.userRepo.FindStandHolderByUserID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("s.userRepo.FindStandHolderByUserID -> %w", err)
+	// Changes of quantity are journaled, as adjustments unless told otherwise.
+	reason := domain.StockAdjustment
+	if req.Reason != "" {
+		reason = domain.StockMovementReason(req.Reason)
 	}
-
-	if standHolder.StandID != stand.ID {
-		return ErrUnauthorizedOrganizer
-	}
-
-	// Fetch the existing stock item
-	existingStock, err := s.repo.GetStockByID(ctx, req.StockID)
-	if err != nil {
-		return fmt.Errorf("s.repo.GetStockByID -> %w", err)
-	}
-
-	// Check if the stock item belongs to the given stand
-	if existingStock.StandID != standID {
-		return ErrUnauthorizedOrganizer
+	delta := req.Quantity - existingStock.Quantity
+	if delta != 0 && !reason.AllowsManual(delta) {
+		return ErrInvalidStockMovement
 	}
 
 	// Update the stock item
 	updatedStock := domain.Stock{
-		ID:        req.StockID,
-		StandID:   standID,
-		ItemName:  req.ItemName,
-		Quantity:  req.Quantity,
-		TokenCost: req.TokenCost,
+		ID:                req.StockID,
+		StandID:           standID,
+		ItemName:          req.ItemName,
+		Quantity:          req.Quantity,
+		TokenCost:         req.TokenCost,
+		LowStockThreshold: req.LowStockThreshold,
+	}
+	movement := domain.StockMovement{
+		Reason:  reason,
+		ActorID: &user.ID,
+		Note:    req.Note,
 	}
 
-	if _, err := s.repo.UpdateStock(ctx, updatedStock); err != nil {
+	if _, err := s.repo.UpdateStock(ctx, updatedStock, movement); err != nil {
 		return fmt.Errorf("s.repo.UpdateStock -> %w", err)
 	}
 
@@ -676,18 +1037,20 @@ func (s *KermesseService) AttributePointsToStudent(ctx context.Context, kermesse
 	return result, nil
 }
 
-func (s *KermesseService) UpdateParentTokens(ctx context.Context, parentID uint, amount int) (domain.Parent, error) {
-	parent, err := s.userRepo.FindParentByUserID(ctx, parentID)
-	if err != nil {
-		return domain.Parent{}, fmt.Errorf("failed to get parent: %w", err)
+// AuditLedger audits the ledger of a kermesse. Only organizers of the
+// kermesse can run it.
+func (s *KermesseService) AuditLedger(ctx context.Context, kermesseID uint, user domain.User) (domain.LedgerAudit, error) {
+	if _, err := s.repo.GetByID(kermesseID); err != nil {
+		return domain.LedgerAudit{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+	if err := s.checkOrganizer(kermesseID, user); err != nil {
+		return domain.LedgerAudit{}, err
 	}
 
-	parent.Tokens += amount
-
-	updatedParent, err := s.userRepo.UpdateParent(ctx, parent)
+	audit, err := s.repo.AuditLedger(ctx, kermesseID)
 	if err != nil {
-		return domain.Parent{}, fmt.Errorf("failed to update parent tokens: %w", err)
+		return domain.LedgerAudit{}, fmt.Errorf("s.repo.AuditLedger -> %w", err)
 	}
 
-	return updatedParent, nil
+	return audit, nil
 }
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/request"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"go.uber.org/zap"
+)
+
+// SetKermesseStatus moves a kermesse to the status that follows its current
+// one. Only organizers of the kermesse can move it.
+func (s *KermesseService) SetKermesseStatus(ctx context.Context, kermesseID uint, user domain.User, status domain.KermesseStatus) (domain.Kermesse, error) {
+	kermesse, err := s.repo.GetByID(kermesseID)
+	if err != nil {
+		return domain.Kermesse{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+	if err := s.checkOrganizer(kermesseID, user); err != nil {
+		return domain.Kermesse{}, err
+	}
+
+	if !kermesse.Status.CanBecome(status) {
+		return domain.Kermesse{}, fmt.Errorf("%w: %s to %s", ErrInvalidKermesseTransition, kermesse.Status, status)
+	}
+
+	updated, err := s.repo.SetKermesseStatus(ctx, kermesseID, kermesse.Status, status)
+	if err != nil {
+		return domain.Kermesse{}, fmt.Errorf("s.repo.SetKermesseStatus -> %w", err)
+	}
+
+	return updated, nil
+}
+
+// UpdateKermesse edits the name, date, hours, location or description of a
+// kermesse until it closes. Only organizers of the kermesse can edit it, and
+// only from the version it is at. Participants and stand holders are told
+// when the kermesse moves to another date or place.
+func (s *KermesseService) UpdateKermesse(ctx context.Context, kermesseID uint, user domain.User, req request.KermessePatchRequest) (domain.Kermesse, error) {
+	kermesse, err := s.repo.GetByID(kermesseID)
+	if err != nil {
+		return domain.Kermesse{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+	if err := s.checkOrganizer(kermesseID, user); err != nil {
+		return domain.Kermesse{}, err
+	}
+	if err := checkKermesseStatus(kermesse, domain.KermesseDraft, domain.KermessePublished, domain.KermesseOpen); err != nil {
+		return domain.Kermesse{}, err
+	}
+	if kermesse.Version != req.Version {
+		return domain.Kermesse{}, ErrKermesseVersionConflict
+	}
+
+	moved := false
+	if req.Name != nil {
+		kermesse.Name = *req.Name
+	}
+	if req.TimeZone != nil {
+		kermesse.TimeZone = *req.TimeZone
+	}
+	if req.Date != nil {
+		date, err := time.ParseInLocation("02/01/2006", *req.Date, kermesse.Zone())
+		if err != nil {
+			return domain.Kermesse{}, fmt.Errorf("time.ParseInLocation -> %w", err)
+		}
+		moved = moved || !date.Equal(kermesse.Date)
+		kermesse.Date = date
+	}
+	if req.StartsAt != nil {
+		startsAt, err := parseOptionalTime(*req.StartsAt)
+		if err != nil {
+			return domain.Kermesse{}, err
+		}
+		moved = moved || kermesse.StartsAt == nil || !startsAt.Equal(*kermesse.StartsAt)
+		kermesse.StartsAt = startsAt
+		if req.Date == nil {
+			kermesse.Date = kermesse.DayOf(*startsAt)
+		}
+	}
+	if req.EndsAt != nil {
+		if kermesse.EndsAt, err = parseOptionalTime(*req.EndsAt); err != nil {
+			return domain.Kermesse{}, err
+		}
+	}
+	if req.Location != nil {
+		moved = moved || *req.Location != kermesse.Location
+		kermesse.Location = *req.Location
+	}
+	if req.Description != nil {
+		kermesse.Description = *req.Description
+	}
+	if err := kermesse.CheckSchedule(); err != nil {
+		return domain.Kermesse{}, err
+	}
+
+	updated, err := s.repo.UpdateKermesseDetails(ctx, kermesse)
+	if err != nil {
+		return domain.Kermesse{}, fmt.Errorf("s.repo.UpdateKermesseDetails -> %w", err)
+	}
+
+	if moved {
+		when := updated.Date.Format("02/01/2006")
+		if updated.StartsAt != nil {
+			when = fmt.Sprintf("%s from %s to %s", updated.StartsAt.Format("02/01/2006"), updated.StartsAt.Format("15:04"), updated.EndsAt.Format("15:04"))
+		}
+		message := fmt.Sprintf("%s now takes place on %s at %s", updated.Name, when, updated.Location)
+		s.notifyKermesse(ctx, updated.ID, domain.NotificationKermesseUpdated, message)
+	}
+
+	return updated, nil
+}
+
+// CancelKermesse calls a kermesse off before it closes. Participants and
+// stand holders are told, and the unused tokens paid by card are refunded
+// like when the kermesse closes. The kermesse is cancelled even if refunds
+// fail; organizers then run them again.
+func (s *KermesseService) CancelKermesse(ctx context.Context, kermesseID uint, user domain.User) (domain.KermesseCancellation, error) {
+	kermesse, err := s.SetKermesseStatus(ctx, kermesseID, user, domain.KermesseCancelled)
+	if err != nil {
+		return domain.KermesseCancellation{}, err
+	}
+
+	s.notifyKermesse(ctx, kermesse.ID, domain.NotificationKermesseCancelled, fmt.Sprintf("%s is cancelled", kermesse.Name))
+
+	cancellation := domain.KermesseCancellation{Kermesse: kermesse}
+	report, err := s.RunKermesseRefunds(ctx, kermesseID, user)
+	if err != nil {
+		zap.L().Warn(fmt.Sprintf("s.RunKermesseRefunds -> %v", err))
+		return cancellation, nil
+	}
+	cancellation.Refunds = &report
+
+	return cancellation, nil
+}
+
+// notifyKermesse tells the participants and stand holders of a kermesse
+// about a change made to it. The change is saved already, so failing to
+// notify is only logged.
+func (s *KermesseService) notifyKermesse(ctx context.Context, kermesseID uint, notificationType domain.NotificationType, message string) {
+	recipients, err := s.repo.GetKermesseAudience(ctx, kermesseID)
+	if err != nil {
+		zap.L().Warn(fmt.Sprintf("s.repo.GetKermesseAudience -> %v", err))
+		return
+	}
+
+	notifications := make([]domain.Notification, 0, len(recipients))
+	for _, userID := range recipients {
+		notifications = append(notifications, domain.Notification{
+			UserID:     userID,
+			KermesseID: kermesseID,
+			Type:       notificationType,
+			Message:    message,
+		})
+	}
+
+	if err := s.repo.CreateNotifications(ctx, notifications); err != nil {
+		zap.L().Warn(fmt.Sprintf("s.repo.CreateNotifications -> %v", err))
+	}
+}
+
+// kermesseIn returns the kermesse provided it is in one of statuses, or an
+// error telling which status it is in otherwise.
+func (s *KermesseService) kermesseIn(kermesseID uint, statuses ...domain.KermesseStatus) (domain.Kermesse, error) {
+	kermesse, err := s.repo.GetByID(kermesseID)
+	if err != nil {
+		return domain.Kermesse{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+	if err := checkKermesseStatus(kermesse, statuses...); err != nil {
+		return domain.Kermesse{}, err
+	}
+
+	return kermesse, nil
+}
+
+func checkKermesseStatus(kermesse domain.Kermesse, statuses ...domain.KermesseStatus) error {
+	if slices.Contains(statuses, kermesse.Status) {
+		return nil
+	}
+
+	switch kermesse.Status {
+	case domain.KermesseDraft:
+		return ErrKermesseNotPublished
+	case domain.KermesseClosed:
+		return ErrKermesseClosed
+	case domain.KermesseArchived:
+		return ErrKermesseArchived
+	case domain.KermesseCancelled:
+		return ErrKermesseCancelled
+	}
+
+	return ErrKermesseNotOpen
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository"
+)
+
+// OfflineAllowanceSettings are how the secrets of offline allowances are
+// derived and how long allowances last.
+type OfflineAllowanceSettings struct {
+	Key []byte
+	TTL time.Duration
+}
+
+// IssueOfflineAllowance lets the app of a student sign spend vouchers of up
+// to limit tokens while stands are offline. Students issue allowances for
+// themselves and parents for their children. The limit can't be more than
+// the student's wallet holds at the time.
+func (s *KermesseService) IssueOfflineAllowance(ctx context.Context, kermesseID uint, user domain.User, studentID uint, limit int) (domain.IssuedOfflineAllowance, error) {
+	if limit <= 0 {
+		return domain.IssuedOfflineAllowance{}, ErrInvalidAllowance
+	}
+	if _, err := s.openKermesse(kermesseID); err != nil {
+		return domain.IssuedOfflineAllowance{}, err
+	}
+
+	switch user.Role {
+	case "student":
+		if studentID != 0 && studentID != user.ID {
+			return domain.IssuedOfflineAllowance{}, ErrAllowanceNotAllowed
+		}
+		studentID = user.ID
+	case "parent":
+		student, err := s.userRepo.FindStudentByUserID(ctx, studentID)
+		if err != nil {
+			return domain.IssuedOfflineAllowance{}, fmt.Errorf("s.userRepo.FindStudentByUserID -> %w", err)
+		}
+		if student.ParentID != user.ID {
+			return domain.IssuedOfflineAllowance{}, ErrAllowanceNotAllowed
+		}
+	default:
+		return domain.IssuedOfflineAllowance{}, ErrAllowanceNotAllowed
+	}
+
+	isParticipant, err := s.IsParticipating(kermesseID, studentID)
+	if err != nil {
+		return domain.IssuedOfflineAllowance{}, fmt.Errorf("s.IsParticipating -> %w", err)
+	}
+	if !isParticipant {
+		return domain.IssuedOfflineAllowance{}, ErrUserNotParticipant
+	}
+
+	tokens, err := s.userRepo.FindWalletTokens(ctx, "student", studentID, kermesseID)
+	if err != nil {
+		return domain.IssuedOfflineAllowance{}, fmt.Errorf("s.userRepo.FindWalletTokens -> %w", err)
+	}
+	if tokens < limit {
+		return domain.IssuedOfflineAllowance{}, ErrInsufficientTokens
+	}
+
+	allowance, err := s.repo.CreateOfflineAllowance(ctx, domain.OfflineAllowance{
+		KermesseID: kermesseID,
+		StudentID:  studentID,
+		Limit:      limit,
+		ExpiresAt:  time.Now().Add(s.offline.TTL),
+	})
+	if err != nil {
+		return domain.IssuedOfflineAllowance{}, fmt.Errorf("s.repo.CreateOfflineAllowance -> %w", err)
+	}
+
+	secret := domain.OfflineAllowanceSecret(s.offline.Key, allowance.ID)
+
+	return domain.IssuedOfflineAllowance{
+		OfflineAllowance: allowance,
+		Secret:           base64.RawURLEncoding.EncodeToString(secret),
+	}, nil
+}
+
+// ReconcileOfflineVouchers redeems the vouchers a stand collected while
+// offline. Only holders of the stand can upload them. Every voucher is
+// checked and paid on its own, so a bad voucher doesn't hold back the others,
+// and uploading a batch again only reports its vouchers as duplicates.
+//
+// Vouchers must have been signed while their allowance was valid and the
+// stand open, by the time they are uploaded. Closing the kermesse stops new
+// sales, not the upload of those made before: stands can still upload their
+// vouchers once it closed, as long as the refunds haven't emptied the wallets.
+func (s *KermesseService) ReconcileOfflineVouchers(ctx context.Context, kermesseID, standID uint, holder domain.User, payloads []string) (domain.VoucherReconciliation, error) {
+	stand, err := s.heldStandIn(ctx, kermesseID, standID, holder, domain.KermesseOpen, domain.KermesseClosed)
+	if err != nil {
+		return domain.VoucherReconciliation{}, err
+	}
+	kermesse, err := s.repo.GetByID(kermesseID)
+	if err != nil {
+		return domain.VoucherReconciliation{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+	uploadedAt := time.Now()
+
+	report := domain.VoucherReconciliation{
+		KermesseID: kermesseID,
+		StandID:    standID,
+		Results:    make([]domain.VoucherResult, 0, len(payloads)),
+	}
+	for i, payload := range payloads {
+		result, err := s.redeemVoucher(ctx, kermesse, stand, payload, uploadedAt)
+		if err != nil {
+			return domain.VoucherReconciliation{}, fmt.Errorf("voucher %d: %w", i, err)
+		}
+		result.Index = i
+		report.Add(result)
+	}
+
+	return report, nil
+}
+
+// redeemVoucher pays for the voucher carried by payload, uploaded at
+// uploadedAt. Vouchers that can't be paid come out rejected with the reason,
+// errors are kept for failures unrelated to the voucher.
+func (s *KermesseService) redeemVoucher(ctx context.Context, kermesse domain.Kermesse, stand domain.Stand, payload string, uploadedAt time.Time) (domain.VoucherResult, error) {
+	rejected := func(result domain.VoucherResult, reason string) (domain.VoucherResult, error) {
+		result.Status = domain.VoucherRejected
+		result.Reason = reason
+		return result, nil
+	}
+
+	var result domain.VoucherResult
+	voucher, err := domain.ParseOfflineVoucher(payload, s.offline.Key)
+	if err != nil {
+		return rejected(result, domain.VoucherReasonInvalid)
+	}
+	result.AllowanceID = voucher.AllowanceID
+	result.Sequence = voucher.Sequence
+
+	if voucher.StandID != stand.ID {
+		return rejected(result, domain.VoucherReasonWrongStand)
+	}
+
+	allowance, err := s.repo.GetOfflineAllowance(ctx, voucher.AllowanceID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAllowanceNotFound) {
+			return rejected(result, domain.VoucherReasonUnknownAllowance)
+		}
+		return domain.VoucherResult{}, fmt.Errorf("s.repo.GetOfflineAllowance -> %w", err)
+	}
+	if allowance.KermesseID != stand.KermesseID {
+		return rejected(result, domain.VoucherReasonUnknownAllowance)
+	}
+	if voucher.SignedAt.After(allowance.ExpiresAt) {
+		return rejected(result, domain.VoucherReasonAllowanceExpired)
+	}
+	if !allowance.SignedWithin(voucher.SignedAt, uploadedAt) {
+		return rejected(result, domain.VoucherReasonInvalidSigningTime)
+	}
+	if !stand.IsOpenAt(kermesse, voucher.SignedAt) || (kermesse.IsClosed() && voucher.SignedAt.After(*kermesse.ClosedAt)) {
+		return rejected(result, domain.VoucherReasonStandClosed)
+	}
+
+	redeemed, err := s.repo.IsOfflineVoucherRedeemed(ctx, voucher)
+	if err != nil {
+		return domain.VoucherResult{}, fmt.Errorf("s.repo.IsOfflineVoucherRedeemed -> %w", err)
+	}
+	if redeemed {
+		result.Status = domain.VoucherDuplicate
+		return result, nil
+	}
+
+	// Vouchers get the promotions that were on when the app priced them,
+	// within the times checked above.
+	order, err := s.priceOrder(ctx, stand, voucher.Lines, voucher.SignedAt)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidCart) || errors.Is(err, domain.ErrItemNotInStand) {
+			return rejected(result, domain.VoucherReasonInvalidCart)
+		}
+		return domain.VoucherResult{}, fmt.Errorf("s.priceOrder -> %w", err)
+	}
+	if order.TotalTokens != voucher.Amount {
+		return rejected(result, domain.VoucherReasonPriceMismatch)
+	}
+	order.BuyerID = allowance.StudentID
+	order.BuyerType = "Student"
+
+	spend := order.Spend()
+	if !spend.IsValid() {
+		return rejected(result, domain.VoucherReasonInvalidCart)
+	}
+
+	created, err := s.repo.RedeemOfflineVoucher(ctx, voucher, order, stand.Type != "activity")
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrVoucherRedeemed):
+			result.Status = domain.VoucherDuplicate
+			return result, nil
+		case errors.Is(err, repository.ErrAllowanceExceeded):
+			return rejected(result, domain.VoucherReasonLimitExceeded)
+		case errors.Is(err, repository.ErrInsufficientTokens):
+			return rejected(result, domain.VoucherReasonInsufficientTokens)
+		case errors.Is(err, repository.ErrPurchaseConflict):
+			return rejected(result, domain.VoucherReasonConflict)
+		}
+		return domain.VoucherResult{}, fmt.Errorf("s.repo.RedeemOfflineVoucher -> %w", err)
+	}
+
+	s.alertLowStock(ctx, stand, created.TransactionID)
+
+	result.Status = domain.VoucherAccepted
+	result.Order = &created
+
+	return result, nil
+}
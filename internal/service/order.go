@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// Checkout buys the items of cart at a stand in one order, paid by a single
+// spend. Every line is priced from the stand's stock and the whole order goes
+// through or none of it does.
+func (s *KermesseService) Checkout(ctx context.Context, userID, kermesseID, standID uint, cart []domain.CartLine) (domain.Order, error) {
+	stand, order, err := s.prepareOrder(ctx, userID, kermesseID, standID, cart)
+	if err != nil {
+		return domain.Order{}, err
+	}
+
+	// The stock and balance checks are re-applied under lock there.
+	created, err := s.repo.Checkout(ctx, order, stand.Type != "activity")
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("s.repo.Checkout -> %w", err)
+	}
+	s.alertLowStock(ctx, stand, created.TransactionID)
+
+	return created, nil
+}
+
+// prepareOrder prices cart at a stand for the user and checks that they can
+// pay for it, returning the stand along with the order.
+func (s *KermesseService) prepareOrder(ctx context.Context, userID, kermesseID, standID uint, cart []domain.CartLine) (domain.Stand, domain.Order, error) {
+	if _, err := s.openKermesse(kermesseID); err != nil {
+		return domain.Stand{}, domain.Order{}, err
+	}
+
+	stand, err := s.repo.GetStandByID(standID)
+	if err != nil {
+		return domain.Stand{}, domain.Order{}, fmt.Errorf("s.repo.GetStandByID -> %w", err)
+	}
+	if stand.KermesseID != kermesseID {
+		return domain.Stand{}, domain.Order{}, ErrStandNotInKermesse
+	}
+	if stand.IsArchived() {
+		return domain.Stand{}, domain.Order{}, ErrStandNotFound
+	}
+	if err := s.checkStandOpen(stand); err != nil {
+		return domain.Stand{}, domain.Order{}, err
+	}
+
+	order, err := s.priceOrder(ctx, stand, cart, time.Now())
+	if err != nil {
+		return domain.Stand{}, domain.Order{}, fmt.Errorf("s.priceOrder -> %w", err)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return domain.Stand{}, domain.Order{}, fmt.Errorf("s.userRepo.FindByID -> %w", err)
+	}
+
+	switch user.Role {
+	case "student":
+		order.BuyerType = "Student"
+	case "parent":
+		order.BuyerType = "Parent"
+	default:
+		return domain.Stand{}, domain.Order{}, ErrInvalidUserRole
+	}
+	order.BuyerID = userID
+
+	if err := s.checkOrder(ctx, stand, order, user.Role); err != nil {
+		return domain.Stand{}, domain.Order{}, err
+	}
+
+	spend := order.Spend()
+	if !spend.IsValid() {
+		return domain.Stand{}, domain.Order{}, ErrInvalidTransaction
+	}
+
+	return stand, order, nil
+}
+
+// checkOrder tells whether the stand has the items of order in stock and
+// the buyer, whose role is role, enough tokens in their wallet to pay. Items
+// reserved by others aren't in stock, those the buyer reserved are.
+func (s *KermesseService) checkOrder(ctx context.Context, stand domain.Stand, order domain.Order, role string) error {
+	// Activity stands don't run out of stock.
+	if stand.Type != "activity" {
+		reservations, err := s.repo.GetHeldReservations(ctx, order.BuyerID, stand.ID)
+		if err != nil {
+			return fmt.Errorf("s.repo.GetHeldReservations -> %w", err)
+		}
+		held := domain.HeldQuantities(reservations, time.Now())
+
+		for _, line := range order.Lines {
+			i := slices.IndexFunc(stand.Stock, func(s domain.Stock) bool { return s.ID == line.StockID })
+			if i < 0 || stand.Stock[i].IsArchived() {
+				return ErrItemNotInStand
+			}
+			if stand.Stock[i].AvailableQuantity()+held[line.StockID] < line.Quantity {
+				return ErrInsufficientStock
+			}
+		}
+	}
+
+	// Only the wallet of this kermesse can pay
+	userTokens, err := s.userRepo.FindWalletTokens(ctx, role, order.BuyerID, order.KermesseID)
+	if err != nil {
+		return fmt.Errorf("s.userRepo.FindWalletTokens -> %w", err)
+	}
+	if userTokens < order.TotalTokens {
+		return ErrInsufficientTokens
+	}
+
+	return nil
+}
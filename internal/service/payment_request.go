@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/pkg/qrcode"
+)
+
+// PaymentRequestSettings are how stand payment requests are signed and how
+// long they can be paid.
+type PaymentRequestSettings struct {
+	Key []byte
+	TTL time.Duration
+}
+
+// CreatePaymentRequest issues a signed payment request for cart at a stand,
+// for a buyer to scan and pay. Only holders of the stand can issue one. A
+// non-zero amount is the total the holder expects and must match the cart.
+func (s *KermesseService) CreatePaymentRequest(ctx context.Context, kermesseID, standID uint, holder domain.User, cart []domain.CartLine, amount int) (domain.SignedStandPaymentRequest, error) {
+	stand, err := s.heldStand(ctx, kermesseID, standID, holder)
+	if err != nil {
+		return domain.SignedStandPaymentRequest{}, err
+	}
+	if err := s.checkStandOpen(stand); err != nil {
+		return domain.SignedStandPaymentRequest{}, err
+	}
+
+	order, err := s.priceOrder(ctx, stand, cart, time.Now())
+	if err != nil {
+		return domain.SignedStandPaymentRequest{}, fmt.Errorf("s.priceOrder -> %w", err)
+	}
+	if amount != 0 && amount != order.TotalTokens {
+		return domain.SignedStandPaymentRequest{}, ErrPaymentRequestAmount
+	}
+
+	request, err := domain.NewStandPaymentRequest(order, s.paymentRequests.TTL)
+	if err != nil {
+		return domain.SignedStandPaymentRequest{}, fmt.Errorf("domain.NewStandPaymentRequest -> %w", err)
+	}
+
+	return domain.SignedStandPaymentRequest{
+		StandPaymentRequest: request,
+		Payload:             request.Sign(s.paymentRequests.Key),
+	}, nil
+}
+
+// PayPaymentRequest pays the payment request carried by payload as the
+// user. The request must be signed by us, unexpired and unpaid, and the
+// cart must still cost what the request says.
+func (s *KermesseService) PayPaymentRequest(ctx context.Context, kermesseID, userID uint, payload string) (domain.Order, error) {
+	request, err := s.parsePaymentRequest(kermesseID, payload)
+	if err != nil {
+		return domain.Order{}, err
+	}
+
+	stand, order, err := s.prepareOrder(ctx, userID, kermesseID, request.StandID, request.Lines)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if order.TotalTokens != request.Amount {
+		return domain.Order{}, ErrPaymentRequestRepriced
+	}
+
+	created, err := s.repo.PayPaymentRequest(ctx, request, order, stand.Type != "activity")
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("s.repo.PayPaymentRequest -> %w", err)
+	}
+	s.alertLowStock(ctx, stand, created.TransactionID)
+
+	return created, nil
+}
+
+// PaymentRequestQRCode renders payload as a PNG QR code about size pixels
+// wide. Only payment requests we signed and that can still be paid are
+// rendered.
+func (s *KermesseService) PaymentRequestQRCode(kermesseID uint, payload string, size int) ([]byte, error) {
+	if _, err := s.parsePaymentRequest(kermesseID, payload); err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.Encode([]byte(payload), qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("qrcode.Encode -> %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := code.WritePNG(&out, size/(code.Size+2*qrcode.QuietZone)); err != nil {
+		return nil, fmt.Errorf("code.WritePNG -> %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+func (s *KermesseService) parsePaymentRequest(kermesseID uint, payload string) (domain.StandPaymentRequest, error) {
+	request, err := domain.ParseStandPaymentRequest(payload, s.paymentRequests.Key)
+	if err != nil {
+		return domain.StandPaymentRequest{}, fmt.Errorf("domain.ParseStandPaymentRequest -> %w", err)
+	}
+	if request.KermesseID != kermesseID {
+		return domain.StandPaymentRequest{}, ErrInvalidPaymentRequest
+	}
+	if request.Expired() {
+		return domain.StandPaymentRequest{}, ErrPaymentRequestExpired
+	}
+
+	return request, nil
+}
+
+// heldStand returns the stand of an open kermesse, provided holder is one of
+// its holders.
+func (s *KermesseService) heldStand(ctx context.Context, kermesseID, standID uint, holder domain.User) (domain.Stand, error) {
+	return s.heldStandIn(ctx, kermesseID, standID, holder, domain.KermesseOpen)
+}
+
+// heldStandIn returns the stand of a kermesse in one of statuses, provided
+// holder is one of its holders.
+func (s *KermesseService) heldStandIn(ctx context.Context, kermesseID, standID uint, holder domain.User, statuses ...domain.KermesseStatus) (domain.Stand, error) {
+	if _, err := s.kermesseIn(kermesseID, statuses...); err != nil {
+		return domain.Stand{}, err
+	}
+
+	stand, err := s.repo.GetStandByID(standID)
+	if err != nil {
+		return domain.Stand{}, fmt.Errorf("s.repo.GetStandByID -> %w", err)
+	}
+	if stand.KermesseID != kermesseID {
+		return domain.Stand{}, ErrStandNotInKermesse
+	}
+	if stand.IsArchived() {
+		return domain.Stand{}, ErrStandNotFound
+	}
+
+	if holder.Role != "stand_holder" {
+		return domain.Stand{}, ErrNotStandHolder
+	}
+	isHolder, err := s.IsStandHolderAssociatedWithStand(ctx, holder.ID, standID)
+	if err != nil {
+		return domain.Stand{}, fmt.Errorf("s.IsStandHolderAssociatedWithStand -> %w", err)
+	}
+	if !isHolder {
+		return domain.Stand{}, ErrNotStandHolder
+	}
+
+	return stand, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository"
+)
+
+// CreateCharge rings up cart at a stand for the student whose short code or
+// badge ID is studentCode. Only holders of the stand can charge. Charges
+// within the student's auto-approve limit are settled at once, the others
+// wait for the student or their parent to confirm them.
+func (s *KermesseService) CreateCharge(ctx context.Context, kermesseID, standID uint, holder domain.User, studentCode string, cart []domain.CartLine) (domain.Charge, error) {
+	stand, err := s.heldStand(ctx, kermesseID, standID, holder)
+	if err != nil {
+		return domain.Charge{}, err
+	}
+	if err := s.checkStandOpen(stand); err != nil {
+		return domain.Charge{}, err
+	}
+
+	student, err := s.userRepo.FindStudentByCode(ctx, studentCode)
+	if err != nil {
+		if errors.Is(err, repository.ErrStudentNotFound) {
+			return domain.Charge{}, ErrUnknownStudentCode
+		}
+		return domain.Charge{}, fmt.Errorf("s.userRepo.FindStudentByCode -> %w", err)
+	}
+
+	isParticipant, err := s.IsParticipating(kermesseID, student.UserID)
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("s.IsParticipating -> %w", err)
+	}
+	if !isParticipant {
+		return domain.Charge{}, ErrUserNotParticipant
+	}
+
+	order, err := s.priceOrder(ctx, stand, cart, time.Now())
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("s.priceOrder -> %w", err)
+	}
+	order.BuyerID = student.UserID
+	order.BuyerType = "Student"
+
+	if err := s.checkOrder(ctx, stand, order, "student"); err != nil {
+		return domain.Charge{}, err
+	}
+
+	spend := order.Spend()
+	if !spend.IsValid() {
+		return domain.Charge{}, ErrInvalidTransaction
+	}
+
+	if order.TotalTokens <= student.AutoApproveLimit {
+		created, err := s.repo.Checkout(ctx, order, stand.Type != "activity")
+		if err != nil {
+			return domain.Charge{}, fmt.Errorf("s.repo.Checkout -> %w", err)
+		}
+		s.alertLowStock(ctx, stand, created.TransactionID)
+
+		charge, err := s.repo.GetCharge(ctx, created.TransactionID)
+		if err != nil {
+			return domain.Charge{}, fmt.Errorf("s.repo.GetCharge -> %w", err)
+		}
+
+		return charge, nil
+	}
+
+	charge, err := s.repo.CreateCharge(ctx, order)
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("s.repo.CreateCharge -> %w", err)
+	}
+
+	return charge, nil
+}
+
+// ConfirmCharge settles a pending charge on behalf of the student charged
+// or their parent. Stock and tokens are checked again, as they may have
+// moved since the charge was rung up.
+func (s *KermesseService) ConfirmCharge(ctx context.Context, kermesseID, transactionID uint, user domain.User) (domain.Charge, error) {
+	if _, err := s.openKermesse(kermesseID); err != nil {
+		return domain.Charge{}, err
+	}
+
+	charge, err := s.repo.GetCharge(ctx, transactionID)
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("s.repo.GetCharge -> %w", err)
+	}
+	if charge.Transaction.KermesseID != kermesseID || charge.Transaction.Type != domain.TokenSpend {
+		return domain.Charge{}, ErrTransactionNotFound
+	}
+
+	allowed, err := s.isChargedStudentOrParent(ctx, charge.Transaction, user)
+	if err != nil {
+		return domain.Charge{}, err
+	}
+	if !allowed {
+		return domain.Charge{}, ErrChargeNotAllowed
+	}
+
+	if charge.Transaction.Status != "Pending" {
+		return domain.Charge{}, ErrInvalidTransactionStatus
+	}
+
+	stand, err := s.repo.GetStandByID(charge.Order.StandID)
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("s.repo.GetStandByID -> %w", err)
+	}
+	if stand.IsArchived() {
+		return domain.Charge{}, ErrStandNotFound
+	}
+	if err := s.checkStandOpen(stand); err != nil {
+		return domain.Charge{}, err
+	}
+
+	if err := s.checkOrder(ctx, stand, charge.Order, "student"); err != nil {
+		return domain.Charge{}, err
+	}
+
+	confirmed, err := s.repo.ConfirmCharge(ctx, charge.Order, stand.Type != "activity")
+	if err != nil {
+		return domain.Charge{}, fmt.Errorf("s.repo.ConfirmCharge -> %w", err)
+	}
+	s.alertLowStock(ctx, stand, charge.Order.TransactionID)
+
+	return confirmed, nil
+}
+
+// isChargedStudentOrParent tells whether user is the student a stand
+// charged with transaction, or their parent. It goes by who the student and
+// their parent are rather than by the role of user, which may also work at a
+// stand.
+func (s *KermesseService) isChargedStudentOrParent(ctx context.Context, transaction domain.TokenTransaction, user domain.User) (bool, error) {
+	if !strings.EqualFold(transaction.FromType, "student") {
+		return false, nil
+	}
+	if user.ID == transaction.FromID {
+		return true, nil
+	}
+
+	student, err := s.userRepo.FindStudentByUserID(ctx, transaction.FromID)
+	if err != nil {
+		return false, fmt.Errorf("s.userRepo.FindStudentByUserID -> %w", err)
+	}
+
+	return student.ParentID == user.ID, nil
+}
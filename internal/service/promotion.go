@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// CreatePromotion adds a promotion to a stand. Managers of the stand and
+// organizers of the kermesse can add one, and its items must be sold at the
+// stand. Like the rest of the stand, promotions can be set up before the
+// kermesse opens.
+func (s *KermesseService) CreatePromotion(ctx context.Context, kermesseID, standID uint, user domain.User, promotion domain.Promotion) (domain.Promotion, error) {
+	if _, err := s.kermesseIn(kermesseID, domain.KermesseDraft, domain.KermessePublished, domain.KermesseOpen); err != nil {
+		return domain.Promotion{}, err
+	}
+	stand, err := s.managedStand(ctx, kermesseID, standID, user)
+	if err != nil {
+		return domain.Promotion{}, err
+	}
+
+	promotion.StandID = stand.ID
+	promotion.Active = true
+	if err := promotion.Validate(stand); err != nil {
+		return domain.Promotion{}, fmt.Errorf("promotion.Validate -> %w", err)
+	}
+
+	created, err := s.repo.CreatePromotion(ctx, promotion)
+	if err != nil {
+		return domain.Promotion{}, fmt.Errorf("s.repo.CreatePromotion -> %w", err)
+	}
+
+	return created, nil
+}
+
+// GetPromotions returns the active promotions of a stand, for buyers to see
+// what's on offer.
+func (s *KermesseService) GetPromotions(ctx context.Context, kermesseID, standID uint) ([]domain.Promotion, error) {
+	stand, err := s.repo.GetStandByID(standID)
+	if err != nil {
+		return nil, fmt.Errorf("s.repo.GetStandByID -> %w", err)
+	}
+	if stand.KermesseID != kermesseID {
+		return nil, ErrStandNotInKermesse
+	}
+
+	promotions, err := s.repo.GetPromotions(ctx, standID, true)
+	if err != nil {
+		return nil, fmt.Errorf("s.repo.GetPromotions -> %w", err)
+	}
+
+	return promotions, nil
+}
+
+// DeactivatePromotion ends a promotion of a stand. Managers of the stand and
+// organizers of the kermesse can end one, until the kermesse closes.
+func (s *KermesseService) DeactivatePromotion(ctx context.Context, kermesseID, standID uint, user domain.User, promotionID uint) error {
+	if _, err := s.kermesseIn(kermesseID, domain.KermesseDraft, domain.KermessePublished, domain.KermesseOpen); err != nil {
+		return err
+	}
+	if _, err := s.managedStand(ctx, kermesseID, standID, user); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeactivatePromotion(ctx, standID, promotionID); err != nil {
+		return fmt.Errorf("s.repo.DeactivatePromotion -> %w", err)
+	}
+
+	return nil
+}
+
+// priceOrder prices cart at the stand, taking off the best of the stand's
+// promotions on at the time.
+func (s *KermesseService) priceOrder(ctx context.Context, stand domain.Stand, cart []domain.CartLine, at time.Time) (domain.Order, error) {
+	order, err := domain.NewOrder(stand, cart)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("domain.NewOrder -> %w", err)
+	}
+
+	promotions, err := s.repo.GetPromotions(ctx, stand.ID, true)
+	if err != nil {
+		return domain.Order{}, fmt.Errorf("s.repo.GetPromotions -> %w", err)
+	}
+	order.ApplyBestPromotion(promotions, at)
+
+	return order, nil
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.uber.org/zap"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository"
+)
+
+// CloseKermesse ends an open kermesse. Tokens can no longer be bought, given
+// or spent there, and unused ones can be refunded with RunKermesseRefunds.
+func (s *KermesseService) CloseKermesse(ctx context.Context, kermesseID uint, user domain.User) (domain.Kermesse, error) {
+	return s.SetKermesseStatus(ctx, kermesseID, user, domain.KermesseClosed)
+}
+
+// RunKermesseRefunds pays the unused tokens of a closed kermesse back to the
+// cards of the parents who bought them. The tokens of a family, the parent's
+// and their children's, are refunded against the parent's card purchases,
+// newest first, never for more than a purchase cost.
+//
+// Every refund is recorded as pending, with its tokens taken out of the
+// wallet, before the payment provider is asked for the money, under an
+// idempotency key derived from the refund. A run that stopped half-way, or
+// refunds the provider could not be reached for, are therefore completed by
+// running again, which also makes a run on a fully refunded kermesse a no-op.
+// Refunds the provider declines are not retried: they are reported for the
+// organizers to pay back by hand.
+func (s *KermesseService) RunKermesseRefunds(ctx context.Context, kermesseID uint, user domain.User) (domain.RefundRunReport, error) {
+	kermesse, err := s.closedKermesse(kermesseID, user)
+	if err != nil {
+		return domain.RefundRunReport{}, err
+	}
+
+	refunds, err := s.repo.GetRefunds(ctx, kermesseID)
+	if err != nil {
+		return domain.RefundRunReport{}, fmt.Errorf("s.repo.GetRefunds -> %w", err)
+	}
+	for _, refund := range refunds {
+		if refund.Status != "Pending" {
+			continue
+		}
+		purchase, err := s.repo.GetTokenTransactionByID(*refund.ReversedTransactionID)
+		if err != nil {
+			return domain.RefundRunReport{}, fmt.Errorf("s.repo.GetTokenTransactionByID -> %w", err)
+		}
+		if err := s.issueRefund(ctx, purchase, refund); err != nil {
+			return domain.RefundRunReport{}, err
+		}
+	}
+
+	wallets, err := s.repo.GetKermesseWallets(ctx, kermesseID)
+	if err != nil {
+		return domain.RefundRunReport{}, fmt.Errorf("s.repo.GetKermesseWallets -> %w", err)
+	}
+
+	families, err := s.walletsByParent(ctx, wallets)
+	if err != nil {
+		return domain.RefundRunReport{}, err
+	}
+
+	for parentID, family := range families {
+		purchases, err := s.repo.GetRefundablePurchases(ctx, kermesseID, parentID)
+		if err != nil {
+			return domain.RefundRunReport{}, fmt.Errorf("s.repo.GetRefundablePurchases -> %w", err)
+		}
+
+		for _, wallet := range family {
+			tokens := wallet.Balance
+			for i := 0; tokens > 0 && i < len(purchases); i++ {
+				purchase := &purchases[i]
+				n := min(tokens, purchase.RefundableTokens())
+				if n == 0 {
+					continue
+				}
+
+				refund, err := purchase.RefundTokens(string(wallet.Type), wallet.OwnerID, n)
+				if err != nil {
+					return domain.RefundRunReport{}, fmt.Errorf("purchase.RefundTokens -> %w", err)
+				}
+				refund, err = s.repo.CreateRefund(ctx, *purchase, refund)
+				if err != nil {
+					return domain.RefundRunReport{}, fmt.Errorf("s.repo.CreateRefund -> %w", err)
+				}
+				purchase.RefundedQuantity += n
+				tokens -= n
+
+				if err := s.issueRefund(ctx, *purchase, refund); err != nil {
+					return domain.RefundRunReport{}, err
+				}
+			}
+		}
+	}
+
+	return s.refundReport(ctx, kermesse)
+}
+
+// GetRefundReport sums up the refunds of a closed kermesse so far.
+func (s *KermesseService) GetRefundReport(ctx context.Context, kermesseID uint, user domain.User) (domain.RefundRunReport, error) {
+	kermesse, err := s.closedKermesse(kermesseID, user)
+	if err != nil {
+		return domain.RefundRunReport{}, err
+	}
+
+	return s.refundReport(ctx, kermesse)
+}
+
+func (s *KermesseService) checkOrganizer(kermesseID uint, user domain.User) error {
+	isOrganizer, err := s.repo.IsUserKermesseOrganizer(kermesseID, user.ID)
+	if err != nil {
+		return fmt.Errorf("s.repo.IsUserKermesseOrganizer -> %w", err)
+	}
+	if !isOrganizer {
+		return ErrUnauthorizedOrganizer
+	}
+
+	return nil
+}
+
+func (s *KermesseService) closedKermesse(kermesseID uint, user domain.User) (domain.Kermesse, error) {
+	kermesse, err := s.repo.GetByID(kermesseID)
+	if err != nil {
+		return domain.Kermesse{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+	if err := s.checkOrganizer(kermesseID, user); err != nil {
+		return domain.Kermesse{}, err
+	}
+	if !kermesse.IsClosed() {
+		return domain.Kermesse{}, ErrKermesseNotClosed
+	}
+
+	return kermesse, nil
+}
+
+// openKermesse returns the kermesse provided tokens can move in it, i.e. it
+// is open.
+func (s *KermesseService) openKermesse(kermesseID uint) (domain.Kermesse, error) {
+	return s.kermesseIn(kermesseID, domain.KermesseOpen)
+}
+
+// walletsByParent groups wallets by the parent paying for them, the parent's
+// own wallet first. Wallets of students without a parent are left out.
+func (s *KermesseService) walletsByParent(ctx context.Context, wallets []domain.LedgerAccount) (map[uint][]domain.LedgerAccount, error) {
+	families := map[uint][]domain.LedgerAccount{}
+	for _, wallet := range wallets {
+		switch wallet.Type {
+		case domain.LedgerAccountParent:
+			families[wallet.OwnerID] = append([]domain.LedgerAccount{wallet}, families[wallet.OwnerID]...)
+		case domain.LedgerAccountStudent:
+			student, err := s.userRepo.FindStudentByUserID(ctx, wallet.OwnerID)
+			if err != nil {
+				return nil, fmt.Errorf("s.userRepo.FindStudentByUserID -> %w", err)
+			}
+			if student.ParentID == 0 {
+				continue
+			}
+			families[student.ParentID] = append(families[student.ParentID], wallet)
+		}
+	}
+
+	return families, nil
+}
+
+// issueRefund asks the payment provider for the money of a pending refund. The
+// refund stays pending, and is retried by the next run, when the provider
+// can't be reached. A refund the provider declines fails for good, since
+// retrying under the same idempotency key would only get the same answer.
+func (s *KermesseService) issueRefund(ctx context.Context, purchase, refund domain.TokenTransaction) error {
+	var reference string
+	if refund.MoneyAmount > 0 {
+		paymentRefund, err := s.payments.Refund(ctx, domain.RefundRequest{
+			PaymentID:      purchase.PaymentReference,
+			Amount:         refund.MoneyAmount,
+			IdempotencyKey: fmt.Sprintf("kermesse-refund-%d", refund.ID),
+		})
+		if err != nil {
+			zap.L().Warn(fmt.Sprintf("refund %d: s.payments.Refund -> %v", refund.ID, err))
+			return nil
+		}
+		if paymentRefund.Status == domain.PaymentFailed {
+			zap.L().Warn(fmt.Sprintf("refund %d declined: %s", refund.ID, paymentRefund.FailureReason))
+
+			err := s.repo.FailRefund(ctx, refund.ID, paymentRefund.FailureReason)
+			if err != nil && !errors.Is(err, repository.ErrInvalidTransactionStatus) {
+				return fmt.Errorf("s.repo.FailRefund -> %w", err)
+			}
+
+			return nil
+		}
+		reference = paymentRefund.ID
+	}
+
+	err := s.repo.CompleteRefund(ctx, refund.ID, reference)
+	if err != nil && !errors.Is(err, repository.ErrInvalidTransactionStatus) {
+		return fmt.Errorf("s.repo.CompleteRefund -> %w", err)
+	}
+
+	return nil
+}
+
+func (s *KermesseService) refundReport(ctx context.Context, kermesse domain.Kermesse) (domain.RefundRunReport, error) {
+	refunds, err := s.repo.GetRefunds(ctx, kermesse.ID)
+	if err != nil {
+		return domain.RefundRunReport{}, fmt.Errorf("s.repo.GetRefunds -> %w", err)
+	}
+
+	wallets, err := s.repo.GetKermesseWallets(ctx, kermesse.ID)
+	if err != nil {
+		return domain.RefundRunReport{}, fmt.Errorf("s.repo.GetKermesseWallets -> %w", err)
+	}
+
+	report := domain.RefundRunReport{
+		KermesseID:      kermesse.ID,
+		Currency:        kermesse.Currency,
+		Parents:         []domain.ParentRefunds{},
+		PendingRefunds:  []uint{},
+		DeclinedRefunds: []uint{},
+	}
+
+	parents := map[uint]*domain.ParentRefunds{}
+	var parentIDs []uint
+	for _, refund := range refunds {
+		parent, ok := parents[refund.ToID]
+		if !ok {
+			parent = &domain.ParentRefunds{ParentID: refund.ToID}
+			parents[refund.ToID] = parent
+			parentIDs = append(parentIDs, refund.ToID)
+		}
+
+		switch refund.Status {
+		case "Pending":
+			parent.PendingTokens += refund.Amount
+			report.PendingRefunds = append(report.PendingRefunds, refund.ID)
+			continue
+		case "Failed":
+			parent.DeclinedTokens += refund.Amount
+			parent.DeclinedAmount += refund.MoneyAmount
+			report.DeclinedRefunds = append(report.DeclinedRefunds, refund.ID)
+			report.DeclinedAmount += refund.MoneyAmount
+			continue
+		}
+		parent.RefundedTokens += refund.Amount
+		parent.RefundedAmount += refund.MoneyAmount
+		report.RefundedTokens += refund.Amount
+		report.RefundedAmount += refund.MoneyAmount
+	}
+
+	slices.Sort(parentIDs)
+	for _, id := range parentIDs {
+		report.Parents = append(report.Parents, *parents[id])
+	}
+
+	for _, wallet := range wallets {
+		report.UnrefundableTokens += wallet.Balance
+	}
+
+	return report, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// ReserveStock holds the items of cart at a stand for the user, so that
+// nobody else can buy them while they make up their mind. The reservations
+// last the reservation TTL; the user's next checkout at the stand confirms
+// them.
+func (s *KermesseService) ReserveStock(ctx context.Context, userID, kermesseID, standID uint, cart []domain.CartLine) ([]domain.StockReservation, error) {
+	if _, err := s.openKermesse(kermesseID); err != nil {
+		return nil, err
+	}
+
+	stand, err := s.repo.GetStandByID(standID)
+	if err != nil {
+		return nil, fmt.Errorf("s.repo.GetStandByID -> %w", err)
+	}
+	if stand.KermesseID != kermesseID {
+		return nil, ErrStandNotInKermesse
+	}
+	if stand.IsArchived() {
+		return nil, ErrStandNotFound
+	}
+	if stand.Type == "activity" {
+		return nil, ErrNothingToReserve
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("s.userRepo.FindByID -> %w", err)
+	}
+	if user.Role != "student" && user.Role != "parent" {
+		return nil, ErrInvalidUserRole
+	}
+
+	reservations, err := domain.NewStockReservations(stand, userID, cart, time.Now().Add(s.reservationTTL))
+	if err != nil {
+		return nil, fmt.Errorf("domain.NewStockReservations -> %w", err)
+	}
+
+	// Availability is checked under lock there.
+	created, err := s.repo.ReserveStock(ctx, reservations)
+	if err != nil {
+		return nil, fmt.Errorf("s.repo.ReserveStock -> %w", err)
+	}
+
+	return created, nil
+}
+
+// ReleaseReservation gives up a reservation the user holds, putting its
+// items back on sale.
+func (s *KermesseService) ReleaseReservation(ctx context.Context, kermesseID, reservationID, userID uint) (domain.StockReservation, error) {
+	released, err := s.repo.ReleaseReservation(ctx, kermesseID, reservationID, userID)
+	if err != nil {
+		return domain.StockReservation{}, fmt.Errorf("s.repo.ReleaseReservation -> %w", err)
+	}
+
+	return released, nil
+}
+
+// ReleaseExpiredReservations puts the items of expired reservations back on
+// sale, returning how many reservations expired.
+func (s *KermesseService) ReleaseExpiredReservations(ctx context.Context) (int, error) {
+	released, err := s.repo.ReleaseExpiredReservations(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("s.repo.ReleaseExpiredReservations -> %w", err)
+	}
+
+	return released, nil
+}
+
+// SweepReservations releases expired reservations every interval until ctx
+// is done. Checkouts ignore expired reservations anyway, the sweep only gives
+// their items back to the others.
+func (s *KermesseService) SweepReservations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, err := s.ReleaseExpiredReservations(ctx)
+			if err != nil {
+				zap.L().Warn(fmt.Sprintf("s.ReleaseExpiredReservations -> %v", err))
+				continue
+			}
+			if released > 0 {
+				zap.L().Debug(fmt.Sprintf("released %d expired stock reservations", released))
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/request"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// GetStand returns a stand of a kermesse without its archived stock items,
+// its times in the time zone of the kermesse. Archived stands aren't found.
+func (s *KermesseService) GetStand(kermesseID, standID uint) (domain.Stand, error) {
+	kermesse, err := s.repo.GetByID(kermesseID)
+	if err != nil {
+		return domain.Stand{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+
+	stand, err := s.repo.GetStandByID(standID)
+	if err != nil {
+		return domain.Stand{}, fmt.Errorf("s.repo.GetStandByID -> %w", err)
+	}
+	if stand.KermesseID != kermesseID {
+		return domain.Stand{}, ErrStandNotInKermesse
+	}
+	if stand.IsArchived() {
+		return domain.Stand{}, ErrStandNotFound
+	}
+
+	return stand.Live().InLocation(kermesse.Zone()), nil
+}
+
+// staffedStand returns a stand of a kermesse, provided user is on its staff
+// or an organizer of the kermesse. With manage set, cashiers are refused.
+func (s *KermesseService) staffedStand(ctx context.Context, kermesseID, standID uint, user domain.User, manage bool) (domain.Stand, error) {
+	stand, err := s.GetStand(kermesseID, standID)
+	if err != nil {
+		return domain.Stand{}, err
+	}
+
+	isOrganizer, err := s.repo.IsUserKermesseOrganizer(kermesseID, user.ID)
+	if err != nil {
+		return domain.Stand{}, fmt.Errorf("s.repo.IsUserKermesseOrganizer -> %w", err)
+	}
+	if isOrganizer {
+		return stand, nil
+	}
+
+	member, err := s.repo.GetStandStaffMember(ctx, standID, user.ID)
+	if err != nil {
+		if errors.Is(err, ErrStandStaffNotFound) {
+			return domain.Stand{}, ErrNotStandHolder
+		}
+		return domain.Stand{}, fmt.Errorf("s.repo.GetStandStaffMember -> %w", err)
+	}
+	if manage && !member.CanManage() {
+		return domain.Stand{}, ErrNotStandManager
+	}
+
+	return stand, nil
+}
+
+// managedStand returns a stand of a kermesse, provided user is one of its
+// managers or an organizer of the kermesse.
+func (s *KermesseService) managedStand(ctx context.Context, kermesseID, standID uint, user domain.User) (domain.Stand, error) {
+	return s.staffedStand(ctx, kermesseID, standID, user, true)
+}
+
+// UpdateStand edits the name, type, description or opening hours of a
+// stand. Managers of the stand and organizers of the kermesse can edit it.
+func (s *KermesseService) UpdateStand(ctx context.Context, kermesseID, standID uint, user domain.User, req request.StandPatchRequest) (domain.Stand, error) {
+	stand, err := s.managedStand(ctx, kermesseID, standID, user)
+	if err != nil {
+		return domain.Stand{}, err
+	}
+	kermesse, err := s.repo.GetByID(kermesseID)
+	if err != nil {
+		return domain.Stand{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+
+	if req.Name != nil {
+		stand.Name = *req.Name
+	}
+	if req.Type != nil {
+		stand.Type = *req.Type
+	}
+	if req.Description != nil {
+		stand.Description = *req.Description
+	}
+	if req.OpensAt != nil {
+		if stand.OpensAt, err = parseOptionalTime(*req.OpensAt); err != nil {
+			return domain.Stand{}, err
+		}
+	}
+	if req.ClosesAt != nil {
+		if stand.ClosesAt, err = parseOptionalTime(*req.ClosesAt); err != nil {
+			return domain.Stand{}, err
+		}
+	}
+	if err := stand.CheckOpeningHours(kermesse); err != nil {
+		return domain.Stand{}, err
+	}
+
+	updated, err := s.repo.UpdateStandDetails(ctx, stand)
+	if err != nil {
+		return domain.Stand{}, fmt.Errorf("s.repo.UpdateStandDetails -> %w", err)
+	}
+
+	return updated.Live().InLocation(kermesse.Zone()), nil
+}
+
+// checkStandOpen returns ErrStandClosed unless the stand takes sales now.
+func (s *KermesseService) checkStandOpen(stand domain.Stand) error {
+	kermesse, err := s.repo.GetByID(stand.KermesseID)
+	if err != nil {
+		return fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+	if !stand.IsOpenAt(kermesse, time.Now()) {
+		return ErrStandClosed
+	}
+
+	return nil
+}
+
+// parseOptionalTime parses an RFC 3339 time, nil when value is empty.
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("time.Parse -> %w", err)
+	}
+
+	return &t, nil
+}
+
+// ArchiveStand takes a stand off the kermesse. It takes no new sales, but
+// the transactions made at it keep referring to it.
+func (s *KermesseService) ArchiveStand(ctx context.Context, kermesseID, standID uint, user domain.User) error {
+	if _, err := s.managedStand(ctx, kermesseID, standID, user); err != nil {
+		return err
+	}
+
+	if err := s.repo.ArchiveStand(ctx, standID); err != nil {
+		return fmt.Errorf("s.repo.ArchiveStand -> %w", err)
+	}
+
+	return nil
+}
+
+// GetStandStock returns a stock item of a stand to its staff and the
+// organizers of the kermesse.
+func (s *KermesseService) GetStandStock(ctx context.Context, kermesseID, standID, stockID uint, user domain.User) (domain.Stock, error) {
+	return s.standStock(ctx, kermesseID, standID, stockID, user, false)
+}
+
+// standStock returns a stock item of a stand that user may see, or edit
+// with manage set.
+func (s *KermesseService) standStock(ctx context.Context, kermesseID, standID, stockID uint, user domain.User, manage bool) (domain.Stock, error) {
+	stand, err := s.staffedStand(ctx, kermesseID, standID, user, manage)
+	if err != nil {
+		return domain.Stock{}, err
+	}
+
+	for _, stock := range stand.Stock {
+		if stock.ID == stockID {
+			return stock, nil
+		}
+	}
+
+	return domain.Stock{}, ErrStockNotFound
+}
+
+// UpdateStandStock edits a stock item of a stand. A change of quantity is
+// journaled with the reason of req, an adjustment unless told otherwise.
+func (s *KermesseService) UpdateStandStock(ctx context.Context, kermesseID, standID, stockID uint, user domain.User, req request.StockPatchRequest) (domain.Stock, error) {
+	stock, err := s.standStock(ctx, kermesseID, standID, stockID, user, true)
+	if err != nil {
+		return domain.Stock{}, err
+	}
+
+	if req.ItemName != nil {
+		stock.ItemName = *req.ItemName
+	}
+	if req.TokenCost != nil {
+		stock.TokenCost = *req.TokenCost
+	}
+	if req.LowStockThreshold != nil {
+		stock.LowStockThreshold = *req.LowStockThreshold
+	}
+
+	if req.Quantity == nil || *req.Quantity == stock.Quantity {
+		updated, err := s.repo.UpdateStockDetails(ctx, stock)
+		if err != nil {
+			return domain.Stock{}, fmt.Errorf("s.repo.UpdateStockDetails -> %w", err)
+		}
+
+		return updated, nil
+	}
+
+	reason := domain.StockAdjustment
+	if req.Reason != "" {
+		reason = domain.StockMovementReason(req.Reason)
+	}
+	if !reason.AllowsManual(*req.Quantity - stock.Quantity) {
+		return domain.Stock{}, ErrInvalidStockMovement
+	}
+
+	stock.Quantity = *req.Quantity
+	movement := domain.StockMovement{
+		Reason:  reason,
+		ActorID: &user.ID,
+		Note:    req.Note,
+	}
+
+	updated, err := s.repo.UpdateStock(ctx, stock, movement)
+	if err != nil {
+		return domain.Stock{}, fmt.Errorf("s.repo.UpdateStock -> %w", err)
+	}
+
+	return updated, nil
+}
+
+// ArchiveStandStock takes a stock item of a stand off sale. The orders and
+// stock movements of the item keep referring to it.
+func (s *KermesseService) ArchiveStandStock(ctx context.Context, kermesseID, standID, stockID uint, user domain.User) error {
+	if _, err := s.standStock(ctx, kermesseID, standID, stockID, user, true); err != nil {
+		return err
+	}
+
+	if err := s.repo.ArchiveStock(ctx, standID, stockID); err != nil {
+		return fmt.Errorf("s.repo.ArchiveStock -> %w", err)
+	}
+
+	return nil
+}
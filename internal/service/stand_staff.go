@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/api/handler/v1/request"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/repository"
+)
+
+// GetStandStaff returns the staff of a stand to its staff and the organizers
+// of the kermesse.
+func (s *KermesseService) GetStandStaff(ctx context.Context, kermesseID, standID uint, user domain.User) ([]domain.StandStaff, error) {
+	if _, err := s.staffedStand(ctx, kermesseID, standID, user, false); err != nil {
+		return nil, err
+	}
+
+	staff, err := s.repo.GetStandStaff(ctx, standID)
+	if err != nil {
+		return nil, fmt.Errorf("s.repo.GetStandStaff -> %w", err)
+	}
+
+	return staff, nil
+}
+
+// InviteStandStaff invites the owner of an email address to the staff of a
+// stand, and emails them the code of the invitation. Managers of the stand
+// and organizers of the kermesse can invite, until the kermesse closes.
+func (s *KermesseService) InviteStandStaff(ctx context.Context, kermesseID, standID uint, user domain.User, req request.StandInvitationRequest) (domain.StandInvitation, error) {
+	stand, err := s.managedStand(ctx, kermesseID, standID, user)
+	if err != nil {
+		return domain.StandInvitation{}, err
+	}
+	kermesse, err := s.kermesseIn(kermesseID, domain.KermesseDraft, domain.KermessePublished, domain.KermesseOpen)
+	if err != nil {
+		return domain.StandInvitation{}, err
+	}
+
+	invitation, err := domain.NewStandInvitation(stand, req.Email, domain.StandRole(req.Role), user.ID, s.invitationTTL)
+	if err != nil {
+		return domain.StandInvitation{}, fmt.Errorf("domain.NewStandInvitation -> %w", err)
+	}
+
+	created, err := s.repo.CreateStandInvitation(ctx, invitation)
+	if err != nil {
+		return domain.StandInvitation{}, fmt.Errorf("s.repo.CreateStandInvitation -> %w", err)
+	}
+	created = created.InLocation(kermesse.Zone())
+
+	email := domain.Email{
+		To:      created.Email,
+		Subject: fmt.Sprintf("Join the %s stand at %s", stand.Name, kermesse.Name),
+		Body: fmt.Sprintf(
+			"%s invited you to work as %s at the %s stand of %s.\n\n"+
+				"Sign in as a stand holder and enter this code to accept: %s\n\n"+
+				"The code expires on %s.\n",
+			user.Name, created.Role, stand.Name, kermesse.Name, invitation.Code, created.ExpiresAt.Format("02/01/2006 at 15:04"),
+		),
+	}
+	if err := s.mailer.Send(ctx, email); err != nil {
+		// Nobody got the code: don't leave an invitation behind that can't be
+		// accepted, and let the inviter send it again.
+		if err := s.repo.DeleteStandInvitation(ctx, created.ID); err != nil {
+			zap.L().Error(fmt.Sprintf("s.repo.DeleteStandInvitation -> %v", err), zap.Uint("invitation_id", created.ID))
+		}
+		return domain.StandInvitation{}, fmt.Errorf("s.mailer.Send -> %w", err)
+	}
+
+	return created, nil
+}
+
+// AcceptStandInvitation adds the stand holder the code was sent to to the
+// staff of the stand they were invited to.
+func (s *KermesseService) AcceptStandInvitation(ctx context.Context, user domain.User, code string) (domain.StandStaff, error) {
+	if user.Role != "stand_holder" {
+		return domain.StandStaff{}, ErrNotStandHolder
+	}
+
+	invitation, err := s.repo.GetStandInvitationByCode(ctx, domain.NormalizeInvitationCode(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrStandInvitationNotFound) {
+			return domain.StandStaff{}, ErrInvitationNotFound
+		}
+		return domain.StandStaff{}, fmt.Errorf("s.repo.GetStandInvitationByCode -> %w", err)
+	}
+	if err := invitation.CheckAcceptable(user, time.Now()); err != nil {
+		return domain.StandStaff{}, err
+	}
+
+	if _, err := s.kermesseIn(invitation.KermesseID, domain.KermesseDraft, domain.KermessePublished, domain.KermesseOpen); err != nil {
+		return domain.StandStaff{}, err
+	}
+	if _, err := s.GetStand(invitation.KermesseID, invitation.StandID); err != nil {
+		return domain.StandStaff{}, err
+	}
+
+	member, err := s.repo.AcceptStandInvitation(ctx, invitation, user.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrStandInvitationUsed) {
+			return domain.StandStaff{}, ErrInvitationUsed
+		}
+		return domain.StandStaff{}, fmt.Errorf("s.repo.AcceptStandInvitation -> %w", err)
+	}
+
+	return member, nil
+}
+
+// RemoveStandStaff takes a user off the staff of a stand. Managers of the
+// stand and organizers of the kermesse can remove anyone, and staff can leave
+// on their own, as long as the stand keeps a manager.
+func (s *KermesseService) RemoveStandStaff(ctx context.Context, kermesseID, standID, staffID uint, user domain.User) error {
+	if _, err := s.staffedStand(ctx, kermesseID, standID, user, staffID != user.ID); err != nil {
+		return err
+	}
+
+	if err := s.repo.RemoveStandStaff(ctx, standID, staffID); err != nil {
+		return fmt.Errorf("s.repo.RemoveStandStaff -> %w", err)
+	}
+
+	return nil
+}
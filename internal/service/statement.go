@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// GetFamilyStatement returns the statement of a parent and their children at
+// a kermesse: token purchases, transfers to the children, spends by stand and
+// item, refunds and closing balances.
+func (s *KermesseService) GetFamilyStatement(ctx context.Context, kermesseID uint, user domain.User) (domain.FamilyStatement, error) {
+	if user.Role != "parent" {
+		return domain.FamilyStatement{}, ErrInvalidUserRole
+	}
+
+	kermesse, err := s.repo.GetByID(kermesseID)
+	if err != nil {
+		return domain.FamilyStatement{}, fmt.Errorf("s.repo.GetByID -> %w", err)
+	}
+
+	childrenIDs, err := s.repo.GetChildrenIDs(user.ID)
+	if err != nil {
+		return domain.FamilyStatement{}, fmt.Errorf("s.repo.GetChildrenIDs -> %w", err)
+	}
+	children := make([]domain.User, 0, len(childrenIDs))
+	for _, childID := range childrenIDs {
+		child, err := s.userRepo.FindByID(ctx, childID)
+		if err != nil {
+			return domain.FamilyStatement{}, fmt.Errorf("s.userRepo.FindByID -> %w", err)
+		}
+		children = append(children, child)
+	}
+
+	stands, err := s.repo.GetStandsByKermesseID(kermesseID)
+	if err != nil {
+		return domain.FamilyStatement{}, fmt.Errorf("s.repo.GetStandsByKermesseID -> %w", err)
+	}
+
+	scope := domain.TransactionScope{Parties: []domain.TransactionParty{
+		{Type: "parent", IDs: []uint{user.ID}},
+		{Type: "student", IDs: childrenIDs},
+	}}
+	filter := domain.TransactionFilter{
+		KermesseID: kermesseID,
+		Ascending:  true,
+		Limit:      domain.MaxTransactionPageSize,
+	}
+	var transactions []domain.TokenTransaction
+	for {
+		page, err := s.repo.FindTokenTransactions(ctx, scope, filter)
+		if err != nil {
+			return domain.FamilyStatement{}, fmt.Errorf("s.repo.FindTokenTransactions -> %w", err)
+		}
+		transactions = append(transactions, page.Transactions...)
+		if page.NextCursor == "" {
+			break
+		}
+		last := page.Transactions[len(page.Transactions)-1]
+		filter.After = &domain.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	for i, transaction := range transactions {
+		transactions[i] = transaction.InLocation(kermesse.Zone())
+	}
+	statement := domain.NewFamilyStatement(kermesse, user, children, stands, transactions)
+	statement.GeneratedAt = time.Now().In(kermesse.Zone())
+
+	members := append([]domain.User{user}, children...)
+	for _, member := range members {
+		tokens, err := s.userRepo.FindWalletTokens(ctx, member.Role, member.ID, kermesseID)
+		if err != nil {
+			return domain.FamilyStatement{}, fmt.Errorf("s.userRepo.FindWalletTokens -> %w", err)
+		}
+		statement.Balances = append(statement.Balances, domain.StatementBalance{Member: member.Name, Tokens: tokens})
+	}
+
+	return statement, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+// GetStockAudit returns the stock journal of a stand, reconciled against the
+// quantities in stock. Organizers of the kermesse and holders of the stand
+// can see it.
+func (s *KermesseService) GetStockAudit(ctx context.Context, kermesseID, standID uint, user domain.User) (domain.StockAudit, error) {
+	stand, err := s.repo.GetStandByID(standID)
+	if err != nil {
+		return domain.StockAudit{}, fmt.Errorf("s.repo.GetStandByID -> %w", err)
+	}
+	if stand.KermesseID != kermesseID {
+		return domain.StockAudit{}, ErrStandNotInKermesse
+	}
+
+	isOrganizer, err := s.repo.IsUserKermesseOrganizer(kermesseID, user.ID)
+	if err != nil {
+		return domain.StockAudit{}, fmt.Errorf("s.repo.IsUserKermesseOrganizer -> %w", err)
+	}
+	if !isOrganizer {
+		isStandHolder, err := s.repo.IsUserStandHolder(standID, user.ID)
+		if err != nil {
+			return domain.StockAudit{}, fmt.Errorf("s.repo.IsUserStandHolder -> %w", err)
+		}
+		if !isStandHolder {
+			return domain.StockAudit{}, ErrNotStandHolder
+		}
+	}
+
+	movements, err := s.repo.GetStockMovements(ctx, standID)
+	if err != nil {
+		return domain.StockAudit{}, fmt.Errorf("s.repo.GetStockMovements -> %w", err)
+	}
+
+	return domain.NewStockAudit(stand, movements), nil
+}
@@ -9,17 +9,21 @@ import (
 
 var (
 	ErrUserNotFound = repository.ErrUserNotFound
+	ErrBadgeIDTaken = repository.ErrBadgeIDTaken
+	// ErrUnknownStudent is returned when no student has the ID asked for.
+	ErrUnknownStudent = repository.ErrStudentNotFound
 )
 
 type UserRepository interface {
 	FindByID(ctx context.Context, id uint) (domain.User, error)
-	FindByIDWithDetails(ctx context.Context, id uint) (domain.UserWithDetails, error)
+	FindByIDWithDetails(ctx context.Context, id, kermesseID uint) (domain.UserWithDetails, error)
 	CreateStudent(ctx context.Context, student domain.Student) (domain.Student, error)
 	FindStudentByUserID(ctx context.Context, id uint) (domain.Student, error)
 	FindParentByUserID(ctx context.Context, id uint) (domain.Parent, error)
 	FindStandHolderByUserID(ctx context.Context, id uint) (domain.StandHolder, error)
-	UpdateUserTokens(ctx context.Context, userID uint, amount int) error
-	UpdateParent(ctx context.Context, parent domain.Parent) (domain.Parent, error)
+	FindWalletTokens(ctx context.Context, accountType string, ownerID, kermesseID uint) (int, error)
+	FindStudentByCode(ctx context.Context, code string) (domain.Student, error)
+	UpdateStudentPOSSettings(ctx context.Context, studentID uint, badgeID string, autoApproveLimit int) (domain.Student, error)
 }
 
 type UserService struct {
@@ -42,7 +46,13 @@ func NewUserService(repo UserRepository) *UserService {
 //}
 
 func (s *UserService) GetUser(ctx context.Context, id uint) (domain.UserWithDetails, error) {
-	user, err := s.repo.FindByIDWithDetails(ctx, id)
+	return s.GetUserInKermesse(ctx, id, 0)
+}
+
+// GetUserInKermesse is GetUser with the token balances of the wallets of
+// kermesseID. A kermesseID of 0 sums all wallets.
+func (s *UserService) GetUserInKermesse(ctx context.Context, id, kermesseID uint) (domain.UserWithDetails, error) {
+	user, err := s.repo.FindByIDWithDetails(ctx, id, kermesseID)
 	if err != nil {
 		return domain.UserWithDetails{}, fmt.Errorf("s.repo.FindByIDWithDetails -> %w", err)
 	}
@@ -77,25 +87,41 @@ func (s *UserService) GetStandHolderByUserID(ctx context.Context, userID uint) (
 	return standHolder, nil
 }
 
-func (s *UserService) GetUserTokens(ctx context.Context, userID uint) (int, error) {
+// GetUserTokens returns the balance of the user's wallet for kermesseID.
+func (s *UserService) GetUserTokens(ctx context.Context, userID, kermesseID uint) (int, error) {
 	user, err := s.repo.FindByID(ctx, userID)
 	if err != nil {
 		return 0, fmt.Errorf("s.repo.FindByID -> %w", err)
 	}
 
-	if user.Role == "parent" {
-		parent, err := s.repo.FindParentByUserID(ctx, userID)
-		if err != nil {
-			return 0, fmt.Errorf("s.repo.FindParentByUserID -> %w", err)
-		}
-		return parent.Tokens, nil
-	} else if user.Role == "student" {
-		student, err := s.repo.FindStudentByUserID(ctx, userID)
-		if err != nil {
-			return 0, fmt.Errorf("s.repo.FindStudentByUserID -> %w", err)
-		}
-		return student.Tokens, nil
+	if user.Role != "parent" && user.Role != "student" {
+		return 0, nil
+	}
+
+	tokens, err := s.repo.FindWalletTokens(ctx, user.Role, userID, kermesseID)
+	if err != nil {
+		return 0, fmt.Errorf("s.repo.FindWalletTokens -> %w", err)
+	}
+
+	return tokens, nil
+}
+
+// UpdateStudentPOSSettings sets how a student pays at the point of sale of
+// stands: the badge identifying them, and the largest charge approved without
+// confirmation. Only their parent can change them.
+func (s *UserService) UpdateStudentPOSSettings(ctx context.Context, parentID, studentID uint, badgeID string, autoApproveLimit int) (domain.Student, error) {
+	student, err := s.repo.FindStudentByUserID(ctx, studentID)
+	if err != nil {
+		return domain.Student{}, fmt.Errorf("s.repo.FindStudentByUserID -> %w", err)
+	}
+	if student.ParentID != parentID {
+		return domain.Student{}, ErrNotParentOfStudent
+	}
+
+	updated, err := s.repo.UpdateStudentPOSSettings(ctx, studentID, badgeID, autoApproveLimit)
+	if err != nil {
+		return domain.Student{}, fmt.Errorf("s.repo.UpdateStudentPOSSettings -> %w", err)
 	}
 
-	return 0, nil
+	return updated, nil
 }
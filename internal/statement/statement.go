@@ -0,0 +1,156 @@
+// Package statement renders family statements as CSV and PDF files.
+package statement
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/pkg/pdf"
+)
+
+const dateLayout = "2006-01-02 15:04"
+
+var csvHeader = []string{"section", "date", "member", "stand", "item", "quantity", "tokens", "amount", "currency", "status", "transaction_id"}
+
+// WriteCSV writes the statement as a single table, one row per line of the
+// statement, its section in the first column.
+func WriteCSV(w io.Writer, statement domain.FamilyStatement) error {
+	cw := csv.NewWriter(w)
+	currency := strings.ToUpper(statement.Currency)
+
+	rows := [][]string{csvHeader}
+	for _, p := range statement.Purchases {
+		rows = append(rows, []string{"purchase", formatDate(p.Date), statement.Parent.Name, "", "", "", strconv.Itoa(p.Tokens), formatAmount(p.Amount), currency, p.Status, formatID(p.TransactionID)})
+	}
+	for _, t := range statement.Transfers {
+		rows = append(rows, []string{"transfer", formatDate(t.Date), t.Child, "", "", "", strconv.Itoa(t.Tokens), "", "", "", formatID(t.TransactionID)})
+	}
+	for _, s := range statement.Spends {
+		rows = append(rows, []string{"spend", "", s.Member, s.Stand, s.Item, strconv.Itoa(s.Quantity), strconv.Itoa(s.Tokens), "", "", "", ""})
+	}
+	for _, r := range statement.Refunds {
+		amount, rowCurrency := "", ""
+		if r.Type == domain.TokenRefund {
+			amount, rowCurrency = formatAmount(r.Amount), currency
+		}
+		rows = append(rows, []string{refundSection(r), formatDate(r.Date), r.Member, r.Stand, "", "", strconv.Itoa(r.Tokens), amount, rowCurrency, r.Status, formatID(r.TransactionID)})
+	}
+	for _, b := range statement.Balances {
+		rows = append(rows, []string{"balance", "", b.Member, "", "", "", strconv.Itoa(b.Tokens), "", "", "", ""})
+	}
+
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("cw.WriteAll -> %w", err)
+	}
+
+	return nil
+}
+
+// WritePDF writes the statement as a printable document, one table per
+// section.
+func WritePDF(w io.Writer, statement domain.FamilyStatement) error {
+	doc := pdf.New()
+	currency := strings.ToUpper(statement.Currency)
+
+	doc.Title(fmt.Sprintf("Family statement - %s", statement.KermesseName))
+	doc.Text(fmt.Sprintf("Parent: %s", statement.Parent.Name))
+	if len(statement.Children) > 0 {
+		names := make([]string, len(statement.Children))
+		for i, child := range statement.Children {
+			names[i] = child.Name
+		}
+		doc.Text(fmt.Sprintf("Children: %s", strings.Join(names, ", ")))
+	}
+	doc.Text(fmt.Sprintf("Generated on %s", formatDate(statement.GeneratedAt)))
+
+	doc.Heading("Token purchases")
+	widths := []float64{110, 60, 100, 80, 145}
+	doc.Row(widths, true, "Date", "Tokens", "Amount", "Method", "Status")
+	for _, p := range statement.Purchases {
+		doc.Row(widths, false, formatDate(p.Date), strconv.Itoa(p.Tokens), formatAmount(p.Amount)+" "+currency, string(p.Method), p.Status)
+	}
+	emptySection(doc, len(statement.Purchases))
+
+	doc.Heading("Transfers to children")
+	widths = []float64{110, 245, 140}
+	doc.Row(widths, true, "Date", "Child", "Tokens")
+	for _, t := range statement.Transfers {
+		doc.Row(widths, false, formatDate(t.Date), t.Child, strconv.Itoa(t.Tokens))
+	}
+	emptySection(doc, len(statement.Transfers))
+
+	doc.Heading("Spends by stand and item")
+	widths = []float64{110, 125, 140, 60, 60}
+	doc.Row(widths, true, "Member", "Stand", "Item", "Quantity", "Tokens")
+	for _, s := range statement.Spends {
+		doc.Row(widths, false, s.Member, s.Stand, s.Item, strconv.Itoa(s.Quantity), strconv.Itoa(s.Tokens))
+	}
+	emptySection(doc, len(statement.Spends))
+
+	doc.Heading("Refunds")
+	widths = []float64{110, 80, 90, 95, 50, 70}
+	doc.Row(widths, true, "Date", "Kind", "Member", "Stand", "Tokens", "Amount")
+	for _, r := range statement.Refunds {
+		amount := ""
+		if r.Type == domain.TokenRefund {
+			amount = formatAmount(r.Amount) + " " + currency
+		}
+		doc.Row(widths, false, formatDate(r.Date), refundSection(r), r.Member, r.Stand, strconv.Itoa(r.Tokens), amount)
+	}
+	emptySection(doc, len(statement.Refunds))
+
+	doc.Heading("Closing balances")
+	widths = []float64{355, 140}
+	doc.Row(widths, true, "Member", "Tokens")
+	for _, b := range statement.Balances {
+		doc.Row(widths, false, b.Member, strconv.Itoa(b.Tokens))
+	}
+
+	if _, err := doc.WriteTo(w); err != nil {
+		return fmt.Errorf("doc.WriteTo -> %w", err)
+	}
+
+	return nil
+}
+
+func emptySection(doc *pdf.Document, lines int) {
+	if lines == 0 {
+		doc.Text("None")
+	}
+}
+
+func refundSection(r domain.StatementRefund) string {
+	if r.Type == domain.TokenReversal {
+		return "stand refund"
+	}
+
+	return "card refund"
+}
+
+// formatAmount formats an amount in a currency's minor unit, all supported
+// currencies having two decimals.
+func formatAmount(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+
+	return date.Format(dateLayout)
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
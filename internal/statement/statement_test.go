@@ -0,0 +1,65 @@
+package statement
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yizeng/gab/gin/gorm/auth-jwt/internal/domain"
+)
+
+var testStatement = domain.FamilyStatement{
+	KermesseID:   1,
+	KermesseName: "Summer fair",
+	Currency:     "eur",
+	Parent:       domain.StatementMember{ID: 2, Name: "Alice"},
+	Children:     []domain.StatementMember{{ID: 3, Name: "Bob"}},
+	Purchases: []domain.StatementPurchase{
+		{TransactionID: 10, Date: time.Date(2024, 6, 1, 14, 0, 0, 0, time.UTC), Tokens: 10, Amount: 1250, Method: domain.PaymentMethodCard, Status: "Completed"},
+	},
+	Transfers: []domain.StatementTransfer{
+		{TransactionID: 11, Date: time.Date(2024, 6, 1, 14, 5, 0, 0, time.UTC), Child: "Bob", Tokens: 4},
+	},
+	Spends: []domain.StatementSpend{
+		{Member: "Bob", Stand: "Crêpes", Item: "Crêpe, sugar", Quantity: 2, Tokens: 4},
+	},
+	Refunds: []domain.StatementRefund{
+		{TransactionID: 13, Date: time.Date(2024, 6, 1, 14, 20, 0, 0, time.UTC), Type: domain.TokenReversal, Member: "Bob", Stand: "Crêpes", Tokens: 2, Status: "Completed"},
+		{TransactionID: 14, Date: time.Date(2024, 6, 2, 9, 0, 0, 0, time.UTC), Type: domain.TokenRefund, Member: "Alice", Tokens: 6, Amount: 750, Status: "Completed"},
+	},
+	Balances: []domain.StatementBalance{
+		{Member: "Alice", Tokens: 0},
+		{Member: "Bob", Tokens: 2},
+	},
+}
+
+func TestWriteCSV(t *testing.T) {
+	var out bytes.Buffer
+	err := WriteCSV(&out, testStatement)
+	require.NoError(t, err)
+
+	want := `section,date,member,stand,item,quantity,tokens,amount,currency,status,transaction_id
+purchase,2024-06-01 14:00,Alice,,,,10,12.50,EUR,Completed,10
+transfer,2024-06-01 14:05,Bob,,,,4,,,,11
+spend,,Bob,Crêpes,"Crêpe, sugar",2,4,,,,
+stand refund,2024-06-01 14:20,Bob,Crêpes,,,2,,,Completed,13
+card refund,2024-06-02 09:00,Alice,,,,6,7.50,EUR,Completed,14
+balance,,Alice,,,,0,,,,
+balance,,Bob,,,,2,,,,
+`
+	assert.Equal(t, want, out.String())
+}
+
+func TestWritePDF(t *testing.T) {
+	var out bytes.Buffer
+	err := WritePDF(&out, testStatement)
+	require.NoError(t, err)
+
+	assert.True(t, bytes.HasPrefix(out.Bytes(), []byte("%PDF-")))
+	assert.Contains(t, out.String(), "(Family statement - Summer fair) Tj")
+	assert.Contains(t, out.String(), "(12.50 EUR) Tj")
+	assert.Contains(t, out.String(), "(Cr\xeape, sugar) Tj")
+}